@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -34,15 +35,36 @@ func main() {
 }
 
 func newNucleusCommand() *cobra.Command {
+	logOptions := logs.NewOptions()
+	var logLevel int
+
 	cmd := &cobra.Command{
 		Use:   "registration-operator",
 		Short: "Nucleus Operator",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Apply the log format before the subcommands start logging. The klog
+			// verbosity flag is already registered on the go flag set by the logs
+			// package, so --log-level just forwards to it.
+			if _, err := logOptions.Get(); err != nil {
+				return fmt.Errorf("unsupported log format: %s", logOptions.LogFormat)
+			}
+			logOptions.Apply()
+			if logLevel > 0 {
+				_ = goflag.Set("v", strconv.Itoa(logLevel))
+			}
+			return nil
+		},
 		Run: func(cmd *cobra.Command, args []string) {
 			_ = cmd.Help()
 			os.Exit(1)
 		},
 	}
 
+	cmd.PersistentFlags().StringVar(&logOptions.LogFormat, "log-format", logOptions.LogFormat,
+		`Set the log format. Permitted formats: "text", "json".`)
+	cmd.PersistentFlags().IntVar(&logLevel, "log-level", 0,
+		"Set the log verbosity of the operator. Higher values produce more detailed reconcile logs.")
+
 	if v := version.Get().String(); len(v) == 0 {
 		cmd.Version = "<unknown>"
 	} else {
@@ -51,6 +73,9 @@ func newNucleusCommand() *cobra.Command {
 
 	cmd.AddCommand(operator.NewHubOperatorCmd())
 	cmd.AddCommand(operator.NewKlusterletOperatorCmd())
+	cmd.AddCommand(operator.NewCombinedOperatorCmd())
+	cmd.AddCommand(operator.NewRenderCmd())
+	cmd.AddCommand(operator.NewGatherCmd())
 
 	return cmd
 }
@@ -13,6 +13,7 @@ require (
 	github.com/openshift/library-go v0.0.0-20210406144447-d9cdfbd844ea
 	github.com/spf13/cobra v1.1.1
 	github.com/spf13/pflag v1.0.5
+	golang.org/x/time v0.0.0-20210220033141-f8bda1e9f3ba
 	k8s.io/api v0.21.1
 	k8s.io/apiextensions-apiserver v0.21.0-rc.0
 	k8s.io/apimachinery v0.21.1
@@ -22,4 +23,5 @@ require (
 	k8s.io/kube-aggregator v0.21.0-rc.0
 	open-cluster-management.io/api v0.0.0-20210908005819-815ac23c7308
 	sigs.k8s.io/controller-runtime v0.6.1-0.20200829232221-efc74d056b24
+	sigs.k8s.io/yaml v1.2.0
 )
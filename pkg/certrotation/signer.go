@@ -2,6 +2,7 @@ package certrotation
 
 import (
 	"bytes"
+	"crypto/x509"
 	"fmt"
 	"time"
 
@@ -16,16 +17,33 @@ import (
 	"k8s.io/client-go/util/cert"
 )
 
-// SigningRotation rotates a self-signed signing CA stored in a secret. It creates a new one when 80%
-// of the lifetime of the old CA has passed.
+// SigningRotation rotates a self-signed signing CA stored in a secret. It creates a new one when
+// the renewal percentage of the lifetime of the old CA has passed.
 type SigningRotation struct {
 	Namespace        string
 	Name             string
 	SignerNamePrefix string
 	Validity         time.Duration
-	Lister           corev1listers.SecretLister
-	Client           corev1client.SecretsGetter
-	EventRecorder    events.Recorder
+	// RenewalPercentage is the percentage of the validity after which a new signing CA is
+	// created. If it is not set, defaultRenewalPercentage is used.
+	RenewalPercentage int32
+	Lister            corev1listers.SecretLister
+	Client            corev1client.SecretsGetter
+	EventRecorder     events.Recorder
+}
+
+// defaultRenewalPercentage is the percentage of the certificate validity after which
+// a new certificate is created when no renewal percentage is specified.
+const defaultRenewalPercentage = 80
+
+// renewalThreshold returns the time after which a new certificate should be created, i.e.
+// the time when the given renewal percentage of the certificate validity has passed.
+func renewalThreshold(cert *x509.Certificate, renewalPercentage int32) time.Time {
+	if renewalPercentage <= 0 || renewalPercentage >= 100 {
+		renewalPercentage = defaultRenewalPercentage
+	}
+	validity := cert.NotAfter.Sub(cert.NotBefore)
+	return cert.NotBefore.Add(validity * time.Duration(renewalPercentage) / 100)
 }
 
 func (c SigningRotation) EnsureSigningCertKeyPair() (*crypto.CA, error) {
@@ -40,7 +58,7 @@ func (c SigningRotation) EnsureSigningCertKeyPair() (*crypto.CA, error) {
 	}
 	signingCertKeyPairSecret.Type = corev1.SecretTypeTLS
 
-	if reason := needNewSigningCertKeyPair(signingCertKeyPairSecret); len(reason) > 0 {
+	if reason := needNewSigningCertKeyPair(signingCertKeyPairSecret, c.RenewalPercentage); len(reason) > 0 {
 		c.EventRecorder.Eventf("SignerUpdateRequired", "%q in %q requires a new signing cert/key pair: %v", c.Name, c.Namespace, reason)
 		if err := setSigningCertKeyPairSecret(signingCertKeyPairSecret, c.SignerNamePrefix, c.Validity); err != nil {
 			return nil, err
@@ -61,7 +79,22 @@ func (c SigningRotation) EnsureSigningCertKeyPair() (*crypto.CA, error) {
 	return signingCertKeyPair, nil
 }
 
-func needNewSigningCertKeyPair(secret *corev1.Secret) string {
+// EnsureCustomSigningCertKeyPair returns the signing cert/key pair from the given secret
+// in the namespace of the rotation. The pair is brought by the user, so it is used as is
+// and never rotated by the operator.
+func (c SigningRotation) EnsureCustomSigningCertKeyPair(secretName string) (*crypto.CA, error) {
+	signingCertKeyPairSecret, err := c.Lister.Secrets(c.Namespace).Get(secretName)
+	if err != nil {
+		return nil, err
+	}
+	signingCertKeyPair, err := crypto.GetCAFromBytes(signingCertKeyPairSecret.Data["tls.crt"], signingCertKeyPairSecret.Data["tls.key"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing cert/key pair in secret %q: %v", secretName, err)
+	}
+	return signingCertKeyPair, nil
+}
+
+func needNewSigningCertKeyPair(secret *corev1.Secret, renewalPercentage int32) string {
 	certData := secret.Data["tls.crt"]
 	if len(certData) == 0 {
 		return "missing tls.crt"
@@ -80,9 +113,7 @@ func needNewSigningCertKeyPair(secret *corev1.Secret) string {
 		return "already expired"
 	}
 
-	maxWait := cert.NotAfter.Sub(cert.NotBefore) / 5
-	latestTime := cert.NotAfter.Add(-maxWait)
-	if time.Now().After(latestTime) {
+	if time.Now().After(renewalThreshold(cert, renewalPercentage)) {
 		return fmt.Sprintf("expired in %6.3f seconds", cert.NotAfter.Sub(time.Now()).Seconds())
 	}
 
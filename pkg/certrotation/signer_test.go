@@ -2,6 +2,7 @@ package certrotation
 
 import (
 	"bytes"
+	"crypto/x509"
 	"testing"
 	"time"
 
@@ -63,12 +64,51 @@ func TestNeedNewSigningCertKeyPair(t *testing.T) {
 
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
-			actual := needNewSigningCertKeyPair(c.secret)
+			actual := needNewSigningCertKeyPair(c.secret, 0)
 			c.validateReason(t, actual)
 		})
 	}
 }
 
+func TestRenewalThreshold(t *testing.T) {
+	notBefore := time.Now()
+	certificate := &x509.Certificate{
+		NotBefore: notBefore,
+		NotAfter:  notBefore.Add(time.Hour * 100),
+	}
+
+	cases := []struct {
+		name              string
+		renewalPercentage int32
+		expected          time.Time
+	}{
+		{
+			name:              "default percentage",
+			renewalPercentage: 0,
+			expected:          notBefore.Add(time.Hour * 80),
+		},
+		{
+			name:              "custom percentage",
+			renewalPercentage: 50,
+			expected:          notBefore.Add(time.Hour * 50),
+		},
+		{
+			name:              "out of range percentage",
+			renewalPercentage: 200,
+			expected:          notBefore.Add(time.Hour * 80),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := renewalThreshold(certificate, c.renewalPercentage)
+			if !actual.Equal(c.expected) {
+				t.Errorf("Expected renewal threshold %v, but got %v", c.expected, actual)
+			}
+		})
+	}
+}
+
 func newSigningCertKeyPair(signerName string, validity time.Duration) (certData, keyData []byte, err error) {
 	ca, err := crypto.MakeSelfSignedCAConfigForDuration(signerName, validity)
 	if err != nil {
@@ -19,17 +19,20 @@ import (
 	"k8s.io/client-go/util/cert"
 )
 
-// TargetRotation rotates a key and cert signed by a CA. It creates a new one when 80%
-// of the lifetime of the old cert has passed, or the CA used to signed the old cert is
-// gone from the CA bundle.
+// TargetRotation rotates a key and cert signed by a CA. It creates a new one when the renewal
+// percentage of the lifetime of the old cert has passed, or the CA used to signed the old cert
+// is gone from the CA bundle.
 type TargetRotation struct {
-	Namespace     string
-	Name          string
-	Validity      time.Duration
-	HostNames     []string
-	Lister        corev1listers.SecretLister
-	Client        corev1client.SecretsGetter
-	EventRecorder events.Recorder
+	Namespace string
+	Name      string
+	Validity  time.Duration
+	// RenewalPercentage is the percentage of the validity after which a new cert/key pair is
+	// created. If it is not set, defaultRenewalPercentage is used.
+	RenewalPercentage int32
+	HostNames         []string
+	Lister            corev1listers.SecretLister
+	Client            corev1client.SecretsGetter
+	EventRecorder     events.Recorder
 }
 
 func (c TargetRotation) EnsureTargetCertKeyPair(signingCertKeyPair *crypto.CA, caBundleCerts []*x509.Certificate) error {
@@ -44,7 +47,7 @@ func (c TargetRotation) EnsureTargetCertKeyPair(signingCertKeyPair *crypto.CA, c
 	}
 	targetCertKeyPairSecret.Type = corev1.SecretTypeTLS
 
-	reason := needNewTargetCertKeyPair(targetCertKeyPairSecret, caBundleCerts)
+	reason := needNewTargetCertKeyPair(targetCertKeyPairSecret, caBundleCerts, c.RenewalPercentage)
 	if len(reason) == 0 {
 		return nil
 	}
@@ -64,11 +67,11 @@ func (c TargetRotation) EnsureTargetCertKeyPair(signingCertKeyPair *crypto.CA, c
 // Return empty if a valid cert/key pair is in place and no need to rotate it yet.
 //
 // We create a new target cert/key pair if
-//   1) no cert/key pair exits
-//   2) or the cert expired (then we are also pretty late)
-//   3) or we are over the renewal percentage of the validity
-//   4) or our old CA is gone from the bundle (then we are pretty late to the renewal party)
-func needNewTargetCertKeyPair(secret *corev1.Secret, caBundleCerts []*x509.Certificate) string {
+//  1. no cert/key pair exits
+//  2. or the cert expired (then we are also pretty late)
+//  3. or we are over the renewal percentage of the validity
+//  4. or our old CA is gone from the bundle (then we are pretty late to the renewal party)
+func needNewTargetCertKeyPair(secret *corev1.Secret, caBundleCerts []*x509.Certificate, renewalPercentage int32) string {
 	certData := secret.Data["tls.crt"]
 	if len(certData) == 0 {
 		return "missing tls.crt"
@@ -87,9 +90,7 @@ func needNewTargetCertKeyPair(secret *corev1.Secret, caBundleCerts []*x509.Certi
 		return "already expired"
 	}
 
-	maxWait := cert.NotAfter.Sub(cert.NotBefore) / 5
-	latestTime := cert.NotAfter.Add(-maxWait)
-	if time.Now().After(latestTime) {
+	if time.Now().After(renewalThreshold(cert, renewalPercentage)) {
 		return fmt.Sprintf("expired in %6.3f seconds", cert.NotAfter.Sub(time.Now()).Seconds())
 	}
 
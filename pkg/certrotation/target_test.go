@@ -175,7 +175,7 @@ func TestNeedNewTargetCertKeyPair(t *testing.T) {
 				}
 			}
 
-			actual := needNewTargetCertKeyPair(c.secret, caBundleCerts)
+			actual := needNewTargetCertKeyPair(c.secret, caBundleCerts, 0)
 			c.validateReason(t, actual)
 		})
 	}
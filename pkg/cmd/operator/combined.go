@@ -0,0 +1,25 @@
+package operator
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/openshift/library-go/pkg/controller/controllercmd"
+
+	"open-cluster-management.io/registration-operator/pkg/operators"
+	"open-cluster-management.io/registration-operator/pkg/version"
+)
+
+// NewCombinedOperatorCmd generatee a command to start both operators in one process
+func NewCombinedOperatorCmd() *cobra.Command {
+	options := operators.NewOptions()
+	cmdConfig := controllercmd.
+		NewControllerCommandConfig("registration-operator", version.Get(), options.RunCombinedOperators)
+	cmd := cmdConfig.NewCommand()
+	cmd.Use = "combined"
+	cmd.Short = "Start the cluster manager and the klusterlet operator in one process"
+	cmd.Flags().BoolVar(&cmdConfig.DisableLeaderElection, "disable-leader-election", false,
+		"Disable leader election. Only use this in single replica deployments, e.g. in CI environments.")
+	options.AddFlags(cmd.Flags())
+
+	return cmd
+}
@@ -0,0 +1,213 @@
+package operator
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+
+	operatorclient "open-cluster-management.io/api/client/operator/clientset/versioned"
+	"open-cluster-management.io/registration-operator/pkg/helpers"
+)
+
+// NewGatherCmd generates a command that collects the diagnostics for registration
+// problems into a tarball
+func NewGatherCmd() *cobra.Command {
+	kubeconfig := ""
+	output := ""
+	withAgentLogs := false
+	cmd := &cobra.Command{
+		Use:   "gather",
+		Short: "Collect the registration diagnostics of a cluster into a tarball",
+		Long: "Gather collects the ClusterManager and Klusterlet resources with their " +
+			"conditions, the deployments the operators generated for them and the recent " +
+			"events of their namespaces into a tarball, so a registration failure can be " +
+			"diagnosed from one standardized bundle. Agent pod logs are included on request.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output == "" {
+				output = fmt.Sprintf("registration-gather-%s.tar.gz", time.Now().UTC().Format("20060102-150405"))
+			}
+			if err := gather(cmd.Context(), kubeconfig, output, withAgentLogs); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Wrote %s\n", output)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&kubeconfig, "kubeconfig", kubeconfig,
+		"Path to the kubeconfig of the cluster to gather from. Defaults to the usual kubeconfig resolution.")
+	cmd.Flags().StringVar(&output, "output", output,
+		"Path of the tarball to write. Defaults to registration-gather-<timestamp>.tar.gz in the working directory.")
+	cmd.Flags().BoolVar(&withAgentLogs, "with-agent-logs", withAgentLogs,
+		"Include the logs of the pods in the gathered namespaces. The logs can contain resource names of the workloads the agents distribute.")
+
+	return cmd
+}
+
+func gather(ctx context.Context, kubeconfig, output string, withAgentLogs bool) error {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, nil).ClientConfig()
+	if err != nil {
+		return err
+	}
+	kubeClient, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+	operatorClient, err := operatorclient.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gzipWriter := gzip.NewWriter(file)
+	defer gzipWriter.Close()
+	tarWriter := tar.NewWriter(gzipWriter)
+	defer tarWriter.Close()
+
+	g := &gatherer{
+		kubeClient:    kubeClient,
+		tarWriter:     tarWriter,
+		withAgentLogs: withAgentLogs,
+	}
+
+	// The CR lists can legitimately fail, e.g. the klusterlet CRD is not installed
+	// on a hub-only cluster, so a failed list is recorded instead of aborting the
+	// bundle.
+	namespaces := []string{}
+	if clusterManagers, err := operatorClient.OperatorV1().ClusterManagers().List(ctx, metav1.ListOptions{}); err != nil {
+		g.addError(fmt.Errorf("unable to list clustermanagers: %v", err))
+	} else {
+		for i := range clusterManagers.Items {
+			clusterManager := &clusterManagers.Items[i]
+			g.addYAML(fmt.Sprintf("clustermanagers/%s.yaml", clusterManager.Name), clusterManager)
+			namespaces = append(namespaces, helpers.ClusterManagerDeployNamespace(clusterManager))
+		}
+	}
+	if klusterlets, err := operatorClient.OperatorV1().Klusterlets().List(ctx, metav1.ListOptions{}); err != nil {
+		g.addError(fmt.Errorf("unable to list klusterlets: %v", err))
+	} else {
+		for i := range klusterlets.Items {
+			klusterlet := &klusterlets.Items[i]
+			g.addYAML(fmt.Sprintf("klusterlets/%s.yaml", klusterlet.Name), klusterlet)
+			namespaces = append(namespaces, helpers.KlusterletAgentNamespace(klusterlet))
+		}
+	}
+
+	gathered := map[string]bool{}
+	for _, namespace := range namespaces {
+		if gathered[namespace] {
+			continue
+		}
+		gathered[namespace] = true
+		g.gatherNamespace(ctx, namespace)
+	}
+
+	if len(g.errors) > 0 {
+		g.addFile("gather-errors.txt", []byte(g.describeErrors()))
+	}
+	return nil
+}
+
+// gatherer writes the collected resources into the tarball and keeps going on
+// per-resource errors, so one broken namespace does not lose the rest of the bundle.
+type gatherer struct {
+	kubeClient    kubernetes.Interface
+	tarWriter     *tar.Writer
+	withAgentLogs bool
+	errors        []error
+}
+
+func (g *gatherer) gatherNamespace(ctx context.Context, namespace string) {
+	if deployments, err := g.kubeClient.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{}); err != nil {
+		g.addError(fmt.Errorf("unable to list deployments in namespace %q: %v", namespace, err))
+	} else {
+		for i := range deployments.Items {
+			deployment := &deployments.Items[i]
+			g.addYAML(fmt.Sprintf("namespaces/%s/deployments/%s.yaml", namespace, deployment.Name), deployment)
+		}
+	}
+
+	if events, err := g.kubeClient.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{}); err != nil {
+		g.addError(fmt.Errorf("unable to list events in namespace %q: %v", namespace, err))
+	} else if len(events.Items) > 0 {
+		g.addYAML(fmt.Sprintf("namespaces/%s/events.yaml", namespace), events)
+	}
+
+	if !g.withAgentLogs {
+		return
+	}
+	pods, err := g.kubeClient.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		g.addError(fmt.Errorf("unable to list pods in namespace %q: %v", namespace, err))
+		return
+	}
+	// the recent log tail is enough to diagnose a registration failure and keeps
+	// the bundle small
+	tailLines := int64(1000)
+	for _, pod := range pods.Items {
+		for _, container := range pod.Spec.Containers {
+			logs, err := g.kubeClient.CoreV1().Pods(namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+				Container: container.Name,
+				TailLines: &tailLines,
+			}).DoRaw(ctx)
+			if err != nil {
+				g.addError(fmt.Errorf("unable to get logs of container %q of pod %q %q: %v", container.Name, namespace, pod.Name, err))
+				continue
+			}
+			g.addFile(fmt.Sprintf("namespaces/%s/logs/%s-%s.log", namespace, pod.Name, container.Name), logs)
+		}
+	}
+}
+
+func (g *gatherer) addYAML(name string, object interface{}) {
+	data, err := yaml.Marshal(object)
+	if err != nil {
+		g.addError(fmt.Errorf("unable to marshal %q: %v", name, err))
+		return
+	}
+	g.addFile(name, data)
+}
+
+func (g *gatherer) addFile(name string, data []byte) {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := g.tarWriter.WriteHeader(header); err != nil {
+		g.addError(fmt.Errorf("unable to write %q: %v", name, err))
+		return
+	}
+	if _, err := g.tarWriter.Write(data); err != nil {
+		g.addError(fmt.Errorf("unable to write %q: %v", name, err))
+	}
+}
+
+func (g *gatherer) addError(err error) {
+	g.errors = append(g.errors, err)
+}
+
+func (g *gatherer) describeErrors() string {
+	description := ""
+	for _, err := range g.errors {
+		description += err.Error() + "\n"
+	}
+	return description
+}
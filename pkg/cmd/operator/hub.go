@@ -11,11 +11,15 @@ import (
 
 // NewHubOperatorCmd generatee a command to start hub operator
 func NewHubOperatorCmd() *cobra.Command {
-	cmd := controllercmd.
-		NewControllerCommandConfig("clustermanager", version.Get(), operators.RunClusterManagerOperator).
-		NewCommand()
+	options := operators.NewOptions()
+	cmdConfig := controllercmd.
+		NewControllerCommandConfig("clustermanager", version.Get(), options.RunClusterManagerOperator)
+	cmd := cmdConfig.NewCommand()
 	cmd.Use = "hub"
 	cmd.Short = "Start the cluster manager operator"
+	cmd.Flags().BoolVar(&cmdConfig.DisableLeaderElection, "disable-leader-election", false,
+		"Disable leader election. Only use this in single replica deployments, e.g. in CI environments.")
+	options.AddFlags(cmd.Flags())
 
 	return cmd
 }
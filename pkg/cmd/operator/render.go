@@ -0,0 +1,65 @@
+package operator
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	operatorscheme "open-cluster-management.io/api/client/operator/clientset/versioned/scheme"
+	operatorapiv1 "open-cluster-management.io/api/operator/v1"
+	"open-cluster-management.io/registration-operator/pkg/helpers"
+	"open-cluster-management.io/registration-operator/pkg/operators/clustermanager/controllers/clustermanagercontroller"
+	"open-cluster-management.io/registration-operator/pkg/operators/klusterlet/controllers/klusterletcontroller"
+)
+
+// NewRenderCmd generates a command to render the manifests for a custom resource
+func NewRenderCmd() *cobra.Command {
+	operatorNamespace := "open-cluster-management"
+	cmd := &cobra.Command{
+		Use:   "render <file>",
+		Short: "Render the manifests for a ClusterManager or Klusterlet without applying them",
+		Long: "Render prints the manifests the operator would apply for the ClusterManager or " +
+			"Klusterlet in the given file with the template values resolved, so they can be " +
+			"reviewed or pre-staged without a live cluster. Values that are resolved from a " +
+			"live cluster during a reconcile fall back to their defaults.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return renderManifests(cmd.OutOrStdout(), args[0], operatorNamespace)
+		},
+	}
+	cmd.Flags().StringVar(&operatorNamespace, "operator-namespace", operatorNamespace,
+		"Namespace the operator is assumed to run in when rendering klusterlet manifests.")
+
+	return cmd
+}
+
+func renderManifests(out io.Writer, file, operatorNamespace string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	object, _, err := operatorscheme.Codecs.UniversalDeserializer().Decode(data, nil, nil)
+	if err != nil {
+		return fmt.Errorf("unable to decode %q: %w", file, err)
+	}
+
+	var rendered []helpers.RenderedManifest
+	switch resource := object.(type) {
+	case *operatorapiv1.ClusterManager:
+		rendered, err = clustermanagercontroller.RenderManifests(resource)
+	case *operatorapiv1.Klusterlet:
+		rendered, err = klusterletcontroller.RenderManifests(resource, operatorNamespace)
+	default:
+		return fmt.Errorf("%q must contain a ClusterManager or a Klusterlet, got %T", file, object)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, manifest := range rendered {
+		fmt.Fprintf(out, "---\n# Source: %s\n%s\n", manifest.Name, manifest.Data)
+	}
+	return nil
+}
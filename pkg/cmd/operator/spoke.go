@@ -11,11 +11,15 @@ import (
 
 // NewKlusterletOperatorCmd generatee a command to start klusterlet operator
 func NewKlusterletOperatorCmd() *cobra.Command {
-	cmd := controllercmd.
-		NewControllerCommandConfig("klusterlet", version.Get(), operators.RunKlusterletOperator).
-		NewCommand()
+	options := operators.NewOptions()
+	cmdConfig := controllercmd.
+		NewControllerCommandConfig("klusterlet", version.Get(), options.RunKlusterletOperator)
+	cmd := cmdConfig.NewCommand()
 	cmd.Use = "klusterlet"
 	cmd.Short = "Start the klusterlet operator"
+	cmd.Flags().BoolVar(&cmdConfig.DisableLeaderElection, "disable-leader-election", false,
+		"Disable leader election. Only use this in single replica deployments, e.g. in CI environments.")
+	options.AddFlags(cmd.Flags())
 
 	return cmd
 }
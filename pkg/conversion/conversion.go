@@ -0,0 +1,136 @@
+package conversion
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2"
+)
+
+// ConvertFunc converts one custom resource to the given target API version. The
+// returned object must carry the target API version and keep everything the source
+// version can represent, so a converted object converts back without loss.
+type ConvertFunc func(obj *unstructured.Unstructured, targetAPIVersion string) (*unstructured.Unstructured, error)
+
+// Webhook answers the CRD conversion reviews of the operator APIs, so a future
+// v1beta2 or v2 version of the Klusterlet and ClusterManager CRDs can be introduced
+// without breaking the stored v1 objects. The conversions are registered per kind;
+// while every served version shares the v1 schema, the identity conversion is all
+// that is needed and new versions only add their ConvertFunc here.
+type Webhook struct {
+	converters map[string]ConvertFunc
+}
+
+// NewWebhook returns a conversion webhook without any registered conversions.
+func NewWebhook() *Webhook {
+	return &Webhook{converters: map[string]ConvertFunc{}}
+}
+
+// RegisterConverter registers the conversion function answering the reviews for the
+// given kind.
+func (w *Webhook) RegisterConverter(kind string, convert ConvertFunc) {
+	w.converters[kind] = convert
+}
+
+// IdentityConvert converts an object by only rewriting its API version, for version
+// pairs sharing one schema. Introducing a schema change means replacing this with a
+// ConvertFunc translating the changed fields.
+func IdentityConvert(obj *unstructured.Unstructured, targetAPIVersion string) (*unstructured.Unstructured, error) {
+	converted := obj.DeepCopy()
+	converted.SetAPIVersion(targetAPIVersion)
+	return converted, nil
+}
+
+// ServeHTTP answers a ConversionReview request on the /convert path.
+func (w *Webhook) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		http.Error(writer, fmt.Sprintf("failed to read the review request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	review := &apiextensionsv1.ConversionReview{}
+	if err := json.Unmarshal(body, review); err != nil {
+		http.Error(writer, fmt.Sprintf("failed to decode the review request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if review.Request == nil {
+		http.Error(writer, "the review request has no request field", http.StatusBadRequest)
+		return
+	}
+
+	review.Response = w.convert(review.Request)
+	review.Request = nil
+
+	writer.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(writer).Encode(review); err != nil {
+		klog.ErrorS(err, "Failed to encode the conversion review response")
+	}
+}
+
+// convert converts every object of the request to the desired API version. The
+// review fails as a whole when one object cannot be converted, like the in-tree
+// conversion of the API server does.
+func (w *Webhook) convert(request *apiextensionsv1.ConversionRequest) *apiextensionsv1.ConversionResponse {
+	response := &apiextensionsv1.ConversionResponse{UID: request.UID}
+
+	convertedObjects := []runtime.RawExtension{}
+	for _, rawObject := range request.Objects {
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(rawObject.Raw); err != nil {
+			response.Result = metav1.Status{
+				Status:  metav1.StatusFailure,
+				Message: fmt.Sprintf("failed to decode the object to convert: %v", err),
+			}
+			return response
+		}
+
+		convert, registered := w.converters[obj.GetKind()]
+		if !registered {
+			response.Result = metav1.Status{
+				Status:  metav1.StatusFailure,
+				Message: fmt.Sprintf("no conversion registered for kind %q", obj.GetKind()),
+			}
+			return response
+		}
+		converted, err := convert(obj, request.DesiredAPIVersion)
+		if err != nil {
+			response.Result = metav1.Status{
+				Status: metav1.StatusFailure,
+				Message: fmt.Sprintf("failed to convert %s %q to %s: %v",
+					obj.GetKind(), obj.GetName(), request.DesiredAPIVersion, err),
+			}
+			return response
+		}
+		convertedObjects = append(convertedObjects, runtime.RawExtension{Object: converted})
+	}
+
+	response.ConvertedObjects = convertedObjects
+	response.Result = metav1.Status{Status: metav1.StatusSuccess}
+	return response
+}
+
+// Serve exposes the conversion webhook on the given address until the context is
+// done. The listener serves TLS with the given certificate, the API server only
+// calls conversion webhooks over https.
+func (w *Webhook) Serve(ctx context.Context, addr, certFile, keyFile string) {
+	mux := http.NewServeMux()
+	mux.Handle("/convert", w)
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.Background())
+	}()
+
+	if err := server.ListenAndServeTLS(certFile, keyFile); err != nil && err != http.ErrServerClosed {
+		klog.ErrorS(err, "Failed to serve the conversion webhook", "addr", addr)
+	}
+}
@@ -0,0 +1,141 @@
+package conversion
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func newKlusterlet(apiVersion, name string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       "Klusterlet",
+		"metadata": map[string]interface{}{
+			"name": name,
+		},
+		"spec": map[string]interface{}{
+			"namespace":   "open-cluster-management-agent",
+			"clusterName": "cluster1",
+		},
+	}}
+}
+
+func newReview(uid types.UID, desiredAPIVersion string, objects ...*unstructured.Unstructured) *apiextensionsv1.ConversionReview {
+	request := &apiextensionsv1.ConversionRequest{
+		UID:               uid,
+		DesiredAPIVersion: desiredAPIVersion,
+	}
+	for _, object := range objects {
+		request.Objects = append(request.Objects, runtime.RawExtension{Object: object})
+	}
+	return &apiextensionsv1.ConversionReview{Request: request}
+}
+
+func TestIdentityConvertRoundTrip(t *testing.T) {
+	original := newKlusterlet("operator.open-cluster-management.io/v1", "klusterlet")
+
+	converted, err := IdentityConvert(original, "operator.open-cluster-management.io/v1beta2")
+	if err != nil {
+		t.Fatalf("Expected no error converting to v1beta2, but got %v", err)
+	}
+	if converted.GetAPIVersion() != "operator.open-cluster-management.io/v1beta2" {
+		t.Errorf("Expected api version v1beta2, but got %q", converted.GetAPIVersion())
+	}
+
+	restored, err := IdentityConvert(converted, "operator.open-cluster-management.io/v1")
+	if err != nil {
+		t.Fatalf("Expected no error converting back to v1, but got %v", err)
+	}
+	if !reflect.DeepEqual(original, restored) {
+		t.Errorf("Expected the object to round trip unchanged, but got %v", restored)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	cases := []struct {
+		name              string
+		review            *apiextensionsv1.ConversionReview
+		expectedStatus    string
+		validateConverted func(t *testing.T, objects []runtime.RawExtension)
+	}{
+		{
+			name: "convert registered kind",
+			review: newReview("uid1", "operator.open-cluster-management.io/v1beta2",
+				newKlusterlet("operator.open-cluster-management.io/v1", "klusterlet")),
+			expectedStatus: metav1.StatusSuccess,
+			validateConverted: func(t *testing.T, objects []runtime.RawExtension) {
+				if len(objects) != 1 {
+					t.Fatalf("Expected 1 converted object, but got %d", len(objects))
+				}
+				converted := &unstructured.Unstructured{}
+				if err := converted.UnmarshalJSON(objects[0].Raw); err != nil {
+					t.Fatalf("Expected a decodable converted object, but got %v", err)
+				}
+				if converted.GetAPIVersion() != "operator.open-cluster-management.io/v1beta2" {
+					t.Errorf("Expected api version v1beta2, but got %q", converted.GetAPIVersion())
+				}
+				if converted.GetName() != "klusterlet" {
+					t.Errorf("Expected the object name to be kept, but got %q", converted.GetName())
+				}
+			},
+		},
+		{
+			name: "unregistered kind fails the review",
+			review: newReview("uid2", "operator.open-cluster-management.io/v1beta2",
+				&unstructured.Unstructured{Object: map[string]interface{}{
+					"apiVersion": "operator.open-cluster-management.io/v1",
+					"kind":       "ClusterManager",
+					"metadata":   map[string]interface{}{"name": "cluster-manager"},
+				}}),
+			expectedStatus: metav1.StatusFailure,
+		},
+	}
+
+	webhook := NewWebhook()
+	webhook.RegisterConverter("Klusterlet", IdentityConvert)
+	server := httptest.NewServer(webhook)
+	defer server.Close()
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			body, err := json.Marshal(c.review)
+			if err != nil {
+				t.Fatalf("Expected no error encoding the review, but got %v", err)
+			}
+			resp, err := http.Post(server.URL+"/convert", "application/json", bytes.NewReader(body))
+			if err != nil {
+				t.Fatalf("Expected no error posting the review, but got %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("Expected status 200, but got %d", resp.StatusCode)
+			}
+
+			review := &apiextensionsv1.ConversionReview{}
+			if err := json.NewDecoder(resp.Body).Decode(review); err != nil {
+				t.Fatalf("Expected a decodable review response, but got %v", err)
+			}
+			if review.Response == nil {
+				t.Fatal("Expected a review response, but got none")
+			}
+			if review.Response.UID != c.review.Request.UID {
+				t.Errorf("Expected the request uid %q to be echoed, but got %q", c.review.Request.UID, review.Response.UID)
+			}
+			if review.Response.Result.Status != c.expectedStatus {
+				t.Errorf("Expected result status %q, but got %q: %s", c.expectedStatus, review.Response.Result.Status, review.Response.Result.Message)
+			}
+			if c.validateConverted != nil {
+				c.validateConverted(t, review.Response.ConvertedObjects)
+			}
+		})
+	}
+}
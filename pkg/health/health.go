@@ -0,0 +1,53 @@
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	lock sync.RWMutex
+	// readinessChecks maps a name to a check reporting whether that part of the
+	// operator is ready to serve, e.g. whether an informer cache has synced.
+	readinessChecks = map[string]func() bool{}
+)
+
+// AddReadinessCheck registers a named check that must return true before the
+// /readyz endpoint reports the operator as ready.
+func AddReadinessCheck(name string, check func() bool) {
+	lock.Lock()
+	defer lock.Unlock()
+	readinessChecks[name] = check
+}
+
+// HealthzHandler reports whether the operator process is alive. The handler only
+// serves while the operator holds the leader election lease; losing the lease
+// cancels the operator context and stops the listener, which fails the probe.
+func HealthzHandler(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "ok")
+}
+
+// ReadyzHandler reports whether all registered readiness checks pass.
+func ReadyzHandler(w http.ResponseWriter, _ *http.Request) {
+	lock.RLock()
+	var failed []string
+	for name, check := range readinessChecks {
+		if !check() {
+			failed = append(failed, name)
+		}
+	}
+	lock.RUnlock()
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "not ready: %s", strings.Join(failed, ","))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "ok")
+}
@@ -2,11 +2,17 @@ package helpers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
+	"sync"
 
 	admissionv1 "k8s.io/api/admissionregistration/v1"
 	appsv1 "k8s.io/api/apps/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
@@ -15,12 +21,21 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	versionutil "k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	admissionclient "k8s.io/client-go/kubernetes/typed/admissionregistration/v1"
+	autoscalingclient "k8s.io/client-go/kubernetes/typed/autoscaling/v1"
+	policyclient "k8s.io/client-go/kubernetes/typed/policy/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/retry"
@@ -28,16 +43,50 @@ import (
 	apiregistrationclient "k8s.io/kube-aggregator/pkg/client/clientset_generated/clientset/typed/apiregistration/v1"
 	operatorv1client "open-cluster-management.io/api/client/operator/clientset/versioned/typed/operator/v1"
 	operatorapiv1 "open-cluster-management.io/api/operator/v1"
+	"open-cluster-management.io/registration-operator/pkg/metrics"
+	"open-cluster-management.io/registration-operator/pkg/version"
+
+	"golang.org/x/time/rate"
 
 	"github.com/openshift/api"
+	"github.com/openshift/library-go/pkg/controller/factory"
 	"github.com/openshift/library-go/pkg/operator/events"
 	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
 	"github.com/openshift/library-go/pkg/operator/resource/resourcemerge"
+
+	"sigs.k8s.io/yaml"
 )
 
 const (
 	defaultReplica = 3
 	singleReplica  = 1
+
+	// FieldManager is the field manager the operator applies resources with. Fields
+	// that are not set by the operator stay owned by their own field managers.
+	FieldManager = "registration-operator"
+
+	// ManagedByLabel is set on every deployment the operator creates, so the deployment
+	// informers can be scoped to the operator managed deployments only.
+	ManagedByLabel = "operator.open-cluster-management.io/managed-by"
+
+	// ClusterManagerOwnerLabel and KlusterletOwnerLabel hold the name of the owning
+	// custom resource on the cluster scoped resources the operator creates, so
+	// resources whose owner no longer exists can be garbage collected.
+	ClusterManagerOwnerLabel = "operator.open-cluster-management.io/clustermanager"
+	KlusterletOwnerLabel     = "operator.open-cluster-management.io/klusterlet"
+
+	// PodSecurityEnforceLabel is the pod security admission label set on the
+	// namespaces the operator creates, so the namespaces are admitted on clusters
+	// that enforce pod security without manual labeling.
+	PodSecurityEnforceLabel = "pod-security.kubernetes.io/enforce"
+	// DefaultPodSecurityEnforceLevel is the pod security level enforced on the
+	// created namespaces unless it is overridden by a command line flag.
+	DefaultPodSecurityEnforceLevel = "baseline"
+
+	// specHashAnnotation records a hash of the rendered desired state on applied
+	// resources, so an unchanged resource can be skipped without a deep comparison.
+	// The key matches the annotation resourceapply.SetSpecHashAnnotation sets.
+	specHashAnnotation = "operator.openshift.io/spec-hash"
 )
 
 var (
@@ -52,6 +101,7 @@ func init() {
 	utilruntime.Must(apiextensionsv1.AddToScheme(genericScheme))
 	utilruntime.Must(apiregistrationv1.AddToScheme(genericScheme))
 	utilruntime.Must(admissionv1.AddToScheme(genericScheme))
+	utilruntime.Must(policyv1.AddToScheme(genericScheme))
 }
 
 type UpdateClusterManagerStatusFunc func(status *operatorapiv1.ClusterManagerStatus) error
@@ -91,6 +141,9 @@ func UpdateClusterManagerStatus(
 		updated = err == nil
 		return err
 	})
+	if err == nil {
+		metrics.SetConditions("ClusterManager", clusterManagerName, updatedClusterManagerStatus.Conditions)
+	}
 
 	return updatedClusterManagerStatus, updated, err
 }
@@ -141,6 +194,9 @@ func UpdateKlusterletStatus(
 		updated = err == nil
 		return err
 	})
+	if err == nil {
+		metrics.SetConditions("Klusterlet", klusterletName, updatedKlusterletStatus.Conditions)
+	}
 
 	return updatedKlusterletStatus, updated, err
 }
@@ -154,6 +210,91 @@ func UpdateKlusterletConditionFn(conds ...metav1.Condition) UpdateKlusterletStat
 	}
 }
 
+// Status summary values condensing the conditions for printer columns.
+const (
+	StatusSummaryAvailable   = "Available"
+	StatusSummaryProgressing = "Progressing"
+	StatusSummaryDegraded    = "Degraded"
+)
+
+// StatusSummary condenses the given conditions into a single word for the scalar
+// status summary field: Degraded when any degraded condition is raised,
+// Progressing until the manifests are applied, and Available otherwise.
+func StatusSummary(conditions []metav1.Condition) string {
+	for _, condition := range conditions {
+		if strings.HasSuffix(condition.Type, "Degraded") && condition.Status == metav1.ConditionTrue {
+			return StatusSummaryDegraded
+		}
+	}
+	if !meta.IsStatusConditionTrue(conditions, "Applied") {
+		return StatusSummaryProgressing
+	}
+	return StatusSummaryAvailable
+}
+
+// UpdateClusterManagerSummaryFn recomputes the status summary from the conditions.
+// It must run after the condition update funcs of the same status update, so the
+// summary reflects the conditions as they are written.
+func UpdateClusterManagerSummaryFn() UpdateClusterManagerStatusFunc {
+	return func(oldStatus *operatorapiv1.ClusterManagerStatus) error {
+		oldStatus.Summary = StatusSummary(oldStatus.Conditions)
+		return nil
+	}
+}
+
+// UpdateKlusterletSummaryFn recomputes the status summary from the conditions. It
+// must run after the condition update funcs of the same status update, so the
+// summary reflects the conditions as they are written.
+func UpdateKlusterletSummaryFn() UpdateKlusterletStatusFunc {
+	return func(oldStatus *operatorapiv1.KlusterletStatus) error {
+		oldStatus.Summary = StatusSummary(oldStatus.Conditions)
+		return nil
+	}
+}
+
+// UpdateClusterManagerRelatedResourcesFn records the resources the operator manages
+// for a clustermanager, so they can be enumerated without knowing the manifests.
+func UpdateClusterManagerRelatedResourcesFn(relatedResources ...operatorapiv1.RelatedResourceMeta) UpdateClusterManagerStatusFunc {
+	return func(oldStatus *operatorapiv1.ClusterManagerStatus) error {
+		oldStatus.RelatedResources = relatedResources
+		return nil
+	}
+}
+
+// UpdateKlusterletRelatedResourcesFn records the resources the operator manages for a
+// klusterlet, so they can be enumerated without knowing the manifests.
+func UpdateKlusterletRelatedResourcesFn(relatedResources ...operatorapiv1.RelatedResourceMeta) UpdateKlusterletStatusFunc {
+	return func(oldStatus *operatorapiv1.KlusterletStatus) error {
+		oldStatus.RelatedResources = relatedResources
+		return nil
+	}
+}
+
+// NewRelatedResources returns the references of the objects in the given rendered
+// manifests for tracking in status.RelatedResources.
+func NewRelatedResources(render func(name string) ([]byte, error), files ...string) ([]operatorapiv1.RelatedResourceMeta, error) {
+	relatedResources := []operatorapiv1.RelatedResourceMeta{}
+	for _, file := range files {
+		data, err := render(file)
+		if err != nil {
+			return nil, err
+		}
+		object := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal(data, object); err != nil {
+			return nil, fmt.Errorf("cannot decode %q: %v", file, err)
+		}
+		gvr, _ := meta.UnsafeGuessKindToResource(object.GroupVersionKind())
+		relatedResources = append(relatedResources, operatorapiv1.RelatedResourceMeta{
+			Group:     gvr.Group,
+			Version:   gvr.Version,
+			Resource:  gvr.Resource,
+			Namespace: object.GetNamespace(),
+			Name:      object.GetName(),
+		})
+	}
+	return relatedResources, nil
+}
+
 func CleanUpStaticObject(
 	ctx context.Context,
 	client kubernetes.Interface,
@@ -198,6 +339,10 @@ func CleanUpStaticObject(
 		err = client.AdmissionregistrationV1().ValidatingWebhookConfigurations().Delete(ctx, t.Name, metav1.DeleteOptions{})
 	case *admissionv1.MutatingWebhookConfiguration:
 		err = client.AdmissionregistrationV1().MutatingWebhookConfigurations().Delete(ctx, t.Name, metav1.DeleteOptions{})
+	case *policyv1.PodDisruptionBudget:
+		err = client.PolicyV1().PodDisruptionBudgets(t.Namespace).Delete(ctx, t.Name, metav1.DeleteOptions{})
+	case *autoscalingv1.HorizontalPodAutoscaler:
+		err = client.AutoscalingV1().HorizontalPodAutoscalers(t.Namespace).Delete(ctx, t.Name, metav1.DeleteOptions{})
 	default:
 		err = fmt.Errorf("unhandled type %T", object)
 	}
@@ -207,9 +352,26 @@ func CleanUpStaticObject(
 	return err
 }
 
+// seedSpecHashAnnotation copies the spec hash of the desired state onto an existing
+// object that was applied before the hash was recorded, so an otherwise unchanged
+// object is not rewritten just to add the annotation. The hash is then persisted
+// with the next real update.
+func seedSpecHashAnnotation(existing *metav1.ObjectMeta, required metav1.ObjectMeta) {
+	if _, recorded := existing.Annotations[specHashAnnotation]; recorded {
+		return
+	}
+	if existing.Annotations == nil {
+		existing.Annotations = map[string]string{}
+	}
+	existing.Annotations[specHashAnnotation] = required.Annotations[specHashAnnotation]
+}
+
 func ApplyValidatingWebhookConfiguration(
 	client admissionclient.ValidatingWebhookConfigurationsGetter,
 	required *admissionv1.ValidatingWebhookConfiguration) (*admissionv1.ValidatingWebhookConfiguration, bool, error) {
+	if err := resourceapply.SetSpecHashAnnotation(&required.ObjectMeta, required.Webhooks); err != nil {
+		return nil, false, err
+	}
 	existing, err := client.ValidatingWebhookConfigurations().Get(context.TODO(), required.Name, metav1.GetOptions{})
 	if errors.IsNotFound(err) {
 		actual, err := client.ValidatingWebhookConfigurations().Create(context.TODO(), required, metav1.CreateOptions{})
@@ -218,13 +380,19 @@ func ApplyValidatingWebhookConfiguration(
 	if err != nil {
 		return nil, false, err
 	}
+	// The recorded hash of the desired state still matches, so the update and the deep
+	// comparison are skipped. Server side defaulting cannot cause a rewrite loop.
+	if existing.Annotations[specHashAnnotation] == required.Annotations[specHashAnnotation] {
+		return existing, false, nil
+	}
 
 	modified := resourcemerge.BoolPtr(false)
 	existingCopy := existing.DeepCopy()
+	seedSpecHashAnnotation(&existingCopy.ObjectMeta, required.ObjectMeta)
 	resourcemerge.EnsureObjectMeta(modified, &existingCopy.ObjectMeta, required.ObjectMeta)
 	if !equality.Semantic.DeepEqual(existingCopy.Webhooks, required.Webhooks) {
 		*modified = true
-		existing.Webhooks = required.Webhooks
+		existingCopy.Webhooks = required.Webhooks
 	}
 	if !*modified {
 		return existing, false, nil
@@ -237,6 +405,9 @@ func ApplyValidatingWebhookConfiguration(
 func ApplyMutatingWebhookConfiguration(
 	client admissionclient.MutatingWebhookConfigurationsGetter,
 	required *admissionv1.MutatingWebhookConfiguration) (*admissionv1.MutatingWebhookConfiguration, bool, error) {
+	if err := resourceapply.SetSpecHashAnnotation(&required.ObjectMeta, required.Webhooks); err != nil {
+		return nil, false, err
+	}
 	existing, err := client.MutatingWebhookConfigurations().Get(context.TODO(), required.Name, metav1.GetOptions{})
 	if errors.IsNotFound(err) {
 		actual, err := client.MutatingWebhookConfigurations().Create(context.TODO(), required, metav1.CreateOptions{})
@@ -245,13 +416,19 @@ func ApplyMutatingWebhookConfiguration(
 	if err != nil {
 		return nil, false, err
 	}
+	// The recorded hash of the desired state still matches, so the update and the deep
+	// comparison are skipped.
+	if existing.Annotations[specHashAnnotation] == required.Annotations[specHashAnnotation] {
+		return existing, false, nil
+	}
 
 	modified := resourcemerge.BoolPtr(false)
 	existingCopy := existing.DeepCopy()
+	seedSpecHashAnnotation(&existingCopy.ObjectMeta, required.ObjectMeta)
 	resourcemerge.EnsureObjectMeta(modified, &existingCopy.ObjectMeta, required.ObjectMeta)
 	if !equality.Semantic.DeepEqual(existingCopy.Webhooks, required.Webhooks) {
 		*modified = true
-		existing.Webhooks = required.Webhooks
+		existingCopy.Webhooks = required.Webhooks
 	}
 	if !*modified {
 		return existing, false, nil
@@ -261,10 +438,100 @@ func ApplyMutatingWebhookConfiguration(
 	return actual, true, err
 }
 
+func ApplyPodDisruptionBudget(
+	client policyclient.PodDisruptionBudgetsGetter,
+	required *policyv1.PodDisruptionBudget) (*policyv1.PodDisruptionBudget, bool, error) {
+	if err := resourceapply.SetSpecHashAnnotation(&required.ObjectMeta, required.Spec); err != nil {
+		return nil, false, err
+	}
+	existing, err := client.PodDisruptionBudgets(required.Namespace).Get(context.TODO(), required.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		actual, err := client.PodDisruptionBudgets(required.Namespace).Create(context.TODO(), required, metav1.CreateOptions{})
+		return actual, true, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	// The recorded hash of the desired state still matches, so the update and the deep
+	// comparison are skipped.
+	if existing.Annotations[specHashAnnotation] == required.Annotations[specHashAnnotation] {
+		return existing, false, nil
+	}
+
+	modified := resourcemerge.BoolPtr(false)
+	existingCopy := existing.DeepCopy()
+	seedSpecHashAnnotation(&existingCopy.ObjectMeta, required.ObjectMeta)
+	resourcemerge.EnsureObjectMeta(modified, &existingCopy.ObjectMeta, required.ObjectMeta)
+	if !equality.Semantic.DeepEqual(existingCopy.Spec, required.Spec) {
+		*modified = true
+		existingCopy.Spec = required.Spec
+	}
+	if !*modified {
+		return existing, false, nil
+	}
+
+	actual, err := client.PodDisruptionBudgets(required.Namespace).Update(context.TODO(), existingCopy, metav1.UpdateOptions{})
+	return actual, true, err
+}
+
+func ApplyHorizontalPodAutoscaler(
+	client autoscalingclient.HorizontalPodAutoscalersGetter,
+	required *autoscalingv1.HorizontalPodAutoscaler) (*autoscalingv1.HorizontalPodAutoscaler, bool, error) {
+	if err := resourceapply.SetSpecHashAnnotation(&required.ObjectMeta, required.Spec); err != nil {
+		return nil, false, err
+	}
+	existing, err := client.HorizontalPodAutoscalers(required.Namespace).Get(context.TODO(), required.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		actual, err := client.HorizontalPodAutoscalers(required.Namespace).Create(context.TODO(), required, metav1.CreateOptions{})
+		return actual, true, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	// The recorded hash of the desired state still matches, so the update and the deep
+	// comparison are skipped.
+	if existing.Annotations[specHashAnnotation] == required.Annotations[specHashAnnotation] {
+		return existing, false, nil
+	}
+
+	modified := resourcemerge.BoolPtr(false)
+	existingCopy := existing.DeepCopy()
+	seedSpecHashAnnotation(&existingCopy.ObjectMeta, required.ObjectMeta)
+	resourcemerge.EnsureObjectMeta(modified, &existingCopy.ObjectMeta, required.ObjectMeta)
+	if !equality.Semantic.DeepEqual(existingCopy.Spec, required.Spec) {
+		*modified = true
+		existingCopy.Spec = required.Spec
+	}
+	if !*modified {
+		return existing, false, nil
+	}
+
+	actual, err := client.HorizontalPodAutoscalers(required.Namespace).Update(context.TODO(), existingCopy, metav1.UpdateOptions{})
+	return actual, true, err
+}
+
+// ThrottleSync wraps the sync function of a controller with a rate limiter, so the
+// number of reconciles per second can be bounded on hubs hosting many resources.
+// A nil limiter leaves the sync function unwrapped.
+func ThrottleSync(limiter *rate.Limiter, sync factory.SyncFunc) factory.SyncFunc {
+	if limiter == nil {
+		return sync
+	}
+	return func(ctx context.Context, syncContext factory.SyncContext) error {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+		return sync(ctx, syncContext)
+	}
+}
+
 func ApplyDeployment(
 	client kubernetes.Interface,
 	generationStatuses []operatorapiv1.GenerationStatus,
 	nodePlacement operatorapiv1.NodePlacement,
+	runtimeClassName string,
+	probeConfiguration *operatorapiv1.ProbeConfiguration,
+	rolloutConfiguration *operatorapiv1.RolloutConfiguration,
 	manifests resourceapply.AssetFunc,
 	recorder events.Recorder, file string) (operatorapiv1.GenerationStatus, error) {
 	deploymentBytes, err := manifests(file)
@@ -282,24 +549,179 @@ func ApplyDeployment(
 		generationStatus.LastGeneration = currentGenerationStatus.LastGeneration
 	}
 
-	deployment.(*appsv1.Deployment).Spec.Template.Spec.NodeSelector = nodePlacement.NodeSelector
-	deployment.(*appsv1.Deployment).Spec.Template.Spec.Tolerations = nodePlacement.Tolerations
+	required := deployment.(*appsv1.Deployment)
+	if required.Labels == nil {
+		required.Labels = map[string]string{}
+	}
+	required.Labels[ManagedByLabel] = FieldManager
+	required.Spec.Template.Spec.NodeSelector = nodePlacement.NodeSelector
+	required.Spec.Template.Spec.Tolerations = nodePlacement.Tolerations
+	ensureNodeFailureTolerations(required)
+	ensureZoneAntiAffinity(required)
+	if len(runtimeClassName) > 0 {
+		required.Spec.Template.Spec.RuntimeClassName = &runtimeClassName
+	}
+	if rolloutConfiguration != nil {
+		if rolloutConfiguration.MinReadySeconds > 0 {
+			required.Spec.MinReadySeconds = rolloutConfiguration.MinReadySeconds
+		}
+		if rolloutConfiguration.ProgressDeadlineSeconds > 0 {
+			progressDeadlineSeconds := rolloutConfiguration.ProgressDeadlineSeconds
+			required.Spec.ProgressDeadlineSeconds = &progressDeadlineSeconds
+		}
+	}
+	if probeConfiguration != nil {
+		for i := range required.Spec.Template.Spec.Containers {
+			container := &required.Spec.Template.Spec.Containers[i]
+			for _, probe := range []*corev1.Probe{container.LivenessProbe, container.ReadinessProbe} {
+				if probe == nil {
+					continue
+				}
+				if probeConfiguration.TimeoutSeconds > 0 {
+					probe.TimeoutSeconds = probeConfiguration.TimeoutSeconds
+				}
+				if probeConfiguration.PeriodSeconds > 0 {
+					probe.PeriodSeconds = probeConfiguration.PeriodSeconds
+				}
+				if probeConfiguration.FailureThreshold > 0 {
+					probe.FailureThreshold = probeConfiguration.FailureThreshold
+				}
+			}
+		}
+	}
+	if err := resourceapply.SetSpecHashAnnotation(&required.ObjectMeta, required.Spec); err != nil {
+		return generationStatus, fmt.Errorf("%q (%T): %v", file, deployment, err)
+	}
+
+	existing, err := client.AppsV1().Deployments(required.Namespace).Get(context.TODO(), required.Name, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		created, err := client.AppsV1().Deployments(required.Namespace).Create(
+			context.TODO(), required, metav1.CreateOptions{FieldManager: FieldManager})
+		if err != nil {
+			return generationStatus, fmt.Errorf("%q (%T): %v", file, deployment, err)
+		}
+		recorder.Eventf("DeploymentCreated", "Created deployment %s/%s", required.Namespace, required.Name)
+		generationStatus.LastGeneration = created.Generation
+		return generationStatus, nil
+	case err != nil:
+		return generationStatus, fmt.Errorf("%q (%T): %v", file, deployment, err)
+	}
+
+	// The spec hash annotation is part of the metadata comparison, so a change of the
+	// manifest is detected as a metadata modification.
+	modified := resourcemerge.BoolPtr(false)
+	existingCopy := existing.DeepCopy()
+	seedSpecHashAnnotation(&existingCopy.ObjectMeta, required.ObjectMeta)
+	resourcemerge.EnsureObjectMeta(modified, &existingCopy.ObjectMeta, required.ObjectMeta)
+	if !*modified && existing.Generation == generationStatus.LastGeneration {
+		generationStatus.LastGeneration = existing.Generation
+		return generationStatus, nil
+	}
 
-	updatedDeployment, updated, err := resourceapply.ApplyDeployment(
-		client.AppsV1(),
-		recorder,
-		deployment.(*appsv1.Deployment), generationStatus.LastGeneration)
+	// Reconcile drift with server-side apply, so fields the manifest does not set, e.g.
+	// replicas managed by an autoscaler, stay owned by their own field managers and no
+	// conflict retries are needed.
+	required.TypeMeta = metav1.TypeMeta{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: "Deployment"}
+	requiredBytes, err := json.Marshal(required)
 	if err != nil {
 		return generationStatus, fmt.Errorf("%q (%T): %v", file, deployment, err)
 	}
-
-	if updated {
-		generationStatus.LastGeneration = updatedDeployment.ObjectMeta.Generation
+	applied, err := client.AppsV1().Deployments(required.Namespace).Patch(
+		context.TODO(), required.Name, types.ApplyPatchType, requiredBytes,
+		metav1.PatchOptions{FieldManager: FieldManager, Force: resourcemerge.BoolPtr(true)})
+	if err != nil {
+		return generationStatus, fmt.Errorf("%q (%T): %v", file, deployment, err)
 	}
+	recorder.Eventf("DeploymentUpdated", "Updated deployment %s/%s", required.Namespace, required.Name)
+	generationStatus.LastGeneration = applied.Generation
 
 	return generationStatus, nil
 }
 
+// ensureZoneAntiAffinity makes sure a deployment running with the HA replica count
+// prefers spreading its replicas across zones on the topology.kubernetes.io/zone
+// node label. The manifests carry preferred anti-affinity on the deprecated
+// failure-domain.beta.kubernetes.io/zone label, which recent clusters no longer
+// set, so without the rewrite all replicas could land in a single zone. The
+// anti-affinity stays preferred, so the nodePlacement constraints remain
+// authoritative over where the pods are allowed to run.
+func ensureZoneAntiAffinity(deployment *appsv1.Deployment) {
+	if deployment.Spec.Replicas == nil || *deployment.Spec.Replicas != defaultReplica {
+		return
+	}
+	podSpec := &deployment.Spec.Template.Spec
+	if podSpec.Affinity == nil {
+		podSpec.Affinity = &corev1.Affinity{}
+	}
+	if podSpec.Affinity.PodAntiAffinity == nil {
+		podSpec.Affinity.PodAntiAffinity = &corev1.PodAntiAffinity{}
+	}
+	antiAffinity := podSpec.Affinity.PodAntiAffinity
+	hasZoneTerm := false
+	for i := range antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+		term := &antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution[i]
+		if term.PodAffinityTerm.TopologyKey == corev1.LabelFailureDomainBetaZone {
+			term.PodAffinityTerm.TopologyKey = corev1.LabelTopologyZone
+		}
+		if term.PodAffinityTerm.TopologyKey == corev1.LabelTopologyZone {
+			hasZoneTerm = true
+		}
+	}
+	if hasZoneTerm || deployment.Spec.Selector == nil {
+		return
+	}
+	antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+		antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution,
+		corev1.WeightedPodAffinityTerm{
+			Weight: 70,
+			PodAffinityTerm: corev1.PodAffinityTerm{
+				TopologyKey:   corev1.LabelTopologyZone,
+				LabelSelector: deployment.Spec.Selector.DeepCopy(),
+			},
+		})
+}
+
+// defaultNodeFailureTolerationSeconds bounds how long a deployed pod stays bound to
+// a failed node before it is evicted and rescheduled. The admission-injected
+// default of 300 seconds leaves a single-replica agent gone for five minutes when
+// its node dies, which is longer than the hub takes to mark the cluster unknown.
+const defaultNodeFailureTolerationSeconds int64 = 60
+
+// ensureNodeFailureTolerations tightens the NoExecute tolerations the admission
+// controller would otherwise inject for the node not-ready and unreachable taints,
+// so pods on a dead node are evicted after defaultNodeFailureTolerationSeconds
+// instead of the 300-second cluster default. A toleration the user already set for
+// one of the keys through nodePlacement stays authoritative for that key.
+func ensureNodeFailureTolerations(deployment *appsv1.Deployment) {
+	podSpec := &deployment.Spec.Template.Spec
+	for _, key := range []string{corev1.TaintNodeNotReady, corev1.TaintNodeUnreachable} {
+		tolerated := false
+		for _, toleration := range podSpec.Tolerations {
+			if toleration.Key == key || len(toleration.Key) == 0 {
+				tolerated = true
+				break
+			}
+		}
+		if tolerated {
+			continue
+		}
+		tolerationSeconds := defaultNodeFailureTolerationSeconds
+		podSpec.Tolerations = append(podSpec.Tolerations, corev1.Toleration{
+			Key:               key,
+			Operator:          corev1.TolerationOpExists,
+			Effect:            corev1.TaintEffectNoExecute,
+			TolerationSeconds: &tolerationSeconds,
+		})
+	}
+}
+
+// applyWorkers bounds how many static resources ApplyDirectly applies concurrently.
+const applyWorkers = 4
+
+// ApplyDirectly applies the given manifest files. The files are independent static
+// resources, so they are applied concurrently with bounded parallelism instead of
+// one round trip at a time. The results are returned in the order of the files.
 func ApplyDirectly(
 	client kubernetes.Interface,
 	apiExtensionClient apiextensionsclient.Interface,
@@ -307,49 +729,96 @@ func ApplyDirectly(
 	recorder events.Recorder,
 	manifests resourceapply.AssetFunc,
 	files ...string) []resourceapply.ApplyResult {
-	ret := []resourceapply.ApplyResult{}
-	genericApplyFiles := []string{}
-	for _, file := range files {
-		result := resourceapply.ApplyResult{File: file}
-		objBytes, err := manifests(file)
-		if err != nil {
-			result.Error = fmt.Errorf("missing %q: %v", file, err)
-			ret = append(ret, result)
-			continue
-		}
-		requiredObj, _, err := genericCodec.Decode(objBytes, nil, nil)
-		if err != nil {
-			result.Error = fmt.Errorf("cannot decode %q: %v", file, err)
-			ret = append(ret, result)
+	ret := make([]resourceapply.ApplyResult, len(files))
+	// Namespaces must exist before the resources created in them, so the namespace
+	// manifests are applied up front instead of racing their dependents on the
+	// first install.
+	remaining := make([]int, 0, len(files))
+	for index := range files {
+		if isNamespaceManifest(manifests, files[index]) {
+			ret[index] = applyFile(client, apiExtensionClient, apiRegistrationClient, recorder, manifests, files[index])
 			continue
 		}
-		result.Type = fmt.Sprintf("%T", requiredObj)
-		switch t := requiredObj.(type) {
-		case *admissionv1.ValidatingWebhookConfiguration:
-			result.Result, result.Changed, result.Error = ApplyValidatingWebhookConfiguration(
-				client.AdmissionregistrationV1(), t)
-		case *admissionv1.MutatingWebhookConfiguration:
-			result.Result, result.Changed, result.Error = ApplyMutatingWebhookConfiguration(
-				client.AdmissionregistrationV1(), t)
-		case *apiregistrationv1.APIService:
-			result.Result, result.Changed, result.Error = resourceapply.ApplyAPIService(apiRegistrationClient, recorder, t)
-		default:
-			genericApplyFiles = append(genericApplyFiles, file)
-		}
-	}
-
-	clientHolder := resourceapply.NewKubeClientHolder(client).WithAPIExtensionsClient(apiExtensionClient)
-	applyResults := resourceapply.ApplyDirectly(
-		clientHolder,
-		recorder,
-		manifests,
-		genericApplyFiles...,
-	)
-
-	ret = append(ret, applyResults...)
+		remaining = append(remaining, index)
+	}
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, applyWorkers)
+	for _, index := range remaining {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			workers <- struct{}{}
+			defer func() { <-workers }()
+			ret[index] = applyFile(client, apiExtensionClient, apiRegistrationClient, recorder, manifests, files[index])
+		}(index)
+	}
+	wg.Wait()
 	return ret
 }
 
+// isNamespaceManifest reports whether the file decodes to a namespace. Missing
+// or undecodable files are left to applyFile so the error shows up in its result.
+func isNamespaceManifest(manifests resourceapply.AssetFunc, file string) bool {
+	objBytes, err := manifests(file)
+	if err != nil {
+		return false
+	}
+	obj, _, err := genericCodec.Decode(objBytes, nil, nil)
+	if err != nil {
+		return false
+	}
+	_, ok := obj.(*corev1.Namespace)
+	return ok
+}
+
+// applyFile applies a single manifest file for ApplyDirectly.
+func applyFile(
+	client kubernetes.Interface,
+	apiExtensionClient apiextensionsclient.Interface,
+	apiRegistrationClient apiregistrationclient.APIServicesGetter,
+	recorder events.Recorder,
+	manifests resourceapply.AssetFunc,
+	file string) resourceapply.ApplyResult {
+	result := resourceapply.ApplyResult{File: file}
+	objBytes, err := manifests(file)
+	if err != nil {
+		result.Error = fmt.Errorf("missing %q: %v", file, err)
+		return result
+	}
+	requiredObj, _, err := genericCodec.Decode(objBytes, nil, nil)
+	if err != nil {
+		result.Error = fmt.Errorf("cannot decode %q: %v", file, err)
+		return result
+	}
+	result.Type = fmt.Sprintf("%T", requiredObj)
+	switch t := requiredObj.(type) {
+	case *admissionv1.ValidatingWebhookConfiguration:
+		result.Result, result.Changed, result.Error = ApplyValidatingWebhookConfiguration(
+			client.AdmissionregistrationV1(), t)
+	case *admissionv1.MutatingWebhookConfiguration:
+		result.Result, result.Changed, result.Error = ApplyMutatingWebhookConfiguration(
+			client.AdmissionregistrationV1(), t)
+	case *apiregistrationv1.APIService:
+		result.Result, result.Changed, result.Error = resourceapply.ApplyAPIService(apiRegistrationClient, recorder, t)
+	case *policyv1.PodDisruptionBudget:
+		result.Result, result.Changed, result.Error = ApplyPodDisruptionBudget(client.PolicyV1(), t)
+	case *autoscalingv1.HorizontalPodAutoscaler:
+		result.Result, result.Changed, result.Error = ApplyHorizontalPodAutoscaler(client.AutoscalingV1(), t)
+	case *appsv1.Deployment:
+		// The spec hash annotation makes a manifest change show up as a metadata
+		// modification, so the expected generation can be taken from the live object.
+		expectedGeneration := int64(-1)
+		if existing, err := client.AppsV1().Deployments(t.Namespace).Get(context.TODO(), t.Name, metav1.GetOptions{}); err == nil {
+			expectedGeneration = existing.Generation
+		}
+		result.Result, result.Changed, result.Error = resourceapply.ApplyDeployment(client.AppsV1(), recorder, t, expectedGeneration)
+	default:
+		clientHolder := resourceapply.NewKubeClientHolder(client).WithAPIExtensionsClient(apiExtensionClient)
+		return resourceapply.ApplyDirectly(clientHolder, recorder, manifests, file)[0]
+	}
+	return result
+}
+
 // NumOfUnavailablePod is to check if a deployment is in degraded state.
 func NumOfUnavailablePod(deployment *appsv1.Deployment) int32 {
 	desiredReplicas := int32(1)
@@ -464,18 +933,385 @@ func LoadClientConfigFromSecret(secret *corev1.Secret) (*restclient.Config, erro
 	return clientcmd.NewDefaultClientConfig(*config, nil).ClientConfig()
 }
 
+// AddOnManagerEnabled returns true if the addon manager is enabled in the cluster manager spec
+// and has an image to deploy.
+func AddOnManagerEnabled(clusterManager *operatorapiv1.ClusterManager) bool {
+	return clusterManager.Spec.AddOnManagerConfiguration != nil &&
+		clusterManager.Spec.AddOnManagerConfiguration.Enabled &&
+		len(clusterManager.Spec.AddOnManagerConfiguration.ImagePullSpec) > 0
+}
+
+// ManifestWorkReplicaSetEnabled returns true if the manifestworkreplicaset controller is
+// enabled in the cluster manager spec.
+func ManifestWorkReplicaSetEnabled(clusterManager *operatorapiv1.ClusterManager) bool {
+	return clusterManager.Spec.WorkConfiguration != nil &&
+		clusterManager.Spec.WorkConfiguration.ManifestWorkReplicaSetEnabled
+}
+
+// ClusterManagerDeployNamespace returns the namespace in spec to deploy the hub components,
+// or the default namespace of "open-cluster-management-hub" if it is not set.
+func ClusterManagerDeployNamespace(clusterManager *operatorapiv1.ClusterManager) string {
+	if len(clusterManager.Spec.Namespace) > 0 {
+		return clusterManager.Spec.Namespace
+	}
+	return ClusterManagerNamespace
+}
+
+// KlusterletAgentNamespace returns the namespace the agents of the given klusterlet are
+// deployed in. In Hosted mode every klusterlet gets its own namespace on the management
+// cluster, derived from the klusterlet name, so many hosted klusterlets can share one
+// management cluster without namespace or secret collisions. In Default mode it is the
+// namespace in spec, or "open-cluster-management-agent" if it is not set.
+func KlusterletAgentNamespace(klusterlet *operatorapiv1.Klusterlet) string {
+	if klusterlet.Spec.DeployOption.Mode == operatorapiv1.InstallModeHosted {
+		return fmt.Sprintf("klusterlet-%s", klusterlet.Name)
+	}
+	if len(klusterlet.Spec.Namespace) > 0 {
+		return klusterlet.Spec.Namespace
+	}
+	return KlusterletDefaultNamespace
+}
+
+// MasterNodeLabelSelector selects the master nodes the replica count of the
+// deployments is derived from when no availability config is set.
+const MasterNodeLabelSelector = "node-role.kubernetes.io/master="
+
+// DetermineReplica determines the replica of deployment based on the availability config
+// of the cluster manager or klusterlet. If the availability config is not set, the replica
+// is determined by the number of master nodes in the cluster.
+func DetermineReplica(nodeLister corev1listers.NodeLister, mode operatorapiv1.AvailabilityOption) int32 {
+	switch mode {
+	case operatorapiv1.HighAvailability:
+		return defaultReplica
+	case operatorapiv1.BasicAvailability:
+		return singleReplica
+	default:
+		return DetermineReplicaByNodes(nodeLister)
+	}
+}
+
 // DetermineReplicaByNodes determines the replica of deployment based on:
-// list master nodes in the cluster and return 1 if
+// list master nodes from the shared node informer and return 1 if
 // the number of master nodes is equal or less than 1. Return 3 otherwise.
-func DetermineReplicaByNodes(ctx context.Context, kubeClient kubernetes.Interface) int32 {
-	nodes, err := kubeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: "node-role.kubernetes.io/master="})
+func DetermineReplicaByNodes(nodeLister corev1listers.NodeLister) int32 {
+	selector, err := labels.Parse(MasterNodeLabelSelector)
+	if err != nil {
+		return defaultReplica
+	}
+	nodes, err := nodeLister.List(selector)
 	if err != nil {
 		return defaultReplica
 	}
 
-	if len(nodes.Items) <= 1 {
+	if len(nodes) <= 1 {
 		return singleReplica
 	}
 
 	return defaultReplica
 }
+
+// ResolveImageDigests maps image references to digest-pinned references by reading
+// the image IDs of the running pods in the given namespace. Images that are not yet
+// running, or that are already pinned by digest, are left out of the returned map.
+func ResolveImageDigests(ctx context.Context, kubeClient kubernetes.Interface, namespace string, images ...string) map[string]string {
+	requested := map[string]bool{}
+	for _, image := range images {
+		if len(image) > 0 && !strings.Contains(image, "@") {
+			requested[image] = true
+		}
+	}
+	resolved := map[string]string{}
+	if len(requested) == 0 {
+		return resolved
+	}
+	pods, err := kubeClient.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return resolved
+	}
+	for _, pod := range pods.Items {
+		for _, containerStatus := range pod.Status.ContainerStatuses {
+			if !requested[containerStatus.Image] {
+				continue
+			}
+			imageID := strings.TrimPrefix(containerStatus.ImageID, "docker-pullable://")
+			if strings.Contains(imageID, "@") {
+				resolved[containerStatus.Image] = imageID
+			}
+		}
+	}
+	return resolved
+}
+
+// RenderedManifest is a manifest rendered from its template for review, e.g. by the
+// render subcommand, instead of being applied to a cluster.
+type RenderedManifest struct {
+	// Name is the manifest file name the data was rendered from.
+	Name string
+	// Data is the rendered manifest in yaml.
+	Data []byte
+}
+
+// MigrateCRDStorageVersion rewrites all objects of the given CRD at its current
+// storage version and prunes the legacy versions from its storedVersions. The
+// operator uses this for its own CRDs, which hold too few objects to need the
+// kube-storage-version-migrator.
+func MigrateCRDStorageVersion(
+	ctx context.Context,
+	apiExtensionClient apiextensionsclient.Interface,
+	dynamicClient dynamic.Interface,
+	crdName string,
+	recorder events.Recorder) error {
+	crd, err := apiExtensionClient.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, crdName, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		return nil
+	case err != nil:
+		return err
+	}
+
+	storageVersion := ""
+	for _, version := range crd.Spec.Versions {
+		if version.Storage {
+			storageVersion = version.Name
+			break
+		}
+	}
+	if len(storageVersion) == 0 {
+		return nil
+	}
+	if len(crd.Status.StoredVersions) == 1 && crd.Status.StoredVersions[0] == storageVersion {
+		return nil
+	}
+
+	// An unchanged update rewrites each object at the current storage version.
+	gvr := schema.GroupVersionResource{Group: crd.Spec.Group, Version: storageVersion, Resource: crd.Spec.Names.Plural}
+	objects, err := dynamicClient.Resource(gvr).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for i := range objects.Items {
+		object := objects.Items[i]
+		_, err := dynamicClient.Resource(gvr).Namespace(object.GetNamespace()).Update(ctx, &object, metav1.UpdateOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	crd.Status.StoredVersions = []string{storageVersion}
+	if _, err := apiExtensionClient.ApiextensionsV1().CustomResourceDefinitions().UpdateStatus(ctx, crd, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+	recorder.Eventf("CRDStoredVersionsPruned", "stored versions of crd %q are pruned to %q", crdName, storageVersion)
+	return nil
+}
+
+// CheckAgentImageVersions checks whether the version tags of the given agent images
+// match the OCM bundle version supported by this operator build on major and minor
+// version. Images without a parsable version tag, e.g. pinned by digest or tagged
+// latest, are assumed to be compatible. An error describing the first mismatched
+// image is returned, or nil when all images are compatible.
+func CheckAgentImageVersions(images ...string) error {
+	supported, err := versionutil.ParseSemantic(version.SupportedBundleVersion)
+	if err != nil {
+		return err
+	}
+	for _, image := range images {
+		if len(image) == 0 || strings.Contains(image, "@") {
+			continue
+		}
+		index := strings.LastIndex(image, ":")
+		if index < 0 || strings.Contains(image[index:], "/") {
+			continue
+		}
+		imageVersion, err := versionutil.ParseSemantic(strings.TrimPrefix(image[index+1:], "v"))
+		if err != nil {
+			continue
+		}
+		if imageVersion.Major() != supported.Major() || imageVersion.Minor() != supported.Minor() {
+			return fmt.Errorf("image %q has version %d.%d, the operator supports bundle version %s",
+				image, imageVersion.Major(), imageVersion.Minor(), version.SupportedBundleVersion)
+		}
+	}
+	return nil
+}
+
+// AgentImageVersionSkew describes the given agent images whose version tags do not
+// exactly match the OCM bundle version of this operator build. Such images still
+// deploy, since CheckAgentImageVersions refuses the incompatible ones, but explicit
+// pull specs drifting from the operator release stream are a common fleet
+// misconfiguration worth a warning. Images without a parsable version tag are skipped.
+func AgentImageVersionSkew(images ...string) []string {
+	supported, err := versionutil.ParseSemantic(version.SupportedBundleVersion)
+	if err != nil {
+		return nil
+	}
+	skews := []string{}
+	for _, image := range images {
+		if len(image) == 0 || strings.Contains(image, "@") {
+			continue
+		}
+		index := strings.LastIndex(image, ":")
+		if index < 0 || strings.Contains(image[index:], "/") {
+			continue
+		}
+		imageVersion, err := versionutil.ParseSemantic(strings.TrimPrefix(image[index+1:], "v"))
+		if err != nil {
+			continue
+		}
+		if imageVersion.String() != supported.String() {
+			skews = append(skews, fmt.Sprintf("image %q has version %s, the operator deploys bundle version %s",
+				image, imageVersion.String(), version.SupportedBundleVersion))
+		}
+	}
+	return skews
+}
+
+// ImageMirror redirects the image references whose repository starts with Source to
+// the same path under Mirror when the components are rendered.
+type ImageMirror struct {
+	Source string
+	Mirror string
+}
+
+// ParseImageMirrors parses the given source=mirror pairs into image mirrors. The
+// prefixes are kept in the order given, ApplyImageMirrors picks the most specific
+// match independent of the order.
+func ParseImageMirrors(pairs []string) ([]ImageMirror, error) {
+	mirrors := []ImageMirror{}
+	for _, pair := range pairs {
+		source, mirror, found := strings.Cut(pair, "=")
+		if !found || len(source) == 0 || len(mirror) == 0 {
+			return nil, fmt.Errorf("invalid image mirror %q, expected the form source-prefix=mirror-prefix", pair)
+		}
+		mirrors = append(mirrors, ImageMirror{Source: strings.TrimSuffix(source, "/"), Mirror: strings.TrimSuffix(mirror, "/")})
+	}
+	return mirrors, nil
+}
+
+// ApplyImageMirrors redirects the given image reference to the configured registry
+// mirrors, so air-gapped fleets can pull the components from a local registry without
+// editing every pull spec. The source prefixes only match on path, tag or digest
+// boundaries, and the longest matching prefix wins like in the container runtime
+// mirror configurations. An image no source matches is returned unchanged.
+func ApplyImageMirrors(mirrors []ImageMirror, image string) string {
+	matched := ImageMirror{}
+	for _, mirror := range mirrors {
+		if len(mirror.Source) <= len(matched.Source) || !strings.HasPrefix(image, mirror.Source) {
+			continue
+		}
+		rest := image[len(mirror.Source):]
+		if len(rest) > 0 && rest[0] != '/' && rest[0] != ':' && rest[0] != '@' {
+			continue
+		}
+		matched = mirror
+	}
+	if len(matched.Source) == 0 {
+		return image
+	}
+	return matched.Mirror + strings.TrimPrefix(image, matched.Source)
+}
+
+// OperatorPermissionDegraded is the type of the condition that reports the result of
+// the operator RBAC self-check.
+const OperatorPermissionDegraded = "OperatorPermissionDegraded"
+
+// OperatorPermission is a resource/verb pair an operator needs for its reconcile loops.
+type OperatorPermission struct {
+	Group    string
+	Resource string
+	Verb     string
+}
+
+// MissingOperatorPermissions issues a SelfSubjectAccessReview per given permission and
+// describes each one the operator does not hold as "verb resource.group", so a
+// misconfigured operator RBAC surfaces as one concise list instead of scattered
+// Forbidden errors in the reconcile loops.
+func MissingOperatorPermissions(ctx context.Context, client kubernetes.Interface, permissions []OperatorPermission) ([]string, error) {
+	missing := []string{}
+	for _, permission := range permissions {
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Group:    permission.Group,
+					Resource: permission.Resource,
+					Verb:     permission.Verb,
+				},
+			},
+		}
+		result, err := client.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if !result.Status.Allowed {
+			resource := permission.Resource
+			if len(permission.Group) > 0 {
+				resource = fmt.Sprintf("%s.%s", permission.Resource, permission.Group)
+			}
+			missing = append(missing, fmt.Sprintf("%s %s", permission.Verb, resource))
+		}
+	}
+	return missing, nil
+}
+
+// OperatorPermissionCondition runs the given permission self-check and converts the
+// result into the OperatorPermissionDegraded condition.
+func OperatorPermissionCondition(ctx context.Context, check func(context.Context) ([]string, error)) metav1.Condition {
+	missing, err := check(ctx)
+	switch {
+	case err != nil:
+		return metav1.Condition{
+			Type:    OperatorPermissionDegraded,
+			Status:  metav1.ConditionUnknown,
+			Reason:  "PermissionCheckFailed",
+			Message: fmt.Sprintf("Failed to verify the operator permissions: %v", err),
+		}
+	case len(missing) > 0:
+		return metav1.Condition{
+			Type:    OperatorPermissionDegraded,
+			Status:  metav1.ConditionTrue,
+			Reason:  "MissingOperatorPermissions",
+			Message: fmt.Sprintf("The operator is not allowed to: %s", strings.Join(missing, ", ")),
+		}
+	default:
+		return metav1.Condition{
+			Type:    OperatorPermissionDegraded,
+			Status:  metav1.ConditionFalse,
+			Reason:  "OperatorPermissionsSufficient",
+			Message: "The operator holds the permissions it needs",
+		}
+	}
+}
+
+// OperatorRequiredPermissions lists the RBAC both operators need to manage the CRDs,
+// component deployments, and certificate secrets of their operands.
+func OperatorRequiredPermissions() []OperatorPermission {
+	permissions := []OperatorPermission{}
+	for _, resource := range []OperatorPermission{
+		{Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"},
+		{Group: "apps", Resource: "deployments"},
+		{Group: "", Resource: "secrets"},
+	} {
+		for _, verb := range []string{"get", "create", "update", "delete"} {
+			permissions = append(permissions, OperatorPermission{Group: resource.Group, Resource: resource.Resource, Verb: verb})
+		}
+	}
+	return permissions
+}
+
+// APIGroupVersionSupported reports whether the cluster serves the given API group
+// version, e.g. "policy/v1", so manifests depending on a version-specific API can be
+// selected to match the cluster.
+func APIGroupVersionSupported(discoveryClient discovery.DiscoveryInterface, groupVersion string) (bool, error) {
+	groups, err := discoveryClient.ServerGroups()
+	if err != nil {
+		return false, err
+	}
+	for _, group := range groups.Groups {
+		for _, version := range group.Versions {
+			if version.GroupVersion == groupVersion {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -9,8 +9,10 @@ import (
 	"time"
 
 	"github.com/openshift/library-go/pkg/operator/events/eventstesting"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
 	operatorhelpers "github.com/openshift/library-go/pkg/operator/v1helpers"
 	admissionv1 "k8s.io/api/admissionregistration/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
 	corev1 "k8s.io/api/core/v1"
 	fakeapiextensions "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
 	opereatorfake "open-cluster-management.io/api/client/operator/clientset/versioned/fake"
@@ -22,7 +24,9 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/diff"
+	"k8s.io/client-go/informers"
 	fakekube "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	clientcmdlatest "k8s.io/client-go/tools/clientcmd/api/latest"
 	fakeapiregistration "k8s.io/kube-aggregator/pkg/client/clientset_generated/clientset/fake"
@@ -255,6 +259,30 @@ func TestApplyValidatingWebhookConfiguration(t *testing.T) {
 			existing:      []runtime.Object{newValidatingWebhookConfiguration("test", "svc1", "svc1")},
 			expected:      newValidatingWebhookConfiguration("test", "svc1", "svc1"),
 		},
+		{
+			name:          "skip update with recorded spec hash",
+			expectUpdated: false,
+			existing: []runtime.Object{func() runtime.Object {
+				config := newValidatingWebhookConfiguration("test", "svc1", "svc1")
+				if err := resourceapply.SetSpecHashAnnotation(&config.ObjectMeta, config.Webhooks); err != nil {
+					t.Fatalf("Expected no error when hashing: %v", err)
+				}
+				return config
+			}()},
+			expected: newValidatingWebhookConfiguration("test", "svc1", "svc1"),
+		},
+		{
+			name:          "update when the recorded spec hash differs",
+			expectUpdated: true,
+			existing: []runtime.Object{func() runtime.Object {
+				config := newValidatingWebhookConfiguration("test", "svc1", "svc1")
+				if err := resourceapply.SetSpecHashAnnotation(&config.ObjectMeta, config.Webhooks); err != nil {
+					t.Fatalf("Expected no error when hashing: %v", err)
+				}
+				return config
+			}()},
+			expected: newValidatingWebhookConfiguration("test", "svc2", "svc2"),
+		},
 	}
 
 	for _, c := range testcase {
@@ -268,6 +296,14 @@ func TestApplyValidatingWebhookConfiguration(t *testing.T) {
 			if updated != c.expectUpdated {
 				t.Errorf("Expect update is %t, but got %t", c.expectUpdated, updated)
 			}
+
+			stored, err := fakeKubeClient.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(context.TODO(), c.expected.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("Expected no error when getting the applied configuration: %v", err)
+			}
+			if !equality.Semantic.DeepEqual(stored.Webhooks, c.expected.Webhooks) {
+				t.Errorf("Expect the desired webhooks to be stored, %v", diff.ObjectDiff(stored.Webhooks, c.expected.Webhooks))
+			}
 		})
 	}
 }
@@ -297,6 +333,30 @@ func TestApplyMutatingWebhookConfiguration(t *testing.T) {
 			existing:      []runtime.Object{newMutatingWebhookConfiguration("test", "svc1", "svc1")},
 			expected:      newMutatingWebhookConfiguration("test", "svc1", "svc1"),
 		},
+		{
+			name:          "skip update with recorded spec hash",
+			expectUpdated: false,
+			existing: []runtime.Object{func() runtime.Object {
+				config := newMutatingWebhookConfiguration("test", "svc1", "svc1")
+				if err := resourceapply.SetSpecHashAnnotation(&config.ObjectMeta, config.Webhooks); err != nil {
+					t.Fatalf("Expected no error when hashing: %v", err)
+				}
+				return config
+			}()},
+			expected: newMutatingWebhookConfiguration("test", "svc1", "svc1"),
+		},
+		{
+			name:          "update when the recorded spec hash differs",
+			expectUpdated: true,
+			existing: []runtime.Object{func() runtime.Object {
+				config := newMutatingWebhookConfiguration("test", "svc1", "svc1")
+				if err := resourceapply.SetSpecHashAnnotation(&config.ObjectMeta, config.Webhooks); err != nil {
+					t.Fatalf("Expected no error when hashing: %v", err)
+				}
+				return config
+			}()},
+			expected: newMutatingWebhookConfiguration("test", "svc2", "svc2"),
+		},
 	}
 
 	for _, c := range testcase {
@@ -310,6 +370,14 @@ func TestApplyMutatingWebhookConfiguration(t *testing.T) {
 			if updated != c.expectUpdated {
 				t.Errorf("Expect update is %t, but got %t", c.expectUpdated, updated)
 			}
+
+			stored, err := fakeKubeClient.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(), c.expected.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("Expected no error when getting the applied configuration: %v", err)
+			}
+			if !equality.Semantic.DeepEqual(stored.Webhooks, c.expected.Webhooks) {
+				t.Errorf("Expect the desired webhooks to be stored, %v", diff.ObjectDiff(stored.Webhooks, c.expected.Webhooks))
+			}
 		})
 	}
 }
@@ -376,6 +444,63 @@ func TestApplyDirectly(t *testing.T) {
 	}
 }
 
+func TestApplyDirectlyAppliesNamespacesFirst(t *testing.T) {
+	applyFiles := map[string]runtime.Object{
+		"namespace": newUnstructured("v1", "Namespace", "", "ns1", map[string]interface{}{}),
+	}
+	applyFileNames := []string{}
+	// Enough namespaced resources to keep all workers busy, with the namespace
+	// deliberately listed last to prove ordering does not depend on its position.
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("secret-%d", i)
+		applyFiles[name] = newUnstructured("v1", "Secret", "ns1", name, map[string]interface{}{"data": map[string]interface{}{"key1": []byte("key1")}})
+		applyFileNames = append(applyFileNames, name)
+	}
+	applyFileNames = append(applyFileNames, "namespace")
+
+	fakeKubeClient := fakekube.NewSimpleClientset()
+	fakeResgistrationClient := fakeapiregistration.NewSimpleClientset()
+	fakeExtensionClient := fakeapiextensions.NewSimpleClientset()
+	results := ApplyDirectly(
+		fakeKubeClient, fakeExtensionClient, fakeResgistrationClient.ApiregistrationV1(),
+		eventstesting.NewTestingEventRecorder(t),
+		func(name string) ([]byte, error) {
+			if applyFiles[name] == nil {
+				return nil, fmt.Errorf("Failed to find file")
+			}
+
+			return json.Marshal(applyFiles[name])
+		},
+		applyFileNames...,
+	)
+
+	for index, r := range results {
+		if r.Error != nil {
+			t.Errorf("Expect no apply error, %v", r.Error)
+		}
+		if r.File != applyFileNames[index] {
+			t.Errorf("Expect results in the order of the files, got %q at %d", r.File, index)
+		}
+	}
+
+	namespaceApplied := false
+	for _, action := range fakeKubeClient.Actions() {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		if action.GetResource().Resource == "namespaces" {
+			namespaceApplied = true
+			continue
+		}
+		if !namespaceApplied {
+			t.Fatalf("Expect the namespace to be applied before %s", action.GetResource().Resource)
+		}
+	}
+	if !namespaceApplied {
+		t.Errorf("Expect the namespace to be applied")
+	}
+}
+
 func TestDeleteStaticObject(t *testing.T) {
 	applyFiles := map[string]runtime.Object{
 		"validatingwebhooks": newUnstructured("admissionregistration.k8s.io/v1", "ValidatingWebhookConfiguration", "", "", map[string]interface{}{"webhooks": []interface{}{}}),
@@ -665,7 +790,12 @@ func TestDeterminReplica(t *testing.T) {
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
 			fakeKubeClient := fakekube.NewSimpleClientset(c.existingNodes...)
-			replica := DetermineReplicaByNodes(context.Background(), fakeKubeClient)
+			kubeInformers := informers.NewSharedInformerFactory(fakeKubeClient, 5*time.Minute)
+			nodeStore := kubeInformers.Core().V1().Nodes().Informer().GetStore()
+			for _, node := range c.existingNodes {
+				nodeStore.Add(node)
+			}
+			replica := DetermineReplicaByNodes(kubeInformers.Core().V1().Nodes().Lister())
 			if replica != c.expectedReplica {
 				t.Errorf("Unexpected replica, actual: %d, expected: %d", replica, c.expectedReplica)
 			}
@@ -693,6 +823,11 @@ func newDeploymentUnstructured(name, namespace string) *unstructured.Unstructure
 						{
 							"name":  "hub-registration-controller",
 							"image": "quay.io/open-cluster-management/registration:latest",
+							"livenessProbe": map[string]interface{}{
+								"timeoutSeconds":   int64(1),
+								"periodSeconds":    int64(10),
+								"failureThreshold": int64(3),
+							},
 						},
 					},
 				}}}}
@@ -702,11 +837,14 @@ func newDeploymentUnstructured(name, namespace string) *unstructured.Unstructure
 
 func TestApplyDeployment(t *testing.T) {
 	testcases := []struct {
-		name                string
-		deploymentName      string
-		deploymentNamespace string
-		nodePlacement       operatorapiv1.NodePlacement
-		expectErr           bool
+		name                 string
+		deploymentName       string
+		deploymentNamespace  string
+		nodePlacement        operatorapiv1.NodePlacement
+		runtimeClassName     string
+		probeConfiguration   *operatorapiv1.ProbeConfiguration
+		rolloutConfiguration *operatorapiv1.RolloutConfiguration
+		expectErr            bool
 	}{
 		{
 			name:                "Apply a deployment without nodePlacement",
@@ -730,13 +868,41 @@ func TestApplyDeployment(t *testing.T) {
 			},
 			expectErr: false,
 		},
+		{
+			name:                "Apply a deployment with runtimeClassName",
+			deploymentName:      "cluster-manager-registration-controller",
+			deploymentNamespace: "open-cluster-management-hub",
+			runtimeClassName:    "kata",
+			expectErr:           false,
+		},
+		{
+			name:                "Apply a deployment with probe overrides",
+			deploymentName:      "cluster-manager-registration-controller",
+			deploymentNamespace: "open-cluster-management-hub",
+			probeConfiguration: &operatorapiv1.ProbeConfiguration{
+				TimeoutSeconds:   30,
+				PeriodSeconds:    60,
+				FailureThreshold: 5,
+			},
+			expectErr: false,
+		},
+		{
+			name:                "Apply a deployment with rollout overrides",
+			deploymentName:      "cluster-manager-registration-controller",
+			deploymentNamespace: "open-cluster-management-hub",
+			rolloutConfiguration: &operatorapiv1.RolloutConfiguration{
+				MinReadySeconds:         15,
+				ProgressDeadlineSeconds: 120,
+			},
+			expectErr: false,
+		},
 	}
 
 	for _, c := range testcases {
 		t.Run(c.name, func(t *testing.T) {
 			fakeKubeClient := fakekube.NewSimpleClientset()
 			_, err := ApplyDeployment(
-				fakeKubeClient, []operatorapiv1.GenerationStatus{}, c.nodePlacement,
+				fakeKubeClient, []operatorapiv1.GenerationStatus{}, c.nodePlacement, c.runtimeClassName, c.probeConfiguration, c.rolloutConfiguration,
 				func(name string) ([]byte, error) {
 					return json.Marshal(newDeploymentUnstructured(c.deploymentName, c.deploymentNamespace))
 				},
@@ -755,8 +921,397 @@ func TestApplyDeployment(t *testing.T) {
 			if !reflect.DeepEqual(deployment.Spec.Template.Spec.NodeSelector, c.nodePlacement.NodeSelector) {
 				t.Errorf("Expect nodeSelector %v, got %v", c.nodePlacement.NodeSelector, deployment.Spec.Template.Spec.NodeSelector)
 			}
-			if !reflect.DeepEqual(deployment.Spec.Template.Spec.Tolerations, c.nodePlacement.Tolerations) {
-				t.Errorf("Expect Tolerations %v, got %v", c.nodePlacement.Tolerations, deployment.Spec.Template.Spec.Tolerations)
+			tolerationSeconds := defaultNodeFailureTolerationSeconds
+			expectedTolerations := append([]corev1.Toleration{}, c.nodePlacement.Tolerations...)
+			for _, key := range []string{corev1.TaintNodeNotReady, corev1.TaintNodeUnreachable} {
+				expectedTolerations = append(expectedTolerations, corev1.Toleration{
+					Key:               key,
+					Operator:          corev1.TolerationOpExists,
+					Effect:            corev1.TaintEffectNoExecute,
+					TolerationSeconds: &tolerationSeconds,
+				})
+			}
+			if !reflect.DeepEqual(deployment.Spec.Template.Spec.Tolerations, expectedTolerations) {
+				t.Errorf("Expect Tolerations %v, got %v", expectedTolerations, deployment.Spec.Template.Spec.Tolerations)
+			}
+			runtimeClassName := ""
+			if deployment.Spec.Template.Spec.RuntimeClassName != nil {
+				runtimeClassName = *deployment.Spec.Template.Spec.RuntimeClassName
+			}
+			if runtimeClassName != c.runtimeClassName {
+				t.Errorf("Expect runtimeClassName %q, got %q", c.runtimeClassName, runtimeClassName)
+			}
+			if c.probeConfiguration != nil {
+				probe := deployment.Spec.Template.Spec.Containers[0].LivenessProbe
+				if probe.TimeoutSeconds != c.probeConfiguration.TimeoutSeconds ||
+					probe.PeriodSeconds != c.probeConfiguration.PeriodSeconds ||
+					probe.FailureThreshold != c.probeConfiguration.FailureThreshold {
+					t.Errorf("Expect the liveness probe timings to be overridden, got %v", probe)
+				}
+			}
+			if c.rolloutConfiguration != nil {
+				if deployment.Spec.MinReadySeconds != c.rolloutConfiguration.MinReadySeconds {
+					t.Errorf("Expect minReadySeconds %d, got %d", c.rolloutConfiguration.MinReadySeconds, deployment.Spec.MinReadySeconds)
+				}
+				if deployment.Spec.ProgressDeadlineSeconds == nil || *deployment.Spec.ProgressDeadlineSeconds != c.rolloutConfiguration.ProgressDeadlineSeconds {
+					t.Errorf("Expect progressDeadlineSeconds %d, got %v", c.rolloutConfiguration.ProgressDeadlineSeconds, deployment.Spec.ProgressDeadlineSeconds)
+				}
+			}
+		})
+	}
+}
+
+func TestEnsureNodeFailureTolerations(t *testing.T) {
+	tolerationSeconds := func(seconds int64) *int64 { return &seconds }
+	deployment := func(tolerations ...corev1.Toleration) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			Spec: appsv1.DeploymentSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{Tolerations: tolerations},
+				},
+			},
+		}
+	}
+
+	cases := []struct {
+		name                string
+		deployment          *appsv1.Deployment
+		expectedTolerations []corev1.Toleration
+	}{
+		{
+			name:       "defaults are added for both node failure taints",
+			deployment: deployment(),
+			expectedTolerations: []corev1.Toleration{
+				{Key: corev1.TaintNodeNotReady, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute, TolerationSeconds: tolerationSeconds(defaultNodeFailureTolerationSeconds)},
+				{Key: corev1.TaintNodeUnreachable, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute, TolerationSeconds: tolerationSeconds(defaultNodeFailureTolerationSeconds)},
+			},
+		},
+		{
+			name: "user toleration suppresses the default for its key only",
+			deployment: deployment(corev1.Toleration{
+				Key:               corev1.TaintNodeUnreachable,
+				Operator:          corev1.TolerationOpExists,
+				Effect:            corev1.TaintEffectNoExecute,
+				TolerationSeconds: tolerationSeconds(600),
+			}),
+			expectedTolerations: []corev1.Toleration{
+				{Key: corev1.TaintNodeUnreachable, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute, TolerationSeconds: tolerationSeconds(600)},
+				{Key: corev1.TaintNodeNotReady, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute, TolerationSeconds: tolerationSeconds(defaultNodeFailureTolerationSeconds)},
+			},
+		},
+		{
+			name:       "tolerate-everything toleration suppresses both defaults",
+			deployment: deployment(corev1.Toleration{Operator: corev1.TolerationOpExists}),
+			expectedTolerations: []corev1.Toleration{
+				{Operator: corev1.TolerationOpExists},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ensureNodeFailureTolerations(c.deployment)
+			if tolerations := c.deployment.Spec.Template.Spec.Tolerations; !reflect.DeepEqual(tolerations, c.expectedTolerations) {
+				t.Errorf("Expect tolerations %v, got %v", c.expectedTolerations, tolerations)
+			}
+		})
+	}
+}
+
+func TestEnsureZoneAntiAffinity(t *testing.T) {
+	replicas := func(count int32) *int32 { return &count }
+	antiAffinity := func(topologyKeys ...string) *corev1.Affinity {
+		affinity := &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{}}
+		for _, topologyKey := range topologyKeys {
+			affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+				affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution,
+				corev1.WeightedPodAffinityTerm{
+					Weight:          70,
+					PodAffinityTerm: corev1.PodAffinityTerm{TopologyKey: topologyKey},
+				})
+		}
+		return affinity
+	}
+
+	cases := []struct {
+		name                 string
+		deployment           *appsv1.Deployment
+		expectedTopologyKeys []string
+	}{
+		{
+			name: "single replica deployment is left alone",
+			deployment: &appsv1.Deployment{
+				Spec: appsv1.DeploymentSpec{
+					Replicas: replicas(1),
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{Affinity: antiAffinity(corev1.LabelFailureDomainBetaZone)},
+					},
+				},
+			},
+			expectedTopologyKeys: []string{corev1.LabelFailureDomainBetaZone},
+		},
+		{
+			name: "deprecated zone key is rewritten",
+			deployment: &appsv1.Deployment{
+				Spec: appsv1.DeploymentSpec{
+					Replicas: replicas(3),
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{Affinity: antiAffinity(corev1.LabelFailureDomainBetaZone, corev1.LabelHostname)},
+					},
+				},
+			},
+			expectedTopologyKeys: []string{corev1.LabelTopologyZone, corev1.LabelHostname},
+		},
+		{
+			name: "zone term is added when missing",
+			deployment: &appsv1.Deployment{
+				Spec: appsv1.DeploymentSpec{
+					Replicas: replicas(3),
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "clustermanager-registration-controller"}},
+				},
+			},
+			expectedTopologyKeys: []string{corev1.LabelTopologyZone},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ensureZoneAntiAffinity(c.deployment)
+			topologyKeys := []string{}
+			if affinity := c.deployment.Spec.Template.Spec.Affinity; affinity != nil && affinity.PodAntiAffinity != nil {
+				for _, term := range affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+					topologyKeys = append(topologyKeys, term.PodAffinityTerm.TopologyKey)
+				}
+			}
+			if !reflect.DeepEqual(topologyKeys, c.expectedTopologyKeys) {
+				t.Errorf("Expect topology keys %v, got %v", c.expectedTopologyKeys, topologyKeys)
+			}
+		})
+	}
+}
+
+func TestStatusSummary(t *testing.T) {
+	cases := []struct {
+		name            string
+		conditions      []metav1.Condition
+		expectedSummary string
+	}{
+		{
+			name: "degraded condition wins",
+			conditions: []metav1.Condition{
+				{Type: "Applied", Status: metav1.ConditionTrue},
+				{Type: "HubConnectionDegraded", Status: metav1.ConditionTrue},
+			},
+			expectedSummary: StatusSummaryDegraded,
+		},
+		{
+			name: "progressing until applied",
+			conditions: []metav1.Condition{
+				{Type: "Applied", Status: metav1.ConditionFalse},
+				{Type: "HubConnectionDegraded", Status: metav1.ConditionFalse},
+			},
+			expectedSummary: StatusSummaryProgressing,
+		},
+		{
+			name: "available when applied and nothing degraded",
+			conditions: []metav1.Condition{
+				{Type: "Applied", Status: metav1.ConditionTrue},
+				{Type: "HubKubeConfigExpiring", Status: metav1.ConditionTrue},
+			},
+			expectedSummary: StatusSummaryAvailable,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if summary := StatusSummary(c.conditions); summary != c.expectedSummary {
+				t.Errorf("Expect summary %q, got %q", c.expectedSummary, summary)
+			}
+		})
+	}
+}
+
+func TestApplyImageMirrors(t *testing.T) {
+	cases := []struct {
+		name           string
+		pairs          []string
+		image          string
+		expectedImage  string
+		expectParseErr bool
+	}{
+		{
+			name:          "no mirrors leave the image unchanged",
+			pairs:         []string{},
+			image:         "quay.io/open-cluster-management/registration:v0.5.0",
+			expectedImage: "quay.io/open-cluster-management/registration:v0.5.0",
+		},
+		{
+			name:          "registry prefix is redirected",
+			pairs:         []string{"quay.io=registry.example.com:5000"},
+			image:         "quay.io/open-cluster-management/registration:v0.5.0",
+			expectedImage: "registry.example.com:5000/open-cluster-management/registration:v0.5.0",
+		},
+		{
+			name: "longest matching source prefix wins",
+			pairs: []string{
+				"quay.io=registry.example.com:5000",
+				"quay.io/open-cluster-management=registry.example.com:5000/ocm",
+			},
+			image:         "quay.io/open-cluster-management/registration:v0.5.0",
+			expectedImage: "registry.example.com:5000/ocm/registration:v0.5.0",
+		},
+		{
+			name:          "source only matches on path boundaries",
+			pairs:         []string{"quay.io/open-cluster=registry.example.com:5000/ocm"},
+			image:         "quay.io/open-cluster-management/registration:v0.5.0",
+			expectedImage: "quay.io/open-cluster-management/registration:v0.5.0",
+		},
+		{
+			name:          "full repository source matches before the tag",
+			pairs:         []string{"quay.io/open-cluster-management/registration=registry.example.com:5000/registration"},
+			image:         "quay.io/open-cluster-management/registration:v0.5.0",
+			expectedImage: "registry.example.com:5000/registration:v0.5.0",
+		},
+		{
+			name:           "pair without a mirror is refused",
+			pairs:          []string{"quay.io"},
+			expectParseErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mirrors, err := ParseImageMirrors(c.pairs)
+			if c.expectParseErr {
+				if err == nil {
+					t.Fatalf("Expected a parse error for pairs %v", c.pairs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error when parsing pairs %v: %v", c.pairs, err)
+			}
+			if image := ApplyImageMirrors(mirrors, c.image); image != c.expectedImage {
+				t.Errorf("Expect image %q, got %q", c.expectedImage, image)
+			}
+		})
+	}
+}
+
+func TestMissingOperatorPermissions(t *testing.T) {
+	cases := []struct {
+		name              string
+		allowedResources  map[string]bool
+		permissions       []OperatorPermission
+		expectedMissing   []string
+		expectedCondition metav1.Condition
+	}{
+		{
+			name:             "all permissions held",
+			allowedResources: map[string]bool{"customresourcedefinitions": true, "deployments": true, "secrets": true},
+			permissions:      OperatorRequiredPermissions(),
+			expectedMissing:  []string{},
+			expectedCondition: metav1.Condition{
+				Type:   OperatorPermissionDegraded,
+				Status: metav1.ConditionFalse,
+				Reason: "OperatorPermissionsSufficient",
+			},
+		},
+		{
+			name:             "secrets permissions missing",
+			allowedResources: map[string]bool{"customresourcedefinitions": true, "deployments": true},
+			permissions:      OperatorRequiredPermissions(),
+			expectedMissing:  []string{"get secrets", "create secrets", "update secrets", "delete secrets"},
+			expectedCondition: metav1.Condition{
+				Type:   OperatorPermissionDegraded,
+				Status: metav1.ConditionTrue,
+				Reason: "MissingOperatorPermissions",
+			},
+		},
+		{
+			name:             "grouped resource is reported with its group",
+			allowedResources: map[string]bool{},
+			permissions:      []OperatorPermission{{Group: "apps", Resource: "deployments", Verb: "get"}},
+			expectedMissing:  []string{"get deployments.apps"},
+			expectedCondition: metav1.Condition{
+				Type:   OperatorPermissionDegraded,
+				Status: metav1.ConditionTrue,
+				Reason: "MissingOperatorPermissions",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fakeKubeClient := fakekube.NewSimpleClientset()
+			fakeKubeClient.PrependReactor("create", "selfsubjectaccessreviews",
+				func(action clienttesting.Action) (bool, runtime.Object, error) {
+					review := action.(clienttesting.CreateActionImpl).Object.(*authorizationv1.SelfSubjectAccessReview)
+					review = review.DeepCopy()
+					review.Status.Allowed = c.allowedResources[review.Spec.ResourceAttributes.Resource]
+					return true, review, nil
+				})
+
+			missing, err := MissingOperatorPermissions(context.TODO(), fakeKubeClient, c.permissions)
+			if err != nil {
+				t.Fatalf("Expected no error when checking permissions: %v", err)
+			}
+			if !reflect.DeepEqual(missing, c.expectedMissing) {
+				t.Errorf("Expect missing permissions %v, got %v", c.expectedMissing, missing)
+			}
+
+			condition := OperatorPermissionCondition(context.TODO(), func(ctx context.Context) ([]string, error) {
+				return missing, nil
+			})
+			if condition.Type != c.expectedCondition.Type ||
+				condition.Status != c.expectedCondition.Status ||
+				condition.Reason != c.expectedCondition.Reason {
+				t.Errorf("Expect condition %v/%v/%v, got %v/%v/%v",
+					c.expectedCondition.Type, c.expectedCondition.Status, c.expectedCondition.Reason,
+					condition.Type, condition.Status, condition.Reason)
+			}
+		})
+	}
+}
+
+func TestAPIGroupVersionSupported(t *testing.T) {
+	cases := []struct {
+		name         string
+		served       []*metav1.APIResourceList
+		groupVersion string
+		expected     bool
+	}{
+		{
+			name:         "group version served",
+			served:       []*metav1.APIResourceList{{GroupVersion: "v1"}, {GroupVersion: "policy/v1"}},
+			groupVersion: "policy/v1",
+			expected:     true,
+		},
+		{
+			name:         "group served with another version",
+			served:       []*metav1.APIResourceList{{GroupVersion: "policy/v1beta1"}},
+			groupVersion: "policy/v1",
+			expected:     false,
+		},
+		{
+			name:         "group not served",
+			served:       []*metav1.APIResourceList{{GroupVersion: "v1"}},
+			groupVersion: "apiextensions.k8s.io/v1",
+			expected:     false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fakeKubeClient := fakekube.NewSimpleClientset()
+			fakeKubeClient.Resources = c.served
+
+			supported, err := APIGroupVersionSupported(fakeKubeClient.Discovery(), c.groupVersion)
+			if err != nil {
+				t.Fatalf("Expected no error when checking group version: %v", err)
+			}
+			if supported != c.expected {
+				t.Errorf("Expect group version %q supported to be %v, got %v", c.groupVersion, c.expected, supported)
 			}
 		})
 	}
@@ -3,9 +3,13 @@ package helpers
 import (
 	"strings"
 
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
 
 	"github.com/openshift/library-go/pkg/controller/factory"
 
@@ -20,8 +24,17 @@ const (
 	BootstrapHubKubeConfig = "bootstrap-hub-kubeconfig"
 	// HubKubeConfig is the secret name of kubeconfig secret to connect to hub with mtls
 	HubKubeConfig = "hub-kubeconfig-secret"
+	// ExternalManagedKubeConfig is the secret name of the kubeconfig a hosted mode
+	// klusterlet reaches its managed cluster with
+	ExternalManagedKubeConfig = "external-managed-kubeconfig"
 	// ClusterManagerNamespace is the namespace to deploy cluster manager components
 	ClusterManagerNamespace = "open-cluster-management-hub"
+	// ImagePullSecret is the secret name of the image pull credentials the operator
+	// distributes from its own namespace into every namespace it creates
+	ImagePullSecret = "open-cluster-management-image-pull-credentials"
+	// BackupLabel marks the resources a velero based backup of the cluster should
+	// include, so registration can be recovered on a restored hub
+	BackupLabel = "cluster.open-cluster-management.io/backup"
 
 	RegistrationWebhookSecret  = "registration-webhook-serving-cert"
 	RegistrationWebhookService = "cluster-manager-registration-webhook"
@@ -34,20 +47,18 @@ func KlusterletSecretQueueKeyFunc(klusterletLister operatorlister.KlusterletList
 		accessor, _ := meta.Accessor(obj)
 		namespace := accessor.GetNamespace()
 		name := accessor.GetName()
-		interestedObjectFound := false
-		if name == HubKubeConfig || name == BootstrapHubKubeConfig {
-			interestedObjectFound = true
-		}
-		if !interestedObjectFound {
-			return ""
-		}
 
 		klusterlets, err := klusterletLister.List(labels.Everything())
 		if err != nil {
 			return ""
 		}
 
-		if klusterlet := FindKlusterletByNamespace(klusterlets, namespace); klusterlet != nil {
+		klusterlet := FindKlusterletByNamespace(klusterlets, namespace)
+		if klusterlet == nil {
+			return ""
+		}
+
+		if name == BootstrapHubKubeConfig || name == HubKubeConfigSecretName(klusterlet) {
 			return klusterlet.Name
 		}
 
@@ -55,6 +66,16 @@ func KlusterletSecretQueueKeyFunc(klusterletLister operatorlister.KlusterletList
 	}
 }
 
+// HubKubeConfigSecretName returns the name of the hub kubeconfig secret in the agent
+// namespace of the given klusterlet. The default name can be overridden in spec for
+// credential tooling that owns the secret naming.
+func HubKubeConfigSecretName(klusterlet *operatorapiv1.Klusterlet) string {
+	if klusterlet.Spec.HubKubeConfigSecret != "" {
+		return klusterlet.Spec.HubKubeConfigSecret
+	}
+	return HubKubeConfig
+}
+
 func KlusterletDeploymentQueueKeyFunc(klusterletLister operatorlister.KlusterletLister) factory.ObjectQueueKeyFunc {
 	return func(obj runtime.Object) string {
 		accessor, _ := meta.Accessor(obj)
@@ -87,10 +108,8 @@ func ClusterManagerDeploymentQueueKeyFunc(clusterManagerLister operatorlister.Cl
 		namespace := accessor.GetNamespace()
 		name := accessor.GetName()
 		interestedObjectFound := false
-		if namespace != ClusterManagerNamespace {
-			return ""
-		}
-		if strings.HasSuffix(name, "registration-controller") || strings.HasSuffix(name, "work-controller") || strings.HasSuffix(name, "placement-controller") {
+		if strings.HasSuffix(name, "registration-controller") || strings.HasSuffix(name, "work-controller") ||
+			strings.HasSuffix(name, "placement-controller") || strings.HasSuffix(name, "addon-manager-controller") {
 			interestedObjectFound = true
 		}
 		if !interestedObjectFound {
@@ -103,7 +122,9 @@ func ClusterManagerDeploymentQueueKeyFunc(clusterManagerLister operatorlister.Cl
 		}
 
 		for _, clustermanager := range clustermanagers {
-			return clustermanager.Name
+			if namespace == ClusterManagerDeployNamespace(clustermanager) {
+				return clustermanager.Name
+			}
 		}
 
 		return ""
@@ -112,26 +133,66 @@ func ClusterManagerDeploymentQueueKeyFunc(clusterManagerLister operatorlister.Cl
 
 func ClusterManagerConfigmapQueueKeyFunc(clusterManagerLister operatorlister.ClusterManagerLister) factory.ObjectQueueKeyFunc {
 	return func(obj runtime.Object) string {
+		accessor, _ := meta.Accessor(obj)
+		namespace := accessor.GetNamespace()
+
 		clustermanagers, err := clusterManagerLister.List(labels.Everything())
 		if err != nil {
 			return ""
 		}
 
+		// Several clustermanagers can coexist, each with its own deploy namespace,
+		// so the configmap is attributed to the instance owning its namespace.
 		for _, clustermanager := range clustermanagers {
-			return clustermanager.Name
+			if namespace == ClusterManagerDeployNamespace(clustermanager) {
+				return clustermanager.Name
+			}
 		}
 
 		return ""
 	}
 }
 
+// DeploymentQueueEventHandler returns an informer event handler that enqueues the key
+// computed by queueKeyFn on the given queue. Updates that modified only the deployment
+// status are dropped, so an agent pod status flap does not trigger a full reconcile of
+// the owning custom resource.
+func DeploymentQueueEventHandler(queue workqueue.RateLimitingInterface, queueKeyFn factory.ObjectQueueKeyFunc) cache.ResourceEventHandler {
+	enqueue := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		if runtimeObj, ok := obj.(runtime.Object); ok {
+			queue.Add(queueKeyFn(runtimeObj))
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: enqueue,
+		UpdateFunc: func(old, new interface{}) {
+			oldDeployment, oldOk := old.(*appsv1.Deployment)
+			newDeployment, newOk := new.(*appsv1.Deployment)
+			if oldOk && newOk && deploymentStatusOnlyChanged(oldDeployment, newDeployment) {
+				return
+			}
+			enqueue(new)
+		},
+		DeleteFunc: enqueue,
+	}
+}
+
+// deploymentStatusOnlyChanged returns true when an update of a deployment left its
+// spec and metadata untouched. Spec changes bump the generation, so only the metadata
+// the operator manages needs a direct comparison.
+func deploymentStatusOnlyChanged(old, new *appsv1.Deployment) bool {
+	return old.Generation == new.Generation &&
+		old.DeletionTimestamp.Equal(new.DeletionTimestamp) &&
+		equality.Semantic.DeepEqual(old.Labels, new.Labels) &&
+		equality.Semantic.DeepEqual(old.Annotations, new.Annotations)
+}
+
 func FindKlusterletByNamespace(klusterlets []*operatorapiv1.Klusterlet, namespace string) *operatorapiv1.Klusterlet {
 	for _, klusterlet := range klusterlets {
-		klusterletNS := klusterlet.Spec.Namespace
-		if klusterletNS == "" {
-			klusterletNS = KlusterletDefaultNamespace
-		}
-		if namespace == klusterletNS {
+		if namespace == KlusterletAgentNamespace(klusterlet) {
 			return klusterlet
 		}
 	}
@@ -0,0 +1,53 @@
+package helpers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// RenderCache caches manifests rendered from the embedded templates, keyed by the
+// template name and a hash of the template config. The operator renders the same
+// templates with an unchanged config on every resync, so the cache lets steady-state
+// reconciles skip the template parsing. A nil cache is valid and renders on every
+// call, which keeps controllers constructed as struct literals in tests working.
+type RenderCache struct {
+	lock    sync.Mutex
+	entries map[string][]byte
+}
+
+// NewRenderCache returns an empty render cache.
+func NewRenderCache() *RenderCache {
+	return &RenderCache{entries: map[string][]byte{}}
+}
+
+// Render returns the manifest rendered from the named template with the given
+// config, reusing the cached result when the same name and config have been
+// rendered before. The config must be a flat value type, as the key is derived
+// from its formatted representation.
+func (c *RenderCache) Render(name string, config interface{}, render func() ([]byte, error)) ([]byte, error) {
+	if c == nil {
+		return render()
+	}
+
+	hasher := fnv.New64a()
+	fmt.Fprintf(hasher, "%#v", config)
+	key := fmt.Sprintf("%s@%x", name, hasher.Sum64())
+
+	c.lock.Lock()
+	data, ok := c.entries[key]
+	c.lock.Unlock()
+	if ok {
+		return data, nil
+	}
+
+	data, err := render()
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	c.entries[key] = data
+	c.lock.Unlock()
+	return data, nil
+}
@@ -0,0 +1,62 @@
+package helpers
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRenderCache(t *testing.T) {
+	type config struct {
+		Name string
+	}
+
+	renderCount := 0
+	render := func() ([]byte, error) {
+		renderCount++
+		return []byte(fmt.Sprintf("rendered %d", renderCount)), nil
+	}
+
+	cache := NewRenderCache()
+	data, err := cache.Render("test.yaml", config{Name: "test"}, render)
+	if err != nil {
+		t.Fatalf("Expected no error when rendering, got %v", err)
+	}
+	if string(data) != "rendered 1" {
+		t.Errorf("Expected rendered data, got %q", string(data))
+	}
+
+	// The same name and config hits the cache.
+	data, err = cache.Render("test.yaml", config{Name: "test"}, render)
+	if err != nil {
+		t.Fatalf("Expected no error when rendering, got %v", err)
+	}
+	if string(data) != "rendered 1" || renderCount != 1 {
+		t.Errorf("Expected the cached data, got %q after %d renders", string(data), renderCount)
+	}
+
+	// A changed config misses the cache.
+	data, err = cache.Render("test.yaml", config{Name: "changed"}, render)
+	if err != nil {
+		t.Fatalf("Expected no error when rendering, got %v", err)
+	}
+	if string(data) != "rendered 2" || renderCount != 2 {
+		t.Errorf("Expected a new render, got %q after %d renders", string(data), renderCount)
+	}
+
+	// A different name with the same config misses the cache.
+	if _, err = cache.Render("other.yaml", config{Name: "changed"}, render); err != nil {
+		t.Fatalf("Expected no error when rendering, got %v", err)
+	}
+	if renderCount != 3 {
+		t.Errorf("Expected a new render, got %d renders", renderCount)
+	}
+
+	// A nil cache renders on every call.
+	var nilCache *RenderCache
+	if _, err = nilCache.Render("test.yaml", config{Name: "test"}, render); err != nil {
+		t.Fatalf("Expected no error when rendering, got %v", err)
+	}
+	if renderCount != 4 {
+		t.Errorf("Expected a new render, got %d renders", renderCount)
+	}
+}
@@ -0,0 +1,62 @@
+package testing
+
+import (
+	"encoding/json"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+// EnableServerSideApplyForDeployments emulates server-side apply of deployments on
+// the fake client, which does not support the apply patch type. The deployment in
+// the patch replaces the existing one, except for fields the patch does not set,
+// e.g. replicas managed by an autoscaler.
+func EnableServerSideApplyForDeployments(client *fakekube.Clientset) {
+	gvr := appsv1.SchemeGroupVersion.WithResource("deployments")
+	client.PrependReactor("patch", "deployments", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		patchAction := action.(clienttesting.PatchActionImpl)
+		if patchAction.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+
+		deployment := &appsv1.Deployment{}
+		if err := json.Unmarshal(patchAction.GetPatch(), deployment); err != nil {
+			return true, nil, err
+		}
+
+		existing, err := client.Tracker().Get(gvr, patchAction.GetNamespace(), patchAction.GetName())
+		switch {
+		case errors.IsNotFound(err):
+			return true, deployment, client.Tracker().Create(gvr, deployment, patchAction.GetNamespace())
+		case err != nil:
+			return true, nil, err
+		}
+
+		if deployment.Spec.Replicas == nil {
+			deployment.Spec.Replicas = existing.(*appsv1.Deployment).Spec.Replicas
+		}
+		deployment.Generation = existing.(*appsv1.Deployment).Generation
+		return true, deployment, client.Tracker().Update(gvr, deployment, patchAction.GetNamespace())
+	})
+}
+
+// AppliedDeployment returns the deployment contained in a server-side apply patch
+// action, or nil when the action is not an apply patch of a deployment.
+func AppliedDeployment(action clienttesting.Action) *appsv1.Deployment {
+	if action.GetVerb() != "patch" || action.GetResource().Resource != "deployments" {
+		return nil
+	}
+	patchAction := action.(clienttesting.PatchActionImpl)
+	if patchAction.GetPatchType() != types.ApplyPatchType {
+		return nil
+	}
+	deployment := &appsv1.Deployment{}
+	if err := json.Unmarshal(patchAction.GetPatch(), deployment); err != nil {
+		return nil
+	}
+	return deployment
+}
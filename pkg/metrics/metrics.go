@@ -0,0 +1,146 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/library-go/pkg/controller/factory"
+
+	"open-cluster-management.io/registration-operator/pkg/health"
+)
+
+var (
+	reconcileMetric = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name: "open_cluster_management_operator_reconcile_total",
+			Help: "The number of reconciles of an operator controller.",
+		},
+		[]string{"controller"},
+	)
+
+	reconcileDurationMetric = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Name:    "open_cluster_management_operator_reconcile_duration_seconds",
+			Help:    "The time a reconcile of an operator controller took.",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30},
+		},
+		[]string{"controller"},
+	)
+
+	reconcileFailureMetric = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name: "open_cluster_management_operator_reconcile_failures_total",
+			Help: "The number of times a reconcile of an operator controller failed.",
+		},
+		[]string{"controller"},
+	)
+
+	conditionMetric = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Name: "open_cluster_management_operator_condition",
+			Help: "The condition states of the operator managed resources. 1 means the condition is true, 0 false and -1 unknown.",
+		},
+		[]string{"kind", "name", "type"},
+	)
+
+	hubKubeConfigExpiryMetric = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Name: "open_cluster_management_operator_hub_kubeconfig_expiry_timestamp_seconds",
+			Help: "The expiry time of the hub kubeconfig client certificate of a klusterlet as a unix timestamp.",
+		},
+		[]string{"klusterlet"},
+	)
+)
+
+func init() {
+	legacyregistry.MustRegister(reconcileMetric)
+	legacyregistry.MustRegister(reconcileDurationMetric)
+	legacyregistry.MustRegister(reconcileFailureMetric)
+	legacyregistry.MustRegister(conditionMetric)
+	legacyregistry.MustRegister(hubKubeConfigExpiryMetric)
+}
+
+// InstrumentSyncer wraps the sync function of a controller to count its reconciles,
+// observe their durations and count their failures under the given controller name.
+func InstrumentSyncer(controller string, sync factory.SyncFunc) factory.SyncFunc {
+	return func(ctx context.Context, syncContext factory.SyncContext) error {
+		startTime := time.Now()
+		err := sync(ctx, syncContext)
+		reconcileMetric.WithLabelValues(controller).Inc()
+		reconcileDurationMetric.WithLabelValues(controller).Observe(time.Since(startTime).Seconds())
+		if err != nil && err != factory.SyntheticRequeueError {
+			reconcileFailureMetric.WithLabelValues(controller).Inc()
+		}
+		return err
+	}
+}
+
+// SetConditions exports the condition states of a resource managed by the operator,
+// so the conditions can be alerted on without scraping the resource itself.
+func SetConditions(kind, name string, conditions []metav1.Condition) {
+	for _, condition := range conditions {
+		value := float64(-1)
+		switch condition.Status {
+		case metav1.ConditionTrue:
+			value = 1
+		case metav1.ConditionFalse:
+			value = 0
+		}
+		conditionMetric.WithLabelValues(kind, name, condition.Type).Set(value)
+	}
+}
+
+// SetHubKubeConfigExpiry exports the expiry time of the hub kubeconfig client
+// certificate of a klusterlet, so alerts can fire before the certificate expires.
+func SetHubKubeConfigExpiry(klusterlet string, notAfter time.Time) {
+	hubKubeConfigExpiryMetric.WithLabelValues(klusterlet).Set(float64(notAfter.Unix()))
+}
+
+// ServeMetrics exposes the operator metrics and health probes on the given address
+// until the context is done. The listener is plain http, since the endpoint is only
+// reachable from inside the cluster.
+func ServeMetrics(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", legacyregistry.Handler())
+	mux.HandleFunc("/healthz", health.HealthzHandler)
+	mux.HandleFunc("/readyz", health.ReadyzHandler)
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.Background())
+	}()
+
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		klog.ErrorS(err, "Failed to serve metrics", "addr", addr)
+	}
+}
+
+// ServePprof exposes the pprof endpoints on the given address until the context is
+// done. The listener is separate from the metrics one and off by default, since the
+// profiles can reveal more than the metrics and heap profiling has a runtime cost.
+func ServePprof(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.Background())
+	}()
+
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		klog.ErrorS(err, "Failed to serve pprof", "addr", addr)
+	}
+}
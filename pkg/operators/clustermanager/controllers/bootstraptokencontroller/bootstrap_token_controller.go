@@ -0,0 +1,203 @@
+package bootstraptokencontroller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/klog/v2"
+
+	operatorinformer "open-cluster-management.io/api/client/operator/informers/externalversions/operator/v1"
+	operatorlister "open-cluster-management.io/api/client/operator/listers/operator/v1"
+	"open-cluster-management.io/registration-operator/pkg/helpers"
+	"open-cluster-management.io/registration-operator/pkg/metrics"
+
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+)
+
+const (
+	// bootstrapTokenNamespaceAnnotation marks a clustermanager for bootstrap token
+	// minting. Its value is the namespace a bootstrap kubeconfig secret is
+	// maintained in, giving fleet-enrollment tooling a supported way to obtain
+	// bootstrap credentials from the operator.
+	bootstrapTokenNamespaceAnnotation = "operator.open-cluster-management.io/bootstrap-token-namespace"
+	// tokenExpirationAnnotation records on the secret when the minted token expires.
+	tokenExpirationAnnotation = "operator.open-cluster-management.io/token-expiration"
+	// bootstrapServiceAccount is the service account the bootstrap tokens are
+	// minted for. Granting it the registration bootstrap permissions is left to the
+	// enrollment tooling owning the designated namespace.
+	bootstrapServiceAccount = "agent-registration-bootstrap"
+	// tokenTTL is how long a minted bootstrap token stays valid. The secret is
+	// renewed once less than half of the TTL is left.
+	tokenTTL = 24 * time.Hour
+)
+
+// bootstrapTokenController maintains a time-limited bootstrap hub kubeconfig secret
+// in the namespace a clustermanager designates via annotation. The kubeconfig
+// combines the hub apiserver endpoint and CA of the operator with a service account
+// token minted through the TokenRequest API.
+type bootstrapTokenController struct {
+	kubeClient           kubernetes.Interface
+	clusterManagerLister operatorlister.ClusterManagerLister
+	apiServerURL         string
+	apiServerCAData      []byte
+}
+
+// NewBootstrapTokenController creates the hub bootstrap token minting controller
+func NewBootstrapTokenController(
+	kubeClient kubernetes.Interface,
+	clusterManagerInformer operatorinformer.ClusterManagerInformer,
+	kubeConfig *rest.Config,
+	recorder events.Recorder) factory.Controller {
+	// The in-cluster config references the CA by file, so fall back to reading it
+	// when the config carries no inline CA data.
+	caData := kubeConfig.CAData
+	if len(caData) == 0 && len(kubeConfig.CAFile) > 0 {
+		if data, err := os.ReadFile(kubeConfig.CAFile); err == nil {
+			caData = data
+		}
+	}
+
+	controller := &bootstrapTokenController{
+		kubeClient:           kubeClient,
+		clusterManagerLister: clusterManagerInformer.Lister(),
+		apiServerURL:         kubeConfig.Host,
+		apiServerCAData:      caData,
+	}
+
+	return factory.New().WithSync(metrics.InstrumentSyncer("BootstrapTokenController", controller.sync)).
+		WithInformersQueueKeyFunc(func(obj runtime.Object) string {
+			accessor, _ := meta.Accessor(obj)
+			return accessor.GetName()
+		}, clusterManagerInformer.Informer()).
+		// The resync renews the tokens, since no event fires when one approaches
+		// its expiration.
+		ResyncEvery(30*time.Minute).
+		ToController("BootstrapTokenController", recorder)
+}
+
+func (b *bootstrapTokenController) sync(ctx context.Context, controllerContext factory.SyncContext) error {
+	clusterManagerName := controllerContext.QueueKey()
+	klog.V(4).InfoS("Reconciling ClusterManager", "controller", "BootstrapTokenController", "clustermanager", clusterManagerName)
+
+	// The periodic resync enqueues the default queue key, re-enqueue every
+	// clustermanager so their bootstrap tokens are renewed before they expire.
+	if clusterManagerName == factory.DefaultQueueKey {
+		clusterManagers, err := b.clusterManagerLister.List(labels.Everything())
+		if err != nil {
+			return err
+		}
+		for _, clusterManager := range clusterManagers {
+			controllerContext.Queue().Add(clusterManager.Name)
+		}
+		return nil
+	}
+
+	clusterManager, err := b.clusterManagerLister.Get(clusterManagerName)
+	// ClusterManager not found, could have been deleted, do nothing.
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Token minting is opt-in per clustermanager via the namespace annotation.
+	namespace := clusterManager.Annotations[bootstrapTokenNamespaceAnnotation]
+	if len(namespace) == 0 {
+		return nil
+	}
+
+	secret, err := b.kubeClient.CoreV1().Secrets(namespace).Get(ctx, helpers.BootstrapHubKubeConfig, metav1.GetOptions{})
+	switch {
+	case err == nil:
+		// Keep the current token as long as more than half of its TTL is left, so
+		// kubeconfigs handed out to enrollment tooling stay stable.
+		if expiration, parseErr := time.Parse(time.RFC3339, secret.Annotations[tokenExpirationAnnotation]); parseErr == nil &&
+			time.Until(expiration) > tokenTTL/2 {
+			return nil
+		}
+	case !errors.IsNotFound(err):
+		return err
+	}
+
+	if err := b.ensureServiceAccount(ctx, namespace); err != nil {
+		return err
+	}
+
+	expirationSeconds := int64(tokenTTL / time.Second)
+	tokenRequest, err := b.kubeClient.CoreV1().ServiceAccounts(namespace).CreateToken(ctx, bootstrapServiceAccount,
+		&authenticationv1.TokenRequest{
+			Spec: authenticationv1.TokenRequestSpec{ExpirationSeconds: &expirationSeconds},
+		}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to mint a token for service account %q %q: %v", namespace, bootstrapServiceAccount, err)
+	}
+
+	kubeconfigData, err := clientcmd.Write(clientcmdapi.Config{
+		Clusters: map[string]*clientcmdapi.Cluster{"hub": {
+			Server:                   b.apiServerURL,
+			CertificateAuthorityData: b.apiServerCAData,
+		}},
+		AuthInfos:      map[string]*clientcmdapi.AuthInfo{"bootstrap": {Token: tokenRequest.Status.Token}},
+		Contexts:       map[string]*clientcmdapi.Context{"bootstrap": {Cluster: "hub", AuthInfo: "bootstrap"}},
+		CurrentContext: "bootstrap",
+	})
+	if err != nil {
+		return err
+	}
+
+	_, _, err = resourceapply.ApplySecret(b.kubeClient.CoreV1(), controllerContext.Recorder(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      helpers.BootstrapHubKubeConfig,
+			Labels:    map[string]string{helpers.BackupLabel: "true"},
+			Annotations: map[string]string{
+				tokenExpirationAnnotation: tokenRequest.Status.ExpirationTimestamp.Format(time.RFC3339),
+			},
+		},
+		Data: map[string][]byte{"kubeconfig": kubeconfigData},
+	})
+	if err != nil {
+		return err
+	}
+
+	controllerContext.Recorder().Eventf("BootstrapTokenMinted",
+		"minted a bootstrap kubeconfig secret %s/%s expiring at %s", namespace, helpers.BootstrapHubKubeConfig,
+		tokenRequest.Status.ExpirationTimestamp.Format(time.RFC3339))
+	return nil
+}
+
+// ensureServiceAccount creates the service account the bootstrap tokens are minted
+// for, if it does not exist yet.
+func (b *bootstrapTokenController) ensureServiceAccount(ctx context.Context, namespace string) error {
+	_, err := b.kubeClient.CoreV1().ServiceAccounts(namespace).Get(ctx, bootstrapServiceAccount, metav1.GetOptions{})
+	if !errors.IsNotFound(err) {
+		return err
+	}
+
+	_, err = b.kubeClient.CoreV1().ServiceAccounts(namespace).Create(ctx, &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      bootstrapServiceAccount,
+		},
+	}, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,166 @@
+package bootstraptokencontroller
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	fakeoperatorclient "open-cluster-management.io/api/client/operator/clientset/versioned/fake"
+	operatorinformers "open-cluster-management.io/api/client/operator/informers/externalversions"
+	operatorapiv1 "open-cluster-management.io/api/operator/v1"
+	"open-cluster-management.io/registration-operator/pkg/helpers"
+	testinghelper "open-cluster-management.io/registration-operator/pkg/helpers/testing"
+)
+
+const testClusterManagerName = "testclustermanager"
+
+func newClusterManager(annotations map[string]string) *operatorapiv1.ClusterManager {
+	return &operatorapiv1.ClusterManager{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        testClusterManagerName,
+			Annotations: annotations,
+		},
+	}
+}
+
+func newTokenSecret(expiration time.Time) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      helpers.BootstrapHubKubeConfig,
+			Namespace: "fleet-bootstrap",
+			Annotations: map[string]string{
+				tokenExpirationAnnotation: expiration.Format(time.RFC3339),
+			},
+		},
+		Data: map[string][]byte{"kubeconfig": []byte("kubeconfig")},
+	}
+}
+
+func newTestController(clusterManager *operatorapiv1.ClusterManager, objects ...runtime.Object) (*bootstrapTokenController, *fakekube.Clientset) {
+	fakeKubeClient := fakekube.NewSimpleClientset(objects...)
+	// The fake clientset does not serve the token subresource, emulate the
+	// apiserver minting a token with the requested TTL.
+	fakeKubeClient.PrependReactor("create", "serviceaccounts",
+		func(action clienttesting.Action) (bool, runtime.Object, error) {
+			if action.GetSubresource() != "token" {
+				return false, nil, nil
+			}
+			return true, &authenticationv1.TokenRequest{
+				Status: authenticationv1.TokenRequestStatus{
+					Token:               "testtoken",
+					ExpirationTimestamp: metav1.NewTime(time.Now().Add(tokenTTL)),
+				},
+			}, nil
+		})
+
+	fakeOperatorClient := fakeoperatorclient.NewSimpleClientset(clusterManager)
+	operatorInformers := operatorinformers.NewSharedInformerFactory(fakeOperatorClient, 5*time.Minute)
+	operatorInformers.Operator().V1().ClusterManagers().Informer().GetStore().Add(clusterManager)
+
+	controller := &bootstrapTokenController{
+		kubeClient:           fakeKubeClient,
+		clusterManagerLister: operatorInformers.Operator().V1().ClusterManagers().Lister(),
+		apiServerURL:         "https://testhost:443",
+		apiServerCAData:      []byte("testca"),
+	}
+	return controller, fakeKubeClient
+}
+
+func TestSyncWithoutAnnotation(t *testing.T) {
+	controller, fakeKubeClient := newTestController(newClusterManager(nil))
+
+	syncContext := testinghelper.NewFakeSyncContext(t, testClusterManagerName)
+	if err := controller.sync(context.TODO(), syncContext); err != nil {
+		t.Fatalf("Expected no error when sync: %v", err)
+	}
+	testinghelper.AssertEqualNumber(t, len(fakeKubeClient.Actions()), 0)
+}
+
+func TestSyncMintsToken(t *testing.T) {
+	controller, fakeKubeClient := newTestController(newClusterManager(map[string]string{
+		bootstrapTokenNamespaceAnnotation: "fleet-bootstrap",
+	}))
+
+	syncContext := testinghelper.NewFakeSyncContext(t, testClusterManagerName)
+	if err := controller.sync(context.TODO(), syncContext); err != nil {
+		t.Fatalf("Expected no error when sync: %v", err)
+	}
+
+	var secret *corev1.Secret
+	for _, action := range fakeKubeClient.Actions() {
+		if action.GetVerb() == "create" && action.GetResource().Resource == "secrets" {
+			secret = action.(clienttesting.CreateActionImpl).Object.(*corev1.Secret)
+		}
+	}
+	if secret == nil {
+		t.Fatalf("Expected the bootstrap kubeconfig secret to be created")
+	}
+	if secret.Name != helpers.BootstrapHubKubeConfig || secret.Namespace != "fleet-bootstrap" {
+		t.Errorf("Expected secret fleet-bootstrap/%s, got %s/%s", helpers.BootstrapHubKubeConfig, secret.Namespace, secret.Name)
+	}
+	if _, err := time.Parse(time.RFC3339, secret.Annotations[tokenExpirationAnnotation]); err != nil {
+		t.Errorf("Expected a valid expiration annotation, got %q", secret.Annotations[tokenExpirationAnnotation])
+	}
+
+	kubeconfig := string(secret.Data["kubeconfig"])
+	if !strings.Contains(kubeconfig, "server: https://testhost:443") {
+		t.Errorf("Expected the hub apiserver in the kubeconfig, got %q", kubeconfig)
+	}
+	if !strings.Contains(kubeconfig, base64.StdEncoding.EncodeToString([]byte("testca"))) {
+		t.Errorf("Expected the hub CA in the kubeconfig, got %q", kubeconfig)
+	}
+	if !strings.Contains(kubeconfig, "token: testtoken") {
+		t.Errorf("Expected the minted token in the kubeconfig, got %q", kubeconfig)
+	}
+}
+
+func TestSyncTokenRenewal(t *testing.T) {
+	cases := []struct {
+		name          string
+		expiration    time.Time
+		expectRenewal bool
+	}{
+		{
+			name:       "token still valid",
+			expiration: time.Now().Add(tokenTTL - time.Hour),
+		},
+		{
+			name:          "token close to expiration",
+			expiration:    time.Now().Add(time.Hour),
+			expectRenewal: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			controller, fakeKubeClient := newTestController(newClusterManager(map[string]string{
+				bootstrapTokenNamespaceAnnotation: "fleet-bootstrap",
+			}), newTokenSecret(c.expiration))
+
+			syncContext := testinghelper.NewFakeSyncContext(t, testClusterManagerName)
+			if err := controller.sync(context.TODO(), syncContext); err != nil {
+				t.Fatalf("Expected no error when sync: %v", err)
+			}
+
+			// ApplySecret replaces a changed secret by deleting and recreating it.
+			renewed := false
+			for _, action := range fakeKubeClient.Actions() {
+				if action.GetVerb() == "create" && action.GetResource().Resource == "secrets" {
+					renewed = true
+				}
+			}
+			if renewed != c.expectRenewal {
+				t.Errorf("Expected renewal %v, got %v", c.expectRenewal, renewed)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/crypto"
 	"github.com/openshift/library-go/pkg/operator/events"
 	errorhelpers "github.com/openshift/library-go/pkg/operator/v1helpers"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -17,8 +18,10 @@ import (
 
 	operatorinformer "open-cluster-management.io/api/client/operator/informers/externalversions/operator/v1"
 	operatorlister "open-cluster-management.io/api/client/operator/listers/operator/v1"
+	operatorapiv1 "open-cluster-management.io/api/operator/v1"
 	"open-cluster-management.io/registration-operator/pkg/certrotation"
 	"open-cluster-management.io/registration-operator/pkg/helpers"
+	"open-cluster-management.io/registration-operator/pkg/metrics"
 )
 
 const (
@@ -37,12 +40,12 @@ var ResyncInterval = time.Minute * 5
 
 // certRotationController does:
 //
-// 1) continuously create a self-signed signing CA (via SigningRotation).
-//    It creates the next one when a given percentage of the validity of the old CA has passed.
-// 2) maintain a CA bundle with all not yet expired CA certs.
-// 3) continuously create target cert/key pairs signed by the latest signing CA
-//    It creates the next one when a given percentage of the validity of the previous cert has
-//    passed, or when a new CA has been created.
+//  1. continuously create a self-signed signing CA (via SigningRotation).
+//     It creates the next one when a given percentage of the validity of the old CA has passed.
+//  2. maintain a CA bundle with all not yet expired CA certs.
+//  3. continuously create target cert/key pairs signed by the latest signing CA
+//     It creates the next one when a given percentage of the validity of the previous cert has
+//     passed, or when a new CA has been created.
 type certRotationController struct {
 	signingRotation      certrotation.SigningRotation
 	caBundleRotation     certrotation.CABundleRotation
@@ -104,7 +107,7 @@ func NewCertRotationController(
 	}
 	return factory.New().
 		ResyncEvery(ResyncInterval).
-		WithSync(c.sync).
+		WithSync(metrics.InstrumentSyncer("CertRotationController", c.sync)).
 		WithInformers(
 			secretInformer.Informer(),
 			configMapInformer.Informer(),
@@ -120,40 +123,90 @@ func (c certRotationController) sync(ctx context.Context, syncCtx factory.SyncCo
 		return err
 	}
 	if len(clustermanagers) == 0 {
-		klog.V(4).Infof("No ClusterManager found")
+		klog.V(4).InfoS("No ClusterManager found", "controller", "CertRotationController")
 		return nil
 	}
 
-	klog.Infof("Reconciling ClusterManager %q", clustermanagers[0].Name)
+	// Every clustermanager gets its own signer and serving certs in its deploy
+	// namespace, so several coexisting instances rotate independently.
+	errs := []error{}
+	for _, clustermanager := range clustermanagers {
+		if err := c.syncClusterManager(ctx, clustermanager); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errorhelpers.NewMultiLineAggregate(errs)
+}
+
+func (c certRotationController) syncClusterManager(ctx context.Context, clustermanager *operatorapiv1.ClusterManager) error {
+	klog.InfoS("Reconciling ClusterManager", "controller", "CertRotationController", "clustermanager", clustermanager.Name)
 	// do nothing if the cluster manager is deleting
-	if !clustermanagers[0].DeletionTimestamp.IsZero() {
+	if !clustermanager.DeletionTimestamp.IsZero() {
 		return nil
 	}
 
 	// check if namespace exists or not
-	_, err = c.kubeClient.CoreV1().Namespaces().Get(ctx, helpers.ClusterManagerNamespace, metav1.GetOptions{})
+	deployNamespace := helpers.ClusterManagerDeployNamespace(clustermanager)
+	_, err := c.kubeClient.CoreV1().Namespaces().Get(ctx, deployNamespace, metav1.GetOptions{})
 	if errors.IsNotFound(err) {
-		return fmt.Errorf("namespace %q does not exist yet", helpers.ClusterManagerNamespace)
+		return fmt.Errorf("namespace %q does not exist yet", deployNamespace)
 	}
 	if err != nil {
 		return err
 	}
 
-	// reconcile cert/key pair for signer
-	signingCertKeyPair, err := c.signingRotation.EnsureSigningCertKeyPair()
+	certificateConfiguration := clustermanager.Spec.CertificateConfiguration
+
+	// tune the rotations with the certificate configuration in spec, if any, and point
+	// them at the namespace the hub components are deployed in
+	signingRotation := c.signingRotation
+	signingRotation.Namespace = deployNamespace
+	caBundleRotation := c.caBundleRotation
+	caBundleRotation.Namespace = deployNamespace
+	targetRotations := append([]certrotation.TargetRotation{}, c.targetRotations...)
+	for i := range targetRotations {
+		targetRotations[i].Namespace = deployNamespace
+		switch targetRotations[i].Name {
+		case helpers.RegistrationWebhookSecret:
+			targetRotations[i].HostNames = []string{fmt.Sprintf("%s.%s.svc", helpers.RegistrationWebhookService, deployNamespace)}
+		case helpers.WorkWebhookSecret:
+			targetRotations[i].HostNames = []string{fmt.Sprintf("%s.%s.svc", helpers.WorkWebhookService, deployNamespace)}
+		}
+	}
+	if config := certificateConfiguration; config != nil {
+		if config.SigningCertValidityDays > 0 {
+			signingRotation.Validity = time.Duration(config.SigningCertValidityDays) * 24 * time.Hour
+		}
+		signingRotation.RenewalPercentage = config.RenewalPercentage
+		for i := range targetRotations {
+			if config.ServingCertValidityDays > 0 {
+				targetRotations[i].Validity = time.Duration(config.ServingCertValidityDays) * 24 * time.Hour
+			}
+			targetRotations[i].RenewalPercentage = config.RenewalPercentage
+		}
+	}
+
+	// reconcile cert/key pair for signer. A signing CA brought by the user is used as is
+	// and is not rotated by the operator.
+	var signingCertKeyPair *crypto.CA
+	if certificateConfiguration != nil && len(certificateConfiguration.SigningCASecret) > 0 {
+		signingCertKeyPair, err = signingRotation.EnsureCustomSigningCertKeyPair(certificateConfiguration.SigningCASecret)
+	} else {
+		signingCertKeyPair, err = signingRotation.EnsureSigningCertKeyPair()
+	}
 	if err != nil {
 		return err
 	}
 
 	// reconcile ca bundle
-	cabundleCerts, err := c.caBundleRotation.EnsureConfigMapCABundle(signingCertKeyPair)
+	cabundleCerts, err := caBundleRotation.EnsureConfigMapCABundle(signingCertKeyPair)
 	if err != nil {
 		return err
 	}
 
 	// reconcile target cert/key pairs
 	errs := []error{}
-	for _, targetRotation := range c.targetRotations {
+	for _, targetRotation := range targetRotations {
 		if err := targetRotation.EnsureTargetCertKeyPair(signingCertKeyPair, cabundleCerts); err != nil {
 			errs = append(errs, err)
 		}
@@ -1,11 +1,14 @@
 package certrotationcontroller
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"testing"
 	"time"
 
+	"github.com/openshift/library-go/pkg/crypto"
+
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -40,12 +43,52 @@ func newClusterManager() *operatorapiv1.ClusterManager {
 
 type validateFunc func(t *testing.T, kubeClient kubernetes.Interface, err error)
 
+// newSigningCASecret creates a secret with a self-signed CA cert/key pair brought by the user
+func newSigningCASecret(name, signerName string) (*corev1.Secret, error) {
+	ca, err := crypto.MakeSelfSignedCAConfigForDuration(signerName, time.Hour*24)
+	if err != nil {
+		return nil, err
+	}
+
+	certBytes := &bytes.Buffer{}
+	keyBytes := &bytes.Buffer{}
+	if err := ca.WriteCertConfig(certBytes, keyBytes); err != nil {
+		return nil, err
+	}
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: helpers.ClusterManagerNamespace,
+			Name:      name,
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			"tls.crt": certBytes.Bytes(),
+			"tls.key": keyBytes.Bytes(),
+		},
+	}, nil
+}
+
 func TestCertRotation(t *testing.T) {
+	customCASecret, err := newSigningCASecret("custom-signer-secret", "custom-signer")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	clusterManagerWithCustomCA := newClusterManager()
+	clusterManagerWithCustomCA.Spec.CertificateConfiguration = &operatorapiv1.CertificateConfiguration{
+		SigningCASecret: "custom-signer-secret",
+	}
+
+	secondClusterManager := newClusterManager()
+	secondClusterManager.Name = "testclustermanager2"
+	secondClusterManager.Spec.Namespace = "open-cluster-management-hub2"
+
 	cases := []struct {
-		name            string
-		clusterManager  *operatorapiv1.ClusterManager
-		existingObjects []runtime.Object
-		validate        validateFunc
+		name                 string
+		clusterManager       *operatorapiv1.ClusterManager
+		secondClusterManager *operatorapiv1.ClusterManager
+		existingObjects      []runtime.Object
+		validate             validateFunc
 	}{
 		{
 			name: "no cluster manager",
@@ -83,16 +126,92 @@ func TestCertRotation(t *testing.T) {
 				assertSecretsExistAndValid(t, kubeClient)
 			},
 		},
+		{
+			name:           "custom signing CA",
+			clusterManager: clusterManagerWithCustomCA,
+			existingObjects: []runtime.Object{
+				&corev1.Namespace{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: helpers.ClusterManagerNamespace,
+					},
+				},
+				customCASecret,
+			},
+			validate: func(t *testing.T, kubeClient kubernetes.Interface, err error) {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				// the user provided CA is used as is, no signer secret is generated
+				_, err = kubeClient.CoreV1().Secrets(helpers.ClusterManagerNamespace).Get(context.Background(), "signer-key-pair-secret", metav1.GetOptions{})
+				if !errors.IsNotFound(err) {
+					t.Fatalf("expected no generated signer secret, got: %v", err)
+				}
+
+				secret, err := kubeClient.CoreV1().Secrets(helpers.ClusterManagerNamespace).Get(context.Background(), "serving-cert-key-pair-secret", metav1.GetOptions{})
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				certificates, err := cert.ParseCertsPEM(secret.Data["tls.crt"])
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if len(certificates) == 0 {
+					t.Fatalf("no certificate found")
+				}
+				if certificates[0].Issuer.CommonName != "custom-signer" {
+					t.Fatalf("expected the serving cert to be signed by the custom CA, got issuer %q", certificates[0].Issuer.CommonName)
+				}
+			},
+		},
+		{
+			name:                 "two cluster managers rotate independently",
+			clusterManager:       newClusterManager(),
+			secondClusterManager: secondClusterManager,
+			existingObjects: []runtime.Object{
+				&corev1.Namespace{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: helpers.ClusterManagerNamespace,
+					},
+				},
+				&corev1.Namespace{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "open-cluster-management-hub2",
+					},
+				},
+			},
+			validate: func(t *testing.T, kubeClient kubernetes.Interface, err error) {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				assertSecretsExistAndValid(t, kubeClient)
+				// the second instance gets its own secrets in its own namespace
+				for _, name := range secretNames {
+					if _, err := kubeClient.CoreV1().Secrets("open-cluster-management-hub2").Get(context.Background(), name, metav1.GetOptions{}); err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+				}
+			},
+		},
 	}
 
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
 			kubeClient := fakekube.NewSimpleClientset(c.existingObjects...)
 			kubeInformer := kubeinformers.NewSharedInformerFactory(kubeClient, 5*time.Minute)
+			secretStore := kubeInformer.Core().V1().Secrets().Informer().GetStore()
+			for _, object := range c.existingObjects {
+				if secret, ok := object.(*corev1.Secret); ok {
+					secretStore.Add(secret)
+				}
+			}
 			clusterManagers := []runtime.Object{}
 			if c.clusterManager != nil {
 				clusterManagers = append(clusterManagers, c.clusterManager)
 			}
+			if c.secondClusterManager != nil {
+				clusterManagers = append(clusterManagers, c.secondClusterManager)
+			}
 			operatorClient := fakeoperatorclient.NewSimpleClientset(clusterManagers...)
 			operatorInformers := operatorinformers.NewSharedInformerFactory(operatorClient, 5*time.Minute)
 			clusterManagerStore := operatorInformers.Operator().V1().ClusterManagers().Informer().GetStore()
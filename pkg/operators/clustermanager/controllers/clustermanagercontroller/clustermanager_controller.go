@@ -4,15 +4,24 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	versionutil "k8s.io/apimachinery/pkg/util/version"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 	apiregistrationclient "k8s.io/kube-aggregator/pkg/client/clientset_generated/clientset/typed/apiregistration/v1"
 
+	"golang.org/x/time/rate"
+
 	"github.com/openshift/library-go/pkg/assets"
 	"github.com/openshift/library-go/pkg/controller/factory"
 	"github.com/openshift/library-go/pkg/operator/events"
@@ -29,6 +38,8 @@ import (
 	operatorapiv1 "open-cluster-management.io/api/operator/v1"
 	"open-cluster-management.io/registration-operator/manifests"
 	"open-cluster-management.io/registration-operator/pkg/helpers"
+	"open-cluster-management.io/registration-operator/pkg/metrics"
+	"open-cluster-management.io/registration-operator/pkg/version"
 )
 
 var (
@@ -36,7 +47,9 @@ var (
 		"manifestworks.work.open-cluster-management.io",
 		"managedclusters.cluster.open-cluster-management.io",
 	}
-	staticResourceFiles = []string{
+	// crdResourceFiles are the hub CRDs. They are not applied or removed when the
+	// CRDs are declared to be externally managed, e.g. by OLM or a GitOps pipeline.
+	crdResourceFiles = []string{
 		"cluster-manager/0000_00_addon.open-cluster-management.io_clustermanagementaddons.crd.yaml",
 		"cluster-manager/0000_00_clusters.open-cluster-management.io_managedclusters.crd.yaml",
 		"cluster-manager/0000_00_clusters.open-cluster-management.io_managedclustersets.crd.yaml",
@@ -45,6 +58,9 @@ var (
 		"cluster-manager/0000_01_clusters.open-cluster-management.io_managedclustersetbindings.crd.yaml",
 		"cluster-manager/0000_03_clusters.open-cluster-management.io_placements.crd.yaml",
 		"cluster-manager/0000_04_clusters.open-cluster-management.io_placementdecisions.crd.yaml",
+	}
+
+	staticResourceFiles = []string{
 		"cluster-manager/cluster-manager-registration-clusterrole.yaml",
 		"cluster-manager/cluster-manager-registration-clusterrolebinding.yaml",
 		"cluster-manager/cluster-manager-namespace.yaml",
@@ -63,26 +79,225 @@ var (
 		"cluster-manager/cluster-manager-work-webhook-serviceaccount.yaml",
 		"cluster-manager/cluster-manager-work-webhook-apiservice.yaml",
 		"cluster-manager/cluster-manager-work-webhook-validatingconfiguration.yaml",
+	}
+
+	// sharedHubResourceFiles are the cluster scoped resources whose names are fixed
+	// by the API groups they guard: the APIService names are dictated by the group
+	// and version they register, and the webhook configurations route through those
+	// aggregated APIs. They cannot be prefixed per instance, so only the owning
+	// clustermanager applies them and a teardown keeps them while another instance
+	// exists, like the shared hub CRDs.
+	sharedHubResourceFiles = []string{
+		"cluster-manager/cluster-manager-registration-webhook-apiservice.yaml",
+		"cluster-manager/cluster-manager-work-webhook-apiservice.yaml",
+		"cluster-manager/cluster-manager-registration-webhook-clustersetbinding-validatingconfiguration.yaml",
+		"cluster-manager/cluster-manager-registration-webhook-validatingconfiguration.yaml",
+		"cluster-manager/cluster-manager-registration-webhook-mutatingconfiguration.yaml",
+		"cluster-manager/cluster-manager-work-webhook-validatingconfiguration.yaml",
+	}
+
+	// placementStaticFiles are only applied when the placement controller is enabled
+	// by setting PlacementImagePullSpec in spec.
+	placementStaticFiles = []string{
 		"cluster-manager/cluster-manager-placement-clusterrole.yaml",
 		"cluster-manager/cluster-manager-placement-clusterrolebinding.yaml",
 		"cluster-manager/cluster-manager-placement-serviceaccount.yaml",
 	}
 
+	// addOnManagerStaticFiles are only applied when the addon manager is enabled in spec.
+	addOnManagerStaticFiles = []string{
+		"cluster-manager/cluster-manager-addon-manager-clusterrole.yaml",
+		"cluster-manager/cluster-manager-addon-manager-clusterrolebinding.yaml",
+		"cluster-manager/cluster-manager-addon-manager-serviceaccount.yaml",
+	}
+
+	// manifestWorkReplicaSetStaticFiles and the manifestworkreplicaset CRD are only
+	// applied when the manifestworkreplicaset controller is enabled in spec.
+	manifestWorkReplicaSetCRDFile     = "cluster-manager/0000_02_work.open-cluster-management.io_manifestworkreplicasets.crd.yaml"
+	manifestWorkReplicaSetStaticFiles = []string{
+		"cluster-manager/cluster-manager-manifestworkreplicaset-clusterrole.yaml",
+		"cluster-manager/cluster-manager-manifestworkreplicaset-clusterrolebinding.yaml",
+		"cluster-manager/cluster-manager-manifestworkreplicaset-serviceaccount.yaml",
+	}
+
 	deploymentFiles = []string{
 		"cluster-manager/cluster-manager-registration-deployment.yaml",
 		"cluster-manager/cluster-manager-registration-webhook-deployment.yaml",
 		"cluster-manager/cluster-manager-work-webhook-deployment.yaml",
-		"cluster-manager/cluster-manager-placement-deployment.yaml",
+	}
+
+	// The PodDisruptionBudgets are applied only for the deployments running with
+	// multiple replicas, so a node drain can never take down all replicas of a hub
+	// component at once.
+	registrationPodDisruptionBudgetFile = "cluster-manager/cluster-manager-registration-pdb.yaml"
+	placementPodDisruptionBudgetFile    = "cluster-manager/cluster-manager-placement-pdb.yaml"
+	webhookPodDisruptionBudgetFiles     = []string{
+		"cluster-manager/cluster-manager-registration-webhook-pdb.yaml",
+		"cluster-manager/cluster-manager-work-webhook-pdb.yaml",
+	}
+
+	// The HorizontalPodAutoscalers are applied only when autoscaling is enabled in
+	// the webhook configuration, so the webhooks scale with admission load instead
+	// of running a fixed replica count.
+	webhookAutoscalerFiles = []string{
+		"cluster-manager/cluster-manager-registration-webhook-hpa.yaml",
+		"cluster-manager/cluster-manager-work-webhook-hpa.yaml",
+	}
+
+	// optionalAPIManifests maps the group version of an optional API to the manifest
+	// files that need it. The files are skipped and the group version is reported in
+	// the UnsupportedAPI condition when the hub does not serve it, e.g. policy/v1
+	// only exists from kube 1.21.
+	optionalAPIManifests = []struct {
+		groupVersion string
+		files        []string
+	}{
+		{"policy/v1", append([]string{registrationPodDisruptionBudgetFile, placementPodDisruptionBudgetFile}, webhookPodDisruptionBudgetFiles...)},
+		{"autoscaling/v1", webhookAutoscalerFiles},
+	}
+
+	// metricsProxyStaticFiles grant the kube-rbac-proxy sidecars the token and
+	// subject access reviews they authenticate and authorize metrics scrapers with.
+	// They are only applied when the sidecar image is configured on the operator.
+	metricsProxyStaticFiles = []string{
+		"cluster-manager/cluster-manager-metrics-proxy-clusterrole.yaml",
+		"cluster-manager/cluster-manager-metrics-proxy-clusterrolebinding.yaml",
+	}
+
+	placementDeploymentFile              = "cluster-manager/cluster-manager-placement-deployment.yaml"
+	addOnManagerDeploymentFile           = "cluster-manager/cluster-manager-addon-manager-deployment.yaml"
+	manifestWorkReplicaSetDeploymentFile = "cluster-manager/cluster-manager-manifestworkreplicaset-deployment.yaml"
+
+	// cleanUpPhases groups the hub resources for an ordered teardown when the
+	// clustermanager is deleted. The webhook configurations are removed first so a
+	// stranded webhook cannot block a future install, followed by the controller
+	// workloads, the RBAC resources, and finally the CRDs.
+	cleanUpPhases = []struct {
+		name  string
+		files []string
+	}{
+		{
+			name: "webhooks",
+			files: []string{
+				"cluster-manager/cluster-manager-registration-webhook-clustersetbinding-validatingconfiguration.yaml",
+				"cluster-manager/cluster-manager-registration-webhook-validatingconfiguration.yaml",
+				"cluster-manager/cluster-manager-registration-webhook-mutatingconfiguration.yaml",
+				"cluster-manager/cluster-manager-work-webhook-validatingconfiguration.yaml",
+				"cluster-manager/cluster-manager-registration-webhook-apiservice.yaml",
+				"cluster-manager/cluster-manager-work-webhook-apiservice.yaml",
+				"cluster-manager/cluster-manager-registration-webhook-service.yaml",
+				"cluster-manager/cluster-manager-work-webhook-service.yaml",
+			},
+		},
+		{
+			name: "controllers",
+			files: []string{
+				"cluster-manager/cluster-manager-registration-webhook-hpa.yaml",
+				"cluster-manager/cluster-manager-work-webhook-hpa.yaml",
+				"cluster-manager/cluster-manager-registration-pdb.yaml",
+				"cluster-manager/cluster-manager-registration-webhook-pdb.yaml",
+				"cluster-manager/cluster-manager-work-webhook-pdb.yaml",
+				"cluster-manager/cluster-manager-placement-pdb.yaml",
+				"cluster-manager/cluster-manager-namespace.yaml",
+				"cluster-manager/cluster-manager-registration-serviceaccount.yaml",
+				"cluster-manager/cluster-manager-registration-webhook-serviceaccount.yaml",
+				"cluster-manager/cluster-manager-work-webhook-serviceaccount.yaml",
+				"cluster-manager/cluster-manager-placement-serviceaccount.yaml",
+				"cluster-manager/cluster-manager-addon-manager-serviceaccount.yaml",
+				"cluster-manager/cluster-manager-manifestworkreplicaset-serviceaccount.yaml",
+			},
+		},
+		{
+			name: "rbac",
+			files: []string{
+				"cluster-manager/cluster-manager-registration-clusterrole.yaml",
+				"cluster-manager/cluster-manager-registration-clusterrolebinding.yaml",
+				"cluster-manager/cluster-manager-registration-webhook-clusterrole.yaml",
+				"cluster-manager/cluster-manager-registration-webhook-clusterrolebinding.yaml",
+				"cluster-manager/cluster-manager-work-webhook-clusterrole.yaml",
+				"cluster-manager/cluster-manager-work-webhook-clusterrolebinding.yaml",
+				"cluster-manager/cluster-manager-placement-clusterrole.yaml",
+				"cluster-manager/cluster-manager-placement-clusterrolebinding.yaml",
+				"cluster-manager/cluster-manager-addon-manager-clusterrole.yaml",
+				"cluster-manager/cluster-manager-addon-manager-clusterrolebinding.yaml",
+				"cluster-manager/cluster-manager-manifestworkreplicaset-clusterrole.yaml",
+				"cluster-manager/cluster-manager-manifestworkreplicaset-clusterrolebinding.yaml",
+				"cluster-manager/cluster-manager-metrics-proxy-clusterrole.yaml",
+				"cluster-manager/cluster-manager-metrics-proxy-clusterrolebinding.yaml",
+			},
+		},
+		{
+			name:  "crds",
+			files: append(append([]string{}, crdResourceFiles...), manifestWorkReplicaSetCRDFile),
+		},
 	}
 )
 
 const (
-	clusterManagerFinalizer = "operator.open-cluster-management.io/cluster-manager-cleanup"
-	clusterManagerApplied   = "Applied"
-	clusterManagerAvailable = "Available"
-	caBundleConfigmap       = "ca-bundle-configmap"
+	clusterManagerFinalizer    = "operator.open-cluster-management.io/cluster-manager-cleanup"
+	clusterManagerApplied      = "Applied"
+	clusterManagerAvailable    = "Available"
+	clusterManagerDeleting     = "Deleting"
+	clusterManagerIncompatible = "IncompatibleVersion"
+	clusterManagerVersionSkew  = "VersionSkewDetected"
+	reconcilePaused            = "ReconcilePaused"
+	featureGatesValid          = "ValidFeatureGates"
+	extraFlagsValid            = "ValidExtraFlags"
+	crdsValid                  = "ValidCRDs"
+	bundleVersionValid         = "ValidBundleVersion"
+	upgradePreflightFailed     = "UpgradePreflightFailed"
+	unsupportedAPI             = "UnsupportedAPI"
+	caBundleConfigmap          = "ca-bundle-configmap"
+
+	// crdManagementAnnotation declares who manages the hub CRDs. When it is set to
+	// External on the clustermanager, the CRDs are expected to be delivered by an
+	// external mechanism such as OLM or a GitOps pipeline, and the operator only
+	// verifies their presence instead of creating, updating or deleting them.
+	crdManagementAnnotation = "operator.open-cluster-management.io/crd-management"
+	crdManagementExternal   = "External"
+
+	// imageRollbackAnnotation requests a one-step recovery from a bad image pull spec.
+	// While it is set to "true" on the clustermanager, the hub deployments are reverted
+	// to the last-known-good images recorded in status.
+	imageRollbackAnnotation = "operator.open-cluster-management.io/image-rollback"
 )
 
+// BundleVersion is the version of the CRD/component bundle applied by this operator build.
+// It is recorded in the clustermanager status after a successful apply and compared on the
+// next sync to refuse downgrades. It should be set during build via -ldflags.
+var BundleVersion = version.Get().GitVersion
+
+// featureGateRegexp matches feature gate names accepted by the component feature gate flags.
+// An invalid name would crash the component on flag parsing, so it is filtered out and
+// surfaced via the ValidFeatureGates condition instead.
+var featureGateRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+
+// registrationExtraFlagAllowlist are the registration controller flags that may be set
+// through spec.registrationConfiguration.extraFlags. Keeping the list bounded prevents
+// the flags the operator renders itself from being overridden, while common tunables do
+// not each require an operator release.
+var registrationExtraFlagAllowlist = map[string]struct{}{
+	"cluster-lease-duration-seconds": {},
+	"kube-api-qps":                   {},
+	"kube-api-burst":                 {},
+}
+
+// extraFlagValueRegexp matches extra flag values that render safely into the quoted
+// deployment args in the manifest. A quote, backslash or control character would
+// corrupt the rendered YAML, so such values are rejected and surfaced via the
+// ValidExtraFlags condition instead.
+var extraFlagValueRegexp = regexp.MustCompile(`^[A-Za-z0-9._:/=-]*$`)
+
+var (
+	genericScheme = runtime.NewScheme()
+	genericCodecs = serializer.NewCodecFactory(genericScheme)
+	genericCodec  = genericCodecs.UniversalDeserializer()
+)
+
+func init() {
+	utilruntime.Must(apiextensionsv1.AddToScheme(genericScheme))
+}
+
 type clusterManagerController struct {
 	clusterManagerClient  operatorv1client.ClusterManagerInterface
 	clusterManagerLister  operatorlister.ClusterManagerLister
@@ -91,6 +306,31 @@ type clusterManagerController struct {
 	apiRegistrationClient apiregistrationclient.APIServicesGetter
 	currentGeneration     []int64
 	configMapLister       corev1listers.ConfigMapLister
+	// nodeLister lists the master nodes the hub replica count is derived from.
+	nodeLister corev1listers.NodeLister
+	// imageOverrideConfigMap is the name of a configmap in the operator namespace
+	// that maps component keys to mirrored registry images. When it is set, the
+	// images in the configmap are preferred over the image pull specs in the
+	// clustermanager spec, which is the disconnected install workflow.
+	imageOverrideConfigMapNamespace string
+	imageOverrideConfigMapName      string
+	// metricsProxyImage is the image of the kube-rbac-proxy sidecar rendered into
+	// the hub components to front their metrics endpoints. Empty disables the
+	// sidecar.
+	metricsProxyImage string
+	// imageMirrors redirect the rendered image references to mirrored registries.
+	imageMirrors []helpers.ImageMirror
+	// podSecurityEnforceLevel is the pod security level rendered into the hub
+	// namespace manifest. An empty value falls back to the default level.
+	podSecurityEnforceLevel string
+	// renderCache caches the rendered manifests between reconciles, so a resync
+	// with an unchanged config does not parse the templates again.
+	renderCache *helpers.RenderCache
+	// apiSupported reports whether the hub serves the given API group version, for
+	// skipping manifests of optional APIs the hub does not serve. It is a field so
+	// tests can run the controller without a discovery API; a nil check disables
+	// the filtering and the UnsupportedAPI condition.
+	apiSupported func(groupVersion string) (bool, error)
 }
 
 // NewClusterManagerController construct cluster manager hub controller
@@ -102,54 +342,231 @@ func NewClusterManagerController(
 	clusterManagerInformer operatorinformer.ClusterManagerInformer,
 	deploymentInformer appsinformer.DeploymentInformer,
 	configMapInformer corev1informers.ConfigMapInformer,
+	nodeInformer corev1informers.NodeInformer,
+	imageOverrideConfigMapNamespace, imageOverrideConfigMapName string,
+	podSecurityEnforceLevel string,
+	metricsProxyImage string,
+	imageMirrors []helpers.ImageMirror,
+	syncThrottle *rate.Limiter,
 	recorder events.Recorder) factory.Controller {
 	controller := &clusterManagerController{
-		kubeClient:            kubeClient,
-		apiExtensionClient:    apiExtensionClient,
-		apiRegistrationClient: apiRegistrationClient,
-		clusterManagerClient:  clusterManagerClient,
-		clusterManagerLister:  clusterManagerInformer.Lister(),
-		configMapLister:       configMapInformer.Lister(),
-		currentGeneration:     make([]int64, len(deploymentFiles)),
+		kubeClient:                      kubeClient,
+		apiExtensionClient:              apiExtensionClient,
+		apiRegistrationClient:           apiRegistrationClient,
+		clusterManagerClient:            clusterManagerClient,
+		clusterManagerLister:            clusterManagerInformer.Lister(),
+		configMapLister:                 configMapInformer.Lister(),
+		nodeLister:                      nodeInformer.Lister(),
+		currentGeneration:               make([]int64, len(deploymentFiles)),
+		imageOverrideConfigMapNamespace: imageOverrideConfigMapNamespace,
+		imageOverrideConfigMapName:      imageOverrideConfigMapName,
+		podSecurityEnforceLevel:         podSecurityEnforceLevel,
+		metricsProxyImage:               metricsProxyImage,
+		imageMirrors:                    imageMirrors,
+		renderCache:                     helpers.NewRenderCache(),
+		apiSupported: func(groupVersion string) (bool, error) {
+			return helpers.APIGroupVersionSupported(kubeClient.Discovery(), groupVersion)
+		},
 	}
 
-	return factory.New().WithSync(controller.sync).
+	sync := helpers.ThrottleSync(syncThrottle, controller.sync)
+
+	// The deployment informer is registered with its own event handler, so status only
+	// updates of the hub deployments do not enqueue a full reconcile.
+	syncContext := factory.NewSyncContext("ClusterManagerController", recorder)
+	deploymentInformer.Informer().AddEventHandler(helpers.DeploymentQueueEventHandler(
+		syncContext.Queue(), helpers.ClusterManagerDeploymentQueueKeyFunc(controller.clusterManagerLister)))
+
+	return factory.New().WithSync(metrics.InstrumentSyncer("ClusterManagerController", sync)).
 		ResyncEvery(3*time.Minute).
-		WithInformersQueueKeyFunc(helpers.ClusterManagerDeploymentQueueKeyFunc(controller.clusterManagerLister), deploymentInformer.Informer()).
+		WithSyncContext(syncContext).
+		WithBareInformers(deploymentInformer.Informer()).
 		WithFilteredEventsInformersQueueKeyFunc(
 			helpers.ClusterManagerConfigmapQueueKeyFunc(controller.clusterManagerLister),
 			func(obj interface{}) bool {
+				// The queue key func resolves the owning clustermanager from the
+				// configmap namespace, so only the name is filtered here and the ca
+				// bundles of all deploy namespaces are watched.
 				accessor, _ := meta.Accessor(obj)
-				if namespace := accessor.GetNamespace(); namespace != helpers.ClusterManagerNamespace {
-					return false
-				}
-				if name := accessor.GetName(); name != caBundleConfigmap {
-					return false
-				}
-				return true
+				return accessor.GetName() == caBundleConfigmap
 			},
 			configMapInformer.Informer()).
 		WithInformersQueueKeyFunc(func(obj runtime.Object) string {
 			accessor, _ := meta.Accessor(obj)
 			return accessor.GetName()
 		}, clusterManagerInformer.Informer()).
+		// Node events enqueue every clustermanager, so a change of the master node
+		// count adjusts the hub replicas without waiting for a clustermanager update.
+		WithInformers(nodeInformer.Informer()).
 		ToController("ClusterManagerController", recorder)
 }
 
 // hubConfig is used to render the template of hub manifests
 type hubConfig struct {
 	ClusterManagerName             string
+	ClusterManagerNamespace        string
 	RegistrationImage              string
 	RegistrationAPIServiceCABundle string
 	WorkImage                      string
 	WorkAPIServiceCABundle         string
 	PlacementImage                 string
+	AddOnManagerImage              string
 	Replica                        int32
+	RegistrationFeatureGates       string
+	WorkFeatureGates               string
+	// RegistrationExtraFlags are the allowlisted extra flags of spec rendered as
+	// "--name=value" args into the registration controller deployment.
+	RegistrationExtraFlags []string
+	// AutoApproveUsers is the comma separated list of users whose cluster registrations
+	// are automatically approved by the registration controller.
+	AutoApproveUsers string
+	// WorkDriver and WorkDriverConfig switch the work distribution to a non default
+	// driver, e.g. an MQTT broker, configured by the referenced secret.
+	WorkDriver       string
+	WorkDriverConfig string
+	// RegistrationWebhookNodePort and WorkWebhookNodePort turn the webhook services
+	// into NodePort services on the given ports when set. WebhookHostNetwork runs the
+	// webhook pods on the host network instead.
+	RegistrationWebhookNodePort int32
+	WorkWebhookNodePort         int32
+	WebhookHostNetwork          bool
+	// WebhookReplica is the replica count of the webhook deployments, which can be set
+	// independently of the controller replicas.
+	WebhookReplica int32
+	// WebhookFailurePolicy and WebhookTimeoutSeconds are rendered into the
+	// validating/mutating webhook configurations.
+	WebhookFailurePolicy  string
+	WebhookTimeoutSeconds int32
+	// WebhookIPFamilyPolicy and WebhookIPFamilies are rendered into the webhook
+	// services so the webhooks can be exposed on dual-stack or IPv6-only clusters.
+	WebhookIPFamilyPolicy string
+	WebhookIPFamilies     []string
+	// WebhookAutoscaling enables the HorizontalPodAutoscalers of the webhook
+	// deployments. When it is set, the replicas of the webhook deployments are left
+	// to the autoscalers instead of being rendered into the manifests.
+	WebhookAutoscaling                     bool
+	WebhookAutoscalingMinReplicas          int32
+	WebhookAutoscalingMaxReplicas          int32
+	WebhookAutoscalingTargetCPUUtilization int32
+	// WebhookTLSMinVersion and WebhookCipherSuites are rendered into the TLS flags
+	// of the webhook servers so a FIPS or corporate TLS policy can be enforced on
+	// the admission endpoints. The cipher suites are joined with commas for the flag.
+	WebhookTLSMinVersion string
+	WebhookCipherSuites  string
+	// PodSecurityEnforceLevel is the pod security level set on the hub namespace
+	// via the pod-security.kubernetes.io/enforce label.
+	PodSecurityEnforceLevel string
+	// MetricsProxyImage is the image of the kube-rbac-proxy sidecar rendered into
+	// the hub components to front their metrics endpoints.
+	MetricsProxyImage string
+}
+
+// convertFeatureGates translates the feature gates in spec into the value of the
+// --feature-gates flag of the component, and returns the invalid gate names.
+func convertFeatureGates(featureGates []operatorapiv1.FeatureGate) (string, []string) {
+	gates := []string{}
+	invalid := []string{}
+	for _, featureGate := range featureGates {
+		if !featureGateRegexp.MatchString(featureGate.Feature) {
+			invalid = append(invalid, featureGate.Feature)
+			continue
+		}
+		if featureGate.Mode == operatorapiv1.FeatureGateModeTypeEnable {
+			gates = append(gates, fmt.Sprintf("%s=true", featureGate.Feature))
+			continue
+		}
+		gates = append(gates, fmt.Sprintf("%s=false", featureGate.Feature))
+	}
+	return strings.Join(gates, ","), invalid
+}
+
+// convertExtraFlags renders the extra flags in spec that are on the given allowlist
+// into "--name=value" component args, and returns the names of the rejected flags.
+// Flags whose values would not survive the manifest rendering are rejected as well.
+func convertExtraFlags(extraFlags []operatorapiv1.ExtraFlag, allowlist map[string]struct{}) ([]string, []string) {
+	args := []string{}
+	invalid := []string{}
+	for _, extraFlag := range extraFlags {
+		if _, ok := allowlist[extraFlag.Name]; !ok {
+			invalid = append(invalid, extraFlag.Name)
+			continue
+		}
+		if !extraFlagValueRegexp.MatchString(extraFlag.Value) {
+			invalid = append(invalid, extraFlag.Name)
+			continue
+		}
+		args = append(args, fmt.Sprintf("--%s=%s", extraFlag.Name, extraFlag.Value))
+	}
+	return args, invalid
+}
+
+// sharedResourceOwner returns the name of the clustermanager that applies the
+// shared cluster scoped resources, so coexisting instances do not rewrite the same
+// objects with their own namespaces and CA bundles. The oldest instance owns them,
+// ties are broken by name, and instances being deleted or set to Removed are
+// skipped so ownership moves on before the owner is gone.
+func sharedResourceOwner(clusterManagers []*operatorapiv1.ClusterManager) string {
+	owner := ""
+	var ownerCreated metav1.Time
+	for _, clusterManager := range clusterManagers {
+		if !clusterManager.DeletionTimestamp.IsZero() || clusterManager.Spec.ManagementState == operatorapiv1.ManagementStateRemoved {
+			continue
+		}
+		created := clusterManager.CreationTimestamp
+		if owner == "" || created.Before(&ownerCreated) || (created.Equal(&ownerCreated) && clusterManager.Name < owner) {
+			owner = clusterManager.Name
+			ownerCreated = created
+		}
+	}
+	return owner
+}
+
+// otherClusterManagersExist reports whether another clustermanager that is not
+// being deleted still exists, in which case a teardown keeps the shared hub CRDs
+// and admission resources the surviving instances rely on.
+func otherClusterManagersExist(clusterManagers []*operatorapiv1.ClusterManager, name string) bool {
+	for _, clusterManager := range clusterManagers {
+		if clusterManager.Name == name || !clusterManager.DeletionTimestamp.IsZero() {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// withoutSharedFiles drops the shared cluster scoped resource files from the given
+// manifest files.
+func withoutSharedFiles(files []string) []string {
+	shared := map[string]bool{}
+	for _, file := range sharedHubResourceFiles {
+		shared[file] = true
+	}
+	remaining := []string{}
+	for _, file := range files {
+		if shared[file] {
+			continue
+		}
+		remaining = append(remaining, file)
+	}
+	return remaining
 }
 
 func (n *clusterManagerController) sync(ctx context.Context, controllerContext factory.SyncContext) error {
 	clusterManagerName := controllerContext.QueueKey()
-	klog.V(4).Infof("Reconciling ClusterManager %q", clusterManagerName)
+	klog.V(4).InfoS("Reconciling ClusterManager", "controller", "ClusterManagerController", "clustermanager", clusterManagerName)
+
+	// A node event or a periodic resync enqueues the default queue key, re-enqueue
+	// every clustermanager so the hub replica counts follow the master node count.
+	if clusterManagerName == factory.DefaultQueueKey {
+		clusterManagers, err := n.clusterManagerLister.List(labels.Everything())
+		if err != nil {
+			return err
+		}
+		for _, clusterManager := range clusterManagers {
+			controllerContext.Queue().Add(clusterManager.Name)
+		}
+		return nil
+	}
 
 	clusterManager, err := n.clusterManagerLister.Get(clusterManagerName)
 	if errors.IsNotFound(err) {
@@ -161,15 +578,74 @@ func (n *clusterManagerController) sync(ctx context.Context, controllerContext f
 	}
 	clusterManager = clusterManager.DeepCopy()
 
-	config := hubConfig{
-		ClusterManagerName: clusterManager.Name,
-		RegistrationImage:  clusterManager.Spec.RegistrationImagePullSpec,
-		WorkImage:          clusterManager.Spec.WorkImagePullSpec,
-		PlacementImage:     clusterManager.Spec.PlacementImagePullSpec,
-		Replica:            helpers.DetermineReplicaByNodes(ctx, n.kubeClient),
+	// The coexisting clustermanagers decide who applies the shared cluster scoped
+	// resources and whether a teardown may remove them.
+	clusterManagers, err := n.clusterManagerLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	config, invalidFeatureGates, invalidExtraFlags := buildHubConfig(clusterManager, helpers.DetermineReplica(n.nodeLister, clusterManager.Spec.AvailabilityConfig))
+	if len(n.podSecurityEnforceLevel) > 0 {
+		config.PodSecurityEnforceLevel = n.podSecurityEnforceLevel
 	}
+	config.MetricsProxyImage = n.metricsProxyImage
+	if err := n.applyImageOverrides(ctx, &config); err != nil {
+		return err
+	}
+
+	// Redirect the component images to the configured registry mirrors, so air-gapped
+	// hubs pull from their local registry regardless of where the pull specs point.
+	config.RegistrationImage = helpers.ApplyImageMirrors(n.imageMirrors, config.RegistrationImage)
+	config.WorkImage = helpers.ApplyImageMirrors(n.imageMirrors, config.WorkImage)
+	config.PlacementImage = helpers.ApplyImageMirrors(n.imageMirrors, config.PlacementImage)
+	config.AddOnManagerImage = helpers.ApplyImageMirrors(n.imageMirrors, config.AddOnManagerImage)
+	config.MetricsProxyImage = helpers.ApplyImageMirrors(n.imageMirrors, config.MetricsProxyImage)
 
-	// Update finalizer at first
+	// Resolve the component image tags to digests when pinning is enabled, so a
+	// repushed mutable tag does not silently change the running components. The
+	// digests already recorded in status stay pinned until the image pull specs
+	// change.
+	var resolvedImages map[string]string
+	if clusterManager.Spec.PinImageDigests {
+		componentImages := []string{config.RegistrationImage, config.WorkImage, config.PlacementImage, config.AddOnManagerImage}
+		resolvedImages = helpers.ResolveImageDigests(ctx, n.kubeClient, config.ClusterManagerNamespace, componentImages...)
+		for _, image := range componentImages {
+			if digest, ok := clusterManager.Status.ResolvedImages[image]; ok {
+				resolvedImages[image] = digest
+			}
+		}
+		pin := func(image string) string {
+			if digest, ok := resolvedImages[image]; ok {
+				return digest
+			}
+			return image
+		}
+		config.RegistrationImage = pin(config.RegistrationImage)
+		config.WorkImage = pin(config.WorkImage)
+		config.PlacementImage = pin(config.PlacementImage)
+		config.AddOnManagerImage = pin(config.AddOnManagerImage)
+	}
+
+	// Revert the component images to the last-known-good set recorded in status while a
+	// rollback is requested, so a bad image pull spec can be recovered from in one step
+	// without first fixing the spec. The rollback wins over pinning, the recorded images
+	// are exactly what ran last.
+	if clusterManager.Annotations[imageRollbackAnnotation] == "true" && len(clusterManager.Status.LastKnownGoodImages) > 0 {
+		rollback := func(image, deploymentSuffix string) string {
+			if lastKnownGood, ok := clusterManager.Status.LastKnownGoodImages[clusterManager.Name+deploymentSuffix]; ok {
+				return lastKnownGood
+			}
+			return image
+		}
+		config.RegistrationImage = rollback(config.RegistrationImage, "-registration-controller")
+		config.WorkImage = rollback(config.WorkImage, "-work-webhook")
+		config.PlacementImage = rollback(config.PlacementImage, "-placement-controller")
+		config.AddOnManagerImage = rollback(config.AddOnManagerImage, "-addon-manager-controller")
+	}
+
+	// Update finalizer at first, and mark the clustermanager for backup in the same
+	// write, so a velero based backup includes it for disaster recovery
 	if clusterManager.DeletionTimestamp.IsZero() {
 		hasFinalizer := false
 		for i := range clusterManager.Finalizers {
@@ -180,6 +656,10 @@ func (n *clusterManagerController) sync(ctx context.Context, controllerContext f
 		}
 		if !hasFinalizer {
 			clusterManager.Finalizers = append(clusterManager.Finalizers, clusterManagerFinalizer)
+			if clusterManager.Labels == nil {
+				clusterManager.Labels = map[string]string{}
+			}
+			clusterManager.Labels[helpers.BackupLabel] = "true"
 			_, err := n.clusterManagerClient.Update(ctx, clusterManager, metav1.UpdateOptions{})
 			return err
 		}
@@ -187,15 +667,164 @@ func (n *clusterManagerController) sync(ctx context.Context, controllerContext f
 
 	// ClusterManager is deleting, we remove its related resources on hub
 	if !clusterManager.DeletionTimestamp.IsZero() {
-		if err := n.cleanUp(ctx, controllerContext, config); err != nil {
+		if err := n.cleanUp(ctx, controllerContext, config, crdsExternallyManaged(clusterManager), otherClusterManagersExist(clusterManagers, clusterManager.Name)); err != nil {
 			return err
 		}
 		return n.removeClusterManagerFinalizer(ctx, clusterManager)
 	}
 
+	// While the clustermanager is set to Unmanaged, the deployed hub is left exactly
+	// as it is, e.g. during a maintenance window, and only the ReconcilePaused
+	// condition records that the spec is not being applied.
+	if clusterManager.Spec.ManagementState == operatorapiv1.ManagementStateUnmanaged {
+		_, _, updatedErr := helpers.UpdateClusterManagerStatus(
+			ctx, n.clusterManagerClient, clusterManager.Name,
+			helpers.UpdateClusterManagerConditionFn(metav1.Condition{
+				Type:    reconcilePaused,
+				Status:  metav1.ConditionTrue,
+				Reason:  "Unmanaged",
+				Message: "The clustermanager is set to Unmanaged, the deployed hub components are left as they are",
+			}))
+		return updatedErr
+	}
+
+	// Removed tears the deployed hub down with the same ordered teardown as a
+	// deletion, but keeps the clustermanager and its configuration, so the hub can be
+	// reinstalled by setting the state back to Managed.
+	if clusterManager.Spec.ManagementState == operatorapiv1.ManagementStateRemoved {
+		if err := n.cleanUp(ctx, controllerContext, config, crdsExternallyManaged(clusterManager), otherClusterManagersExist(clusterManagers, clusterManager.Name)); err != nil {
+			return err
+		}
+		_, _, updatedErr := helpers.UpdateClusterManagerStatus(
+			ctx, n.clusterManagerClient, clusterManager.Name,
+			helpers.UpdateClusterManagerConditionFn(
+				metav1.Condition{
+					Type:    clusterManagerApplied,
+					Status:  metav1.ConditionFalse,
+					Reason:  "ClusterManagerRemoved",
+					Message: "The clustermanager is set to Removed, the deployed hub components are torn down",
+				},
+				metav1.Condition{
+					Type:    reconcilePaused,
+					Status:  metav1.ConditionTrue,
+					Reason:  "Removed",
+					Message: "The clustermanager is set to Removed, only the teardown of the deployed hub components is reconciled",
+				}))
+		return updatedErr
+	}
+	// The condition is only turned back when the clustermanager returns to Managed,
+	// so the common path does not touch status at all.
+	if meta.IsStatusConditionTrue(clusterManager.Status.Conditions, reconcilePaused) {
+		_, _, updatedErr := helpers.UpdateClusterManagerStatus(
+			ctx, n.clusterManagerClient, clusterManager.Name,
+			helpers.UpdateClusterManagerConditionFn(metav1.Condition{
+				Type:    reconcilePaused,
+				Status:  metav1.ConditionFalse,
+				Reason:  "Managed",
+				Message: "The clustermanager is managed, the spec is reconciled normally",
+			}))
+		if updatedErr != nil {
+			return updatedErr
+		}
+	}
+
+	// Refuse to apply manifests of an older bundle over stored objects written by a newer
+	// version, since such a downgrade may corrupt them. Development builds without a
+	// version set skip the check.
+	if isBundleDowngrade(BundleVersion, clusterManager.Status.AppliedBundleVersion) {
+		_, _, updatedErr := helpers.UpdateClusterManagerStatus(
+			ctx, n.clusterManagerClient, clusterManager.Name,
+			helpers.UpdateClusterManagerConditionFn(metav1.Condition{
+				Type:    bundleVersionValid,
+				Status:  metav1.ConditionFalse,
+				Reason:  "UnsupportedDowngrade",
+				Message: fmt.Sprintf("The operator bundle version %q is older than the applied bundle version %q, refuse to downgrade the hub components", BundleVersion, clusterManager.Status.AppliedBundleVersion),
+			}))
+		return updatedErr
+	}
+
+	// Refuse to deploy hub components from a different OCM release than this operator
+	// build supports, the mismatched components would fail at runtime.
+	if err := helpers.CheckAgentImageVersions(config.RegistrationImage, config.WorkImage, config.PlacementImage, config.AddOnManagerImage); err != nil {
+		_, _, updatedErr := helpers.UpdateClusterManagerStatus(
+			ctx, n.clusterManagerClient, clusterManager.Name,
+			helpers.UpdateClusterManagerConditionFn(metav1.Condition{
+				Type: clusterManagerIncompatible, Status: metav1.ConditionTrue, Reason: "ComponentVersionIncompatible",
+				Message: err.Error(),
+			}))
+		return updatedErr
+	}
+	// The condition is only turned back when the images become compatible again, so the
+	// common path does not touch status at all.
+	if meta.IsStatusConditionTrue(clusterManager.Status.Conditions, clusterManagerIncompatible) {
+		_, _, _ = helpers.UpdateClusterManagerStatus(
+			ctx, n.clusterManagerClient, clusterManager.Name,
+			helpers.UpdateClusterManagerConditionFn(metav1.Condition{
+				Type: clusterManagerIncompatible, Status: metav1.ConditionFalse, Reason: "ComponentVersionCompatible",
+				Message: "Component image versions are compatible with the operator",
+			}))
+	}
+
+	// Warn when explicit image pull specs come from a different release stream than
+	// this operator build. Unlike the incompatible case above, the skewed components
+	// still deploy, the condition just flags the likely fleet misconfiguration.
+	if skews := helpers.AgentImageVersionSkew(config.RegistrationImage, config.WorkImage, config.PlacementImage, config.AddOnManagerImage); len(skews) > 0 {
+		_, _, _ = helpers.UpdateClusterManagerStatus(
+			ctx, n.clusterManagerClient, clusterManager.Name,
+			helpers.UpdateClusterManagerConditionFn(metav1.Condition{
+				Type: clusterManagerVersionSkew, Status: metav1.ConditionTrue, Reason: "ComponentVersionSkew",
+				Message: strings.Join(skews, "; "),
+			}))
+	} else if meta.IsStatusConditionTrue(clusterManager.Status.Conditions, clusterManagerVersionSkew) {
+		_, _, _ = helpers.UpdateClusterManagerStatus(
+			ctx, n.clusterManagerClient, clusterManager.Name,
+			helpers.UpdateClusterManagerConditionFn(metav1.Condition{
+				Type: clusterManagerVersionSkew, Status: metav1.ConditionFalse, Reason: "NoComponentVersionSkew",
+				Message: "Component image versions match the operator release stream",
+			}))
+	}
+
+	// Before rolling a deployed component to a different image, run the preflight
+	// checks and hold the upgrade back until every check passes, rather than rolling
+	// the hub into a broken state. A requested rollback skips the checks, it recovers
+	// from exactly the broken state the checks would report.
+	if clusterManager.Annotations[imageRollbackAnnotation] != "true" && componentImageChanging(clusterManager.Status.DeployedComponents, config) {
+		failures, err := n.upgradePreflightFailures(ctx, clusterManager, config)
+		if err != nil {
+			return err
+		}
+		if len(failures) > 0 {
+			_, _, updatedErr := helpers.UpdateClusterManagerStatus(
+				ctx, n.clusterManagerClient, clusterManager.Name,
+				helpers.UpdateClusterManagerConditionFn(metav1.Condition{
+					Type:    upgradePreflightFailed,
+					Status:  metav1.ConditionTrue,
+					Reason:  "PreflightChecksFailed",
+					Message: fmt.Sprintf("The component upgrade is blocked by failed preflight checks: %s", strings.Join(failures, "; ")),
+				}))
+			if updatedErr != nil {
+				return updatedErr
+			}
+			controllerContext.Queue().AddAfter(clusterManager.Name, 30*time.Second)
+			return nil
+		}
+	}
+	// As with the incompatibility condition, the condition is only turned back after a
+	// blocked upgrade, so the common path does not touch status.
+	if meta.IsStatusConditionTrue(clusterManager.Status.Conditions, upgradePreflightFailed) {
+		_, _, _ = helpers.UpdateClusterManagerStatus(
+			ctx, n.clusterManagerClient, clusterManager.Name,
+			helpers.UpdateClusterManagerConditionFn(metav1.Condition{
+				Type:    upgradePreflightFailed,
+				Status:  metav1.ConditionFalse,
+				Reason:  "PreflightChecksPassed",
+				Message: "All pre-upgrade preflight checks passed",
+			}))
+	}
+
 	// try to load ca bundle from configmap
 	caBundle := "placeholder"
-	configmap, err := n.configMapLister.ConfigMaps(helpers.ClusterManagerNamespace).Get(caBundleConfigmap)
+	configmap, err := n.configMapLister.ConfigMaps(config.ClusterManagerNamespace).Get(caBundleConfigmap)
 	switch {
 	case errors.IsNotFound(err):
 		// do nothing
@@ -210,20 +839,56 @@ func (n *clusterManagerController) sync(ctx context.Context, controllerContext f
 	config.RegistrationAPIServiceCABundle = encodedCaBundle
 	config.WorkAPIServiceCABundle = encodedCaBundle
 
-	// Apply static files
-	resourceResults := helpers.ApplyDirectly(
-		n.kubeClient,
-		n.apiExtensionClient,
-		n.apiRegistrationClient,
-		controllerContext.Recorder(),
-		func(name string) ([]byte, error) {
+	// Apply static files. The CRDs are skipped and only verified when they are
+	// externally managed. The placement controller is deployed only when its image
+	// pull spec is set, so that scheduling capabilities can be installed without a
+	// separate installer.
+	crdFiles := hubCRDFiles(clusterManager)
+	var crdsValidCondition *metav1.Condition
+	applyStaticFiles := []string{}
+	if crdsExternallyManaged(clusterManager) {
+		condition, err := n.checkExternalCRDs(ctx, config, crdFiles)
+		if err != nil {
+			return err
+		}
+		crdsValidCondition = &condition
+	} else {
+		applyStaticFiles = append(applyStaticFiles, crdFiles...)
+	}
+	staticFiles := hubStaticFiles(clusterManager, config)
+	// Only the owning instance applies the shared admission resources, whose fixed
+	// names cannot be prefixed per instance, so coexisting clustermanagers do not
+	// rewrite the APIService service references with their own namespaces.
+	if clusterManager.Name != sharedResourceOwner(clusterManagers) {
+		staticFiles = withoutSharedFiles(staticFiles)
+	}
+	// Manifests of optional APIs the hub does not serve are skipped instead of
+	// failing the apply loop, and the missing group versions are reported in the
+	// UnsupportedAPI condition below.
+	unsupportedAPIs := []string{}
+	if n.apiSupported != nil {
+		staticFiles, unsupportedAPIs, err = n.filterUnsupportedAPIFiles(staticFiles)
+		if err != nil {
+			return err
+		}
+	}
+	applyStaticFiles = append(applyStaticFiles, staticFiles...)
+	render := func(name string) ([]byte, error) {
+		return n.renderCache.Render(name, config, func() ([]byte, error) {
 			template, err := manifests.ClusterManagerManifestFiles.ReadFile(name)
 			if err != nil {
 				return nil, err
 			}
 			return assets.MustCreateAssetFromTemplate(name, template, config).Data, nil
-		},
-		staticResourceFiles...,
+		})
+	}
+	resourceResults := helpers.ApplyDirectly(
+		n.kubeClient,
+		n.apiExtensionClient,
+		n.apiRegistrationClient,
+		controllerContext.Recorder(),
+		render,
+		applyStaticFiles...,
 	)
 	errs := []error{}
 	for _, result := range resourceResults {
@@ -232,20 +897,48 @@ func (n *clusterManagerController) sync(ctx context.Context, controllerContext f
 		}
 	}
 
+	// Wait for the applied CRDs to be established before deploying the components
+	// that serve or consume them, so fresh installs do not crash-loop the
+	// components while the apiserver is still publishing the new types. When the
+	// externally managed CRDs are reported invalid, the ValidCRDs condition already
+	// explains the problem and the wait is skipped.
+	if len(errs) == 0 && (crdsValidCondition == nil || crdsValidCondition.Status == metav1.ConditionTrue) {
+		unestablished, crdErr := n.unestablishedCRDs(ctx, config, crdFiles)
+		if crdErr != nil {
+			errs = append(errs, crdErr)
+		} else if len(unestablished) > 0 {
+			if crdsValidCondition != nil {
+				meta.SetStatusCondition(&clusterManager.Status.Conditions, *crdsValidCondition)
+			}
+			meta.SetStatusCondition(&clusterManager.Status.Conditions, metav1.Condition{
+				Type:    clusterManagerApplied,
+				Status:  metav1.ConditionFalse,
+				Reason:  "WaitingForCRDsEstablished",
+				Message: fmt.Sprintf("Waiting for crds %v to be established before deploying the hub components", unestablished),
+			})
+			_, _, updatedErr := helpers.UpdateClusterManagerStatus(ctx, n.clusterManagerClient, clusterManager.Name,
+				helpers.UpdateClusterManagerConditionFn(clusterManager.Status.Conditions...))
+			if updatedErr != nil {
+				return updatedErr
+			}
+			controllerContext.Queue().AddAfter(clusterManager.Name, 5*time.Second)
+			return nil
+		}
+	}
+
+	applyDeploymentFiles := hubDeploymentFiles(clusterManager, config)
+
 	currentGenerations := []operatorapiv1.GenerationStatus{}
 	// Render deployment manifest and apply
-	for _, file := range deploymentFiles {
+	for _, file := range applyDeploymentFiles {
 		currentGeneration, err := helpers.ApplyDeployment(
 			n.kubeClient,
 			clusterManager.Status.Generations,
 			clusterManager.Spec.NodePlacement,
-			func(name string) ([]byte, error) {
-				template, err := manifests.ClusterManagerManifestFiles.ReadFile(name)
-				if err != nil {
-					return nil, err
-				}
-				return assets.MustCreateAssetFromTemplate(name, template, config).Data, nil
-			},
+			clusterManager.Spec.RuntimeClassName,
+			clusterManager.Spec.ProbeConfiguration,
+			clusterManager.Spec.RolloutConfiguration,
+			render,
 			controllerContext.Recorder(),
 			file)
 		if err != nil {
@@ -254,8 +947,78 @@ func (n *clusterManagerController) sync(ctx context.Context, controllerContext f
 		currentGenerations = append(currentGenerations, currentGeneration)
 	}
 
+	// Record every applied resource in status, so must-gather and uninstall
+	// verification can enumerate them without knowing the manifests.
+	relatedResources, err := helpers.NewRelatedResources(render, append(append([]string{}, applyStaticFiles...), applyDeploymentFiles...)...)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
 	conditions := &clusterManager.Status.Conditions
+	if crdsValidCondition != nil {
+		meta.SetStatusCondition(conditions, *crdsValidCondition)
+	}
+	if len(invalidFeatureGates) == 0 {
+		meta.SetStatusCondition(conditions, metav1.Condition{
+			Type:    featureGatesValid,
+			Status:  metav1.ConditionTrue,
+			Reason:  "FeatureGatesAllValid",
+			Message: "Feature gates are all valid",
+		})
+	} else {
+		meta.SetStatusCondition(conditions, metav1.Condition{
+			Type:    featureGatesValid,
+			Status:  metav1.ConditionFalse,
+			Reason:  "InvalidFeatureGatesExisting",
+			Message: fmt.Sprintf("There are invalid feature gates in spec: %v", invalidFeatureGates),
+		})
+	}
+	// The ValidExtraFlags condition is only maintained when extra flags are specified,
+	// most clustermanagers never use them.
+	if registrationConfiguration := clusterManager.Spec.RegistrationConfiguration; registrationConfiguration != nil && len(registrationConfiguration.ExtraFlags) > 0 {
+		if len(invalidExtraFlags) == 0 {
+			meta.SetStatusCondition(conditions, metav1.Condition{
+				Type:    extraFlagsValid,
+				Status:  metav1.ConditionTrue,
+				Reason:  "ExtraFlagsAllValid",
+				Message: "Extra flags are all on the allowlist",
+			})
+		} else {
+			meta.SetStatusCondition(conditions, metav1.Condition{
+				Type:    extraFlagsValid,
+				Status:  metav1.ConditionFalse,
+				Reason:  "UnsupportedExtraFlagsExisting",
+				Message: fmt.Sprintf("There are extra flags in spec not on the allowlist or with malformed values: %v", invalidExtraFlags),
+			})
+		}
+	}
+	// The UnsupportedAPI condition is only maintained when the served APIs are
+	// checked; a nil check leaves it unset.
+	if n.apiSupported != nil {
+		if len(unsupportedAPIs) > 0 {
+			meta.SetStatusCondition(conditions, metav1.Condition{
+				Type:    unsupportedAPI,
+				Status:  metav1.ConditionTrue,
+				Reason:  "OptionalAPIsNotServed",
+				Message: fmt.Sprintf("The manifests requiring the following group versions were skipped because the hub does not serve them: %s", strings.Join(unsupportedAPIs, ", ")),
+			})
+		} else {
+			meta.SetStatusCondition(conditions, metav1.Condition{
+				Type:    unsupportedAPI,
+				Status:  metav1.ConditionFalse,
+				Reason:  "APIsServed",
+				Message: "The hub serves the APIs required by the applied manifests",
+			})
+		}
+	}
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:    bundleVersionValid,
+		Status:  metav1.ConditionTrue,
+		Reason:  "BundleVersionValid",
+		Message: "The operator bundle version is not older than the applied bundle version",
+	})
 	observedKlusterletGeneration := clusterManager.Status.ObservedGeneration
+	appliedBundleVersion := clusterManager.Status.AppliedBundleVersion
 	if len(errs) == 0 {
 		meta.SetStatusCondition(conditions, metav1.Condition{
 			Type:    clusterManagerApplied,
@@ -264,6 +1027,9 @@ func (n *clusterManagerController) sync(ctx context.Context, controllerContext f
 			Message: "Components of cluster manager is applied",
 		})
 		observedKlusterletGeneration = clusterManager.Generation
+		if len(BundleVersion) > 0 {
+			appliedBundleVersion = BundleVersion
+		}
 	} else {
 		meta.SetStatusCondition(conditions, metav1.Condition{
 			Type:    clusterManagerApplied,
@@ -278,8 +1044,12 @@ func (n *clusterManagerController) sync(ctx context.Context, controllerContext f
 		ctx, n.clusterManagerClient, clusterManager.Name,
 		helpers.UpdateClusterManagerConditionFn(*conditions...),
 		helpers.UpdateClusterManagerGenerationsFn(currentGenerations...),
+		helpers.UpdateClusterManagerRelatedResourcesFn(relatedResources...),
 		func(oldStatus *operatorapiv1.ClusterManagerStatus) error {
 			oldStatus.ObservedGeneration = observedKlusterletGeneration
+			oldStatus.AppliedBundleVersion = appliedBundleVersion
+			oldStatus.OperatorVersion = version.OperatorVersion()
+			oldStatus.ResolvedImages = resolvedImages
 			return nil
 		},
 	)
@@ -331,36 +1101,512 @@ func (n *clusterManagerController) removeCRD(ctx context.Context, name string) e
 	return fmt.Errorf("CRD %s is still being deleted", name)
 }
 
+// cleanUp removes the hub resources phase by phase when the clustermanager is deleted,
+// and reports the phases that still hold resources with the Deleting condition. The
+// CRDs are removed in the last phase, and the teardown waits until the managed cluster
+// and manifest work CRDs are gone so their custom resources can still be cleaned up.
+// Externally managed CRDs are left untouched, and while another clustermanager
+// instance exists the shared CRDs and admission resources are kept as well, so
+// deleting one instance does not destroy the API surface of the survivors.
 func (n *clusterManagerController) cleanUp(
-	ctx context.Context, controllerContext factory.SyncContext, config hubConfig) error {
-	// Remove crd
-	for _, name := range crdNames {
-		err := n.removeCRD(ctx, name)
-		if err != nil {
-			return err
+	ctx context.Context, controllerContext factory.SyncContext, config hubConfig, skipCRDs, skipShared bool) error {
+	for index, phase := range cleanUpPhases {
+		files := phase.files
+		if skipShared {
+			files = withoutSharedFiles(files)
 		}
-		controllerContext.Recorder().Eventf("CRDDeleted", "crd %s is deleted", name)
-	}
-
-	// Remove Static files
-	for _, file := range staticResourceFiles {
-		err := helpers.CleanUpStaticObject(
-			ctx,
-			n.kubeClient,
-			n.apiExtensionClient,
-			n.apiRegistrationClient,
-			func(name string) ([]byte, error) {
-				template, err := manifests.ClusterManagerManifestFiles.ReadFile(name)
+		if phase.name == "crds" {
+			if skipCRDs || skipShared {
+				continue
+			}
+			for _, name := range crdNames {
+				err := n.removeCRD(ctx, name)
 				if err != nil {
-					return nil, err
+					n.updateDeletingCondition(ctx, config.ClusterManagerName, index, err)
+					return err
 				}
-				return assets.MustCreateAssetFromTemplate(name, template, config).Data, nil
-			},
-			file,
-		)
+				controllerContext.Recorder().Eventf("CRDDeleted", "crd %s is deleted", name)
+			}
+		}
+		for _, file := range files {
+			err := helpers.CleanUpStaticObject(
+				ctx,
+				n.kubeClient,
+				n.apiExtensionClient,
+				n.apiRegistrationClient,
+				func(name string) ([]byte, error) {
+					template, err := manifests.ClusterManagerManifestFiles.ReadFile(name)
+					if err != nil {
+						return nil, err
+					}
+					return assets.MustCreateAssetFromTemplate(name, template, config).Data, nil
+				},
+				file,
+			)
+			if err != nil {
+				n.updateDeletingCondition(ctx, config.ClusterManagerName, index, err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// applyImageOverrides overwrites the component images in config with the images in
+// the image override configmap, if one is configured. A missing configmap is not an
+// error, so a hub can be installed before the configmap is mirrored.
+// hubCRDFiles returns the CRD manifest files of the given clustermanager.
+func hubCRDFiles(clusterManager *operatorapiv1.ClusterManager) []string {
+	crdFiles := append([]string{}, crdResourceFiles...)
+	if helpers.ManifestWorkReplicaSetEnabled(clusterManager) {
+		crdFiles = append(crdFiles, manifestWorkReplicaSetCRDFile)
+	}
+	return crdFiles
+}
+
+// hubStaticFiles returns the non deployment manifest files of the given
+// clustermanager, excluding the CRD files.
+func hubStaticFiles(clusterManager *operatorapiv1.ClusterManager, config hubConfig) []string {
+	files := append([]string{}, staticResourceFiles...)
+	if config.PlacementImage != "" {
+		files = append(files, placementStaticFiles...)
+	}
+	if config.AddOnManagerImage != "" {
+		files = append(files, addOnManagerStaticFiles...)
+	}
+	if helpers.ManifestWorkReplicaSetEnabled(clusterManager) {
+		files = append(files, manifestWorkReplicaSetStaticFiles...)
+	}
+	if config.Replica > 1 {
+		files = append(files, registrationPodDisruptionBudgetFile)
+		if config.PlacementImage != "" {
+			files = append(files, placementPodDisruptionBudgetFile)
+		}
+	}
+	if config.WebhookReplica > 1 {
+		files = append(files, webhookPodDisruptionBudgetFiles...)
+	}
+	if config.WebhookAutoscaling {
+		files = append(files, webhookAutoscalerFiles...)
+	}
+	if config.MetricsProxyImage != "" {
+		files = append(files, metricsProxyStaticFiles...)
+	}
+	return files
+}
+
+// filterUnsupportedAPIFiles drops the manifest files whose API group version is not
+// served by the hub and returns the group versions of the dropped files, so an older
+// hub misses its PodDisruptionBudgets instead of failing every apply. Group versions
+// whose files were not selected in the first place are not reported.
+func (n *clusterManagerController) filterUnsupportedAPIFiles(files []string) ([]string, []string, error) {
+	unsupportedAPIs := []string{}
+	for _, optional := range optionalAPIManifests {
+		supported, err := n.apiSupported(optional.groupVersion)
 		if err != nil {
-			return err
+			return nil, nil, err
+		}
+		if supported {
+			continue
+		}
+		skip := map[string]bool{}
+		for _, file := range optional.files {
+			skip[file] = true
+		}
+		remaining := []string{}
+		for _, file := range files {
+			if skip[file] {
+				continue
+			}
+			remaining = append(remaining, file)
+		}
+		if len(remaining) < len(files) {
+			unsupportedAPIs = append(unsupportedAPIs, optional.groupVersion)
+			files = remaining
+		}
+	}
+	return files, unsupportedAPIs, nil
+}
+
+// hubDeploymentFiles returns the deployment manifest files of the given clustermanager.
+func hubDeploymentFiles(clusterManager *operatorapiv1.ClusterManager, config hubConfig) []string {
+	files := append([]string{}, deploymentFiles...)
+	if config.PlacementImage != "" {
+		files = append(files, placementDeploymentFile)
+	}
+	if config.AddOnManagerImage != "" {
+		files = append(files, addOnManagerDeploymentFile)
+	}
+	if helpers.ManifestWorkReplicaSetEnabled(clusterManager) {
+		files = append(files, manifestWorkReplicaSetDeploymentFile)
+	}
+	return files
+}
+
+// buildHubConfig resolves the template values of the hub manifests from the given
+// clustermanager spec. Values that need a live cluster, i.e. the image overrides,
+// the image digests and the CA bundles, are resolved by the caller.
+func buildHubConfig(clusterManager *operatorapiv1.ClusterManager, replica int32) (hubConfig, []string, []string) {
+	config := hubConfig{
+		ClusterManagerName:      clusterManager.Name,
+		ClusterManagerNamespace: helpers.ClusterManagerDeployNamespace(clusterManager),
+		RegistrationImage:       clusterManager.Spec.RegistrationImagePullSpec,
+		WorkImage:               clusterManager.Spec.WorkImagePullSpec,
+		PlacementImage:          clusterManager.Spec.PlacementImagePullSpec,
+		Replica:                 replica,
+		PodSecurityEnforceLevel: helpers.DefaultPodSecurityEnforceLevel,
+	}
+	if helpers.AddOnManagerEnabled(clusterManager) {
+		config.AddOnManagerImage = clusterManager.Spec.AddOnManagerConfiguration.ImagePullSpec
+	}
+
+	// Determine how the webhooks are exposed. The default is ClusterIP services,
+	// which needs no extra rendering in the templates.
+	config.WebhookReplica = config.Replica
+	config.WebhookFailurePolicy = string(operatorapiv1.WebhookFailurePolicyFail)
+	config.WebhookTimeoutSeconds = 10
+	if webhookConfiguration := clusterManager.Spec.WebhookConfiguration; webhookConfiguration != nil {
+		if webhookConfiguration.Replicas > 0 {
+			config.WebhookReplica = webhookConfiguration.Replicas
+		}
+		if len(webhookConfiguration.FailurePolicy) > 0 {
+			config.WebhookFailurePolicy = string(webhookConfiguration.FailurePolicy)
+		}
+		if webhookConfiguration.TimeoutSeconds > 0 {
+			config.WebhookTimeoutSeconds = webhookConfiguration.TimeoutSeconds
+		}
+		if len(webhookConfiguration.IPFamilyPolicy) > 0 {
+			config.WebhookIPFamilyPolicy = string(webhookConfiguration.IPFamilyPolicy)
+		}
+		for _, family := range webhookConfiguration.IPFamilies {
+			config.WebhookIPFamilies = append(config.WebhookIPFamilies, string(family))
 		}
+		config.WebhookTLSMinVersion = webhookConfiguration.TLSMinVersion
+		config.WebhookCipherSuites = strings.Join(webhookConfiguration.CipherSuites, ",")
+		if autoscaling := webhookConfiguration.Autoscaling; autoscaling != nil {
+			config.WebhookAutoscaling = true
+			config.WebhookAutoscalingMinReplicas = 1
+			if autoscaling.MinReplicas > 0 {
+				config.WebhookAutoscalingMinReplicas = autoscaling.MinReplicas
+			}
+			config.WebhookAutoscalingMaxReplicas = autoscaling.MaxReplicas
+			config.WebhookAutoscalingTargetCPUUtilization = 80
+			if autoscaling.TargetCPUUtilizationPercentage > 0 {
+				config.WebhookAutoscalingTargetCPUUtilization = autoscaling.TargetCPUUtilizationPercentage
+			}
+		}
+		switch webhookConfiguration.ExposureType {
+		case operatorapiv1.WebhookExposureTypeNodePort:
+			config.RegistrationWebhookNodePort = webhookConfiguration.RegistrationNodePort
+			config.WorkWebhookNodePort = webhookConfiguration.WorkNodePort
+		case operatorapiv1.WebhookExposureTypeHostNetwork:
+			config.WebhookHostNetwork = true
+		}
+	}
+
+	// Translate the feature gates in spec into the --feature-gates flags of the hub components.
+	// Invalid feature gates are not passed to the components, and are reported with the
+	// ValidFeatureGates condition.
+	invalidFeatureGates := []string{}
+	invalidExtraFlags := []string{}
+	if clusterManager.Spec.RegistrationConfiguration != nil {
+		var invalid []string
+		config.RegistrationFeatureGates, invalid = convertFeatureGates(clusterManager.Spec.RegistrationConfiguration.FeatureGates)
+		invalidFeatureGates = append(invalidFeatureGates, invalid...)
+		config.AutoApproveUsers = strings.Join(clusterManager.Spec.RegistrationConfiguration.AutoApproveUsers, ",")
+		config.RegistrationExtraFlags, invalid = convertExtraFlags(
+			clusterManager.Spec.RegistrationConfiguration.ExtraFlags, registrationExtraFlagAllowlist)
+		invalidExtraFlags = append(invalidExtraFlags, invalid...)
+	}
+	if clusterManager.Spec.WorkConfiguration != nil {
+		var invalid []string
+		config.WorkFeatureGates, invalid = convertFeatureGates(clusterManager.Spec.WorkConfiguration.FeatureGates)
+		invalidFeatureGates = append(invalidFeatureGates, invalid...)
+		if workDriver := clusterManager.Spec.WorkConfiguration.WorkDriver; len(workDriver) > 0 && workDriver != operatorapiv1.WorkDriverTypeKube {
+			config.WorkDriver = string(workDriver)
+			config.WorkDriverConfig = clusterManager.Spec.WorkConfiguration.WorkDriverConfig
+		}
+	}
+
+	return config, invalidFeatureGates, invalidExtraFlags
+}
+
+func (n *clusterManagerController) applyImageOverrides(ctx context.Context, config *hubConfig) error {
+	if len(n.imageOverrideConfigMapName) == 0 {
+		return nil
+	}
+	configMap, err := n.kubeClient.CoreV1().ConfigMaps(n.imageOverrideConfigMapNamespace).Get(
+		ctx, n.imageOverrideConfigMapName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if image := configMap.Data["registration"]; len(image) > 0 {
+		config.RegistrationImage = image
+	}
+	if image := configMap.Data["work"]; len(image) > 0 {
+		config.WorkImage = image
+	}
+	if image := configMap.Data["placement"]; len(image) > 0 {
+		config.PlacementImage = image
+	}
+	if image := configMap.Data["addon-manager"]; len(image) > 0 && len(config.AddOnManagerImage) > 0 {
+		config.AddOnManagerImage = image
 	}
 	return nil
 }
+
+// isBundleDowngrade returns true when the current bundle version is older than the
+// applied bundle version. Empty or unparsable versions are not treated as downgrades.
+func isBundleDowngrade(currentVersion, appliedVersion string) bool {
+	if len(currentVersion) == 0 || len(appliedVersion) == 0 {
+		return false
+	}
+	current, err := versionutil.ParseGeneric(currentVersion)
+	if err != nil {
+		return false
+	}
+	applied, err := versionutil.ParseGeneric(appliedVersion)
+	if err != nil {
+		return false
+	}
+	return current.LessThan(applied)
+}
+
+// componentImageChanging returns true when a hub component that is already deployed
+// would be rolled to a different image by this sync.
+func componentImageChanging(deployedComponents []operatorapiv1.DeployedComponent, config hubConfig) bool {
+	desiredImages := map[string]struct{}{
+		config.RegistrationImage: {},
+		config.WorkImage:         {},
+		config.PlacementImage:    {},
+		config.AddOnManagerImage: {},
+	}
+	for _, component := range deployedComponents {
+		if len(component.Image) == 0 {
+			continue
+		}
+		if _, desired := desiredImages[component.Image]; !desired {
+			return true
+		}
+	}
+	return false
+}
+
+// upgradePreflightFailures runs the pre-upgrade checks and describes every check that
+// fails. An upgrade is only rolled out when the returned list is empty.
+func (n *clusterManagerController) upgradePreflightFailures(ctx context.Context, clusterManager *operatorapiv1.ClusterManager, config hubConfig) ([]string, error) {
+	failures := []string{}
+
+	// All stored versions of the hub CRDs must be migrated to the current storage
+	// version first, an upgrade that drops an old version cannot update such a CRD.
+	for _, file := range hubCRDFiles(clusterManager) {
+		template, err := manifests.ClusterManagerManifestFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		object, _, err := genericCodec.Decode(assets.MustCreateAssetFromTemplate(file, template, config).Data, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", file, err)
+		}
+		required, ok := object.(*apiextensionsv1.CustomResourceDefinition)
+		if !ok {
+			return nil, fmt.Errorf("%q is not a crd", file)
+		}
+
+		crd, err := n.apiExtensionClient.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, required.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		storageVersion := ""
+		for _, version := range crd.Spec.Versions {
+			if version.Storage {
+				storageVersion = version.Name
+			}
+		}
+		for _, storedVersion := range crd.Status.StoredVersions {
+			if storedVersion != storageVersion {
+				failures = append(failures, fmt.Sprintf("crd %s still stores objects in version %s which must be migrated to %s", crd.Name, storedVersion, storageVersion))
+			}
+		}
+	}
+
+	// The webhooks must be healthy, a webhook that rejects requests would leave the
+	// rollout half applied.
+	webhookDeployments := []string{
+		fmt.Sprintf("%s-registration-webhook", clusterManager.Name),
+		fmt.Sprintf("%s-work-webhook", clusterManager.Name),
+	}
+	for _, name := range webhookDeployments {
+		deployment, err := n.kubeClient.AppsV1().Deployments(config.ClusterManagerNamespace).Get(ctx, name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if unavailable := helpers.NumOfUnavailablePod(deployment); unavailable > 0 {
+			failures = append(failures, fmt.Sprintf("webhook deployment %s has %d unavailable replicas", name, unavailable))
+		}
+	}
+
+	// A component deployment that is still being deleted would race with the rollout.
+	for _, component := range clusterManager.Status.DeployedComponents {
+		deployment, err := n.kubeClient.AppsV1().Deployments(config.ClusterManagerNamespace).Get(ctx, component.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !deployment.DeletionTimestamp.IsZero() {
+			failures = append(failures, fmt.Sprintf("deployment %s is still being deleted", component.Name))
+		}
+	}
+
+	return failures, nil
+}
+
+// crdsExternallyManaged returns true when the hub CRDs are declared to be managed by an
+// external delivery mechanism via the crd-management annotation.
+func crdsExternallyManaged(clusterManager *operatorapiv1.ClusterManager) bool {
+	return clusterManager.Annotations[crdManagementAnnotation] == crdManagementExternal
+}
+
+// unestablishedCRDs returns the names of the hub CRDs whose Established condition
+// is not true yet. A CRD that does not exist at all counts as not established.
+func (n *clusterManagerController) unestablishedCRDs(ctx context.Context, config hubConfig, crdFiles []string) ([]string, error) {
+	unestablished := []string{}
+	for _, file := range crdFiles {
+		template, err := manifests.ClusterManagerManifestFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		object, _, err := genericCodec.Decode(assets.MustCreateAssetFromTemplate(file, template, config).Data, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", file, err)
+		}
+		required, ok := object.(*apiextensionsv1.CustomResourceDefinition)
+		if !ok {
+			return nil, fmt.Errorf("%q is not a crd", file)
+		}
+
+		crd, err := n.apiExtensionClient.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, required.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			unestablished = append(unestablished, required.Name)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		established := false
+		for _, condition := range crd.Status.Conditions {
+			if condition.Type == apiextensionsv1.Established && condition.Status == apiextensionsv1.ConditionTrue {
+				established = true
+			}
+		}
+		if !established {
+			unestablished = append(unestablished, crd.Name)
+		}
+	}
+	return unestablished, nil
+}
+
+// checkExternalCRDs verifies that the externally managed hub CRDs are present and serve
+// the versions required by this operator, and returns the resulting ValidCRDs condition.
+func (n *clusterManagerController) checkExternalCRDs(ctx context.Context, config hubConfig, crdFiles []string) (metav1.Condition, error) {
+	missing := []string{}
+	incompatible := []string{}
+	for _, file := range crdFiles {
+		template, err := manifests.ClusterManagerManifestFiles.ReadFile(file)
+		if err != nil {
+			return metav1.Condition{}, err
+		}
+		object, _, err := genericCodec.Decode(assets.MustCreateAssetFromTemplate(file, template, config).Data, nil, nil)
+		if err != nil {
+			return metav1.Condition{}, fmt.Errorf("%q: %v", file, err)
+		}
+		required, ok := object.(*apiextensionsv1.CustomResourceDefinition)
+		if !ok {
+			return metav1.Condition{}, fmt.Errorf("%q is not a crd", file)
+		}
+
+		existing, err := n.apiExtensionClient.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, required.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			missing = append(missing, required.Name)
+			continue
+		}
+		if err != nil {
+			return metav1.Condition{}, err
+		}
+
+		for _, requiredVersion := range required.Spec.Versions {
+			if !requiredVersion.Served {
+				continue
+			}
+			served := false
+			for _, existingVersion := range existing.Spec.Versions {
+				if existingVersion.Name == requiredVersion.Name && existingVersion.Served {
+					served = true
+					break
+				}
+			}
+			if !served {
+				incompatible = append(incompatible, fmt.Sprintf("%s/%s", required.Name, requiredVersion.Name))
+			}
+		}
+	}
+
+	switch {
+	case len(missing) > 0:
+		return metav1.Condition{
+			Type:    crdsValid,
+			Status:  metav1.ConditionFalse,
+			Reason:  "CRDsMissing",
+			Message: fmt.Sprintf("Externally managed CRDs are not found: %s", strings.Join(missing, ", ")),
+		}, nil
+	case len(incompatible) > 0:
+		return metav1.Condition{
+			Type:    crdsValid,
+			Status:  metav1.ConditionFalse,
+			Reason:  "IncompatibleCRDVersions",
+			Message: fmt.Sprintf("Externally managed CRDs do not serve the required versions: %s", strings.Join(incompatible, ", ")),
+		}, nil
+	default:
+		return metav1.Condition{
+			Type:    crdsValid,
+			Status:  metav1.ConditionTrue,
+			Reason:  "CRDsFunctional",
+			Message: "Externally managed CRDs are present and serve the required versions",
+		}, nil
+	}
+}
+
+// updateDeletingCondition reports the teardown progress of a deleting clustermanager by
+// listing the phases that still have resources to be removed and the error the teardown
+// is currently blocked on.
+func (n *clusterManagerController) updateDeletingCondition(ctx context.Context, clusterManagerName string, phaseIndex int, blockingErr error) {
+	remaining := []string{}
+	for _, phase := range cleanUpPhases[phaseIndex:] {
+		remaining = append(remaining, phase.name)
+	}
+	_, _, err := helpers.UpdateClusterManagerStatus(ctx, n.clusterManagerClient, clusterManagerName,
+		helpers.UpdateClusterManagerConditionFn(metav1.Condition{
+			Type:   clusterManagerDeleting,
+			Status: metav1.ConditionTrue,
+			Reason: "ResourcesRemaining",
+			Message: fmt.Sprintf("Waiting for the removal of resources in phases: %s, blocked on: %v",
+				strings.Join(remaining, ", "), blockingErr),
+		}),
+	)
+	if err != nil {
+		klog.ErrorS(err, "Failed to update the Deleting condition of ClusterManager", "controller", "ClusterManagerController", "clustermanager", clusterManagerName)
+	}
+}
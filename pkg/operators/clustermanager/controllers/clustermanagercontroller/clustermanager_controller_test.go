@@ -1,12 +1,16 @@
 package clustermanagercontroller
 
 import (
+	"context"
 	"strings"
 	"testing"
 	"time"
 
+	admissionv1 "k8s.io/api/admissionregistration/v1"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	fakeapiextensions "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -21,6 +25,8 @@ import (
 	operatorinformers "open-cluster-management.io/api/client/operator/informers/externalversions"
 	operatorapiv1 "open-cluster-management.io/api/operator/v1"
 
+	"github.com/openshift/library-go/pkg/assets"
+	"open-cluster-management.io/registration-operator/manifests"
 	"open-cluster-management.io/registration-operator/pkg/helpers"
 	testinghelper "open-cluster-management.io/registration-operator/pkg/helpers/testing"
 )
@@ -41,14 +47,19 @@ func newClusterManager(name string) *operatorapiv1.ClusterManager {
 		},
 		Spec: operatorapiv1.ClusterManagerSpec{
 			RegistrationImagePullSpec: "testregistration",
+			PlacementImagePullSpec:    "testplacement",
 		},
 	}
 }
 
-func newTestController(clustermanager *operatorapiv1.ClusterManager) *testController {
+func newTestController(clustermanager *operatorapiv1.ClusterManager, additionalClusterManagers ...*operatorapiv1.ClusterManager) *testController {
 	kubeClient := fakekube.NewSimpleClientset()
 	kubeInfomers := kubeinformers.NewSharedInformerFactory(kubeClient, 5*time.Minute)
-	fakeOperatorClient := fakeoperatorlient.NewSimpleClientset(clustermanager)
+	clusterManagers := []runtime.Object{clustermanager}
+	for _, additional := range additionalClusterManagers {
+		clusterManagers = append(clusterManagers, additional)
+	}
+	fakeOperatorClient := fakeoperatorlient.NewSimpleClientset(clusterManagers...)
 	operatorInformers := operatorinformers.NewSharedInformerFactory(fakeOperatorClient, 5*time.Minute)
 
 	hubController := &clusterManagerController{
@@ -56,10 +67,14 @@ func newTestController(clustermanager *operatorapiv1.ClusterManager) *testContro
 		clusterManagerLister: operatorInformers.Operator().V1().ClusterManagers().Lister(),
 		currentGeneration:    make([]int64, len(deploymentFiles)),
 		configMapLister:      kubeInfomers.Core().V1().ConfigMaps().Lister(),
+		nodeLister:           kubeInfomers.Core().V1().Nodes().Lister(),
 	}
 
 	store := operatorInformers.Operator().V1().ClusterManagers().Informer().GetStore()
 	store.Add(clustermanager)
+	for _, additional := range additionalClusterManagers {
+		store.Add(additional)
+	}
 
 	return &testController{
 		controller:     hubController,
@@ -69,6 +84,7 @@ func newTestController(clustermanager *operatorapiv1.ClusterManager) *testContro
 
 func (t *testController) withKubeObject(objects ...runtime.Object) *testController {
 	fakeKubeClient := fakekube.NewSimpleClientset(objects...)
+	testinghelper.EnableServerSideApplyForDeployments(fakeKubeClient)
 	t.controller.kubeClient = fakeKubeClient
 	t.kubeClient = fakeKubeClient
 	return t
@@ -76,6 +92,17 @@ func (t *testController) withKubeObject(objects ...runtime.Object) *testControll
 
 func (t *testController) withCRDObject(objects ...runtime.Object) *testController {
 	fakeAPIExtensionClient := fakeapiextensions.NewSimpleClientset(objects...)
+	// The real apiserver establishes a new crd almost immediately, emulate it so
+	// the sync can proceed past the established check.
+	fakeAPIExtensionClient.PrependReactor("create", "customresourcedefinitions",
+		func(action clienttesting.Action) (bool, runtime.Object, error) {
+			crd := action.(clienttesting.CreateActionImpl).Object.(*apiextensionsv1.CustomResourceDefinition)
+			crd.Status.Conditions = append(crd.Status.Conditions, apiextensionsv1.CustomResourceDefinitionCondition{
+				Type:   apiextensionsv1.Established,
+				Status: apiextensionsv1.ConditionTrue,
+			})
+			return false, crd, nil
+		})
 	t.controller.apiExtensionClient = fakeAPIExtensionClient
 	t.apiExtensionClient = fakeAPIExtensionClient
 	return t
@@ -96,7 +123,7 @@ func ensureObject(t *testing.T, object runtime.Object, hubCore *operatorapiv1.Cl
 
 	switch o := object.(type) {
 	case *corev1.Namespace:
-		testinghelper.AssertEqualNameNamespace(t, access.GetName(), "", helpers.ClusterManagerNamespace, "")
+		testinghelper.AssertEqualNameNamespace(t, access.GetName(), "", helpers.ClusterManagerDeployNamespace(hubCore), "")
 	case *appsv1.Deployment:
 		if strings.Contains(o.Name, "registration") && hubCore.Spec.RegistrationImagePullSpec != o.Spec.Template.Spec.Containers[0].Image {
 			t.Errorf("Registration image does not match to the expected.")
@@ -160,14 +187,16 @@ func TestSyncDeploy(t *testing.T) {
 	testinghelper.AssertAction(t, clusterManagerAction[1], "update")
 	testinghelper.AssertOnlyConditions(
 		t, clusterManagerAction[1].(clienttesting.UpdateActionImpl).Object,
+		testinghelper.NamedCondition(featureGatesValid, "FeatureGatesAllValid", metav1.ConditionTrue),
+		testinghelper.NamedCondition(bundleVersionValid, "BundleVersionValid", metav1.ConditionTrue),
 		testinghelper.NamedCondition(clusterManagerApplied, "ClusterManagerApplied", metav1.ConditionTrue))
 }
 
-// TestSyncDelete test cleanup hub deploy
-func TestSyncDelete(t *testing.T) {
+// TestSyncDeployNoPlacement tests that placement resources are not deployed when
+// the placement image pull spec is not set
+func TestSyncDeployNoPlacement(t *testing.T) {
 	clusterManager := newClusterManager("testhub")
-	now := metav1.Now()
-	clusterManager.ObjectMeta.SetDeletionTimestamp(&now)
+	clusterManager.Spec.PlacementImagePullSpec = ""
 	controller := newTestController(clusterManager).withCRDObject().withKubeObject().withAPIServiceObject()
 	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
 
@@ -176,73 +205,1175 @@ func TestSyncDelete(t *testing.T) {
 		t.Errorf("Expected non error when sync, %v", err)
 	}
 
-	deleteKubeActions := []clienttesting.DeleteActionImpl{}
 	kubeActions := controller.kubeClient.Actions()
 	for _, action := range kubeActions {
-		if action.GetVerb() == "delete" {
-			deleteKubeAction := action.(clienttesting.DeleteActionImpl)
-			deleteKubeActions = append(deleteKubeActions, deleteKubeAction)
+		if action.GetVerb() != "create" {
+			continue
+		}
+		object := action.(clienttesting.CreateActionImpl).Object
+		accessor, _ := meta.Accessor(object)
+		if strings.Contains(accessor.GetName(), "placement") {
+			t.Errorf("Expected no placement resource created, got %q", accessor.GetName())
 		}
 	}
-	testinghelper.AssertEqualNumber(t, len(deleteKubeActions), 19)
+}
 
-	deleteCRDActions := []clienttesting.DeleteActionImpl{}
-	crdActions := controller.apiExtensionClient.Actions()
-	for _, action := range crdActions {
-		if action.GetVerb() == "delete" {
-			deleteCRDAction := action.(clienttesting.DeleteActionImpl)
-			deleteCRDActions = append(deleteCRDActions, deleteCRDAction)
+// TestSyncDeployAddOnManager tests that addon manager resources are deployed when
+// the addon manager is enabled in spec
+func TestSyncDeployAddOnManager(t *testing.T) {
+	clusterManager := newClusterManager("testhub")
+	clusterManager.Spec.AddOnManagerConfiguration = &operatorapiv1.AddOnManagerConfiguration{
+		Enabled:       true,
+		ImagePullSpec: "testaddonmanager",
+	}
+	controller := newTestController(clusterManager).withCRDObject().withKubeObject().withAPIServiceObject()
+	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	addOnManagerDeploymentFound := false
+	kubeActions := controller.kubeClient.Actions()
+	for _, action := range kubeActions {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		deployment, ok := action.(clienttesting.CreateActionImpl).Object.(*appsv1.Deployment)
+		if !ok || !strings.Contains(deployment.Name, "addon-manager-controller") {
+			continue
+		}
+		addOnManagerDeploymentFound = true
+		if deployment.Spec.Template.Spec.Containers[0].Image != "testaddonmanager" {
+			t.Errorf("AddOn manager image does not match to the expected.")
 		}
 	}
-	// Check if resources are created as expected
-	testinghelper.AssertEqualNumber(t, len(deleteCRDActions), 10)
+	if !addOnManagerDeploymentFound {
+		t.Errorf("Expected the addon manager deployment to be created")
+	}
+}
 
-	deleteAPIServiceActions := []clienttesting.DeleteActionImpl{}
-	apiServiceActions := controller.apiRegistrationClient.Actions()
-	for _, action := range apiServiceActions {
-		if action.GetVerb() == "delete" {
-			deleteAPIServiceAction := action.(clienttesting.DeleteActionImpl)
-			deleteAPIServiceActions = append(deleteAPIServiceActions, deleteAPIServiceAction)
+// TestSyncDeployManifestWorkReplicaSet tests that the manifestworkreplicaset controller
+// and its CRD are deployed when the component is enabled in spec
+func TestSyncDeployManifestWorkReplicaSet(t *testing.T) {
+	clusterManager := newClusterManager("testhub")
+	clusterManager.Spec.WorkImagePullSpec = "testwork"
+	clusterManager.Spec.WorkConfiguration = &operatorapiv1.WorkConfiguration{
+		ManifestWorkReplicaSetEnabled: true,
+	}
+	controller := newTestController(clusterManager).withCRDObject().withKubeObject().withAPIServiceObject()
+	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	deploymentFound := false
+	kubeActions := controller.kubeClient.Actions()
+	for _, action := range kubeActions {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		deployment, ok := action.(clienttesting.CreateActionImpl).Object.(*appsv1.Deployment)
+		if !ok || !strings.Contains(deployment.Name, "manifestworkreplicaset-controller") {
+			continue
+		}
+		deploymentFound = true
+		if deployment.Spec.Template.Spec.Containers[0].Image != clusterManager.Spec.WorkImagePullSpec {
+			t.Errorf("ManifestWorkReplicaSet controller image does not match to the expected.")
 		}
 	}
-	// Check if resources are created as expected
-	testinghelper.AssertEqualNumber(t, len(deleteAPIServiceActions), 2)
+	if !deploymentFound {
+		t.Errorf("Expected the manifestworkreplicaset controller deployment to be created")
+	}
 
-	for _, action := range deleteKubeActions {
-		switch action.Resource.Resource {
-		case "namespaces":
-			testinghelper.AssertEqualNameNamespace(t, action.Name, "", helpers.ClusterManagerNamespace, "")
+	crdFound := false
+	for _, action := range controller.apiExtensionClient.Actions() {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		object := action.(clienttesting.CreateActionImpl).Object
+		accessor, _ := meta.Accessor(object)
+		if accessor.GetName() == "manifestworkreplicasets.work.open-cluster-management.io" {
+			crdFound = true
+		}
+	}
+	if !crdFound {
+		t.Errorf("Expected the manifestworkreplicaset crd to be created")
+	}
+}
+
+// TestSyncDeployWithFeatureGates tests that feature gates in spec are translated into
+// the --feature-gates flag of hub components, and invalid gates are reported via condition
+func TestSyncDeployWithFeatureGates(t *testing.T) {
+	clusterManager := newClusterManager("testhub")
+	clusterManager.Spec.RegistrationConfiguration = &operatorapiv1.RegistrationHubConfiguration{
+		FeatureGates: []operatorapiv1.FeatureGate{
+			{Feature: "Foo", Mode: operatorapiv1.FeatureGateModeTypeEnable},
+			{Feature: "Bar"},
+			{Feature: "invalid=gate", Mode: operatorapiv1.FeatureGateModeTypeEnable},
+		},
+	}
+	controller := newTestController(clusterManager).withCRDObject().withKubeObject().withAPIServiceObject()
+	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	featureGateArgFound := false
+	kubeActions := controller.kubeClient.Actions()
+	for _, action := range kubeActions {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		deployment, ok := action.(clienttesting.CreateActionImpl).Object.(*appsv1.Deployment)
+		if !ok || !strings.Contains(deployment.Name, "registration-controller") {
+			continue
 		}
+		for _, arg := range deployment.Spec.Template.Spec.Containers[0].Args {
+			if arg == "--feature-gates=Foo=true,Bar=false" {
+				featureGateArgFound = true
+			}
+		}
+	}
+	if !featureGateArgFound {
+		t.Errorf("Expected the rendered registration deployment to have the feature gate flag")
 	}
+
+	clusterManagerAction := controller.operatorClient.Actions()
+	testinghelper.AssertAction(t, clusterManagerAction[1], "update")
+	testinghelper.AssertOnlyConditions(
+		t, clusterManagerAction[1].(clienttesting.UpdateActionImpl).Object,
+		testinghelper.NamedCondition(featureGatesValid, "InvalidFeatureGatesExisting", metav1.ConditionFalse),
+		testinghelper.NamedCondition(bundleVersionValid, "BundleVersionValid", metav1.ConditionTrue),
+		testinghelper.NamedCondition(clusterManagerApplied, "ClusterManagerApplied", metav1.ConditionTrue))
 }
 
-// TestDeleteCRD test delete crds
-func TestDeleteCRD(t *testing.T) {
+// TestSyncDeployWithExtraFlags tests that the allowlisted extra flags in spec are
+// rendered into the registration controller args, and the flags not on the allowlist
+// or with values that would corrupt the rendered manifest are reported via condition
+func TestSyncDeployWithExtraFlags(t *testing.T) {
 	clusterManager := newClusterManager("testhub")
-	now := metav1.Now()
-	clusterManager.ObjectMeta.SetDeletionTimestamp(&now)
-	crd := &apiextensionsv1.CustomResourceDefinition{
+	clusterManager.Spec.RegistrationConfiguration = &operatorapiv1.RegistrationHubConfiguration{
+		ExtraFlags: []operatorapiv1.ExtraFlag{
+			{Name: "cluster-lease-duration-seconds", Value: "120"},
+			{Name: "v", Value: "6"},
+			{Name: "kube-api-qps", Value: "50\"\n        image: attacker/image"},
+		},
+	}
+	controller := newTestController(clusterManager).withCRDObject().withKubeObject().withAPIServiceObject()
+	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	leaseFlagFound := false
+	verbosityFlagFound := false
+	qpsFlagFound := false
+	kubeActions := controller.kubeClient.Actions()
+	for _, action := range kubeActions {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		deployment, ok := action.(clienttesting.CreateActionImpl).Object.(*appsv1.Deployment)
+		if !ok || !strings.Contains(deployment.Name, "registration-controller") {
+			continue
+		}
+		for _, arg := range deployment.Spec.Template.Spec.Containers[0].Args {
+			if arg == "--cluster-lease-duration-seconds=120" {
+				leaseFlagFound = true
+			}
+			if arg == "--v=6" {
+				verbosityFlagFound = true
+			}
+			if strings.HasPrefix(arg, "--kube-api-qps") {
+				qpsFlagFound = true
+			}
+		}
+	}
+	if !leaseFlagFound {
+		t.Errorf("Expected the rendered registration deployment to have the allowlisted extra flag")
+	}
+	if verbosityFlagFound {
+		t.Errorf("Expected the extra flag not on the allowlist to be dropped")
+	}
+	if qpsFlagFound {
+		t.Errorf("Expected the extra flag with a malformed value to be dropped")
+	}
+
+	clusterManagerAction := controller.operatorClient.Actions()
+	testinghelper.AssertAction(t, clusterManagerAction[1], "update")
+	testinghelper.AssertOnlyConditions(
+		t, clusterManagerAction[1].(clienttesting.UpdateActionImpl).Object,
+		testinghelper.NamedCondition(featureGatesValid, "FeatureGatesAllValid", metav1.ConditionTrue),
+		testinghelper.NamedCondition(extraFlagsValid, "UnsupportedExtraFlagsExisting", metav1.ConditionFalse),
+		testinghelper.NamedCondition(bundleVersionValid, "BundleVersionValid", metav1.ConditionTrue),
+		testinghelper.NamedCondition(clusterManagerApplied, "ClusterManagerApplied", metav1.ConditionTrue))
+}
+
+// TestSyncUpgradeBlockedByPreflight tests that a component image change is held back
+// with the UpgradePreflightFailed condition when a preflight check fails, and that no
+// deployments are rolled out
+func TestSyncUpgradeBlockedByPreflight(t *testing.T) {
+	clusterManager := newClusterManager("testhub")
+	clusterManager.Status.DeployedComponents = []operatorapiv1.DeployedComponent{
+		{Name: "testhub-registration-controller", Image: "oldregistration"},
+	}
+	// A webhook deployment without available replicas fails the preflight checks
+	brokenWebhook := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: crdNames[0],
+			Name:      "testhub-registration-webhook",
+			Namespace: helpers.ClusterManagerDeployNamespace(clusterManager),
 		},
 	}
-	controller := newTestController(clusterManager).withCRDObject(crd).withKubeObject().withAPIServiceObject()
+	controller := newTestController(clusterManager).withCRDObject().withKubeObject(brokenWebhook).withAPIServiceObject()
+	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
 
-	// Return crd with the first get, and return not found with the 2nd get
-	getCount := 0
-	controller.apiExtensionClient.PrependReactor("get", "customresourcedefinitions", func(action clienttesting.Action) (handled bool, ret runtime.Object, err error) {
-		if getCount == 0 {
-			getCount = getCount + 1
-			return true, crd, nil
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() != "create" {
+			continue
 		}
-		return true, &apiextensionsv1.CustomResourceDefinition{}, errors.NewNotFound(
-			apiextensionsv1.Resource("customresourcedefinitions"), crdNames[0])
+		if _, ok := action.(clienttesting.CreateActionImpl).Object.(*appsv1.Deployment); ok {
+			t.Errorf("Expected no deployment to be rolled out while the upgrade is blocked")
+		}
+	}
 
-	})
+	clusterManagerAction := controller.operatorClient.Actions()
+	testinghelper.AssertAction(t, clusterManagerAction[1], "update")
+	testinghelper.AssertOnlyConditions(
+		t, clusterManagerAction[1].(clienttesting.UpdateActionImpl).Object,
+		testinghelper.NamedCondition(upgradePreflightFailed, "PreflightChecksFailed", metav1.ConditionTrue))
+}
+
+// TestSyncRollbackToLastKnownGoodImages tests that the deployments are reverted to the
+// last-known-good images recorded in status while the image-rollback annotation is set
+func TestSyncRollbackToLastKnownGoodImages(t *testing.T) {
+	clusterManager := newClusterManager("testhub")
+	clusterManager.Annotations = map[string]string{imageRollbackAnnotation: "true"}
+	clusterManager.Spec.RegistrationImagePullSpec = "badregistration"
+	clusterManager.Status.LastKnownGoodImages = map[string]string{
+		"testhub-registration-controller": "goodregistration",
+	}
+	controller := newTestController(clusterManager).withCRDObject().withKubeObject().withAPIServiceObject()
 	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
+
 	err := controller.controller.sync(nil, syncContext)
-	if err == nil {
-		t.Errorf("Expected error when sync")
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	registrationDeploymentFound := false
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		deployment, ok := action.(clienttesting.CreateActionImpl).Object.(*appsv1.Deployment)
+		if !ok || !strings.Contains(deployment.Name, "registration-controller") {
+			continue
+		}
+		registrationDeploymentFound = true
+		if image := deployment.Spec.Template.Spec.Containers[0].Image; image != "goodregistration" {
+			t.Errorf("Expected the registration deployment to be reverted to the last known good image, got %q", image)
+		}
+	}
+	if !registrationDeploymentFound {
+		t.Errorf("Expected the registration deployment to be applied")
+	}
+}
+
+// TestSyncDeployAutoApproveUsers tests that the auto approve users in spec are rendered
+// into the --cluster-auto-approval-users flag of the registration controller
+func TestSyncDeployAutoApproveUsers(t *testing.T) {
+	clusterManager := newClusterManager("testhub")
+	clusterManager.Spec.RegistrationConfiguration = &operatorapiv1.RegistrationHubConfiguration{
+		AutoApproveUsers: []string{"user1", "user2"},
+	}
+	controller := newTestController(clusterManager).withCRDObject().withKubeObject().withAPIServiceObject()
+	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	autoApproveArgFound := false
+	kubeActions := controller.kubeClient.Actions()
+	for _, action := range kubeActions {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		deployment, ok := action.(clienttesting.CreateActionImpl).Object.(*appsv1.Deployment)
+		if !ok || !strings.Contains(deployment.Name, "registration-controller") {
+			continue
+		}
+		for _, arg := range deployment.Spec.Template.Spec.Containers[0].Args {
+			if arg == "--cluster-auto-approval-users=user1,user2" {
+				autoApproveArgFound = true
+			}
+		}
+	}
+	if !autoApproveArgFound {
+		t.Errorf("Expected the rendered registration deployment to have the auto approval users flag")
+	}
+}
+
+// TestSyncDeployWebhookNodePort tests that the webhook services are exposed with
+// NodePort services when the exposure type is NodePort
+func TestSyncDeployWebhookNodePort(t *testing.T) {
+	clusterManager := newClusterManager("testhub")
+	clusterManager.Spec.WebhookConfiguration = &operatorapiv1.WebhookConfiguration{
+		ExposureType:         operatorapiv1.WebhookExposureTypeNodePort,
+		RegistrationNodePort: 30443,
+		WorkNodePort:         31443,
+	}
+	controller := newTestController(clusterManager).withCRDObject().withKubeObject().withAPIServiceObject()
+	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	nodePorts := map[string]int32{}
+	kubeActions := controller.kubeClient.Actions()
+	for _, action := range kubeActions {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		service, ok := action.(clienttesting.CreateActionImpl).Object.(*corev1.Service)
+		if !ok {
+			continue
+		}
+		if service.Spec.Type != corev1.ServiceTypeNodePort {
+			t.Errorf("Expected service %q to be of type NodePort, got %q", service.Name, service.Spec.Type)
+		}
+		nodePorts[service.Name] = service.Spec.Ports[0].NodePort
+	}
+	if nodePorts[helpers.RegistrationWebhookService] != 30443 {
+		t.Errorf("Expected registration webhook node port 30443, got %d", nodePorts[helpers.RegistrationWebhookService])
+	}
+	if nodePorts[helpers.WorkWebhookService] != 31443 {
+		t.Errorf("Expected work webhook node port 31443, got %d", nodePorts[helpers.WorkWebhookService])
+	}
+}
+
+// TestSyncDeployImageOverrides tests that the images in the image override
+// configmap are preferred over the image pull specs in the clustermanager spec
+func TestSyncDeployImageOverrides(t *testing.T) {
+	clusterManager := newClusterManager("testhub")
+	imageConfigMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "image-manifest",
+			Namespace: "open-cluster-management",
+		},
+		Data: map[string]string{
+			"registration": "mirror.example.com/registration:latest",
+			"placement":    "mirror.example.com/placement:latest",
+		},
+	}
+	controller := newTestController(clusterManager).withCRDObject().withKubeObject(imageConfigMap).withAPIServiceObject()
+	controller.controller.imageOverrideConfigMapNamespace = "open-cluster-management"
+	controller.controller.imageOverrideConfigMapName = "image-manifest"
+	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		deployment, ok := action.(clienttesting.CreateActionImpl).Object.(*appsv1.Deployment)
+		if !ok {
+			continue
+		}
+		image := deployment.Spec.Template.Spec.Containers[0].Image
+		switch {
+		case strings.Contains(deployment.Name, "registration") && image != "mirror.example.com/registration:latest":
+			t.Errorf("Expected deployment %q to use the overridden registration image, got %q", deployment.Name, image)
+		case strings.Contains(deployment.Name, "placement") && image != "mirror.example.com/placement:latest":
+			t.Errorf("Expected deployment %q to use the overridden placement image, got %q", deployment.Name, image)
+		case strings.Contains(deployment.Name, "work") && image != clusterManager.Spec.WorkImagePullSpec:
+			t.Errorf("Expected deployment %q to keep the image pull spec in spec, got %q", deployment.Name, image)
+		}
+	}
+}
+
+// TestSyncDeployPinImageDigests tests that the component images are pinned to the
+// digests recorded in status or resolved from the running pods
+func TestSyncDeployPinImageDigests(t *testing.T) {
+	registrationDigest := "quay.io/open-cluster-management/registration@sha256:aaa"
+	workDigest := "quay.io/open-cluster-management/work@sha256:bbb"
+
+	clusterManager := newClusterManager("testhub")
+	clusterManager.Spec.WorkImagePullSpec = "testwork"
+	clusterManager.Spec.PinImageDigests = true
+	clusterManager.Status.ResolvedImages = map[string]string{
+		"testregistration": registrationDigest,
+	}
+	workPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "work-webhook-pod", Namespace: helpers.ClusterManagerNamespace},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Image: "testwork", ImageID: "docker-pullable://" + workDigest},
+			},
+		},
+	}
+	controller := newTestController(clusterManager).withCRDObject().withKubeObject(workPod).withAPIServiceObject()
+	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		deployment, ok := action.(clienttesting.CreateActionImpl).Object.(*appsv1.Deployment)
+		if !ok {
+			continue
+		}
+		image := deployment.Spec.Template.Spec.Containers[0].Image
+		if strings.Contains(deployment.Name, "registration") && image != registrationDigest {
+			t.Errorf("Expected deployment %q to be pinned to the recorded digest, got %q", deployment.Name, image)
+		}
+		if strings.Contains(deployment.Name, "work") && image != workDigest {
+			t.Errorf("Expected deployment %q to be pinned to the resolved digest, got %q", deployment.Name, image)
+		}
+	}
+
+	var updatedClusterManager *operatorapiv1.ClusterManager
+	for _, action := range controller.operatorClient.Actions() {
+		if action.GetVerb() == "update" {
+			updatedClusterManager = action.(clienttesting.UpdateActionImpl).Object.(*operatorapiv1.ClusterManager)
+		}
+	}
+	if updatedClusterManager == nil {
+		t.Fatalf("Expected the clustermanager status to be updated")
+	}
+	if updatedClusterManager.Status.ResolvedImages["testwork"] != workDigest {
+		t.Errorf("Expected the resolved work digest to be recorded in status, got %v", updatedClusterManager.Status.ResolvedImages)
+	}
+	if updatedClusterManager.Status.ResolvedImages["testregistration"] != registrationDigest {
+		t.Errorf("Expected the recorded registration digest to be kept in status, got %v", updatedClusterManager.Status.ResolvedImages)
+	}
+}
+
+// TestSyncDeployPodDisruptionBudgets tests that PodDisruptionBudgets are created
+// for the multi-replica hub deployments in high availability mode
+func TestSyncDeployPodDisruptionBudgets(t *testing.T) {
+	clusterManager := newClusterManager("testhub")
+	clusterManager.Spec.AvailabilityConfig = operatorapiv1.HighAvailability
+	controller := newTestController(clusterManager).withCRDObject().withKubeObject().withAPIServiceObject()
+	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
+
+	err := controller.controller.sync(context.TODO(), syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	createdPDBs := map[string]bool{}
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		pdb, ok := action.(clienttesting.CreateActionImpl).Object.(*policyv1.PodDisruptionBudget)
+		if !ok {
+			continue
+		}
+		if pdb.Spec.MinAvailable == nil || pdb.Spec.MinAvailable.IntValue() != 1 {
+			t.Errorf("Expected pdb %q to have minAvailable 1", pdb.Name)
+		}
+		createdPDBs[pdb.Name] = true
+	}
+	expectedPDBs := []string{
+		"cluster-manager-registration-controller",
+		"cluster-manager-placement-controller",
+		"cluster-manager-registration-webhook",
+		"cluster-manager-work-webhook",
+	}
+	for _, name := range expectedPDBs {
+		if !createdPDBs[name] {
+			t.Errorf("Expected pdb %q to be created", name)
+		}
+	}
+	if len(createdPDBs) != len(expectedPDBs) {
+		t.Errorf("Expected %d pdbs to be created, got %d", len(expectedPDBs), len(createdPDBs))
+	}
+}
+
+// TestSyncSkipUnsupportedAPIManifests tests that the manifests of an API group
+// version the hub does not serve are skipped and reported in the UnsupportedAPI
+// condition instead of failing the apply loop
+func TestSyncSkipUnsupportedAPIManifests(t *testing.T) {
+	clusterManager := newClusterManager("testhub")
+	clusterManager.Spec.AvailabilityConfig = operatorapiv1.HighAvailability
+	controller := newTestController(clusterManager).withCRDObject().withKubeObject().withAPIServiceObject()
+	controller.controller.apiSupported = func(groupVersion string) (bool, error) {
+		return groupVersion != "policy/v1", nil
+	}
+	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
+
+	err := controller.controller.sync(context.TODO(), syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		if pdb, ok := action.(clienttesting.CreateActionImpl).Object.(*policyv1.PodDisruptionBudget); ok {
+			t.Errorf("Expected no pdb to be created without policy/v1, got %q", pdb.Name)
+		}
+	}
+
+	var updatedClusterManager *operatorapiv1.ClusterManager
+	for _, action := range controller.operatorClient.Actions() {
+		if action.GetVerb() == "update" {
+			updatedClusterManager = action.(clienttesting.UpdateActionImpl).Object.(*operatorapiv1.ClusterManager)
+		}
+	}
+	if updatedClusterManager == nil {
+		t.Fatalf("Expected the clustermanager status to be updated")
+	}
+	condition := meta.FindStatusCondition(updatedClusterManager.Status.Conditions, unsupportedAPI)
+	if condition == nil || condition.Status != metav1.ConditionTrue || condition.Reason != "OptionalAPIsNotServed" {
+		t.Errorf("Expected the UnsupportedAPI condition to report policy/v1, got %v", condition)
+	}
+	if condition != nil && !strings.Contains(condition.Message, "policy/v1") {
+		t.Errorf("Expected the UnsupportedAPI condition message to list policy/v1, got %q", condition.Message)
+	}
+}
+
+// TestSyncDeployWebhookAutoscaling tests that HorizontalPodAutoscalers are created
+// for the webhook deployments when autoscaling is enabled, and that the replicas of
+// the webhook deployments are left to the autoscalers
+func TestSyncDeployWebhookAutoscaling(t *testing.T) {
+	clusterManager := newClusterManager("testhub")
+	clusterManager.Spec.WebhookConfiguration = &operatorapiv1.WebhookConfiguration{
+		Autoscaling: &operatorapiv1.WebhookAutoscalingConfiguration{
+			MaxReplicas: 5,
+		},
+	}
+	controller := newTestController(clusterManager).withCRDObject().withKubeObject().withAPIServiceObject()
+	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	autoscalerCount := 0
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		switch object := action.(clienttesting.CreateActionImpl).Object.(type) {
+		case *autoscalingv1.HorizontalPodAutoscaler:
+			autoscalerCount = autoscalerCount + 1
+			if object.Spec.MinReplicas == nil || *object.Spec.MinReplicas != 1 {
+				t.Errorf("Expected autoscaler %q to have min replicas 1", object.Name)
+			}
+			if object.Spec.MaxReplicas != 5 {
+				t.Errorf("Expected autoscaler %q to have max replicas 5, got %d", object.Name, object.Spec.MaxReplicas)
+			}
+			if object.Spec.TargetCPUUtilizationPercentage == nil || *object.Spec.TargetCPUUtilizationPercentage != 80 {
+				t.Errorf("Expected autoscaler %q to have target cpu utilization 80", object.Name)
+			}
+		case *appsv1.Deployment:
+			if strings.Contains(object.Name, "webhook") && object.Spec.Replicas != nil {
+				t.Errorf("Expected webhook deployment %q to leave the replicas to the autoscaler", object.Name)
+			}
+		}
+	}
+	if autoscalerCount != 2 {
+		t.Errorf("Expected 2 autoscalers to be created, got %d", autoscalerCount)
+	}
+}
+
+// TestSyncDeployWebhookIPFamilies tests that the ip family policy and ip families
+// in the webhook configuration are rendered into the webhook services
+func TestSyncDeployWebhookIPFamilies(t *testing.T) {
+	clusterManager := newClusterManager("testhub")
+	clusterManager.Spec.WebhookConfiguration = &operatorapiv1.WebhookConfiguration{
+		IPFamilyPolicy: operatorapiv1.IPFamilyPolicySingleStack,
+		IPFamilies:     []operatorapiv1.IPFamilyType{operatorapiv1.IPv6Family},
+	}
+	controller := newTestController(clusterManager).withCRDObject().withKubeObject().withAPIServiceObject()
+	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	webhookServiceCount := 0
+	kubeActions := controller.kubeClient.Actions()
+	for _, action := range kubeActions {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		service, ok := action.(clienttesting.CreateActionImpl).Object.(*corev1.Service)
+		if !ok {
+			continue
+		}
+		webhookServiceCount = webhookServiceCount + 1
+		if service.Spec.IPFamilyPolicy == nil || *service.Spec.IPFamilyPolicy != corev1.IPFamilyPolicySingleStack {
+			t.Errorf("Expected service %q to have the SingleStack ip family policy", service.Name)
+		}
+		if len(service.Spec.IPFamilies) != 1 || service.Spec.IPFamilies[0] != corev1.IPv6Protocol {
+			t.Errorf("Expected service %q to have the IPv6 ip family, got %v", service.Name, service.Spec.IPFamilies)
+		}
+	}
+	if webhookServiceCount != 2 {
+		t.Errorf("Expected 2 webhook services to be created, got %d", webhookServiceCount)
+	}
+}
+
+// TestSyncDeployWebhookHostNetwork tests that the webhook pods run on the host
+// network when the exposure type is HostNetwork
+func TestSyncDeployWebhookHostNetwork(t *testing.T) {
+	clusterManager := newClusterManager("testhub")
+	clusterManager.Spec.WebhookConfiguration = &operatorapiv1.WebhookConfiguration{
+		ExposureType: operatorapiv1.WebhookExposureTypeHostNetwork,
+	}
+	controller := newTestController(clusterManager).withCRDObject().withKubeObject().withAPIServiceObject()
+	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	kubeActions := controller.kubeClient.Actions()
+	for _, action := range kubeActions {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		switch object := action.(clienttesting.CreateActionImpl).Object.(type) {
+		case *corev1.Service:
+			if object.Spec.Type == corev1.ServiceTypeNodePort {
+				t.Errorf("Expected service %q not to be of type NodePort", object.Name)
+			}
+		case *appsv1.Deployment:
+			isWebhook := strings.Contains(object.Name, "webhook")
+			if isWebhook && !object.Spec.Template.Spec.HostNetwork {
+				t.Errorf("Expected webhook deployment %q to run on the host network", object.Name)
+			}
+			if !isWebhook && object.Spec.Template.Spec.HostNetwork {
+				t.Errorf("Expected deployment %q not to run on the host network", object.Name)
+			}
+		}
+	}
+}
+
+func newExternalHubCRDs(t *testing.T) []runtime.Object {
+	config := hubConfig{ClusterManagerName: "testhub"}
+	objects := []runtime.Object{}
+	for _, file := range crdResourceFiles {
+		template, err := manifests.ClusterManagerManifestFiles.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Unable to read crd manifest %q: %v", file, err)
+		}
+		object, _, err := genericCodec.Decode(assets.MustCreateAssetFromTemplate(file, template, config).Data, nil, nil)
+		if err != nil {
+			t.Fatalf("Unable to decode crd manifest %q: %v", file, err)
+		}
+		objects = append(objects, object)
+	}
+	return objects
+}
+
+// TestSyncExternallyManagedCRDs tests that the hub CRDs are only verified, not applied,
+// when they are declared to be externally managed.
+func TestSyncExternallyManagedCRDs(t *testing.T) {
+	clusterManager := newClusterManager("testhub")
+	clusterManager.Annotations = map[string]string{crdManagementAnnotation: crdManagementExternal}
+	controller := newTestController(clusterManager).withCRDObject().withKubeObject().withAPIServiceObject()
+	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Fatalf("Expected no error when sync, %v", err)
+	}
+
+	for _, action := range controller.apiExtensionClient.Actions() {
+		if action.GetVerb() == "create" {
+			t.Errorf("Expected no crd to be created, got %v", action)
+		}
+	}
+
+	updatedClusterManager, err := controller.operatorClient.OperatorV1().ClusterManagers().Get(context.TODO(), "testhub", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error when get clustermanager: %v", err)
+	}
+	crdsValidCondition := meta.FindStatusCondition(updatedClusterManager.Status.Conditions, crdsValid)
+	if crdsValidCondition == nil || crdsValidCondition.Status != metav1.ConditionFalse || crdsValidCondition.Reason != "CRDsMissing" {
+		t.Errorf("Expected the ValidCRDs condition to report missing crds, got %v", crdsValidCondition)
+	}
+
+	// The condition turns true once the CRDs are installed by the external mechanism.
+	controller = newTestController(clusterManager).withCRDObject(newExternalHubCRDs(t)...).withKubeObject().withAPIServiceObject()
+	err = controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Fatalf("Expected no error when sync, %v", err)
+	}
+
+	updatedClusterManager, err = controller.operatorClient.OperatorV1().ClusterManagers().Get(context.TODO(), "testhub", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error when get clustermanager: %v", err)
+	}
+	crdsValidCondition = meta.FindStatusCondition(updatedClusterManager.Status.Conditions, crdsValid)
+	if crdsValidCondition == nil || crdsValidCondition.Status != metav1.ConditionTrue {
+		t.Errorf("Expected the ValidCRDs condition to be true, got %v", crdsValidCondition)
+	}
+}
+
+// TestSyncDeployCustomNamespace tests that the hub components are deployed in the
+// namespace configured in spec instead of the default namespace
+func TestSyncDeployCustomNamespace(t *testing.T) {
+	clusterManager := newClusterManager("testhub")
+	clusterManager.Spec.Namespace = "open-cluster-management-custom-hub"
+	controller := newTestController(clusterManager).withCRDObject().withKubeObject().withAPIServiceObject()
+	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Fatalf("Expected no error when sync, %v", err)
+	}
+
+	namespaceCreated := false
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		object := action.(clienttesting.CreateActionImpl).Object
+		switch o := object.(type) {
+		case *corev1.Namespace:
+			namespaceCreated = true
+			ensureObject(t, object, clusterManager)
+		case *appsv1.Deployment:
+			if o.Namespace != "open-cluster-management-custom-hub" {
+				t.Errorf("Expected deployment %q to be created in the custom namespace, got %q", o.Name, o.Namespace)
+			}
+		}
+	}
+	if !namespaceCreated {
+		t.Errorf("Expected the custom namespace to be created")
+	}
+}
+
+// TestSyncBlockDowngrade tests that the sync refuses to apply manifests of a bundle that
+// is older than the one recorded in the clustermanager status
+func TestSyncBlockDowngrade(t *testing.T) {
+	defer func(bundleVersion string) { BundleVersion = bundleVersion }(BundleVersion)
+
+	BundleVersion = "v0.9.0"
+	clusterManager := newClusterManager("testhub")
+	clusterManager.Status.AppliedBundleVersion = "v0.10.0"
+	controller := newTestController(clusterManager).withCRDObject().withKubeObject().withAPIServiceObject()
+	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Fatalf("Expected no error when sync, %v", err)
+	}
+
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() == "create" {
+			t.Errorf("Expected no resource to be created, got %v", action)
+		}
+	}
+
+	updatedClusterManager, err := controller.operatorClient.OperatorV1().ClusterManagers().Get(context.TODO(), "testhub", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error when get clustermanager: %v", err)
+	}
+	bundleVersionCondition := meta.FindStatusCondition(updatedClusterManager.Status.Conditions, bundleVersionValid)
+	if bundleVersionCondition == nil || bundleVersionCondition.Status != metav1.ConditionFalse || bundleVersionCondition.Reason != "UnsupportedDowngrade" {
+		t.Errorf("Expected the ValidBundleVersion condition to report the downgrade, got %v", bundleVersionCondition)
+	}
+	if updatedClusterManager.Status.AppliedBundleVersion != "v0.10.0" {
+		t.Errorf("Expected the applied bundle version to be unchanged, got %q", updatedClusterManager.Status.AppliedBundleVersion)
+	}
+
+	// An upgrade is applied and recorded in the status.
+	BundleVersion = "v0.11.0"
+	err = controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Fatalf("Expected no error when sync, %v", err)
+	}
+
+	updatedClusterManager, err = controller.operatorClient.OperatorV1().ClusterManagers().Get(context.TODO(), "testhub", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error when get clustermanager: %v", err)
+	}
+	bundleVersionCondition = meta.FindStatusCondition(updatedClusterManager.Status.Conditions, bundleVersionValid)
+	if bundleVersionCondition == nil || bundleVersionCondition.Status != metav1.ConditionTrue {
+		t.Errorf("Expected the ValidBundleVersion condition to be true, got %v", bundleVersionCondition)
+	}
+	if updatedClusterManager.Status.AppliedBundleVersion != "v0.11.0" {
+		t.Errorf("Expected the applied bundle version to be recorded, got %q", updatedClusterManager.Status.AppliedBundleVersion)
+	}
+}
+
+// TestSyncDeployWebhookReplicas tests that the webhook deployments get their own replica
+// count when it is set in the webhook configuration
+func TestSyncDeployWebhookReplicas(t *testing.T) {
+	clusterManager := newClusterManager("testhub")
+	clusterManager.Spec.WebhookConfiguration = &operatorapiv1.WebhookConfiguration{
+		Replicas: 2,
+	}
+	controller := newTestController(clusterManager).withCRDObject().withKubeObject().withAPIServiceObject()
+	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		deployment, ok := action.(clienttesting.CreateActionImpl).Object.(*appsv1.Deployment)
+		if !ok {
+			continue
+		}
+		isWebhook := strings.Contains(deployment.Name, "webhook")
+		if isWebhook && *deployment.Spec.Replicas != 2 {
+			t.Errorf("Expected webhook deployment %q to have 2 replicas, got %d", deployment.Name, *deployment.Spec.Replicas)
+		}
+		if !isWebhook && *deployment.Spec.Replicas != 1 {
+			t.Errorf("Expected deployment %q to have 1 replica, got %d", deployment.Name, *deployment.Spec.Replicas)
+		}
+	}
+}
+
+// TestSyncDeployWebhookFailurePolicy tests that the failure policy and timeout in the
+// webhook configuration are rendered into the admission webhook configurations
+func TestSyncDeployWebhookFailurePolicy(t *testing.T) {
+	clusterManager := newClusterManager("testhub")
+	clusterManager.Spec.WebhookConfiguration = &operatorapiv1.WebhookConfiguration{
+		FailurePolicy:  operatorapiv1.WebhookFailurePolicyIgnore,
+		TimeoutSeconds: 5,
+	}
+	controller := newTestController(clusterManager).withCRDObject().withKubeObject().withAPIServiceObject()
+	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	webhookConfigurationFound := false
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		switch object := action.(clienttesting.CreateActionImpl).Object.(type) {
+		case *admissionv1.ValidatingWebhookConfiguration:
+			webhookConfigurationFound = true
+			for _, webhook := range object.Webhooks {
+				if *webhook.FailurePolicy != admissionv1.Ignore {
+					t.Errorf("Expected failure policy Ignore of webhook configuration %q, got %v", object.Name, *webhook.FailurePolicy)
+				}
+				if *webhook.TimeoutSeconds != 5 {
+					t.Errorf("Expected timeout 5 of webhook configuration %q, got %d", object.Name, *webhook.TimeoutSeconds)
+				}
+			}
+		case *admissionv1.MutatingWebhookConfiguration:
+			webhookConfigurationFound = true
+			for _, webhook := range object.Webhooks {
+				if *webhook.FailurePolicy != admissionv1.Ignore {
+					t.Errorf("Expected failure policy Ignore of webhook configuration %q, got %v", object.Name, *webhook.FailurePolicy)
+				}
+				if *webhook.TimeoutSeconds != 5 {
+					t.Errorf("Expected timeout 5 of webhook configuration %q, got %d", object.Name, *webhook.TimeoutSeconds)
+				}
+			}
+		}
+	}
+	if !webhookConfigurationFound {
+		t.Errorf("Expected webhook configurations to be created")
+	}
+}
+
+// TestSyncDelete test cleanup hub deploy
+func TestSyncDelete(t *testing.T) {
+	clusterManager := newClusterManager("testhub")
+	now := metav1.Now()
+	clusterManager.ObjectMeta.SetDeletionTimestamp(&now)
+	controller := newTestController(clusterManager).withCRDObject().withKubeObject().withAPIServiceObject()
+	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	deleteKubeActions := []clienttesting.DeleteActionImpl{}
+	kubeActions := controller.kubeClient.Actions()
+	for _, action := range kubeActions {
+		if action.GetVerb() == "delete" {
+			deleteKubeAction := action.(clienttesting.DeleteActionImpl)
+			deleteKubeActions = append(deleteKubeActions, deleteKubeAction)
+		}
+	}
+	testinghelper.AssertEqualNumber(t, len(deleteKubeActions), 33) // 27 static resources + 4 pod disruption budgets + 2 autoscalers
+
+	// The teardown is ordered, so the webhook configurations are removed before
+	// anything else and cannot be stranded by a partial cleanup.
+	if resource := deleteKubeActions[0].Resource.Resource; resource != "validatingwebhookconfigurations" {
+		t.Errorf("Expected the webhook configurations to be deleted first, got %q", resource)
+	}
+
+	deleteCRDActions := []clienttesting.DeleteActionImpl{}
+	crdActions := controller.apiExtensionClient.Actions()
+	for _, action := range crdActions {
+		if action.GetVerb() == "delete" {
+			deleteCRDAction := action.(clienttesting.DeleteActionImpl)
+			deleteCRDActions = append(deleteCRDActions, deleteCRDAction)
+		}
+	}
+	// Check if resources are created as expected
+	testinghelper.AssertEqualNumber(t, len(deleteCRDActions), 11)
+
+	// The crds phase waits on the managed cluster and manifest work CRDs before
+	// removing the remaining hub CRDs.
+	if name := deleteCRDActions[0].Name; name != crdNames[0] {
+		t.Errorf("Expected crd %q to be deleted first, got %q", crdNames[0], name)
+	}
+
+	deleteAPIServiceActions := []clienttesting.DeleteActionImpl{}
+	apiServiceActions := controller.apiRegistrationClient.Actions()
+	for _, action := range apiServiceActions {
+		if action.GetVerb() == "delete" {
+			deleteAPIServiceAction := action.(clienttesting.DeleteActionImpl)
+			deleteAPIServiceActions = append(deleteAPIServiceActions, deleteAPIServiceAction)
+		}
+	}
+	// Check if resources are created as expected
+	testinghelper.AssertEqualNumber(t, len(deleteAPIServiceActions), 2)
+
+	for _, action := range deleteKubeActions {
+		switch action.Resource.Resource {
+		case "namespaces":
+			testinghelper.AssertEqualNameNamespace(t, action.Name, "", helpers.ClusterManagerNamespace, "")
+		}
+	}
+}
+
+// TestSyncSecondInstanceSkipsSharedResources tests that only the owning instance
+// applies the shared admission resources, so coexisting clustermanagers do not
+// rewrite the APIService service references with their own namespaces
+func TestSyncSecondInstanceSkipsSharedResources(t *testing.T) {
+	owner := newClusterManager("testhub")
+	owner.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	second := newClusterManager("testhub2")
+	second.CreationTimestamp = metav1.Now()
+	second.Spec.Namespace = "open-cluster-management-hub2"
+	controller := newTestController(second, owner).withCRDObject().withKubeObject().withAPIServiceObject()
+	syncContext := testinghelper.NewFakeSyncContext(t, "testhub2")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		switch action.GetResource().Resource {
+		case "validatingwebhookconfigurations", "mutatingwebhookconfigurations":
+			t.Errorf("Expected the shared webhook configurations to be left to the owning instance, got %#v", action)
+		}
+	}
+	for _, action := range controller.apiRegistrationClient.Actions() {
+		if action.GetVerb() == "create" {
+			t.Errorf("Expected the shared apiservices to be left to the owning instance, got %#v", action)
+		}
+	}
+}
+
+// TestSyncDeleteKeepsSharedResources tests that deleting one instance keeps the
+// shared hub CRDs and admission resources another instance still relies on
+func TestSyncDeleteKeepsSharedResources(t *testing.T) {
+	clusterManager := newClusterManager("testhub")
+	now := metav1.Now()
+	clusterManager.ObjectMeta.SetDeletionTimestamp(&now)
+	surviving := newClusterManager("testhub2")
+	surviving.Spec.Namespace = "open-cluster-management-hub2"
+	controller := newTestController(clusterManager, surviving).withCRDObject().withKubeObject().withAPIServiceObject()
+	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	for _, action := range controller.apiExtensionClient.Actions() {
+		if action.GetVerb() == "delete" {
+			t.Errorf("Expected the shared crds to be kept for the surviving instance, got %#v", action)
+		}
+	}
+	for _, action := range controller.apiRegistrationClient.Actions() {
+		if action.GetVerb() == "delete" {
+			t.Errorf("Expected the shared apiservices to be kept for the surviving instance, got %#v", action)
+		}
+	}
+
+	deleteKubeActions := []clienttesting.DeleteActionImpl{}
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() == "delete" {
+			deleteKubeActions = append(deleteKubeActions, action.(clienttesting.DeleteActionImpl))
+		}
+	}
+	for _, action := range deleteKubeActions {
+		switch action.Resource.Resource {
+		case "validatingwebhookconfigurations", "mutatingwebhookconfigurations":
+			t.Errorf("Expected the shared webhook configurations to be kept for the surviving instance, got %#v", action)
+		}
+	}
+	// The per instance resources are still torn down.
+	testinghelper.AssertEqualNumber(t, len(deleteKubeActions), 29)
+}
+
+// TestSyncUnmanaged tests that an Unmanaged clustermanager is not reconciled and
+// the deployed hub components are left untouched
+func TestSyncUnmanaged(t *testing.T) {
+	clusterManager := newClusterManager("testhub")
+	clusterManager.Spec.ManagementState = operatorapiv1.ManagementStateUnmanaged
+	controller := newTestController(clusterManager).withCRDObject().withKubeObject().withAPIServiceObject()
+	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() == "create" || action.GetVerb() == "delete" {
+			t.Errorf("Expected no resources touched for an unmanaged clustermanager, got %#v", action)
+		}
+	}
+
+	operatorActions := controller.operatorClient.Actions()
+	testinghelper.AssertEqualNumber(t, len(operatorActions), 2)
+	testinghelper.AssertGet(t, operatorActions[0], "operator.open-cluster-management.io", "v1", "clustermanagers")
+	testinghelper.AssertAction(t, operatorActions[1], "update")
+	testinghelper.AssertOnlyConditions(
+		t, operatorActions[1].(clienttesting.UpdateActionImpl).Object,
+		testinghelper.NamedCondition(reconcilePaused, "Unmanaged", metav1.ConditionTrue))
+}
+
+// TestSyncRemoved tests that a Removed clustermanager tears the deployed hub
+// components down but keeps the clustermanager and its finalizer
+func TestSyncRemoved(t *testing.T) {
+	clusterManager := newClusterManager("testhub")
+	clusterManager.Spec.ManagementState = operatorapiv1.ManagementStateRemoved
+	controller := newTestController(clusterManager).withCRDObject().withKubeObject().withAPIServiceObject()
+	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	deleteKubeActions := []clienttesting.DeleteActionImpl{}
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() == "create" {
+			t.Errorf("Expected no resources created for a removed clustermanager, got %#v", action)
+		}
+		if action.GetVerb() == "delete" {
+			deleteKubeActions = append(deleteKubeActions, action.(clienttesting.DeleteActionImpl))
+		}
+	}
+	// The same ordered teardown as a deletion runs.
+	testinghelper.AssertEqualNumber(t, len(deleteKubeActions), 33)
+
+	operatorActions := controller.operatorClient.Actions()
+	testinghelper.AssertGet(t, operatorActions[0], "operator.open-cluster-management.io", "v1", "clustermanagers")
+	lastAction := operatorActions[len(operatorActions)-1]
+	testinghelper.AssertAction(t, lastAction, "update")
+	testinghelper.AssertOnlyConditions(
+		t, lastAction.(clienttesting.UpdateActionImpl).Object,
+		testinghelper.NamedCondition(clusterManagerApplied, "ClusterManagerRemoved", metav1.ConditionFalse),
+		testinghelper.NamedCondition(reconcilePaused, "Removed", metav1.ConditionTrue))
+
+	// The clustermanager and its finalizer stay, so the teardown is not a deletion
+	// and the hub can be reinstalled by setting the state back to Managed.
+	updated, err := controller.operatorClient.OperatorV1().ClusterManagers().Get(context.Background(), "testhub", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected the clustermanager to be kept, but got %v", err)
+	}
+	hasFinalizer := false
+	for _, finalizer := range updated.Finalizers {
+		if finalizer == clusterManagerFinalizer {
+			hasFinalizer = true
+		}
+	}
+	if !hasFinalizer {
+		t.Errorf("Expected the finalizer to be kept, but got %v", updated.Finalizers)
+	}
+}
+
+// TestDeleteCRD test delete crds
+func TestDeleteCRD(t *testing.T) {
+	clusterManager := newClusterManager("testhub")
+	now := metav1.Now()
+	clusterManager.ObjectMeta.SetDeletionTimestamp(&now)
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: crdNames[0],
+		},
+	}
+	controller := newTestController(clusterManager).withCRDObject(crd).withKubeObject().withAPIServiceObject()
+
+	// Return crd with the first get, and return not found with the 2nd get
+	getCount := 0
+	controller.apiExtensionClient.PrependReactor("get", "customresourcedefinitions", func(action clienttesting.Action) (handled bool, ret runtime.Object, err error) {
+		if getCount == 0 {
+			getCount = getCount + 1
+			return true, crd, nil
+		}
+		return true, &apiextensionsv1.CustomResourceDefinition{}, errors.NewNotFound(
+			apiextensionsv1.Resource("customresourcedefinitions"), crdNames[0])
+
+	})
+	syncContext := testinghelper.NewFakeSyncContext(t, "testhub")
+	err := controller.controller.sync(nil, syncContext)
+	if err == nil {
+		t.Errorf("Expected error when sync")
+	}
+
+	// While the crd removal is pending, the Deleting condition reports the remaining phase.
+	updatedClusterManager, err := controller.operatorClient.OperatorV1().ClusterManagers().Get(context.TODO(), "testhub", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error when get clustermanager: %v", err)
+	}
+	deletingCondition := meta.FindStatusCondition(updatedClusterManager.Status.Conditions, clusterManagerDeleting)
+	if deletingCondition == nil || deletingCondition.Status != metav1.ConditionTrue {
+		t.Errorf("Expected the Deleting condition to be true, got %v", deletingCondition)
+	} else if !strings.Contains(deletingCondition.Message, "crds") {
+		t.Errorf("Expected the Deleting condition to report the crds phase, got %q", deletingCondition.Message)
 	}
 
 	err = controller.controller.sync(nil, syncContext)
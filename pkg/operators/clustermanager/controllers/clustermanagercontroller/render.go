@@ -0,0 +1,48 @@
+package clustermanagercontroller
+
+import (
+	"encoding/base64"
+
+	"github.com/openshift/library-go/pkg/assets"
+
+	operatorapiv1 "open-cluster-management.io/api/operator/v1"
+	"open-cluster-management.io/registration-operator/manifests"
+	"open-cluster-management.io/registration-operator/pkg/helpers"
+)
+
+// RenderManifests renders every manifest the operator would apply for the given
+// clustermanager without contacting a cluster. Values that are resolved from a live
+// cluster during a reconcile fall back to their defaults: the replica counts are
+// derived from the availability config instead of the node count, the CA bundles
+// stay placeholders and the image overrides and digest pinning are skipped.
+func RenderManifests(clusterManager *operatorapiv1.ClusterManager) ([]helpers.RenderedManifest, error) {
+	replica := int32(3)
+	if clusterManager.Spec.AvailabilityConfig == operatorapiv1.BasicAvailability {
+		replica = 1
+	}
+	config, _, _ := buildHubConfig(clusterManager, replica)
+
+	encodedCaBundle := base64.StdEncoding.EncodeToString([]byte("placeholder"))
+	config.RegistrationAPIServiceCABundle = encodedCaBundle
+	config.WorkAPIServiceCABundle = encodedCaBundle
+
+	files := []string{}
+	if !crdsExternallyManaged(clusterManager) {
+		files = append(files, hubCRDFiles(clusterManager)...)
+	}
+	files = append(files, hubStaticFiles(clusterManager, config)...)
+	files = append(files, hubDeploymentFiles(clusterManager, config)...)
+
+	rendered := []helpers.RenderedManifest{}
+	for _, file := range files {
+		template, err := manifests.ClusterManagerManifestFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		rendered = append(rendered, helpers.RenderedManifest{
+			Name: file,
+			Data: assets.MustCreateAssetFromTemplate(file, template, config).Data,
+		})
+	}
+	return rendered, nil
+}
@@ -0,0 +1,331 @@
+package migrationcontroller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+
+	operatorv1client "open-cluster-management.io/api/client/operator/clientset/versioned/typed/operator/v1"
+	operatorinformer "open-cluster-management.io/api/client/operator/informers/externalversions/operator/v1"
+	operatorlister "open-cluster-management.io/api/client/operator/listers/operator/v1"
+	operatorapiv1 "open-cluster-management.io/api/operator/v1"
+	"open-cluster-management.io/registration-operator/pkg/helpers"
+	"open-cluster-management.io/registration-operator/pkg/metrics"
+)
+
+var migrationGVR = schema.GroupVersionResource{
+	Group:    "migration.k8s.io",
+	Version:  "v1alpha1",
+	Resource: "storageversionmigrations",
+}
+
+const (
+	// migrationRequestCRDName is the name of the CRD served by the kube-storage-version-migrator.
+	// The migration requests are applied only when the migrator is installed on the hub.
+	migrationRequestCRDName = "storageversionmigrations.migration.k8s.io"
+
+	// ocmGroupSuffix is the common suffix of the API groups of the hub CRDs. A hub CRD
+	// needs a storage version migration once objects of more than one version are stored.
+	ocmGroupSuffix = "open-cluster-management.io"
+
+	// clusterManagerCRDName is the CRD of the operator itself. Its storage version is
+	// migrated directly by the operator, since the migrator may not be installed.
+	clusterManagerCRDName = "clustermanagers.operator.open-cluster-management.io"
+
+	storageVersionMigrationSucceeded = "StorageVersionMigrationSucceeded"
+)
+
+var ResyncInterval = time.Minute * 5
+
+// crdMigrationController creates the storage version migration requests of the hub CRDs
+// and tracks them until each migration succeeds. The progress is reported with the
+// StorageVersionMigrationSucceeded condition on the ClusterManager.
+type crdMigrationController struct {
+	dynamicClient        dynamic.Interface
+	apiExtensionClient   apiextensionsclient.Interface
+	clusterManagerClient operatorv1client.ClusterManagerInterface
+	clusterManagerLister operatorlister.ClusterManagerLister
+	// reportedStates keeps the last reported metric state of each migration so that the
+	// duration and the failure count are recorded only once per state transition.
+	reportedStates map[string]string
+}
+
+// NewCRDMigrationController returns a crdMigrationController
+func NewCRDMigrationController(
+	dynamicClient dynamic.Interface,
+	apiExtensionClient apiextensionsclient.Interface,
+	clusterManagerClient operatorv1client.ClusterManagerInterface,
+	clusterManagerInformer operatorinformer.ClusterManagerInformer,
+	recorder events.Recorder) factory.Controller {
+	controller := &crdMigrationController{
+		dynamicClient:        dynamicClient,
+		apiExtensionClient:   apiExtensionClient,
+		clusterManagerClient: clusterManagerClient,
+		clusterManagerLister: clusterManagerInformer.Lister(),
+		reportedStates:       map[string]string{},
+	}
+
+	return factory.New().
+		ResyncEvery(ResyncInterval).
+		WithSync(metrics.InstrumentSyncer("CRDMigrationController", controller.sync)).
+		WithInformers(clusterManagerInformer.Informer()).
+		ToController("CRDMigrationController", recorder)
+}
+
+func (c *crdMigrationController) sync(ctx context.Context, controllerContext factory.SyncContext) error {
+	clusterManagers, err := c.clusterManagerLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	if len(clusterManagers) == 0 {
+		klog.V(4).InfoS("No ClusterManager found", "controller", "CRDMigrationController")
+		return nil
+	}
+	// The CRDs and their storage versions are shared by all clustermanagers, so the
+	// migration itself runs once per cluster. The resulting condition is reported on
+	// every clustermanager that is not being deleted.
+	activeClusterManagers := []*operatorapiv1.ClusterManager{}
+	for _, clusterManager := range clusterManagers {
+		if clusterManager.DeletionTimestamp.IsZero() {
+			activeClusterManagers = append(activeClusterManagers, clusterManager)
+		}
+	}
+	if len(activeClusterManagers) == 0 {
+		return nil
+	}
+
+	// The clustermanagers CRD holds only a handful of objects, so its storage
+	// version is migrated directly instead of through a migration request.
+	if err := helpers.MigrateCRDStorageVersion(ctx, c.apiExtensionClient, c.dynamicClient, clusterManagerCRDName, controllerContext.Recorder()); err != nil {
+		return err
+	}
+
+	// The migration requests can only be handled when the kube-storage-version-migrator
+	// is installed on the hub.
+	_, err = c.apiExtensionClient.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, migrationRequestCRDName, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		klog.V(4).InfoS("CRD not found, skip the storage version migrations", "controller", "CRDMigrationController", "crd", migrationRequestCRDName)
+		return nil
+	case err != nil:
+		return err
+	}
+
+	migrations, err := c.generateMigrationRequests(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := c.applyMigrationRequests(ctx, migrations, controllerContext.Recorder()); err != nil {
+		return err
+	}
+
+	processing, succeeded, failedMessages, err := c.checkMigrationStatus(ctx, migrations)
+	if err != nil {
+		return err
+	}
+
+	if err := c.pruneStoredVersions(ctx, succeeded, controllerContext.Recorder()); err != nil {
+		return err
+	}
+
+	var condition metav1.Condition
+	switch {
+	case len(failedMessages) > 0:
+		condition = metav1.Condition{
+			Type:    storageVersionMigrationSucceeded,
+			Status:  metav1.ConditionFalse,
+			Reason:  "StorageVersionMigrationFailed",
+			Message: fmt.Sprintf("Failed to migrate the storage version of resources: %s", strings.Join(failedMessages, ",")),
+		}
+	case len(processing) > 0:
+		condition = metav1.Condition{
+			Type:    storageVersionMigrationSucceeded,
+			Status:  metav1.ConditionFalse,
+			Reason:  "StorageVersionMigrationProcessing",
+			Message: fmt.Sprintf("Waiting for the storage version migrations of resources: %s", strings.Join(processing, ",")),
+		}
+	default:
+		condition = metav1.Condition{
+			Type:    storageVersionMigrationSucceeded,
+			Status:  metav1.ConditionTrue,
+			Reason:  "StorageVersionMigrationSucceed",
+			Message: "All storage version migrations are succeeded",
+		}
+	}
+
+	for _, clusterManager := range activeClusterManagers {
+		_, _, updatedErr := helpers.UpdateClusterManagerStatus(
+			ctx, c.clusterManagerClient, clusterManager.Name, helpers.UpdateClusterManagerConditionFn(condition))
+		if updatedErr != nil {
+			return updatedErr
+		}
+	}
+
+	// requeue until all migrations are succeeded
+	if len(processing) > 0 {
+		return factory.SyntheticRequeueError
+	}
+	return nil
+}
+
+// applyMigrationRequests creates the storage version migration requests if they do not exist.
+// The status of a StorageVersionMigration is maintained by the migrator, so an existing
+// migration request is left as it is.
+func (c *crdMigrationController) applyMigrationRequests(ctx context.Context, migrations []*unstructured.Unstructured, recorder events.Recorder) error {
+	for _, migration := range migrations {
+		_, err := c.dynamicClient.Resource(migrationGVR).Get(ctx, migration.GetName(), metav1.GetOptions{})
+		switch {
+		case errors.IsNotFound(err):
+			if _, err := c.dynamicClient.Resource(migrationGVR).Create(ctx, migration, metav1.CreateOptions{}); err != nil {
+				return err
+			}
+			recorder.Eventf("StorageVersionMigrationCreated", "storage version migration %q is created", migration.GetName())
+		case err != nil:
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMigrationStatus returns the names of the migrations that are not completed yet,
+// the names of the migrations that are succeeded and the failure messages of the
+// migrations that are failed.
+func (c *crdMigrationController) checkMigrationStatus(ctx context.Context, migrations []*unstructured.Unstructured) (processing, succeeded, failedMessages []string, err error) {
+	for _, migration := range migrations {
+		existing, err := c.dynamicClient.Resource(migrationGVR).Get(ctx, migration.GetName(), metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		switch {
+		case migrationHasCondition(existing, "Succeeded"):
+			succeeded = append(succeeded, migration.GetName())
+			c.recordMigrationState(existing, migrationStateSucceeded)
+		case migrationHasCondition(existing, "Failed"):
+			failedMessages = append(failedMessages, fmt.Sprintf("%s is failed", migration.GetName()))
+			c.recordMigrationState(existing, migrationStateFailed)
+		default:
+			processing = append(processing, migration.GetName())
+			c.recordMigrationState(existing, migrationStateProcessing)
+		}
+	}
+	return processing, succeeded, failedMessages, nil
+}
+
+// pruneStoredVersions drops the legacy versions from the storedVersions of the CRDs whose
+// storage version migrations are succeeded, so that a following upgrade is able to remove
+// the old API versions without manual intervention.
+func (c *crdMigrationController) pruneStoredVersions(ctx context.Context, succeeded []string, recorder events.Recorder) error {
+	for _, crdName := range succeeded {
+		crd, err := c.apiExtensionClient.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, crdName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		storageVersion := ""
+		for _, version := range crd.Spec.Versions {
+			if version.Storage {
+				storageVersion = version.Name
+				break
+			}
+		}
+		if len(storageVersion) == 0 {
+			continue
+		}
+		if len(crd.Status.StoredVersions) == 1 && crd.Status.StoredVersions[0] == storageVersion {
+			continue
+		}
+
+		crd.Status.StoredVersions = []string{storageVersion}
+		if _, err := c.apiExtensionClient.ApiextensionsV1().CustomResourceDefinitions().UpdateStatus(ctx, crd, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		recorder.Eventf("CRDStoredVersionsPruned", "stored versions of crd %q are pruned to %q", crdName, storageVersion)
+	}
+	return nil
+}
+
+func migrationHasCondition(migration *unstructured.Unstructured, conditionType string) bool {
+	_, found := migrationCondition(migration, conditionType)
+	return found
+}
+
+// migrationCondition returns the condition of the given type whose status is true.
+func migrationCondition(migration *unstructured.Unstructured, conditionType string) (map[string]interface{}, bool) {
+	conditions, found, err := unstructured.NestedSlice(migration.Object, "status", "conditions")
+	if !found || err != nil {
+		return nil, false
+	}
+	for _, condition := range conditions {
+		conditionMap, ok := condition.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if conditionMap["type"] == conditionType && conditionMap["status"] == string(metav1.ConditionTrue) {
+			return conditionMap, true
+		}
+	}
+	return nil, false
+}
+
+// generateMigrationRequests builds a storage version migration request for each hub CRD
+// that has objects stored in more than one version, so a CRD version bump does not
+// require an operator code change.
+func (c *crdMigrationController) generateMigrationRequests(ctx context.Context) ([]*unstructured.Unstructured, error) {
+	crds, err := c.apiExtensionClient.ApiextensionsV1().CustomResourceDefinitions().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := []*unstructured.Unstructured{}
+	for _, crd := range crds.Items {
+		if !strings.HasSuffix(crd.Spec.Group, ocmGroupSuffix) {
+			continue
+		}
+		if len(crd.Status.StoredVersions) < 2 {
+			continue
+		}
+
+		storageVersion := ""
+		for _, version := range crd.Spec.Versions {
+			if version.Storage {
+				storageVersion = version.Name
+				break
+			}
+		}
+		if len(storageVersion) == 0 {
+			continue
+		}
+
+		migrations = append(migrations, &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": "migration.k8s.io/v1alpha1",
+				"kind":       "StorageVersionMigration",
+				"metadata": map[string]interface{}{
+					"name": crd.Name,
+				},
+				"spec": map[string]interface{}{
+					"resource": map[string]interface{}{
+						"group":    crd.Spec.Group,
+						"resource": crd.Spec.Names.Plural,
+						"version":  storageVersion,
+					},
+				},
+			},
+		})
+	}
+	return migrations, nil
+}
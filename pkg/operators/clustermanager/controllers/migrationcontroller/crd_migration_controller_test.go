@@ -0,0 +1,245 @@
+package migrationcontroller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/openshift/library-go/pkg/controller/factory"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	fakeapiextensions "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+
+	fakeoperatorclient "open-cluster-management.io/api/client/operator/clientset/versioned/fake"
+	operatorinformers "open-cluster-management.io/api/client/operator/informers/externalversions"
+	operatorapiv1 "open-cluster-management.io/api/operator/v1"
+	testinghelper "open-cluster-management.io/registration-operator/pkg/helpers/testing"
+)
+
+const testClusterManagerName = "testclustermanager"
+
+func newClusterManager() *operatorapiv1.ClusterManager {
+	return &operatorapiv1.ClusterManager{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: testClusterManagerName,
+		},
+	}
+}
+
+func newMigrationRequestCRD() *apiextensionsv1.CustomResourceDefinition {
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: migrationRequestCRDName,
+		},
+	}
+}
+
+func newOCMCRD(group, plural string, storedVersions ...string) *apiextensionsv1.CustomResourceDefinition {
+	versions := []apiextensionsv1.CustomResourceDefinitionVersion{}
+	for index, version := range storedVersions {
+		versions = append(versions, apiextensionsv1.CustomResourceDefinitionVersion{
+			Name:    version,
+			Storage: index == len(storedVersions)-1,
+		})
+	}
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: fmt.Sprintf("%s.%s", plural, group),
+		},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group:    group,
+			Names:    apiextensionsv1.CustomResourceDefinitionNames{Plural: plural},
+			Versions: versions,
+		},
+		Status: apiextensionsv1.CustomResourceDefinitionStatus{
+			StoredVersions: storedVersions,
+		},
+	}
+}
+
+func newMigrationRequest(name string, conditions ...interface{}) *unstructured.Unstructured {
+	migration := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "migration.k8s.io/v1alpha1",
+			"kind":       "StorageVersionMigration",
+			"metadata": map[string]interface{}{
+				"name": name,
+			},
+		},
+	}
+	if len(conditions) > 0 {
+		migration.Object["status"] = map[string]interface{}{
+			"conditions": conditions,
+		}
+	}
+	return migration
+}
+
+func newMigrationCondition(conditionType string, status metav1.ConditionStatus) map[string]interface{} {
+	return map[string]interface{}{
+		"type":   conditionType,
+		"status": string(status),
+	}
+}
+
+func TestSync(t *testing.T) {
+	migrationNames := []string{
+		"managedclustersets.cluster.open-cluster-management.io",
+		"managedclustersetbindings.cluster.open-cluster-management.io",
+	}
+	ocmCRDs := []runtime.Object{
+		newOCMCRD("cluster.open-cluster-management.io", "managedclustersets", "v1beta1", "v1beta2"),
+		newOCMCRD("cluster.open-cluster-management.io", "managedclustersetbindings", "v1beta1", "v1beta2"),
+	}
+	cases := []struct {
+		name               string
+		crds               []runtime.Object
+		migrations         []runtime.Object
+		expectedCreations  int
+		expectedErr        error
+		expectedCondition  *metav1.Condition
+		expectedPrunedCRDs []string
+	}{
+		{
+			name: "migrator is not installed",
+			crds: ocmCRDs,
+		},
+		{
+			name: "no migration required",
+			crds: []runtime.Object{
+				newMigrationRequestCRD(),
+				newOCMCRD("cluster.open-cluster-management.io", "managedclustersets", "v1beta2"),
+			},
+			expectedCondition: &metav1.Condition{
+				Type:   storageVersionMigrationSucceeded,
+				Status: metav1.ConditionTrue,
+				Reason: "StorageVersionMigrationSucceed",
+			},
+		},
+		{
+			name:              "create migration requests",
+			crds:              append([]runtime.Object{newMigrationRequestCRD()}, ocmCRDs...),
+			expectedCreations: 2,
+			expectedErr:       factory.SyntheticRequeueError,
+			expectedCondition: &metav1.Condition{
+				Type:   storageVersionMigrationSucceeded,
+				Status: metav1.ConditionFalse,
+				Reason: "StorageVersionMigrationProcessing",
+			},
+		},
+		{
+			name: "migrations are running",
+			crds: append([]runtime.Object{newMigrationRequestCRD()}, ocmCRDs...),
+			migrations: []runtime.Object{
+				newMigrationRequest(migrationNames[0], newMigrationCondition("Succeeded", metav1.ConditionTrue)),
+				newMigrationRequest(migrationNames[1], newMigrationCondition("Running", metav1.ConditionTrue)),
+			},
+			expectedErr: factory.SyntheticRequeueError,
+			expectedCondition: &metav1.Condition{
+				Type:   storageVersionMigrationSucceeded,
+				Status: metav1.ConditionFalse,
+				Reason: "StorageVersionMigrationProcessing",
+			},
+		},
+		{
+			name: "a migration is failed",
+			crds: append([]runtime.Object{newMigrationRequestCRD()}, ocmCRDs...),
+			migrations: []runtime.Object{
+				newMigrationRequest(migrationNames[0], newMigrationCondition("Succeeded", metav1.ConditionTrue)),
+				newMigrationRequest(migrationNames[1], newMigrationCondition("Failed", metav1.ConditionTrue)),
+			},
+			expectedCondition: &metav1.Condition{
+				Type:   storageVersionMigrationSucceeded,
+				Status: metav1.ConditionFalse,
+				Reason: "StorageVersionMigrationFailed",
+			},
+			expectedPrunedCRDs: []string{migrationNames[0]},
+		},
+		{
+			name: "all migrations are succeeded",
+			crds: append([]runtime.Object{newMigrationRequestCRD()}, ocmCRDs...),
+			migrations: []runtime.Object{
+				newMigrationRequest(migrationNames[0], newMigrationCondition("Succeeded", metav1.ConditionTrue)),
+				newMigrationRequest(migrationNames[1], newMigrationCondition("Succeeded", metav1.ConditionTrue)),
+			},
+			expectedCondition: &metav1.Condition{
+				Type:   storageVersionMigrationSucceeded,
+				Status: metav1.ConditionTrue,
+				Reason: "StorageVersionMigrationSucceed",
+			},
+			expectedPrunedCRDs: migrationNames,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fakeDynamicClient := fakedynamic.NewSimpleDynamicClientWithCustomListKinds(
+				runtime.NewScheme(),
+				map[schema.GroupVersionResource]string{migrationGVR: "StorageVersionMigrationList"},
+				c.migrations...)
+			fakeAPIExtensionClient := fakeapiextensions.NewSimpleClientset(c.crds...)
+
+			clusterManager := newClusterManager()
+			fakeOperatorClient := fakeoperatorclient.NewSimpleClientset(clusterManager)
+			operatorInformers := operatorinformers.NewSharedInformerFactory(fakeOperatorClient, 5*time.Minute)
+			clusterManagerStore := operatorInformers.Operator().V1().ClusterManagers().Informer().GetStore()
+			clusterManagerStore.Add(clusterManager)
+
+			controller := &crdMigrationController{
+				dynamicClient:        fakeDynamicClient,
+				apiExtensionClient:   fakeAPIExtensionClient,
+				clusterManagerClient: fakeOperatorClient.OperatorV1().ClusterManagers(),
+				clusterManagerLister: operatorInformers.Operator().V1().ClusterManagers().Lister(),
+				reportedStates:       map[string]string{},
+			}
+
+			syncContext := testinghelper.NewFakeSyncContext(t, testClusterManagerName)
+			err := controller.sync(context.TODO(), syncContext)
+			if err != c.expectedErr {
+				t.Errorf("Expected error %v, but got %v", c.expectedErr, err)
+			}
+
+			creations := 0
+			for _, action := range fakeDynamicClient.Actions() {
+				if action.GetVerb() == "create" {
+					creations++
+				}
+			}
+			if creations != c.expectedCreations {
+				t.Errorf("Expected %d creations, but got %d", c.expectedCreations, creations)
+			}
+
+			clusterManager, getErr := fakeOperatorClient.OperatorV1().ClusterManagers().Get(context.TODO(), testClusterManagerName, metav1.GetOptions{})
+			if getErr != nil {
+				t.Fatalf("Expected no error when getting cluster manager: %v", getErr)
+			}
+			condition := meta.FindStatusCondition(clusterManager.Status.Conditions, storageVersionMigrationSucceeded)
+			switch {
+			case c.expectedCondition == nil:
+				if condition != nil {
+					t.Errorf("Expected no condition, but got %v", condition)
+				}
+			case condition == nil:
+				t.Errorf("Expected condition %v, but got none", c.expectedCondition)
+			case condition.Status != c.expectedCondition.Status || condition.Reason != c.expectedCondition.Reason:
+				t.Errorf("Expected condition %v, but got %v", c.expectedCondition, condition)
+			}
+
+			for _, crdName := range c.expectedPrunedCRDs {
+				crd, err := fakeAPIExtensionClient.ApiextensionsV1().CustomResourceDefinitions().Get(context.TODO(), crdName, metav1.GetOptions{})
+				if err != nil {
+					t.Fatalf("Expected no error when getting crd: %v", err)
+				}
+				if len(crd.Status.StoredVersions) != 1 || crd.Status.StoredVersions[0] != "v1beta2" {
+					t.Errorf("Expected stored versions of crd %q to be pruned, but got %v", crdName, crd.Status.StoredVersions)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package migrationcontroller
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+const (
+	migrationStateProcessing = "Processing"
+	migrationStateSucceeded  = "Succeeded"
+	migrationStateFailed     = "Failed"
+)
+
+var (
+	migrationStateMetric = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Name: "open_cluster_management_storage_version_migration_state",
+			Help: "The state of the storage version migration of a hub resource. 0 means the migration is running, 1 succeeded and -1 failed.",
+		},
+		[]string{"resource"},
+	)
+
+	migrationDurationMetric = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Name:    "open_cluster_management_storage_version_migration_duration_seconds",
+			Help:    "The time it took for the storage version migration of a hub resource to succeed.",
+			Buckets: []float64{1, 5, 10, 30, 60, 120, 300, 600},
+		},
+		[]string{"resource"},
+	)
+
+	migrationFailureMetric = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name: "open_cluster_management_storage_version_migration_failures_total",
+			Help: "The number of times the storage version migration of a hub resource failed.",
+		},
+		[]string{"resource"},
+	)
+)
+
+func init() {
+	legacyregistry.MustRegister(migrationStateMetric)
+	legacyregistry.MustRegister(migrationDurationMetric)
+	legacyregistry.MustRegister(migrationFailureMetric)
+}
+
+// recordMigrationState updates the metrics of a storage version migration with its current
+// state. The sync is invoked repeatedly, so the duration and the failure count are recorded
+// only once per state transition.
+func (c *crdMigrationController) recordMigrationState(migration *unstructured.Unstructured, state string) {
+	name := migration.GetName()
+	switch state {
+	case migrationStateSucceeded:
+		migrationStateMetric.WithLabelValues(name).Set(1)
+		if c.reportedStates[name] != migrationStateSucceeded {
+			if duration, ok := migrationDuration(migration); ok {
+				migrationDurationMetric.WithLabelValues(name).Observe(duration.Seconds())
+			}
+		}
+	case migrationStateFailed:
+		migrationStateMetric.WithLabelValues(name).Set(-1)
+		if c.reportedStates[name] != migrationStateFailed {
+			migrationFailureMetric.WithLabelValues(name).Inc()
+		}
+	default:
+		migrationStateMetric.WithLabelValues(name).Set(0)
+	}
+	c.reportedStates[name] = state
+}
+
+// migrationDuration returns the time between the creation of a storage version migration
+// and the moment it succeeded.
+func migrationDuration(migration *unstructured.Unstructured) (time.Duration, bool) {
+	condition, ok := migrationCondition(migration, "Succeeded")
+	if !ok {
+		return 0, false
+	}
+	lastUpdateTime, ok := condition["lastUpdateTime"].(string)
+	if !ok {
+		return 0, false
+	}
+	succeededAt, err := time.Parse(time.RFC3339, lastUpdateTime)
+	if err != nil {
+		return 0, false
+	}
+	createdAt := migration.GetCreationTimestamp()
+	if createdAt.IsZero() {
+		return 0, false
+	}
+	return succeededAt.Sub(createdAt.Time), true
+}
@@ -2,48 +2,76 @@ package statuscontroller
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"net"
+	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	appsinformer "k8s.io/client-go/informers/apps/v1"
+	"k8s.io/client-go/kubernetes"
 	appslister "k8s.io/client-go/listers/apps/v1"
 	"k8s.io/klog/v2"
 
 	operatorv1client "open-cluster-management.io/api/client/operator/clientset/versioned/typed/operator/v1"
 	operatorinformer "open-cluster-management.io/api/client/operator/informers/externalversions/operator/v1"
 	operatorlister "open-cluster-management.io/api/client/operator/listers/operator/v1"
+	operatorapiv1 "open-cluster-management.io/api/operator/v1"
 	"open-cluster-management.io/registration-operator/pkg/helpers"
+	"open-cluster-management.io/registration-operator/pkg/metrics"
 
 	"github.com/openshift/library-go/pkg/controller/factory"
 	"github.com/openshift/library-go/pkg/operator/events"
 	operatorhelpers "github.com/openshift/library-go/pkg/operator/v1helpers"
 )
 
+const webhookUnreachable = "HubWebhookUnreachable"
 const registrationDegraded = "HubRegistrationDegraded"
+const registrationWebhookDegraded = "HubRegistrationWebhookDegraded"
+const workWebhookDegraded = "HubWorkWebhookDegraded"
 const placementDegraded = "HubPlacementDegraded"
+const addOnManagerDegraded = "HubAddOnManagerDegraded"
 
 type clusterManagerStatusController struct {
+	kubeClient           kubernetes.Interface
 	deploymentLister     appslister.DeploymentLister
 	clusterManagerClient operatorv1client.ClusterManagerInterface
 	clusterManagerLister operatorlister.ClusterManagerLister
+	// probeWebhook opens a TLS connection to a webhook service and verifies the
+	// serving certificate against the given CA bundle. It is a field so tests can
+	// run the controller without real network access; a nil probe disables the
+	// reachability check.
+	probeWebhook func(addr, serverName string, caBundle []byte) error
+	// checkOperatorPermissions returns the RBAC the operator is missing. It is a
+	// field so tests can run the controller without an authorization API; a nil
+	// check disables the OperatorPermissionDegraded condition.
+	checkOperatorPermissions func(ctx context.Context) ([]string, error)
 }
 
 // NewClusterManagerStatusController creates hub cluster manager status controller
 func NewClusterManagerStatusController(
+	kubeClient kubernetes.Interface,
 	clusterManagerClient operatorv1client.ClusterManagerInterface,
 	clusterManagerInformer operatorinformer.ClusterManagerInformer,
 	deploymentInformer appsinformer.DeploymentInformer,
 	recorder events.Recorder) factory.Controller {
 	controller := &clusterManagerStatusController{
+		kubeClient:           kubeClient,
 		deploymentLister:     deploymentInformer.Lister(),
 		clusterManagerClient: clusterManagerClient,
 		clusterManagerLister: clusterManagerInformer.Lister(),
+		probeWebhook:         probeWebhookTLS,
+		checkOperatorPermissions: func(ctx context.Context) ([]string, error) {
+			return helpers.MissingOperatorPermissions(ctx, kubeClient, helpers.OperatorRequiredPermissions())
+		},
 	}
 
-	return factory.New().WithSync(controller.sync).
+	return factory.New().WithSync(metrics.InstrumentSyncer("ClusterManagerStatusController", controller.sync)).
 		WithInformersQueueKeyFunc(
 			helpers.ClusterManagerDeploymentQueueKeyFunc(controller.clusterManagerLister), deploymentInformer.Informer()).
 		WithInformersQueueKeyFunc(func(obj runtime.Object) string {
@@ -59,7 +87,7 @@ func (s *clusterManagerStatusController) sync(ctx context.Context, controllerCon
 		return nil
 	}
 
-	klog.Infof("Reconciling ClusterManager %q", clusterManagerName)
+	klog.InfoS("Reconciling ClusterManager", "controller", "ClusterManagerStatusController", "clustermanager", clusterManagerName)
 
 	clusterManager, err := s.clusterManagerLister.Get(clusterManagerName)
 	// ClusterManager not found, could have been deleted, do nothing.
@@ -71,94 +99,344 @@ func (s *clusterManagerStatusController) sync(ctx context.Context, controllerCon
 		return err
 	}
 
+	deployNamespace := helpers.ClusterManagerDeployNamespace(clusterManager)
+
+	conditions := []metav1.Condition{
+		s.checkRegistrationDeployment(clusterManagerName, deployNamespace),
+		// The webhooks get their own conditions, so an unhealthy webhook can be told
+		// apart from an unhealthy registration controller.
+		s.checkRegistrationWebhookDeployment(clusterManagerName, deployNamespace),
+		s.checkWorkWebhookDeployment(clusterManagerName, deployNamespace),
+	}
+
+	// The webhook services are also probed directly, since a broken Service
+	// selector or a stale caBundle is not visible in the deployment status.
+	if condition := s.checkWebhookReachability(ctx, deployNamespace); condition != nil {
+		conditions = append(conditions, *condition)
+	}
+
+	// The placement controller is only deployed when its image pull spec is set,
+	// so only check its deployment status in that case.
+	if clusterManager.Spec.PlacementImagePullSpec != "" {
+		conditions = append(conditions, s.checkPlacementDeployment(clusterManagerName, deployNamespace))
+	}
+
+	// The addon manager is an optional component, so only check its deployment
+	// status when it is enabled.
+	if helpers.AddOnManagerEnabled(clusterManager) {
+		conditions = append(conditions, s.checkAddOnManagerDeployment(clusterManagerName, deployNamespace))
+	}
+
+	// Verify the operator still holds the RBAC it needs, so a permission stripped
+	// after install shows up as a condition instead of silent reconcile failures.
+	if s.checkOperatorPermissions != nil {
+		conditions = append(conditions, helpers.OperatorPermissionCondition(ctx, s.checkOperatorPermissions))
+	}
+
 	errs := []error{}
-	if err := s.updateStatusOfRegistration(ctx, clusterManager.Name); err != nil {
+	// The conditions and the deployed component list are batched into a single
+	// status write per sync, which the update helper skips entirely when nothing
+	// changed.
+	updateFuncs := []helpers.UpdateClusterManagerStatusFunc{helpers.UpdateClusterManagerConditionFn(conditions...)}
+	deployedComponents, err := s.deployedComponents(clusterManager)
+	if err != nil {
 		errs = append(errs, err)
+	} else {
+		updateFuncs = append(updateFuncs, func(oldStatus *operatorapiv1.ClusterManagerStatus) error {
+			oldStatus.DeployedComponents = deployedComponents
+			// The image set is recorded as last known good only while every
+			// component runs with all replicas available, so a rollback always
+			// has a working target to revert to.
+			allReady := len(deployedComponents) > 0
+			for _, component := range deployedComponents {
+				if !component.Ready {
+					allReady = false
+					break
+				}
+			}
+			if allReady {
+				lastKnownGoodImages := map[string]string{}
+				for _, component := range deployedComponents {
+					if len(component.Image) > 0 {
+						lastKnownGoodImages[component.Name] = component.Image
+					}
+				}
+				oldStatus.LastKnownGoodImages = lastKnownGoodImages
+			}
+			return nil
+		})
 	}
+	// The summary must be recomputed last, so it rolls up the conditions as they
+	// are written by this update.
+	updateFuncs = append(updateFuncs, helpers.UpdateClusterManagerSummaryFn())
 
-	if err := s.updateStatusOfPlacement(ctx, clusterManager.Name); err != nil {
+	if _, _, err := helpers.UpdateClusterManagerStatus(ctx, s.clusterManagerClient, clusterManagerName, updateFuncs...); err != nil {
 		errs = append(errs, err)
 	}
 
 	return operatorhelpers.NewMultiLineAggregate(errs)
 }
 
-// updateStatusOfRegistration checks registration deployment status and updates condition of clustermanager
-func (s *clusterManagerStatusController) updateStatusOfRegistration(ctx context.Context, clusterManagerName string) error {
+// deployedComponents collects the structured list of deployed hub components for the
+// status of the clustermanager, so that upgrade tooling can verify which images and
+// deployment generations rolled out.
+func (s *clusterManagerStatusController) deployedComponents(clusterManager *operatorapiv1.ClusterManager) ([]operatorapiv1.DeployedComponent, error) {
+	deploymentNames := []string{
+		fmt.Sprintf("%s-registration-controller", clusterManager.Name),
+		fmt.Sprintf("%s-registration-webhook", clusterManager.Name),
+		fmt.Sprintf("%s-work-webhook", clusterManager.Name),
+	}
+	if clusterManager.Spec.PlacementImagePullSpec != "" {
+		deploymentNames = append(deploymentNames, fmt.Sprintf("%s-placement-controller", clusterManager.Name))
+	}
+	if helpers.AddOnManagerEnabled(clusterManager) {
+		deploymentNames = append(deploymentNames, fmt.Sprintf("%s-addon-manager-controller", clusterManager.Name))
+	}
+	if helpers.ManifestWorkReplicaSetEnabled(clusterManager) {
+		deploymentNames = append(deploymentNames, fmt.Sprintf("%s-manifestworkreplicaset-controller", clusterManager.Name))
+	}
+
+	deployedComponents := []operatorapiv1.DeployedComponent{}
+	for _, deploymentName := range deploymentNames {
+		deployment, err := s.deploymentLister.Deployments(helpers.ClusterManagerDeployNamespace(clusterManager)).Get(deploymentName)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		deployedComponent := operatorapiv1.DeployedComponent{
+			Name:               deployment.Name,
+			ObservedGeneration: deployment.Status.ObservedGeneration,
+			Ready:              helpers.NumOfUnavailablePod(deployment) == 0,
+		}
+		if containers := deployment.Spec.Template.Spec.Containers; len(containers) > 0 {
+			deployedComponent.Image = containers[0].Image
+		}
+		deployedComponents = append(deployedComponents, deployedComponent)
+	}
+
+	return deployedComponents, nil
+}
+
+// checkRegistrationDeployment checks registration deployment status and returns the
+// condition of the clustermanager
+func (s *clusterManagerStatusController) checkRegistrationDeployment(clusterManagerName, deployNamespace string) metav1.Condition {
 	// Check registration deployment status
 	registrationDeploymentName := fmt.Sprintf("%s-registration-controller", clusterManagerName)
-	registrationDeployment, err := s.deploymentLister.Deployments(helpers.ClusterManagerNamespace).Get(registrationDeploymentName)
+	registrationDeployment, err := s.deploymentLister.Deployments(deployNamespace).Get(registrationDeploymentName)
 	if err != nil {
-		_, _, err := helpers.UpdateClusterManagerStatus(ctx, s.clusterManagerClient, clusterManagerName,
-			helpers.UpdateClusterManagerConditionFn(metav1.Condition{
-				Type:    registrationDegraded,
-				Status:  metav1.ConditionTrue,
-				Reason:  "GetRegistrationDeploymentFailed",
-				Message: fmt.Sprintf("Failed to get registration deployment %q %q: %v", helpers.ClusterManagerNamespace, registrationDeploymentName, err),
-			}),
-		)
-		return err
+		return metav1.Condition{
+			Type:    registrationDegraded,
+			Status:  metav1.ConditionTrue,
+			Reason:  "GetRegistrationDeploymentFailed",
+			Message: fmt.Sprintf("Failed to get registration deployment %q %q: %v", deployNamespace, registrationDeploymentName, err),
+		}
 	}
 
 	if unavailablePod := helpers.NumOfUnavailablePod(registrationDeployment); unavailablePod > 0 {
-		_, _, err := helpers.UpdateClusterManagerStatus(ctx, s.clusterManagerClient, clusterManagerName,
-			helpers.UpdateClusterManagerConditionFn(metav1.Condition{
-				Type:    registrationDegraded,
-				Status:  metav1.ConditionTrue,
-				Reason:  "UnavailableRegistrationPod",
-				Message: fmt.Sprintf("%v of requested instances are unavailable of registration deployment %q %q", unavailablePod, helpers.ClusterManagerNamespace, registrationDeploymentName),
-			}),
-		)
+		return metav1.Condition{
+			Type:    registrationDegraded,
+			Status:  metav1.ConditionTrue,
+			Reason:  "UnavailableRegistrationPod",
+			Message: fmt.Sprintf("%v of requested instances are unavailable of registration deployment %q %q", unavailablePod, deployNamespace, registrationDeploymentName),
+		}
+	}
+
+	return metav1.Condition{
+		Type:    registrationDegraded,
+		Status:  metav1.ConditionFalse,
+		Reason:  "RegistrationFunctional",
+		Message: "Registration is managing credentials",
+	}
+}
+
+// checkWebhookReachability probes the webhook services over TLS and reflects
+// handshake failures in the HubWebhookUnreachable condition. A nil probe disables
+// the check and returns no condition.
+func (s *clusterManagerStatusController) checkWebhookReachability(ctx context.Context, deployNamespace string) *metav1.Condition {
+	if s.probeWebhook == nil {
+		return nil
+	}
+
+	// The serving certs are verified against the rotated CA bundle the webhook
+	// configurations reference, so a handshake failure also catches a stale caBundle.
+	var caBundle []byte
+	caBundleConfigMap, err := s.kubeClient.CoreV1().ConfigMaps(deployNamespace).Get(ctx, "ca-bundle-configmap", metav1.GetOptions{})
+	if err == nil {
+		caBundle = []byte(caBundleConfigMap.Data["ca-bundle.crt"])
+	}
+
+	failures := []string{}
+	for _, service := range []string{helpers.RegistrationWebhookService, helpers.WorkWebhookService} {
+		serverName := fmt.Sprintf("%s.%s.svc", service, deployNamespace)
+		if err := s.probeWebhook(fmt.Sprintf("%s:443", serverName), serverName, caBundle); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", serverName, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return &metav1.Condition{
+			Type:    webhookUnreachable,
+			Status:  metav1.ConditionTrue,
+			Reason:  "WebhookConnectionFailed",
+			Message: fmt.Sprintf("Failed to complete a TLS handshake with the webhook services: %s", strings.Join(failures, "; ")),
+		}
+	}
+
+	return &metav1.Condition{
+		Type:    webhookUnreachable,
+		Status:  metav1.ConditionFalse,
+		Reason:  "WebhooksReachable",
+		Message: "The webhook services complete TLS handshakes with their serving certificates",
+	}
+}
+
+// probeWebhookTLS completes a TLS handshake with the given address. The serving
+// certificate is verified against the CA bundle when one is given, otherwise only
+// the handshake itself is checked.
+func probeWebhookTLS(addr, serverName string, caBundle []byte) error {
+	tlsConfig := &tls.Config{ServerName: serverName, InsecureSkipVerify: true}
+	if len(caBundle) > 0 {
+		roots := x509.NewCertPool()
+		if roots.AppendCertsFromPEM(caBundle) {
+			tlsConfig.RootCAs = roots
+			tlsConfig.InsecureSkipVerify = false
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	if err != nil {
 		return err
 	}
+	return conn.Close()
+}
 
-	_, _, err = helpers.UpdateClusterManagerStatus(ctx, s.clusterManagerClient, clusterManagerName,
-		helpers.UpdateClusterManagerConditionFn(metav1.Condition{
-			Type:    registrationDegraded,
-			Status:  metav1.ConditionFalse,
-			Reason:  "RegistrationFunctional",
-			Message: "Registration is managing credentials",
-		}),
-	)
-	return err
+// checkRegistrationWebhookDeployment checks registration webhook deployment status
+// and returns the condition of the clustermanager
+func (s *clusterManagerStatusController) checkRegistrationWebhookDeployment(clusterManagerName, deployNamespace string) metav1.Condition {
+	// Check registration webhook deployment status
+	registrationWebhookDeploymentName := fmt.Sprintf("%s-registration-webhook", clusterManagerName)
+	registrationWebhookDeployment, err := s.deploymentLister.Deployments(deployNamespace).Get(registrationWebhookDeploymentName)
+	if err != nil {
+		return metav1.Condition{
+			Type:    registrationWebhookDegraded,
+			Status:  metav1.ConditionTrue,
+			Reason:  "GetRegistrationWebhookDeploymentFailed",
+			Message: fmt.Sprintf("Failed to get registration webhook deployment %q %q: %v", deployNamespace, registrationWebhookDeploymentName, err),
+		}
+	}
+
+	if unavailablePod := helpers.NumOfUnavailablePod(registrationWebhookDeployment); unavailablePod > 0 {
+		return metav1.Condition{
+			Type:    registrationWebhookDegraded,
+			Status:  metav1.ConditionTrue,
+			Reason:  "UnavailableRegistrationWebhookPod",
+			Message: fmt.Sprintf("%v of requested instances are unavailable of registration webhook deployment %q %q", unavailablePod, deployNamespace, registrationWebhookDeploymentName),
+		}
+	}
+
+	return metav1.Condition{
+		Type:    registrationWebhookDegraded,
+		Status:  metav1.ConditionFalse,
+		Reason:  "RegistrationWebhookFunctional",
+		Message: "Registration webhook is serving admission requests",
+	}
 }
 
-// updateStatusOfRegistration checks placement deployment status and updates condition of clustermanager
-func (s *clusterManagerStatusController) updateStatusOfPlacement(ctx context.Context, clusterManagerName string) error {
-	// Check registration deployment status
+// checkWorkWebhookDeployment checks work webhook deployment status and returns the
+// condition of the clustermanager
+func (s *clusterManagerStatusController) checkWorkWebhookDeployment(clusterManagerName, deployNamespace string) metav1.Condition {
+	// Check work webhook deployment status
+	workWebhookDeploymentName := fmt.Sprintf("%s-work-webhook", clusterManagerName)
+	workWebhookDeployment, err := s.deploymentLister.Deployments(deployNamespace).Get(workWebhookDeploymentName)
+	if err != nil {
+		return metav1.Condition{
+			Type:    workWebhookDegraded,
+			Status:  metav1.ConditionTrue,
+			Reason:  "GetWorkWebhookDeploymentFailed",
+			Message: fmt.Sprintf("Failed to get work webhook deployment %q %q: %v", deployNamespace, workWebhookDeploymentName, err),
+		}
+	}
+
+	if unavailablePod := helpers.NumOfUnavailablePod(workWebhookDeployment); unavailablePod > 0 {
+		return metav1.Condition{
+			Type:    workWebhookDegraded,
+			Status:  metav1.ConditionTrue,
+			Reason:  "UnavailableWorkWebhookPod",
+			Message: fmt.Sprintf("%v of requested instances are unavailable of work webhook deployment %q %q", unavailablePod, deployNamespace, workWebhookDeploymentName),
+		}
+	}
+
+	return metav1.Condition{
+		Type:    workWebhookDegraded,
+		Status:  metav1.ConditionFalse,
+		Reason:  "WorkWebhookFunctional",
+		Message: "Work webhook is serving admission requests",
+	}
+}
+
+// checkPlacementDeployment checks placement deployment status and returns the
+// condition of the clustermanager
+func (s *clusterManagerStatusController) checkPlacementDeployment(clusterManagerName, deployNamespace string) metav1.Condition {
+	// Check placement deployment status
 	placementDeploymentName := fmt.Sprintf("%s-placement-controller", clusterManagerName)
-	placementDeployment, err := s.deploymentLister.Deployments(helpers.ClusterManagerNamespace).Get(placementDeploymentName)
+	placementDeployment, err := s.deploymentLister.Deployments(deployNamespace).Get(placementDeploymentName)
 	if err != nil {
-		_, _, err := helpers.UpdateClusterManagerStatus(ctx, s.clusterManagerClient, clusterManagerName,
-			helpers.UpdateClusterManagerConditionFn(metav1.Condition{
-				Type:    placementDegraded,
-				Status:  metav1.ConditionTrue,
-				Reason:  "GetPlacementDeploymentFailed",
-				Message: fmt.Sprintf("Failed to get placement deployment %q %q: %v", helpers.ClusterManagerNamespace, placementDeploymentName, err),
-			}),
-		)
-		return err
+		return metav1.Condition{
+			Type:    placementDegraded,
+			Status:  metav1.ConditionTrue,
+			Reason:  "GetPlacementDeploymentFailed",
+			Message: fmt.Sprintf("Failed to get placement deployment %q %q: %v", deployNamespace, placementDeploymentName, err),
+		}
 	}
 
 	if unavailablePod := helpers.NumOfUnavailablePod(placementDeployment); unavailablePod > 0 {
-		_, _, err := helpers.UpdateClusterManagerStatus(ctx, s.clusterManagerClient, clusterManagerName,
-			helpers.UpdateClusterManagerConditionFn(metav1.Condition{
-				Type:    placementDegraded,
-				Status:  metav1.ConditionTrue,
-				Reason:  "UnavailablePlacementPod",
-				Message: fmt.Sprintf("%v of requested instances are unavailable of placement deployment %q %q", unavailablePod, helpers.ClusterManagerNamespace, placementDeploymentName),
-			}),
-		)
-		return err
+		return metav1.Condition{
+			Type:    placementDegraded,
+			Status:  metav1.ConditionTrue,
+			Reason:  "UnavailablePlacementPod",
+			Message: fmt.Sprintf("%v of requested instances are unavailable of placement deployment %q %q", unavailablePod, deployNamespace, placementDeploymentName),
+		}
 	}
 
-	_, _, err = helpers.UpdateClusterManagerStatus(ctx, s.clusterManagerClient, clusterManagerName,
-		helpers.UpdateClusterManagerConditionFn(metav1.Condition{
-			Type:    placementDegraded,
-			Status:  metav1.ConditionFalse,
-			Reason:  "PlacementFunctional",
-			Message: "Placement is scheduling placement decisions",
-		}),
-	)
-	return err
+	return metav1.Condition{
+		Type:    placementDegraded,
+		Status:  metav1.ConditionFalse,
+		Reason:  "PlacementFunctional",
+		Message: "Placement is scheduling placement decisions",
+	}
+}
+
+// checkAddOnManagerDeployment checks addon manager deployment status and returns the
+// condition of the clustermanager
+func (s *clusterManagerStatusController) checkAddOnManagerDeployment(clusterManagerName, deployNamespace string) metav1.Condition {
+	// Check addon manager deployment status
+	addOnManagerDeploymentName := fmt.Sprintf("%s-addon-manager-controller", clusterManagerName)
+	addOnManagerDeployment, err := s.deploymentLister.Deployments(deployNamespace).Get(addOnManagerDeploymentName)
+	if err != nil {
+		return metav1.Condition{
+			Type:    addOnManagerDegraded,
+			Status:  metav1.ConditionTrue,
+			Reason:  "GetAddOnManagerDeploymentFailed",
+			Message: fmt.Sprintf("Failed to get addon manager deployment %q %q: %v", deployNamespace, addOnManagerDeploymentName, err),
+		}
+	}
+
+	if unavailablePod := helpers.NumOfUnavailablePod(addOnManagerDeployment); unavailablePod > 0 {
+		return metav1.Condition{
+			Type:    addOnManagerDegraded,
+			Status:  metav1.ConditionTrue,
+			Reason:  "UnavailableAddOnManagerPod",
+			Message: fmt.Sprintf("%v of requested instances are unavailable of addon manager deployment %q %q", unavailablePod, deployNamespace, addOnManagerDeploymentName),
+		}
+	}
+
+	return metav1.Condition{
+		Type:    addOnManagerDegraded,
+		Status:  metav1.ConditionFalse,
+		Reason:  "AddOnManagerFunctional",
+		Message: "Addon manager is managing addons",
+	}
 }
@@ -7,6 +7,8 @@ import (
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	kubeinformers "k8s.io/client-go/informers"
@@ -16,6 +18,7 @@ import (
 	fakeoperatorclient "open-cluster-management.io/api/client/operator/clientset/versioned/fake"
 	operatorinformers "open-cluster-management.io/api/client/operator/informers/externalversions"
 	operatorapiv1 "open-cluster-management.io/api/operator/v1"
+	"open-cluster-management.io/registration-operator/pkg/helpers"
 	testinghelper "open-cluster-management.io/registration-operator/pkg/helpers/testing"
 )
 
@@ -28,6 +31,7 @@ func newClusterManager() *operatorapiv1.ClusterManager {
 		},
 		Spec: operatorapiv1.ClusterManagerSpec{
 			RegistrationImagePullSpec: "testregistration",
+			PlacementImagePullSpec:    "testplacement",
 		},
 	}
 }
@@ -40,9 +44,15 @@ func newRegistrationDeployment(desiredReplica, availableReplica int32) *appsv1.D
 		},
 		Spec: appsv1.DeploymentSpec{
 			Replicas: &desiredReplica,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "registration-controller", Image: "testregistration"}},
+				},
+			},
 		},
 		Status: appsv1.DeploymentStatus{
-			AvailableReplicas: availableReplica,
+			AvailableReplicas:  availableReplica,
+			ObservedGeneration: 1,
 		},
 	}
 }
@@ -55,13 +65,41 @@ func newPlacementDeployment(desiredReplica, availableReplica int32) *appsv1.Depl
 		},
 		Spec: appsv1.DeploymentSpec{
 			Replicas: &desiredReplica,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "placement-controller", Image: "testplacement"}},
+				},
+			},
 		},
 		Status: appsv1.DeploymentStatus{
-			AvailableReplicas: availableReplica,
+			AvailableReplicas:  availableReplica,
+			ObservedGeneration: 1,
 		},
 	}
 }
 
+func assertDeployedComponents(t *testing.T, object runtime.Object, expected []operatorapiv1.DeployedComponent) {
+	clusterManager, ok := object.(*operatorapiv1.ClusterManager)
+	if !ok {
+		t.Errorf("Expected a ClusterManager, got %v", object)
+		return
+	}
+	if !equality.Semantic.DeepEqual(clusterManager.Status.DeployedComponents, expected) {
+		t.Errorf("Expected deployed components %v, got %v", expected, clusterManager.Status.DeployedComponents)
+	}
+}
+
+func assertLastKnownGoodImages(t *testing.T, object runtime.Object, expected map[string]string) {
+	clusterManager, ok := object.(*operatorapiv1.ClusterManager)
+	if !ok {
+		t.Errorf("Expected a ClusterManager, got %v", object)
+		return
+	}
+	if !equality.Semantic.DeepEqual(clusterManager.Status.LastKnownGoodImages, expected) {
+		t.Errorf("Expected last known good images %v, got %v", expected, clusterManager.Status.LastKnownGoodImages)
+	}
+}
+
 func TestSyncStatus(t *testing.T) {
 	cases := []struct {
 		name            string
@@ -96,16 +134,22 @@ func TestSyncStatus(t *testing.T) {
 				newPlacementDeployment(3, 0),
 			},
 			validateActions: func(t *testing.T, actions []clienttesting.Action) {
-				testinghelper.AssertEqualNumber(t, len(actions), 4)
+				testinghelper.AssertEqualNumber(t, len(actions), 2)
 				testinghelper.AssertGet(t, actions[0], "operator.open-cluster-management.io", "v1", "clustermanagers")
 				testinghelper.AssertAction(t, actions[1], "update")
-				expectedCondition1 := testinghelper.NamedCondition(registrationDegraded, "GetRegistrationDeploymentFailed", metav1.ConditionTrue)
-				testinghelper.AssertOnlyConditions(t, actions[1].(clienttesting.UpdateActionImpl).Object, expectedCondition1)
-
-				testinghelper.AssertGet(t, actions[2], "operator.open-cluster-management.io", "v1", "clustermanagers")
-				testinghelper.AssertAction(t, actions[3], "update")
-				expectedCondition2 := testinghelper.NamedCondition(placementDegraded, "UnavailablePlacementPod", metav1.ConditionTrue)
-				testinghelper.AssertOnlyConditions(t, actions[3].(clienttesting.UpdateActionImpl).Object, expectedCondition1, expectedCondition2)
+				testinghelper.AssertOnlyConditions(t, actions[1].(clienttesting.UpdateActionImpl).Object,
+					testinghelper.NamedCondition(registrationDegraded, "GetRegistrationDeploymentFailed", metav1.ConditionTrue),
+					testinghelper.NamedCondition(registrationWebhookDegraded, "GetRegistrationWebhookDeploymentFailed", metav1.ConditionTrue),
+					testinghelper.NamedCondition(workWebhookDegraded, "GetWorkWebhookDeploymentFailed", metav1.ConditionTrue),
+					testinghelper.NamedCondition(placementDegraded, "UnavailablePlacementPod", metav1.ConditionTrue))
+				assertDeployedComponents(t, actions[1].(clienttesting.UpdateActionImpl).Object, []operatorapiv1.DeployedComponent{
+					{
+						Name:               fmt.Sprintf("%s-placement-controller", testClusterManagerName),
+						Image:              "testplacement",
+						ObservedGeneration: 1,
+						Ready:              false,
+					},
+				})
 			},
 		},
 		{
@@ -117,16 +161,31 @@ func TestSyncStatus(t *testing.T) {
 				newPlacementDeployment(3, 3),
 			},
 			validateActions: func(t *testing.T, actions []clienttesting.Action) {
-				testinghelper.AssertEqualNumber(t, len(actions), 4)
+				testinghelper.AssertEqualNumber(t, len(actions), 2)
 				testinghelper.AssertGet(t, actions[0], "operator.open-cluster-management.io", "v1", "clustermanagers")
 				testinghelper.AssertAction(t, actions[1], "update")
-				expectedCondition1 := testinghelper.NamedCondition(registrationDegraded, "UnavailableRegistrationPod", metav1.ConditionTrue)
-				testinghelper.AssertOnlyConditions(t, actions[1].(clienttesting.UpdateActionImpl).Object, expectedCondition1)
-
-				testinghelper.AssertGet(t, actions[2], "operator.open-cluster-management.io", "v1", "clustermanagers")
-				testinghelper.AssertAction(t, actions[3], "update")
-				expectedCondition2 := testinghelper.NamedCondition(placementDegraded, "PlacementFunctional", metav1.ConditionFalse)
-				testinghelper.AssertOnlyConditions(t, actions[3].(clienttesting.UpdateActionImpl).Object, expectedCondition1, expectedCondition2)
+				testinghelper.AssertOnlyConditions(t, actions[1].(clienttesting.UpdateActionImpl).Object,
+					testinghelper.NamedCondition(registrationDegraded, "UnavailableRegistrationPod", metav1.ConditionTrue),
+					testinghelper.NamedCondition(registrationWebhookDegraded, "GetRegistrationWebhookDeploymentFailed", metav1.ConditionTrue),
+					testinghelper.NamedCondition(workWebhookDegraded, "GetWorkWebhookDeploymentFailed", metav1.ConditionTrue),
+					testinghelper.NamedCondition(placementDegraded, "PlacementFunctional", metav1.ConditionFalse))
+				assertDeployedComponents(t, actions[1].(clienttesting.UpdateActionImpl).Object, []operatorapiv1.DeployedComponent{
+					{
+						Name:               fmt.Sprintf("%s-registration-controller", testClusterManagerName),
+						Image:              "testregistration",
+						ObservedGeneration: 1,
+						Ready:              false,
+					},
+					{
+						Name:               fmt.Sprintf("%s-placement-controller", testClusterManagerName),
+						Image:              "testplacement",
+						ObservedGeneration: 1,
+						Ready:              true,
+					},
+				})
+				// The unavailable registration pods keep the image set from being
+				// recorded as last known good
+				assertLastKnownGoodImages(t, actions[1].(clienttesting.UpdateActionImpl).Object, nil)
 			},
 		},
 		{
@@ -135,16 +194,52 @@ func TestSyncStatus(t *testing.T) {
 			clusterManagers: []runtime.Object{newClusterManager()},
 			deployments:     []runtime.Object{newRegistrationDeployment(3, 3)},
 			validateActions: func(t *testing.T, actions []clienttesting.Action) {
-				testinghelper.AssertEqualNumber(t, len(actions), 4)
+				testinghelper.AssertEqualNumber(t, len(actions), 2)
 				testinghelper.AssertGet(t, actions[0], "operator.open-cluster-management.io", "v1", "clustermanagers")
 				testinghelper.AssertAction(t, actions[1], "update")
-				expectedCondition1 := testinghelper.NamedCondition(registrationDegraded, "RegistrationFunctional", metav1.ConditionFalse)
-				testinghelper.AssertOnlyConditions(t, actions[1].(clienttesting.UpdateActionImpl).Object, expectedCondition1)
-
-				testinghelper.AssertGet(t, actions[2], "operator.open-cluster-management.io", "v1", "clustermanagers")
-				testinghelper.AssertAction(t, actions[3], "update")
-				expectedCondition2 := testinghelper.NamedCondition(placementDegraded, "GetPlacementDeploymentFailed", metav1.ConditionTrue)
-				testinghelper.AssertOnlyConditions(t, actions[3].(clienttesting.UpdateActionImpl).Object, expectedCondition1, expectedCondition2)
+				testinghelper.AssertOnlyConditions(t, actions[1].(clienttesting.UpdateActionImpl).Object,
+					testinghelper.NamedCondition(registrationDegraded, "RegistrationFunctional", metav1.ConditionFalse),
+					testinghelper.NamedCondition(registrationWebhookDegraded, "GetRegistrationWebhookDeploymentFailed", metav1.ConditionTrue),
+					testinghelper.NamedCondition(workWebhookDegraded, "GetWorkWebhookDeploymentFailed", metav1.ConditionTrue),
+					testinghelper.NamedCondition(placementDegraded, "GetPlacementDeploymentFailed", metav1.ConditionTrue))
+				assertDeployedComponents(t, actions[1].(clienttesting.UpdateActionImpl).Object, []operatorapiv1.DeployedComponent{
+					{
+						Name:               fmt.Sprintf("%s-registration-controller", testClusterManagerName),
+						Image:              "testregistration",
+						ObservedGeneration: 1,
+						Ready:              true,
+					},
+				})
+				assertLastKnownGoodImages(t, actions[1].(clienttesting.UpdateActionImpl).Object, map[string]string{
+					fmt.Sprintf("%s-registration-controller", testClusterManagerName): "testregistration",
+				})
+			},
+		},
+		{
+			name:     "placement disabled",
+			queueKey: testClusterManagerName,
+			clusterManagers: func() []runtime.Object {
+				clusterManager := newClusterManager()
+				clusterManager.Spec.PlacementImagePullSpec = ""
+				return []runtime.Object{clusterManager}
+			}(),
+			deployments: []runtime.Object{newRegistrationDeployment(3, 3)},
+			validateActions: func(t *testing.T, actions []clienttesting.Action) {
+				testinghelper.AssertEqualNumber(t, len(actions), 2)
+				testinghelper.AssertGet(t, actions[0], "operator.open-cluster-management.io", "v1", "clustermanagers")
+				testinghelper.AssertAction(t, actions[1], "update")
+				testinghelper.AssertOnlyConditions(t, actions[1].(clienttesting.UpdateActionImpl).Object,
+					testinghelper.NamedCondition(registrationDegraded, "RegistrationFunctional", metav1.ConditionFalse),
+					testinghelper.NamedCondition(registrationWebhookDegraded, "GetRegistrationWebhookDeploymentFailed", metav1.ConditionTrue),
+					testinghelper.NamedCondition(workWebhookDegraded, "GetWorkWebhookDeploymentFailed", metav1.ConditionTrue))
+				assertDeployedComponents(t, actions[1].(clienttesting.UpdateActionImpl).Object, []operatorapiv1.DeployedComponent{
+					{
+						Name:               fmt.Sprintf("%s-registration-controller", testClusterManagerName),
+						Image:              "testregistration",
+						ObservedGeneration: 1,
+						Ready:              true,
+					},
+				})
 			},
 		},
 	}
@@ -181,3 +276,111 @@ func TestSyncStatus(t *testing.T) {
 	}
 
 }
+
+// TestSyncStatusNoChange verifies a resync with an unchanged status does not issue
+// a status write.
+func TestSyncStatusNoChange(t *testing.T) {
+	fakeKubeClient := fakekube.NewSimpleClientset()
+	kubeInformers := kubeinformers.NewSharedInformerFactory(fakeKubeClient, 5*time.Minute)
+	deployment := newRegistrationDeployment(3, 3)
+	kubeInformers.Apps().V1().Deployments().Informer().GetStore().Add(deployment)
+
+	fakeOperatorClient := fakeoperatorclient.NewSimpleClientset(newClusterManager())
+	operatorInformers := operatorinformers.NewSharedInformerFactory(fakeOperatorClient, 5*time.Minute)
+	operatorInformers.Operator().V1().ClusterManagers().Informer().GetStore().Add(newClusterManager())
+
+	controller := &clusterManagerStatusController{
+		deploymentLister:     kubeInformers.Apps().V1().Deployments().Lister(),
+		clusterManagerClient: fakeOperatorClient.OperatorV1().ClusterManagers(),
+		clusterManagerLister: operatorInformers.Operator().V1().ClusterManagers().Lister(),
+	}
+
+	syncContext := testinghelper.NewFakeSyncContext(t, testClusterManagerName)
+	if err := controller.sync(context.TODO(), syncContext); err != nil {
+		t.Fatalf("Expected no error when update status: %v", err)
+	}
+	testinghelper.AssertEqualNumber(t, len(fakeOperatorClient.Actions()), 2)
+
+	// The second sync computes the same status, so only the get is issued.
+	if err := controller.sync(context.TODO(), syncContext); err != nil {
+		t.Fatalf("Expected no error when update status: %v", err)
+	}
+	actions := fakeOperatorClient.Actions()
+	testinghelper.AssertEqualNumber(t, len(actions), 3)
+	testinghelper.AssertGet(t, actions[2], "operator.open-cluster-management.io", "v1", "clustermanagers")
+}
+
+// TestSyncOperatorPermissionCondition verifies missing operator RBAC is reported
+// through the OperatorPermissionDegraded condition.
+func TestSyncOperatorPermissionCondition(t *testing.T) {
+	fakeKubeClient := fakekube.NewSimpleClientset()
+	kubeInformers := kubeinformers.NewSharedInformerFactory(fakeKubeClient, 5*time.Minute)
+
+	fakeOperatorClient := fakeoperatorclient.NewSimpleClientset(newClusterManager())
+	operatorInformers := operatorinformers.NewSharedInformerFactory(fakeOperatorClient, 5*time.Minute)
+	operatorInformers.Operator().V1().ClusterManagers().Informer().GetStore().Add(newClusterManager())
+
+	controller := &clusterManagerStatusController{
+		deploymentLister:     kubeInformers.Apps().V1().Deployments().Lister(),
+		clusterManagerClient: fakeOperatorClient.OperatorV1().ClusterManagers(),
+		clusterManagerLister: operatorInformers.Operator().V1().ClusterManagers().Lister(),
+		checkOperatorPermissions: func(ctx context.Context) ([]string, error) {
+			return []string{"create secrets", "delete secrets"}, nil
+		},
+	}
+
+	syncContext := testinghelper.NewFakeSyncContext(t, testClusterManagerName)
+	if err := controller.sync(context.TODO(), syncContext); err != nil {
+		t.Fatalf("Expected no error when update status: %v", err)
+	}
+
+	actions := fakeOperatorClient.Actions()
+	testinghelper.AssertEqualNumber(t, len(actions), 2)
+	testinghelper.AssertAction(t, actions[1], "update")
+	testinghelper.AssertOnlyConditions(t, actions[1].(clienttesting.UpdateActionImpl).Object,
+		testinghelper.NamedCondition(registrationDegraded, "GetRegistrationDeploymentFailed", metav1.ConditionTrue),
+		testinghelper.NamedCondition(registrationWebhookDegraded, "GetRegistrationWebhookDeploymentFailed", metav1.ConditionTrue),
+		testinghelper.NamedCondition(workWebhookDegraded, "GetWorkWebhookDeploymentFailed", metav1.ConditionTrue),
+		testinghelper.NamedCondition(placementDegraded, "GetPlacementDeploymentFailed", metav1.ConditionTrue),
+		testinghelper.NamedCondition(helpers.OperatorPermissionDegraded, "MissingOperatorPermissions", metav1.ConditionTrue))
+}
+
+func TestWebhookReachability(t *testing.T) {
+	cases := []struct {
+		name           string
+		probeErr       error
+		expectedStatus metav1.ConditionStatus
+		expectedReason string
+	}{
+		{
+			name:           "webhooks reachable",
+			expectedStatus: metav1.ConditionFalse,
+			expectedReason: "WebhooksReachable",
+		},
+		{
+			name:           "handshake failed",
+			probeErr:       fmt.Errorf("connection refused"),
+			expectedStatus: metav1.ConditionTrue,
+			expectedReason: "WebhookConnectionFailed",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			controller := &clusterManagerStatusController{
+				kubeClient: fakekube.NewSimpleClientset(),
+				probeWebhook: func(addr, serverName string, caBundle []byte) error {
+					return c.probeErr
+				},
+			}
+
+			condition := controller.checkWebhookReachability(context.TODO(), "open-cluster-management-hub")
+			if condition == nil {
+				t.Fatalf("Expected a condition from the reachability check")
+			}
+			if condition.Type != webhookUnreachable || condition.Status != c.expectedStatus || condition.Reason != c.expectedReason {
+				t.Errorf("Expected condition %s/%s/%s, got %v", webhookUnreachable, c.expectedStatus, c.expectedReason, condition)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package gccontroller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	operatorhelpers "github.com/openshift/library-go/pkg/operator/v1helpers"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"open-cluster-management.io/registration-operator/pkg/metrics"
+)
+
+var ResyncInterval = time.Minute * 5
+
+// gcController deletes the cluster scoped resources carrying an owner label whose
+// owning custom resource no longer exists, e.g. the cluster roles left behind when a
+// klusterlet is recreated under a new name. Namespaced resources need no collector,
+// they are removed with their namespace.
+type gcController struct {
+	kubeClient  kubernetes.Interface
+	ownerLabel  string
+	ownerExists func(name string) (bool, error)
+}
+
+// NewGCController returns a controller that garbage collects the orphaned cluster
+// scoped resources labeled with ownerLabel. ownerExists reports whether the named
+// owning custom resource still exists.
+func NewGCController(
+	controllerName string,
+	ownerLabel string,
+	kubeClient kubernetes.Interface,
+	ownerExists func(name string) (bool, error),
+	ownerInformer factory.Informer,
+	recorder events.Recorder) factory.Controller {
+	controller := &gcController{
+		kubeClient:  kubeClient,
+		ownerLabel:  ownerLabel,
+		ownerExists: ownerExists,
+	}
+
+	return factory.New().
+		ResyncEvery(ResyncInterval).
+		WithInformers(ownerInformer).
+		WithSync(metrics.InstrumentSyncer(controllerName, controller.sync)).
+		ToController(controllerName, recorder)
+}
+
+func (c *gcController) sync(ctx context.Context, controllerContext factory.SyncContext) error {
+	// The label key alone is an exists selector, so only the resources the operator
+	// labeled with an owner are listed.
+	listOptions := metav1.ListOptions{LabelSelector: c.ownerLabel}
+	errs := []error{}
+
+	clusterRoles, err := c.kubeClient.RbacV1().ClusterRoles().List(ctx, listOptions)
+	if err != nil {
+		return err
+	}
+	for _, clusterRole := range clusterRoles.Items {
+		orphaned, err := c.isOrphaned(clusterRole.Labels)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !orphaned {
+			continue
+		}
+		if err := c.kubeClient.RbacV1().ClusterRoles().Delete(ctx, clusterRole.Name, metav1.DeleteOptions{}); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		controllerContext.Recorder().Eventf("OrphanedResourceDeleted",
+			"clusterrole %s of removed %s %q is deleted", clusterRole.Name, c.ownerLabel, clusterRole.Labels[c.ownerLabel])
+	}
+
+	clusterRoleBindings, err := c.kubeClient.RbacV1().ClusterRoleBindings().List(ctx, listOptions)
+	if err != nil {
+		return err
+	}
+	for _, clusterRoleBinding := range clusterRoleBindings.Items {
+		orphaned, err := c.isOrphaned(clusterRoleBinding.Labels)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !orphaned {
+			continue
+		}
+		if err := c.kubeClient.RbacV1().ClusterRoleBindings().Delete(ctx, clusterRoleBinding.Name, metav1.DeleteOptions{}); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		controllerContext.Recorder().Eventf("OrphanedResourceDeleted",
+			"clusterrolebinding %s of removed %s %q is deleted", clusterRoleBinding.Name, c.ownerLabel, clusterRoleBinding.Labels[c.ownerLabel])
+	}
+
+	namespaces, err := c.kubeClient.CoreV1().Namespaces().List(ctx, listOptions)
+	if err != nil {
+		return err
+	}
+	for _, namespace := range namespaces.Items {
+		orphaned, err := c.isOrphaned(namespace.Labels)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !orphaned {
+			continue
+		}
+		if err := c.kubeClient.CoreV1().Namespaces().Delete(ctx, namespace.Name, metav1.DeleteOptions{}); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		controllerContext.Recorder().Eventf("OrphanedResourceDeleted",
+			"namespace %s of removed %s %q is deleted", namespace.Name, c.ownerLabel, namespace.Labels[c.ownerLabel])
+	}
+
+	return operatorhelpers.NewMultiLineAggregate(errs)
+}
+
+// isOrphaned reports whether the labeled owner of a resource no longer exists
+func (c *gcController) isOrphaned(resourceLabels map[string]string) (bool, error) {
+	owner := resourceLabels[c.ownerLabel]
+	if len(owner) == 0 {
+		return false, fmt.Errorf("no value for owner label %s", c.ownerLabel)
+	}
+	exists, err := c.ownerExists(owner)
+	if err != nil {
+		return false, err
+	}
+	return !exists, nil
+}
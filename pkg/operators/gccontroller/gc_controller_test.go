@@ -0,0 +1,124 @@
+package gccontroller
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"open-cluster-management.io/registration-operator/pkg/helpers"
+	testinghelper "open-cluster-management.io/registration-operator/pkg/helpers/testing"
+)
+
+func newClusterRole(name, owner string) *rbacv1.ClusterRole {
+	clusterRole := &rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+	}
+	if len(owner) > 0 {
+		clusterRole.Labels = map[string]string{helpers.KlusterletOwnerLabel: owner}
+	}
+	return clusterRole
+}
+
+func newClusterRoleBinding(name, owner string) *rbacv1.ClusterRoleBinding {
+	clusterRoleBinding := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+	}
+	if len(owner) > 0 {
+		clusterRoleBinding.Labels = map[string]string{helpers.KlusterletOwnerLabel: owner}
+	}
+	return clusterRoleBinding
+}
+
+func newNamespace(name, owner string) *corev1.Namespace {
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+	}
+	if len(owner) > 0 {
+		namespace.Labels = map[string]string{helpers.KlusterletOwnerLabel: owner}
+	}
+	return namespace
+}
+
+func TestSync(t *testing.T) {
+	cases := []struct {
+		name            string
+		objects         []runtime.Object
+		owners          []string
+		expectedDeletes []string
+	}{
+		{
+			name: "all owners exist",
+			objects: []runtime.Object{
+				newClusterRole("role1", "klusterlet"),
+				newClusterRoleBinding("binding1", "klusterlet"),
+				newNamespace("ns1", "klusterlet"),
+			},
+			owners:          []string{"klusterlet"},
+			expectedDeletes: []string{},
+		},
+		{
+			name: "orphaned resources are deleted",
+			objects: []runtime.Object{
+				newClusterRole("role1", "klusterlet"),
+				newClusterRole("role2", "removed"),
+				newClusterRoleBinding("binding1", "removed"),
+				newNamespace("ns1", "removed"),
+			},
+			owners:          []string{"klusterlet"},
+			expectedDeletes: []string{"role2", "binding1", "ns1"},
+		},
+		{
+			name: "unlabeled resources are kept",
+			objects: []runtime.Object{
+				newClusterRole("role1", ""),
+				newNamespace("ns1", ""),
+			},
+			owners:          []string{},
+			expectedDeletes: []string{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fakeKubeClient := fakekube.NewSimpleClientset(c.objects...)
+			controller := &gcController{
+				kubeClient: fakeKubeClient,
+				ownerLabel: helpers.KlusterletOwnerLabel,
+				ownerExists: func(name string) (bool, error) {
+					for _, owner := range c.owners {
+						if owner == name {
+							return true, nil
+						}
+					}
+					return false, nil
+				},
+			}
+
+			syncContext := testinghelper.NewFakeSyncContext(t, "")
+			if err := controller.sync(context.TODO(), syncContext); err != nil {
+				t.Fatalf("Expected no error when sync: %v", err)
+			}
+
+			deletes := []string{}
+			for _, action := range fakeKubeClient.Actions() {
+				if action.GetVerb() == "delete" {
+					deletes = append(deletes, action.(clienttesting.DeleteAction).GetName())
+				}
+			}
+			if len(deletes) != len(c.expectedDeletes) {
+				t.Fatalf("Expected deletes %v, but got %v", c.expectedDeletes, deletes)
+			}
+			for index, name := range c.expectedDeletes {
+				if deletes[index] != name {
+					t.Errorf("Expected deletes %v, but got %v", c.expectedDeletes, deletes)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package addoncontroller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	operatorv1client "open-cluster-management.io/api/client/operator/clientset/versioned/typed/operator/v1"
+	operatorinformer "open-cluster-management.io/api/client/operator/informers/externalversions/operator/v1"
+	operatorlister "open-cluster-management.io/api/client/operator/listers/operator/v1"
+	operatorapiv1 "open-cluster-management.io/api/operator/v1"
+	"open-cluster-management.io/registration-operator/pkg/helpers"
+	"open-cluster-management.io/registration-operator/pkg/metrics"
+
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	operatorhelpers "github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// addOnCatalogApplied signals whether the addon catalog manifests have been
+	// applied into the addon namespace.
+	addOnCatalogApplied = "AddOnCatalogApplied"
+)
+
+// addOnCatalogController applies the addon agent manifests a klusterlet references
+// through spec.AddOnCatalogConfigMap into the addon namespace, and deletes resources
+// whose catalog entries are dropped. The applied resources are recorded in
+// status.AppliedAddOnResources, so simple addons can be lifecycled by editing the
+// catalog configmap, without an addon-framework installation on the hub.
+type addOnCatalogController struct {
+	kubeClient         kubernetes.Interface
+	apiExtensionClient apiextensionsclient.Interface
+	dynamicClient      dynamic.Interface
+	klusterletClient   operatorv1client.KlusterletInterface
+	klusterletLister   operatorlister.KlusterletLister
+}
+
+// NewAddOnCatalogController creates the addon catalog controller
+func NewAddOnCatalogController(
+	kubeClient kubernetes.Interface,
+	apiExtensionClient apiextensionsclient.Interface,
+	dynamicClient dynamic.Interface,
+	klusterletClient operatorv1client.KlusterletInterface,
+	klusterletInformer operatorinformer.KlusterletInformer,
+	recorder events.Recorder) factory.Controller {
+	controller := &addOnCatalogController{
+		kubeClient:         kubeClient,
+		apiExtensionClient: apiExtensionClient,
+		dynamicClient:      dynamicClient,
+		klusterletClient:   klusterletClient,
+		klusterletLister:   klusterletInformer.Lister(),
+	}
+	return factory.New().WithSync(metrics.InstrumentSyncer("AddOnCatalogController", controller.sync)).
+		WithInformersQueueKeyFunc(func(obj runtime.Object) string {
+			accessor, _ := meta.Accessor(obj)
+			return accessor.GetName()
+		}, klusterletInformer.Informer()).
+		// The catalog configmap lives in the configurable agent namespace, so its
+		// changes are picked up on resync instead of through a dedicated informer.
+		ResyncEvery(5*time.Minute).
+		ToController("AddOnCatalogController", recorder)
+}
+
+func (a *addOnCatalogController) sync(ctx context.Context, controllerContext factory.SyncContext) error {
+	klusterletName := controllerContext.QueueKey()
+	klog.V(4).InfoS("Reconciling Klusterlet", "controller", "AddOnCatalogController", "klusterlet", klusterletName)
+
+	// The periodic resync enqueues the default queue key, re-enqueue every
+	// klusterlet so catalog configmap changes are picked up.
+	if klusterletName == factory.DefaultQueueKey {
+		klusterlets, err := a.klusterletLister.List(labels.Everything())
+		if err != nil {
+			return err
+		}
+		for _, klusterlet := range klusterlets {
+			controllerContext.Queue().Add(klusterlet.Name)
+		}
+		return nil
+	}
+
+	klusterlet, err := a.klusterletLister.Get(klusterletName)
+	// Klusterlet not found, could have been deleted, do nothing.
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// The klusterlet cleanup removes the addon namespace along with the agent
+	// namespace, so the applied addon resources go away with it.
+	if !klusterlet.DeletionTimestamp.IsZero() {
+		return nil
+	}
+
+	namespace := helpers.KlusterletAgentNamespace(klusterlet)
+	addonNamespace := fmt.Sprintf("%s-addon", namespace)
+	catalogName := klusterlet.Spec.AddOnCatalogConfigMap
+
+	// Most klusterlets do not reference a catalog, return before any status write.
+	if catalogName == "" && len(klusterlet.Status.AppliedAddOnResources) == 0 &&
+		meta.FindStatusCondition(klusterlet.Status.Conditions, addOnCatalogApplied) == nil {
+		return nil
+	}
+
+	errs := []error{}
+	manifests := map[string][]byte{}
+	if catalogName != "" {
+		catalog, err := a.kubeClient.CoreV1().ConfigMaps(namespace).Get(ctx, catalogName, metav1.GetOptions{})
+		switch {
+		case errors.IsNotFound(err):
+			// Keep the applied resources, a missing catalog is likely transient
+			// while it is being distributed into the agent namespace.
+			_, _, updateErr := helpers.UpdateKlusterletStatus(ctx, a.klusterletClient, klusterletName,
+				helpers.UpdateKlusterletConditionFn(metav1.Condition{
+					Type: addOnCatalogApplied, Status: metav1.ConditionFalse, Reason: "AddOnCatalogNotFound",
+					Message: fmt.Sprintf("AddOn catalog configmap %q is not found in namespace %q", catalogName, namespace),
+				}))
+			return updateErr
+		case err != nil:
+			return err
+		}
+		for key, data := range catalog.Data {
+			rendered, err := renderCatalogEntry([]byte(data), addonNamespace)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("cannot decode catalog entry %q: %v", key, err))
+				continue
+			}
+			manifests[key] = rendered
+		}
+	}
+
+	keys := make([]string, 0, len(manifests))
+	for key := range manifests {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	assetFn := func(name string) ([]byte, error) { return manifests[name], nil }
+
+	appliedKeys := []string{}
+	applyResults := helpers.ApplyDirectly(a.kubeClient, a.apiExtensionClient, nil, controllerContext.Recorder(), assetFn, keys...)
+	for _, result := range applyResults {
+		if result.Error != nil {
+			errs = append(errs, fmt.Errorf("%q (%s): %v", result.File, result.Type, result.Error))
+			continue
+		}
+		appliedKeys = append(appliedKeys, result.File)
+	}
+
+	desiredResources, err := helpers.NewRelatedResources(assetFn, keys...)
+	if err != nil {
+		return err
+	}
+	desired := map[operatorapiv1.RelatedResourceMeta]struct{}{}
+	for _, resource := range desiredResources {
+		desired[resource] = struct{}{}
+	}
+	appliedResources, err := helpers.NewRelatedResources(assetFn, appliedKeys...)
+	if err != nil {
+		return err
+	}
+
+	// Delete the resources whose catalog entries are dropped. Resources whose
+	// deletion fails stay recorded, so the deletion is retried on the next sync.
+	for _, resource := range klusterlet.Status.AppliedAddOnResources {
+		if _, ok := desired[resource]; ok {
+			continue
+		}
+		gvr := schema.GroupVersionResource{Group: resource.Group, Version: resource.Version, Resource: resource.Resource}
+		err := a.dynamicClient.Resource(gvr).Namespace(resource.Namespace).Delete(ctx, resource.Name, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("unable to delete addon resource %s %s/%s: %v", resource.Resource, resource.Namespace, resource.Name, err))
+			appliedResources = append(appliedResources, resource)
+			continue
+		}
+		if err == nil {
+			controllerContext.Recorder().Eventf("AddOnResourceDeleted",
+				"deleted addon resource %s %s/%s dropped from catalog %q", resource.Resource, resource.Namespace, resource.Name, catalogName)
+		}
+	}
+
+	condition := metav1.Condition{
+		Type: addOnCatalogApplied, Status: metav1.ConditionTrue, Reason: "AddOnCatalogApplied",
+		Message: fmt.Sprintf("Applied %d addon manifests from catalog configmap %q", len(appliedKeys), catalogName),
+	}
+	if aggregatedErr := operatorhelpers.NewMultiLineAggregate(errs); aggregatedErr != nil {
+		condition = metav1.Condition{
+			Type: addOnCatalogApplied, Status: metav1.ConditionFalse, Reason: "AddOnCatalogApplyFailed",
+			Message: aggregatedErr.Error(),
+		}
+	}
+
+	updateFuncs := []helpers.UpdateKlusterletStatusFunc{
+		func(status *operatorapiv1.KlusterletStatus) error {
+			status.AppliedAddOnResources = appliedResources
+			return nil
+		},
+	}
+	if catalogName == "" && len(errs) == 0 {
+		// The catalog reference is removed and all its resources are deleted,
+		// retire the condition along with the tracked resources.
+		updateFuncs = append(updateFuncs, func(status *operatorapiv1.KlusterletStatus) error {
+			meta.RemoveStatusCondition(&status.Conditions, addOnCatalogApplied)
+			return nil
+		})
+	} else {
+		updateFuncs = append(updateFuncs, helpers.UpdateKlusterletConditionFn(condition))
+	}
+	if _, _, err := helpers.UpdateKlusterletStatus(ctx, a.klusterletClient, klusterletName, updateFuncs...); err != nil {
+		errs = append(errs, err)
+	}
+
+	return operatorhelpers.NewMultiLineAggregate(errs)
+}
+
+// renderCatalogEntry forces the namespace of a catalog entry to the addon namespace,
+// so addon manifests cannot escape into other namespaces and catalog authors do not
+// need to hardcode the namespace. Cluster scoped resources are not supported in the
+// catalog.
+func renderCatalogEntry(data []byte, addonNamespace string) ([]byte, error) {
+	object := &unstructured.Unstructured{}
+	if err := yaml.Unmarshal(data, object); err != nil {
+		return nil, err
+	}
+	object.SetNamespace(addonNamespace)
+	return yaml.Marshal(object)
+}
@@ -0,0 +1,211 @@
+package addoncontroller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	fakeoperatorclient "open-cluster-management.io/api/client/operator/clientset/versioned/fake"
+	operatorinformers "open-cluster-management.io/api/client/operator/informers/externalversions"
+	operatorapiv1 "open-cluster-management.io/api/operator/v1"
+	testinghelper "open-cluster-management.io/registration-operator/pkg/helpers/testing"
+)
+
+const (
+	testKlusterletName = "testklusterlet"
+	agentNamespace     = "open-cluster-management-agent"
+	addonNamespace     = "open-cluster-management-agent-addon"
+)
+
+var serviceAccountManifest = `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: example-addon-sa
+`
+
+var deploymentManifest = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: example-addon
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: example-addon
+  template:
+    metadata:
+      labels:
+        app: example-addon
+    spec:
+      containers:
+      - name: example-addon
+        image: quay.io/example/addon:latest
+`
+
+func newKlusterlet(catalog string) *operatorapiv1.Klusterlet {
+	return &operatorapiv1.Klusterlet{
+		ObjectMeta: metav1.ObjectMeta{Name: testKlusterletName},
+		Spec: operatorapiv1.KlusterletSpec{
+			AddOnCatalogConfigMap: catalog,
+		},
+	}
+}
+
+func newCatalogConfigMap(data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "addon-catalog", Namespace: agentNamespace},
+		Data:       data,
+	}
+}
+
+func newTestController(klusterlet *operatorapiv1.Klusterlet, objects ...runtime.Object) (
+	*addOnCatalogController, *fakekube.Clientset, *fakedynamic.FakeDynamicClient, *fakeoperatorclient.Clientset) {
+	fakeKubeClient := fakekube.NewSimpleClientset(objects...)
+	fakeDynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
+	fakeOperatorClient := fakeoperatorclient.NewSimpleClientset(klusterlet)
+	operatorInformers := operatorinformers.NewSharedInformerFactory(fakeOperatorClient, 5*time.Minute)
+	operatorInformers.Operator().V1().Klusterlets().Informer().GetStore().Add(klusterlet)
+
+	controller := &addOnCatalogController{
+		kubeClient:       fakeKubeClient,
+		dynamicClient:    fakeDynamicClient,
+		klusterletClient: fakeOperatorClient.OperatorV1().Klusterlets(),
+		klusterletLister: operatorInformers.Operator().V1().Klusterlets().Lister(),
+	}
+	return controller, fakeKubeClient, fakeDynamicClient, fakeOperatorClient
+}
+
+func updatedKlusterletStatus(t *testing.T, fakeOperatorClient *fakeoperatorclient.Clientset) *operatorapiv1.KlusterletStatus {
+	var updated *operatorapiv1.Klusterlet
+	for _, action := range fakeOperatorClient.Actions() {
+		if action.GetVerb() == "update" && action.GetSubresource() == "status" {
+			updated = action.(clienttesting.UpdateActionImpl).Object.(*operatorapiv1.Klusterlet)
+		}
+	}
+	if updated == nil {
+		t.Fatalf("Expected the klusterlet status to be updated")
+	}
+	return &updated.Status
+}
+
+func TestSyncNoCatalog(t *testing.T) {
+	controller, fakeKubeClient, _, fakeOperatorClient := newTestController(newKlusterlet(""))
+
+	syncContext := testinghelper.NewFakeSyncContext(t, testKlusterletName)
+	if err := controller.sync(context.TODO(), syncContext); err != nil {
+		t.Fatalf("Expected no error when sync: %v", err)
+	}
+	testinghelper.AssertEqualNumber(t, len(fakeKubeClient.Actions()), 0)
+	testinghelper.AssertEqualNumber(t, len(fakeOperatorClient.Actions()), 0)
+}
+
+func TestSyncApplyCatalog(t *testing.T) {
+	controller, fakeKubeClient, _, fakeOperatorClient := newTestController(
+		newKlusterlet("addon-catalog"),
+		newCatalogConfigMap(map[string]string{
+			"deployment.yaml":     deploymentManifest,
+			"serviceaccount.yaml": serviceAccountManifest,
+		}))
+
+	syncContext := testinghelper.NewFakeSyncContext(t, testKlusterletName)
+	if err := controller.sync(context.TODO(), syncContext); err != nil {
+		t.Fatalf("Expected no error when sync: %v", err)
+	}
+
+	if _, err := fakeKubeClient.CoreV1().ServiceAccounts(addonNamespace).Get(context.TODO(), "example-addon-sa", metav1.GetOptions{}); err != nil {
+		t.Errorf("Expected the addon service account in the addon namespace: %v", err)
+	}
+	if _, err := fakeKubeClient.AppsV1().Deployments(addonNamespace).Get(context.TODO(), "example-addon", metav1.GetOptions{}); err != nil {
+		t.Errorf("Expected the addon deployment in the addon namespace: %v", err)
+	}
+
+	status := updatedKlusterletStatus(t, fakeOperatorClient)
+	condition := meta.FindStatusCondition(status.Conditions, addOnCatalogApplied)
+	if condition == nil || condition.Status != metav1.ConditionTrue {
+		t.Errorf("Expected condition %s to be true, got %v", addOnCatalogApplied, condition)
+	}
+	testinghelper.AssertEqualNumber(t, len(status.AppliedAddOnResources), 2)
+	for _, resource := range status.AppliedAddOnResources {
+		if resource.Namespace != addonNamespace {
+			t.Errorf("Expected applied resource %s/%s in the addon namespace", resource.Namespace, resource.Name)
+		}
+	}
+}
+
+func TestSyncRemoveStaleResource(t *testing.T) {
+	klusterlet := newKlusterlet("addon-catalog")
+	klusterlet.Status.AppliedAddOnResources = []operatorapiv1.RelatedResourceMeta{
+		{Version: "v1", Resource: "serviceaccounts", Namespace: addonNamespace, Name: "example-addon-sa"},
+		{Version: "v1", Resource: "configmaps", Namespace: addonNamespace, Name: "stale-addon-config"},
+	}
+	controller, _, fakeDynamicClient, fakeOperatorClient := newTestController(
+		klusterlet,
+		newCatalogConfigMap(map[string]string{"serviceaccount.yaml": serviceAccountManifest}))
+
+	syncContext := testinghelper.NewFakeSyncContext(t, testKlusterletName)
+	if err := controller.sync(context.TODO(), syncContext); err != nil {
+		t.Fatalf("Expected no error when sync: %v", err)
+	}
+
+	deleted := false
+	for _, action := range fakeDynamicClient.Actions() {
+		if action.GetVerb() != "delete" {
+			continue
+		}
+		deleteAction := action.(clienttesting.DeleteActionImpl)
+		if deleteAction.GetResource().Resource == "configmaps" && deleteAction.Name == "stale-addon-config" {
+			deleted = true
+		}
+	}
+	if !deleted {
+		t.Errorf("Expected the stale addon configmap to be deleted")
+	}
+
+	status := updatedKlusterletStatus(t, fakeOperatorClient)
+	testinghelper.AssertEqualNumber(t, len(status.AppliedAddOnResources), 1)
+	if status.AppliedAddOnResources[0].Name != "example-addon-sa" {
+		t.Errorf("Expected only the service account to stay recorded, got %v", status.AppliedAddOnResources)
+	}
+}
+
+func TestSyncCatalogRemoved(t *testing.T) {
+	klusterlet := newKlusterlet("")
+	klusterlet.Status.Conditions = []metav1.Condition{
+		{Type: addOnCatalogApplied, Status: metav1.ConditionTrue, Reason: "AddOnCatalogApplied"},
+	}
+	klusterlet.Status.AppliedAddOnResources = []operatorapiv1.RelatedResourceMeta{
+		{Version: "v1", Resource: "serviceaccounts", Namespace: addonNamespace, Name: "example-addon-sa"},
+	}
+	controller, _, fakeDynamicClient, fakeOperatorClient := newTestController(klusterlet)
+
+	syncContext := testinghelper.NewFakeSyncContext(t, testKlusterletName)
+	if err := controller.sync(context.TODO(), syncContext); err != nil {
+		t.Fatalf("Expected no error when sync: %v", err)
+	}
+
+	deleted := false
+	for _, action := range fakeDynamicClient.Actions() {
+		if action.GetVerb() == "delete" {
+			deleted = true
+		}
+	}
+	if !deleted {
+		t.Errorf("Expected the applied addon resources to be deleted")
+	}
+
+	status := updatedKlusterletStatus(t, fakeOperatorClient)
+	if condition := meta.FindStatusCondition(status.Conditions, addOnCatalogApplied); condition != nil {
+		t.Errorf("Expected condition %s to be removed, got %v", addOnCatalogApplied, condition)
+	}
+	testinghelper.AssertEqualNumber(t, len(status.AppliedAddOnResources), 0)
+}
@@ -6,12 +6,16 @@ import (
 	"fmt"
 	"time"
 
+	operatorv1client "open-cluster-management.io/api/client/operator/clientset/versioned/typed/operator/v1"
 	operatorinformer "open-cluster-management.io/api/client/operator/informers/externalversions/operator/v1"
 	operatorlister "open-cluster-management.io/api/client/operator/listers/operator/v1"
+	operatorapiv1 "open-cluster-management.io/api/operator/v1"
 	"open-cluster-management.io/registration-operator/pkg/helpers"
+	"open-cluster-management.io/registration-operator/pkg/metrics"
 
 	"github.com/openshift/library-go/pkg/controller/factory"
 	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -29,7 +33,19 @@ import (
 	"k8s.io/klog/v2"
 )
 
-const tlsCertFile = "tls.crt"
+const (
+	tlsCertFile = "tls.crt"
+	// veleroRestoreLabel is set by velero on every restored resource
+	veleroRestoreLabel = "velero.io/restore-name"
+	// hubSwitchBootstrapSecretAnnotation instructs the operator to switch the
+	// klusterlet to a different hub. Its value is the name of a secret in the agent
+	// namespace holding the bootstrap kubeconfig of the new hub. The operator swaps
+	// the secret in as the bootstrap kubeconfig, drops the current hub kubeconfig,
+	// restarts the agents and reports the progress through the HubMigration condition.
+	hubSwitchBootstrapSecretAnnotation = "operator.open-cluster-management.io/hub-switch-bootstrap-secret"
+	// hubMigration is the condition reporting the progress of a hub switchover
+	hubMigration = "HubMigration"
+)
 
 // BootstrapControllerSyncInterval is exposed so that integration tests can crank up the constroller sync speed.
 var BootstrapControllerSyncInterval = 5 * time.Minute
@@ -39,24 +55,35 @@ var BootstrapControllerSyncInterval = 5 * time.Minute
 // will make the klusterlet re-bootstrap to get the new hub kubeconfig from hub cluster by deleting the current hub kubeconfig
 // secret and restart the klusterlet agents
 type bootstrapController struct {
-	kubeClient       kubernetes.Interface
-	klusterletLister operatorlister.KlusterletLister
-	secretLister     corelister.SecretLister
+	kubeClient            kubernetes.Interface
+	klusterletClient      operatorv1client.KlusterletInterface
+	klusterletLister      operatorlister.KlusterletLister
+	bootstrapSecretLister corelister.SecretLister
+	hubSecretLister       corelister.SecretLister
 }
 
 // NewBootstrapController returns a bootstrapController
 func NewBootstrapController(
 	kubeClient kubernetes.Interface,
+	klusterletClient operatorv1client.KlusterletInterface,
 	klusterletInformer operatorinformer.KlusterletInformer,
-	secretInformer coreinformer.SecretInformer,
+	bootstrapSecretInformer coreinformer.SecretInformer,
+	hubSecretInformer coreinformer.SecretInformer,
 	recorder events.Recorder) factory.Controller {
 	controller := &bootstrapController{
-		kubeClient:       kubeClient,
-		klusterletLister: klusterletInformer.Lister(),
-		secretLister:     secretInformer.Lister(),
+		kubeClient:            kubeClient,
+		klusterletClient:      klusterletClient,
+		klusterletLister:      klusterletInformer.Lister(),
+		bootstrapSecretLister: bootstrapSecretInformer.Lister(),
+		hubSecretLister:       hubSecretInformer.Lister(),
 	}
-	return factory.New().WithSync(controller.sync).
-		WithInformersQueueKeyFunc(bootstrapSecretQueueKeyFunc(controller.klusterletLister), secretInformer.Informer()).
+	return factory.New().WithSync(metrics.InstrumentSyncer("BootstrapController", controller.sync)).
+		WithInformersQueueKeyFunc(bootstrapSecretQueueKeyFunc(controller.klusterletLister), bootstrapSecretInformer.Informer()).
+		// klusterlet events drive the hub switchover annotation handling
+		WithInformersQueueKeyFunc(klusterletQueueKeyFunc(), klusterletInformer.Informer()).
+		// the hub kubeconfig secret informer does not trigger the sync, it only backs
+		// the lister used to check the secret expiration on resync
+		WithBareInformers(hubSecretInformer.Informer()).
 		ResyncEvery(BootstrapControllerSyncInterval).
 		ToController("BootstrapController", recorder)
 }
@@ -67,7 +94,7 @@ func (k *bootstrapController) sync(ctx context.Context, controllerContext factor
 		return nil
 	}
 
-	klog.V(4).Infof("Reconciling klusterlet kubeconfig secrets %q", queueKey)
+	klog.V(4).InfoS("Reconciling klusterlet kubeconfig secrets", "controller", "BootstrapController", "queueKey", queueKey)
 
 	klusterletNamespace, klusterletName, err := cache.SplitMetaNamespaceKey(queueKey)
 	if err != nil {
@@ -83,19 +110,29 @@ func (k *bootstrapController) sync(ctx context.Context, controllerContext factor
 		}
 
 		for _, klusterlet := range klusterlets {
-			namespace := klusterlet.Spec.Namespace
-			if namespace == "" {
-				namespace = helpers.KlusterletDefaultNamespace
-			}
-
 			// enqueue the klusterlet to reconcile
-			controllerContext.Queue().Add(fmt.Sprintf("%s/%s", namespace, klusterlet.Name))
+			controllerContext.Queue().Add(fmt.Sprintf("%s/%s", helpers.KlusterletAgentNamespace(klusterlet), klusterlet.Name))
 		}
 
 		return nil
 	}
 
-	bootstrapHubKubeconfigSecret, err := k.secretLister.Secrets(klusterletNamespace).Get(helpers.BootstrapHubKubeConfig)
+	klusterlet, err := k.klusterletLister.Get(klusterletName)
+	switch {
+	case errors.IsNotFound(err):
+		// the klusterlet not found, could have been deleted, do nothing
+		return nil
+	case err != nil:
+		return err
+	}
+	hubKubeConfigSecretName := helpers.HubKubeConfigSecretName(klusterlet)
+
+	// a hub switchover is requested, orchestrate it instead of the regular checks
+	if _, ok := klusterlet.Annotations[hubSwitchBootstrapSecretAnnotation]; ok {
+		return k.switchHub(ctx, controllerContext, klusterlet, klusterletNamespace, hubKubeConfigSecretName)
+	}
+
+	bootstrapHubKubeconfigSecret, err := k.bootstrapSecretLister.Secrets(klusterletNamespace).Get(helpers.BootstrapHubKubeConfig)
 	switch {
 	case errors.IsNotFound(err):
 		// the bootstrap hub kubeconfig secret not found, do nothing
@@ -112,7 +149,14 @@ func (k *bootstrapController) sync(ctx context.Context, controllerContext factor
 		return nil
 	}
 
-	hubKubeconfigSecret, err := k.secretLister.Secrets(klusterletNamespace).Get(helpers.HubKubeConfig)
+	// the hub kubeconfig secret informer is scoped to the default secret name, so a
+	// secret name overridden in the klusterlet spec is read directly from the apiserver
+	var hubKubeconfigSecret *corev1.Secret
+	if hubKubeConfigSecretName == helpers.HubKubeConfig {
+		hubKubeconfigSecret, err = k.hubSecretLister.Secrets(klusterletNamespace).Get(hubKubeConfigSecretName)
+	} else {
+		hubKubeconfigSecret, err = k.kubeClient.CoreV1().Secrets(klusterletNamespace).Get(ctx, hubKubeConfigSecretName, metav1.GetOptions{})
+	}
 	switch {
 	case errors.IsNotFound(err):
 		// the hub kubeconfig secret not found, could not have bootstrap yet, do nothing currently
@@ -133,18 +177,27 @@ func (k *bootstrapController) sync(ctx context.Context, controllerContext factor
 		return nil
 	}
 
+	// a hub kubeconfig restored from a backup carries the velero restore label. Its client
+	// certificate was issued by the hub the backup was taken from, so it cannot be trusted
+	// on the restored hub and the klusterlet has to re-bootstrap to get a fresh one
+	if restoreName, restored := hubKubeconfigSecret.Labels[veleroRestoreLabel]; restored {
+		reloadReason := fmt.Sprintf("the hub kubeconfig secret %s/%s is restored from backup by velero restore %q",
+			klusterletNamespace, hubKubeConfigSecretName, restoreName)
+		return k.reloadAgents(ctx, controllerContext, klusterletNamespace, klusterletName, hubKubeConfigSecretName, reloadReason)
+	}
+
 	if bootstrapKubeconfig.Server != hubKubeconfig.Server ||
 		!bytes.Equal(bootstrapKubeconfig.CertificateAuthorityData, hubKubeconfig.CertificateAuthorityData) {
 		// the bootstrap kubeconfig secret is changed, reload the klusterlet agents
 		reloadReason := fmt.Sprintf("the bootstrap secret %s/%s is changed", klusterletNamespace, helpers.BootstrapHubKubeConfig)
-		return k.reloadAgents(ctx, controllerContext, klusterletNamespace, klusterletName, reloadReason)
+		return k.reloadAgents(ctx, controllerContext, klusterletNamespace, klusterletName, hubKubeConfigSecretName, reloadReason)
 	}
 
 	expired, err := isHubKubeconfigSecretExpired(hubKubeconfigSecret)
 	if err != nil {
 		// the hub kubeconfig secret has errors, do nothing
 		controllerContext.Recorder().Warningf("BadHubKubeConfigSecret",
-			fmt.Sprintf("the hub kubeconfig secret %s/%s is invalid: %v", klusterletNamespace, helpers.HubKubeConfig, err))
+			fmt.Sprintf("the hub kubeconfig secret %s/%s is invalid: %v", klusterletNamespace, hubKubeConfigSecretName, err))
 		return nil
 	}
 
@@ -154,19 +207,19 @@ func (k *bootstrapController) sync(ctx context.Context, controllerContext factor
 	}
 
 	// the hub kubeconfig secret cert is expired, reload klusterlet to restart bootstrap
-	reloadReason := fmt.Sprintf("the hub kubeconfig secret %s/%s is expired", klusterletNamespace, helpers.HubKubeConfig)
-	return k.reloadAgents(ctx, controllerContext, klusterletNamespace, klusterletName, reloadReason)
+	reloadReason := fmt.Sprintf("the hub kubeconfig secret %s/%s is expired", klusterletNamespace, hubKubeConfigSecretName)
+	return k.reloadAgents(ctx, controllerContext, klusterletNamespace, klusterletName, hubKubeConfigSecretName, reloadReason)
 }
 
 // reloadAgents reload klusterlet agents by
 // 1. make the registration agent re-bootstrap by deleting the current hub kubeconfig secret to
 // 2. restart the registration and work agents to reload the new hub ca by deleting the agent deployments
-func (k *bootstrapController) reloadAgents(ctx context.Context, ctrlContext factory.SyncContext, namespace, klusterletName, reason string) error {
-	if err := k.kubeClient.CoreV1().Secrets(namespace).Delete(ctx, helpers.HubKubeConfig, metav1.DeleteOptions{}); err != nil {
+func (k *bootstrapController) reloadAgents(ctx context.Context, ctrlContext factory.SyncContext, namespace, klusterletName, hubKubeConfigSecretName, reason string) error {
+	if err := k.kubeClient.CoreV1().Secrets(namespace).Delete(ctx, hubKubeConfigSecretName, metav1.DeleteOptions{}); err != nil {
 		return err
 	}
 	ctrlContext.Recorder().Eventf("HubKubeconfigSecretDeleted", fmt.Sprintf("the hub kubeconfig secret %s/%s is deleted due to %s",
-		namespace, helpers.HubKubeConfig, reason))
+		namespace, hubKubeConfigSecretName, reason))
 
 	registrationName := fmt.Sprintf("%s-registration-agent", klusterletName)
 	if err := k.kubeClient.AppsV1().Deployments(namespace).Delete(ctx, registrationName, metav1.DeleteOptions{}); err != nil {
@@ -205,6 +258,96 @@ func (k *bootstrapController) loadKubeConfig(secret *corev1.Secret) (*clientcmda
 	return cluster, nil
 }
 
+// switchHub moves the klusterlet to the hub whose bootstrap kubeconfig is held by
+// the secret named in the hub switch annotation. The new bootstrap kubeconfig is
+// swapped in, the current hub kubeconfig is dropped and the agents are restarted, so
+// they register to the new hub. The progress is reported through the HubMigration
+// condition, which turns true once the agents hold a hub kubeconfig of the new hub.
+func (k *bootstrapController) switchHub(ctx context.Context, controllerContext factory.SyncContext,
+	klusterlet *operatorapiv1.Klusterlet, namespace, hubKubeConfigSecretName string) error {
+	secretName := klusterlet.Annotations[hubSwitchBootstrapSecretAnnotation]
+
+	// the new bootstrap secret has an arbitrary name, so it is read directly instead
+	// of through the name scoped bootstrap secret informer
+	newBootstrapSecret, err := k.kubeClient.CoreV1().Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return k.updateHubMigrationCondition(ctx, klusterlet.Name, metav1.Condition{
+			Type: hubMigration, Status: metav1.ConditionFalse, Reason: "HubMigrationBlocked",
+			Message: fmt.Sprintf("The bootstrap secret %s/%s of the new hub is not found", namespace, secretName),
+		})
+	}
+	if err != nil {
+		return err
+	}
+	newCluster, err := k.loadKubeConfig(newBootstrapSecret)
+	if err != nil {
+		return k.updateHubMigrationCondition(ctx, klusterlet.Name, metav1.Condition{
+			Type: hubMigration, Status: metav1.ConditionFalse, Reason: "HubMigrationBlocked",
+			Message: fmt.Sprintf("The bootstrap secret %s/%s of the new hub is invalid: %v", namespace, secretName, err),
+		})
+	}
+
+	currentBootstrapSecret, err := k.kubeClient.CoreV1().Secrets(namespace).Get(ctx, helpers.BootstrapHubKubeConfig, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err != nil || !bytes.Equal(currentBootstrapSecret.Data["kubeconfig"], newBootstrapSecret.Data["kubeconfig"]) {
+		if _, _, err := resourceapply.ApplySecret(k.kubeClient.CoreV1(), controllerContext.Recorder(), &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      helpers.BootstrapHubKubeConfig,
+				Labels:    map[string]string{helpers.BackupLabel: "true"},
+			},
+			Data: map[string][]byte{"kubeconfig": newBootstrapSecret.Data["kubeconfig"]},
+		}); err != nil {
+			return err
+		}
+		reloadReason := fmt.Sprintf("the klusterlet is switching to the hub %q", newCluster.Server)
+		if err := k.reloadAgents(ctx, controllerContext, namespace, klusterlet.Name, hubKubeConfigSecretName, reloadReason); err != nil {
+			return err
+		}
+		return k.updateHubMigrationCondition(ctx, klusterlet.Name, metav1.Condition{
+			Type: hubMigration, Status: metav1.ConditionFalse, Reason: "HubMigrationInProgress",
+			Message: fmt.Sprintf("Waiting for the agents to register to the hub %q", newCluster.Server),
+		})
+	}
+
+	// the bootstrap kubeconfig is already swapped, the migration is done once the
+	// agents hold a hub kubeconfig issued by the new hub
+	hubKubeconfigSecret, err := k.kubeClient.CoreV1().Secrets(namespace).Get(ctx, hubKubeConfigSecretName, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err == nil {
+		if hubCluster, err := k.loadKubeConfig(hubKubeconfigSecret); err == nil && hubCluster.Server == newCluster.Server {
+			return k.updateHubMigrationCondition(ctx, klusterlet.Name, metav1.Condition{
+				Type: hubMigration, Status: metav1.ConditionTrue, Reason: "HubMigrationSucceeded",
+				Message: fmt.Sprintf("The klusterlet registered to the hub %q", newCluster.Server),
+			})
+		}
+	}
+	return k.updateHubMigrationCondition(ctx, klusterlet.Name, metav1.Condition{
+		Type: hubMigration, Status: metav1.ConditionFalse, Reason: "HubMigrationInProgress",
+		Message: fmt.Sprintf("Waiting for the agents to register to the hub %q", newCluster.Server),
+	})
+}
+
+func (k *bootstrapController) updateHubMigrationCondition(ctx context.Context, klusterletName string, condition metav1.Condition) error {
+	_, _, err := helpers.UpdateKlusterletStatus(ctx, k.klusterletClient, klusterletName,
+		helpers.UpdateKlusterletConditionFn(condition))
+	return err
+}
+
+func klusterletQueueKeyFunc() factory.ObjectQueueKeyFunc {
+	return func(obj runtime.Object) string {
+		klusterlet, ok := obj.(*operatorapiv1.Klusterlet)
+		if !ok {
+			return ""
+		}
+		return helpers.KlusterletAgentNamespace(klusterlet) + "/" + klusterlet.Name
+	}
+}
+
 func bootstrapSecretQueueKeyFunc(klusterletLister operatorlister.KlusterletLister) factory.ObjectQueueKeyFunc {
 	return func(obj runtime.Object) string {
 		accessor, err := meta.Accessor(obj)
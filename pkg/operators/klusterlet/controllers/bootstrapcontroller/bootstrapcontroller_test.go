@@ -18,6 +18,7 @@ import (
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	kubeinformers "k8s.io/client-go/informers"
@@ -82,6 +83,21 @@ func TestSync(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:     "the hub kubeconfig secret is restored from a backup",
+			queueKey: "test/test",
+			objects: []runtime.Object{
+				newSecret("bootstrap-hub-kubeconfig", "test", newKubeConfig("https://10.0.118.47:6443")),
+				newRestoredSecret(newHubKubeConfigSecret("test", time.Now().Add(60*time.Second).UTC())),
+				newDeployment("test-registration-agent", "test"),
+				newDeployment("test-work-agent", "test"),
+			},
+			validateActions: func(t *testing.T, actions []clienttesting.Action) {
+				testinghelper.AssertDelete(t, actions[0], "secrets", "test", "hub-kubeconfig-secret")
+				testinghelper.AssertDelete(t, actions[1], "deployments", "test", "test-registration-agent")
+				testinghelper.AssertDelete(t, actions[2], "deployments", "test", "test-work-agent")
+			},
+		},
 		{
 			name:     "the bootstrap secret is changed",
 			queueKey: "test/test",
@@ -117,9 +133,10 @@ func TestSync(t *testing.T) {
 			operatorStore.Add(newKlusterlet("test", "test"))
 
 			controller := &bootstrapController{
-				kubeClient:       fakeKubeClient,
-				klusterletLister: operatorInformers.Operator().V1().Klusterlets().Lister(),
-				secretLister:     kubeInformers.Core().V1().Secrets().Lister(),
+				kubeClient:            fakeKubeClient,
+				klusterletLister:      operatorInformers.Operator().V1().Klusterlets().Lister(),
+				bootstrapSecretLister: kubeInformers.Core().V1().Secrets().Lister(),
+				hubSecretLister:       kubeInformers.Core().V1().Secrets().Lister(),
 			}
 
 			syncContext := testinghelper.NewFakeSyncContext(t, c.queueKey)
@@ -174,6 +191,111 @@ func TestBootstrapSecretQueueKeyFunc(t *testing.T) {
 	}
 }
 
+func TestHubSwitchover(t *testing.T) {
+	cases := []struct {
+		name            string
+		objects         []runtime.Object
+		expectedReason  string
+		validateActions func(t *testing.T, actions []clienttesting.Action)
+	}{
+		{
+			name:           "the new hub bootstrap secret is missing",
+			objects:        []runtime.Object{},
+			expectedReason: "HubMigrationBlocked",
+			validateActions: func(t *testing.T, actions []clienttesting.Action) {
+				for _, action := range actions {
+					if action.GetVerb() == "delete" {
+						t.Errorf("expected no deletions, but got %#v", action)
+					}
+				}
+			},
+		},
+		{
+			name: "swap in the new hub bootstrap secret",
+			objects: []runtime.Object{
+				newSecret("new-hub-bootstrap", "test", newKubeConfig("https://10.0.118.48:6443")),
+				newSecret("bootstrap-hub-kubeconfig", "test", newKubeConfig("https://10.0.118.47:6443")),
+				newSecret("hub-kubeconfig-secret", "test", newKubeConfig("https://10.0.118.47:6443")),
+				newDeployment("test-registration-agent", "test"),
+				newDeployment("test-work-agent", "test"),
+			},
+			expectedReason: "HubMigrationInProgress",
+			validateActions: func(t *testing.T, actions []clienttesting.Action) {
+				deleted := map[string]bool{}
+				for _, action := range actions {
+					if action.GetVerb() == "delete" {
+						deleted[action.(clienttesting.DeleteActionImpl).Name] = true
+					}
+				}
+				for _, name := range []string{"hub-kubeconfig-secret", "test-registration-agent", "test-work-agent"} {
+					if !deleted[name] {
+						t.Errorf("expected %q to be deleted, but got %#v", name, actions)
+					}
+				}
+			},
+		},
+		{
+			name: "the agents registered to the new hub",
+			objects: []runtime.Object{
+				newSecret("new-hub-bootstrap", "test", newKubeConfig("https://10.0.118.48:6443")),
+				newSecret("bootstrap-hub-kubeconfig", "test", newKubeConfig("https://10.0.118.48:6443")),
+				newSecret("hub-kubeconfig-secret", "test", newKubeConfig("https://10.0.118.48:6443")),
+			},
+			expectedReason: "HubMigrationSucceeded",
+			validateActions: func(t *testing.T, actions []clienttesting.Action) {
+				for _, action := range actions {
+					if action.GetVerb() == "delete" {
+						t.Errorf("expected no deletions, but got %#v", action)
+					}
+				}
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			klusterlet := newKlusterlet("test", "test")
+			klusterlet.Annotations = map[string]string{hubSwitchBootstrapSecretAnnotation: "new-hub-bootstrap"}
+
+			fakeKubeClient := fakekube.NewSimpleClientset(c.objects...)
+			kubeInformers := kubeinformers.NewSharedInformerFactory(fakeKubeClient, 5*time.Minute)
+
+			fakeOperatorClient := fakeoperatorclient.NewSimpleClientset(klusterlet)
+			operatorInformers := operatorinformers.NewSharedInformerFactory(fakeOperatorClient, 5*time.Minute)
+			operatorInformers.Operator().V1().Klusterlets().Informer().GetStore().Add(klusterlet)
+
+			controller := &bootstrapController{
+				kubeClient:            fakeKubeClient,
+				klusterletClient:      fakeOperatorClient.OperatorV1().Klusterlets(),
+				klusterletLister:      operatorInformers.Operator().V1().Klusterlets().Lister(),
+				bootstrapSecretLister: kubeInformers.Core().V1().Secrets().Lister(),
+				hubSecretLister:       kubeInformers.Core().V1().Secrets().Lister(),
+			}
+
+			syncContext := testinghelper.NewFakeSyncContext(t, "test/test")
+			if err := controller.sync(context.TODO(), syncContext); err != nil {
+				t.Errorf("Expected no errors, but got %v", err)
+			}
+
+			var updated *operatorapiv1.Klusterlet
+			for _, action := range fakeOperatorClient.Actions() {
+				if action.GetVerb() == "update" && action.GetSubresource() == "status" {
+					updated = action.(clienttesting.UpdateActionImpl).Object.(*operatorapiv1.Klusterlet)
+				}
+			}
+			if updated == nil {
+				t.Fatalf("expected a HubMigration condition to be reported")
+			}
+			condition := apimeta.FindStatusCondition(updated.Status.Conditions, hubMigration)
+			if condition == nil || condition.Reason != c.expectedReason {
+				t.Errorf("expected condition with reason %q, but got %v", c.expectedReason, condition)
+			}
+
+			c.validateActions(t, fakeKubeClient.Actions())
+		})
+	}
+}
+
 func newKlusterlet(name, namespace string) *operatorapiv1.Klusterlet {
 	return &operatorapiv1.Klusterlet{
 		ObjectMeta: metav1.ObjectMeta{
@@ -197,6 +319,11 @@ func newSecret(name, namespace string, kubeConfig []byte) *corev1.Secret {
 	return secret
 }
 
+func newRestoredSecret(secret *corev1.Secret) *corev1.Secret {
+	secret.Labels = map[string]string{veleroRestoreLabel: "restore-1"}
+	return secret
+}
+
 func newKubeConfig(host string) []byte {
 	configData, _ := runtime.Encode(clientcmdlatest.Codec, &clientcmdapi.Config{
 		Clusters: map[string]*clientcmdapi.Cluster{"default-cluster": {
@@ -4,7 +4,9 @@ import (
 	"context"
 	"crypto/sha256"
 	"fmt"
+	"os"
 	"reflect"
+	"sort"
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
@@ -12,12 +14,21 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/dynamic"
 	appsinformer "k8s.io/client-go/informers/apps/v1"
 	coreinformer "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	"k8s.io/klog/v2"
 
+	"golang.org/x/time/rate"
+
 	"github.com/openshift/library-go/pkg/controller/factory"
 	"github.com/openshift/library-go/pkg/operator/events"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -31,14 +42,21 @@ import (
 	operatorlister "open-cluster-management.io/api/client/operator/listers/operator/v1"
 	workv1client "open-cluster-management.io/api/client/work/clientset/versioned/typed/work/v1"
 	operatorapiv1 "open-cluster-management.io/api/operator/v1"
+	workapiv1 "open-cluster-management.io/api/work/v1"
 	"open-cluster-management.io/registration-operator/manifests"
 	"open-cluster-management.io/registration-operator/pkg/helpers"
+	"open-cluster-management.io/registration-operator/pkg/metrics"
+	operatorversion "open-cluster-management.io/registration-operator/pkg/version"
 )
 
 const (
 	klusterletFinalizer          = "operator.open-cluster-management.io/klusterlet-cleanup"
-	imagePullSecret              = "open-cluster-management-image-pull-credentials"
 	klusterletApplied            = "Applied"
+	klusterletDeleting           = "Deleting"
+	klusterletIncompatible       = "IncompatibleVersion"
+	klusterletVersionSkew        = "VersionSkewDetected"
+	reconcilePaused              = "ReconcilePaused"
+	unsupportedAPI               = "UnsupportedAPI"
 	appliedManifestWorkFinalizer = "cluster.open-cluster-management.io/applied-manifest-work-cleanup"
 	defaultReplica               = 3
 	singleReplica                = 1
@@ -63,14 +81,52 @@ var (
 		"klusterlet/klusterlet-registration-rolebinding.yaml",
 		"klusterlet/klusterlet-work-serviceaccount.yaml",
 		"klusterlet/klusterlet-work-clusterrole.yaml",
-		"klusterlet/klusterlet-work-clusterrolebinding.yaml",
 		"klusterlet/klusterlet-work-clusterrolebinding-addition.yaml",
 	}
 
+	// defaultWorkRBACFiles bind the work agent to the built-in admin clusterrole. When
+	// the allowed manifest resources are restricted in the klusterlet spec, the
+	// restrictedWorkRBACFiles bind the work agent to a generated clusterrole limited
+	// to the listed resources instead.
+	defaultWorkRBACFiles = []string{
+		"klusterlet/klusterlet-work-clusterrolebinding.yaml",
+	}
+
+	restrictedWorkRBACFiles = []string{
+		"klusterlet/klusterlet-work-clusterrole-restricted.yaml",
+		"klusterlet/klusterlet-work-clusterrolebinding-restricted.yaml",
+	}
+
+	// trustedCAFiles hold the configmap the cluster network operator injects the
+	// trusted CA bundle of the OpenShift cluster-wide proxy into. The configmap is
+	// only applied when the cluster proxy references a trusted CA bundle.
+	trustedCAFiles = []string{
+		"klusterlet/klusterlet-trusted-ca-configmap.yaml",
+	}
+
+	// metricsProxyFiles grant the kube-rbac-proxy sidecars the token and subject
+	// access reviews they authenticate and authorize metrics scrapers with. They are
+	// only applied when the sidecar image is configured on the operator.
+	metricsProxyFiles = []string{
+		"klusterlet/klusterlet-metrics-proxy-clusterrole.yaml",
+		"klusterlet/klusterlet-metrics-proxy-clusterrolebinding.yaml",
+	}
+
 	kube111StaticResourceFiles = []string{
 		"klusterletkube111/klusterlet-registration-operator-clusterrolebinding.yaml",
 		"klusterletkube111/klusterlet-work-clusterrolebinding.yaml",
 	}
+
+	// cleanUpSteps names the stages of the klusterlet teardown in order, for
+	// reporting deletion progress in the Deleting condition.
+	cleanUpSteps = []string{
+		"deployments",
+		"hubKubeconfigSecret",
+		"staticResources",
+		"namespaces",
+		"appliedManifestWorks",
+		"crds",
+	}
 )
 
 type klusterletController struct {
@@ -78,36 +134,84 @@ type klusterletController struct {
 	klusterletLister          operatorlister.KlusterletLister
 	kubeClient                kubernetes.Interface
 	apiExtensionClient        apiextensionsclient.Interface
+	dynamicClient             dynamic.Interface
 	appliedManifestWorkClient workv1client.AppliedManifestWorkInterface
 	kubeVersion               *version.Version
 	operatorNamespace         string
+	// apiSupported reports whether the spoke serves the given API group version,
+	// for selecting version-dependent manifests. It is a field so tests can run the
+	// controller without a discovery API; a nil check falls back to the kube
+	// version comparisons.
+	apiSupported func(groupVersion string) (bool, error)
+	// nodeLister lists the master nodes the agent replica count is derived from.
+	nodeLister corev1listers.NodeLister
+	// podSecurityEnforceLevel is the pod security level set on the namespaces the
+	// controller creates. An empty value falls back to the default level.
+	podSecurityEnforceLevel string
+	// metricsProxyImage is the image of the kube-rbac-proxy sidecar rendered into
+	// the agents to front their metrics endpoints. Empty disables the sidecar.
+	metricsProxyImage string
+	// imageMirrors redirect the rendered image references to mirrored registries.
+	imageMirrors []helpers.ImageMirror
+	// renderCache caches the rendered manifests between reconciles, so a resync
+	// with an unchanged config does not parse the templates again.
+	renderCache *helpers.RenderCache
 }
 
 // NewKlusterletController construct klusterlet controller
 func NewKlusterletController(
 	kubeClient kubernetes.Interface,
 	apiExtensionClient apiextensionsclient.Interface,
+	dynamicClient dynamic.Interface,
 	klusterletClient operatorv1client.KlusterletInterface,
 	klusterletInformer operatorinformer.KlusterletInformer,
-	secretInformer coreinformer.SecretInformer,
+	bootstrapSecretInformer coreinformer.SecretInformer,
+	hubSecretInformer coreinformer.SecretInformer,
 	deploymentInformer appsinformer.DeploymentInformer,
+	nodeInformer coreinformer.NodeInformer,
 	appliedManifestWorkClient workv1client.AppliedManifestWorkInterface,
 	kubeVersion *version.Version,
 	operatorNamespace string,
+	podSecurityEnforceLevel string,
+	metricsProxyImage string,
+	imageMirrors []helpers.ImageMirror,
+	syncThrottle *rate.Limiter,
 	recorder events.Recorder) factory.Controller {
 	controller := &klusterletController{
 		kubeClient:                kubeClient,
 		apiExtensionClient:        apiExtensionClient,
+		dynamicClient:             dynamicClient,
 		klusterletClient:          klusterletClient,
 		klusterletLister:          klusterletInformer.Lister(),
 		appliedManifestWorkClient: appliedManifestWorkClient,
 		kubeVersion:               kubeVersion,
 		operatorNamespace:         operatorNamespace,
+		nodeLister:                nodeInformer.Lister(),
+		podSecurityEnforceLevel:   podSecurityEnforceLevel,
+		metricsProxyImage:         metricsProxyImage,
+		imageMirrors:              imageMirrors,
+		renderCache:               helpers.NewRenderCache(),
+		apiSupported: func(groupVersion string) (bool, error) {
+			return helpers.APIGroupVersionSupported(kubeClient.Discovery(), groupVersion)
+		},
 	}
 
-	return factory.New().WithSync(controller.sync).
-		WithInformersQueueKeyFunc(helpers.KlusterletSecretQueueKeyFunc(controller.klusterletLister), secretInformer.Informer()).
-		WithInformersQueueKeyFunc(helpers.KlusterletDeploymentQueueKeyFunc(controller.klusterletLister), deploymentInformer.Informer()).
+	sync := helpers.ThrottleSync(syncThrottle, controller.sync)
+
+	// The deployment informer is registered with its own event handler, so status only
+	// updates of the agent deployments do not enqueue a full reconcile.
+	syncContext := factory.NewSyncContext("KlusterletController", recorder)
+	deploymentInformer.Informer().AddEventHandler(helpers.DeploymentQueueEventHandler(
+		syncContext.Queue(), helpers.KlusterletDeploymentQueueKeyFunc(controller.klusterletLister)))
+
+	return factory.New().WithSync(metrics.InstrumentSyncer("KlusterletController", sync)).
+		WithSyncContext(syncContext).
+		WithInformersQueueKeyFunc(helpers.KlusterletSecretQueueKeyFunc(controller.klusterletLister),
+			bootstrapSecretInformer.Informer(), hubSecretInformer.Informer()).
+		WithBareInformers(deploymentInformer.Informer()).
+		// Node events enqueue every klusterlet, so a change of the master node count
+		// adjusts the agent replicas without waiting for a klusterlet update.
+		WithInformers(nodeInformer.Informer()).
 		WithInformersQueueKeyFunc(func(obj runtime.Object) string {
 			accessor, _ := meta.Accessor(obj)
 			return accessor.GetName()
@@ -127,11 +231,175 @@ type klusterletConfig struct {
 	BootStrapKubeConfigSecret string
 	OperatorNamespace         string
 	Replica                   int32
+	// HubConnectionTimeoutSeconds is rendered into the agent args, so the agents use
+	// the same hub request timeout as the hub connectivity checks of the operator.
+	HubConnectionTimeoutSeconds int32
+	// WorkDriver and WorkDriverConfig switch the work agent to a non default driver,
+	// e.g. an MQTT broker, configured by the referenced secret.
+	WorkDriver       string
+	WorkDriverConfig string
+	// WorkStatusSyncIntervalSeconds overrides the interval at which the work agent
+	// resyncs the status feedback of the applied manifest works to the hub.
+	WorkStatusSyncIntervalSeconds int32
+	// ClusterHealthCheckPeriodSeconds overrides the period at which the registration
+	// agent checks the managed cluster kube-apiserver and updates its lease on the hub.
+	ClusterHealthCheckPeriodSeconds int32
+	// LeaseDurationSeconds overrides the duration of the lease the registration agent
+	// maintains for the managed cluster on the hub.
+	LeaseDurationSeconds int32
+	// ClusterAnnotations are the annotations of spec.registrationConfiguration rendered
+	// as sorted comma separated key=value pairs into the registration agent args.
+	ClusterAnnotations string
+	// AllowedManifestResources limits what hub delivered manifest works may manage on
+	// the managed cluster. When it is not empty, the work agent is bound to a
+	// clusterrole generated from the list instead of the built-in admin clusterrole.
+	AllowedManifestResources []operatorapiv1.AllowedManifestResource
+	// HTTPProxy, HTTPSProxy and NoProxy are injected into the agent deployments as
+	// the corresponding proxy environment variables. TrustedCABundleConfigMap is the
+	// name of a configmap in the agent namespace that is mounted into the agents as
+	// an additional CA trust bundle.
+	HTTPProxy                string
+	HTTPSProxy               string
+	NoProxy                  string
+	TrustedCABundleConfigMap string
+	// InjectTrustedCABundle creates the mounted configmap with the OpenShift trusted
+	// CA injection label, so the cluster network operator fills it with the CA bundle
+	// of the cluster-wide proxy.
+	InjectTrustedCABundle bool
+	// MetricsProxyImage is the image of the kube-rbac-proxy sidecar rendered into
+	// the agents to front their metrics endpoints.
+	MetricsProxyImage string
+	// RetainHubCredentialsOnDelete keeps the hub kubeconfig secret and the namespace
+	// holding it during the klusterlet teardown.
+	RetainHubCredentialsOnDelete bool
+	// OrphanAddOnNamespace leaves the addon namespace in place during the klusterlet
+	// teardown, for namespaces that also host non-OCM workloads.
+	OrphanAddOnNamespace bool
+}
+
+// buildKlusterletConfig resolves the template values of the klusterlet manifests from
+// the given klusterlet. The image digests are resolved by the caller when pinning is
+// enabled.
+func buildKlusterletConfig(klusterlet *operatorapiv1.Klusterlet, operatorNamespace string, replica int32) klusterletConfig {
+	config := klusterletConfig{
+		KlusterletName:            klusterlet.Name,
+		KlusterletNamespace:       helpers.KlusterletAgentNamespace(klusterlet),
+		RegistrationImage:         klusterlet.Spec.RegistrationImagePullSpec,
+		WorkImage:                 klusterlet.Spec.WorkImagePullSpec,
+		ClusterName:               klusterlet.Spec.ClusterName,
+		BootStrapKubeConfigSecret: helpers.BootstrapHubKubeConfig,
+		HubKubeConfigSecret:       helpers.HubKubeConfigSecretName(klusterlet),
+		ExternalServerURL:         getServersFromKlusterlet(klusterlet),
+		OperatorNamespace:         operatorNamespace,
+		Replica:                   replica,
+
+		HubConnectionTimeoutSeconds:  klusterlet.Spec.HubConnectionTimeoutSeconds,
+		RetainHubCredentialsOnDelete: klusterlet.Spec.RetainHubCredentialsOnDelete,
+		OrphanAddOnNamespace:         klusterlet.Spec.AddOnNamespaceCleanupPolicy == operatorapiv1.CleanupPolicyOrphan,
+	}
+	// When the image pull specs are left empty in spec, resolve the agent images from
+	// the environment of the operator, so a mirrored registry can be configured once
+	// on the operator instead of on every klusterlet.
+	if config.RegistrationImage == "" {
+		config.RegistrationImage = os.Getenv("REGISTRATION_IMAGE")
+	}
+	if config.WorkImage == "" {
+		config.WorkImage = os.Getenv("WORK_IMAGE")
+	}
+
+	if klusterlet.Spec.WorkConfiguration != nil {
+		if workDriver := klusterlet.Spec.WorkConfiguration.WorkDriver; len(workDriver) > 0 && workDriver != operatorapiv1.WorkDriverTypeKube {
+			config.WorkDriver = string(workDriver)
+			config.WorkDriverConfig = klusterlet.Spec.WorkConfiguration.WorkDriverConfig
+		}
+		config.AllowedManifestResources = klusterlet.Spec.WorkConfiguration.AllowedManifestResources
+		config.WorkStatusSyncIntervalSeconds = klusterlet.Spec.WorkConfiguration.StatusSyncIntervalSeconds
+	}
+
+	if registrationConfig := klusterlet.Spec.RegistrationConfiguration; registrationConfig != nil {
+		config.ClusterHealthCheckPeriodSeconds = registrationConfig.ClusterHealthCheckPeriodSeconds
+		config.LeaseDurationSeconds = registrationConfig.LeaseDurationSeconds
+		// Render the annotations sorted, so the rendered args are stable across syncs.
+		annotations := make([]string, 0, len(registrationConfig.ClusterAnnotations))
+		for key, value := range registrationConfig.ClusterAnnotations {
+			annotations = append(annotations, fmt.Sprintf("%s=%s", key, value))
+		}
+		sort.Strings(annotations)
+		config.ClusterAnnotations = strings.Join(annotations, ",")
+	}
+
+	if proxyConfig := klusterlet.Spec.ProxyConfig; proxyConfig != nil {
+		config.HTTPProxy = proxyConfig.HTTPProxy
+		config.HTTPSProxy = proxyConfig.HTTPSProxy
+		config.NoProxy = proxyConfig.NoProxy
+	}
+	// A configmap referenced in spec already exists in the agent namespace, so it is
+	// only mounted and not created by the operator.
+	config.TrustedCABundleConfigMap = klusterlet.Spec.TrustedCABundleConfigMap
+	return config
+}
+
+// openshiftProxyGVR is the resource of the OpenShift cluster-wide Proxy object.
+var openshiftProxyGVR = schema.GroupVersionResource{
+	Group: "config.openshift.io", Version: "v1", Resource: "proxies",
+}
+
+// resolveClusterProxyConfig fills the proxy settings left empty in spec from the
+// OpenShift cluster-wide Proxy object, so the agents reach the hub through the
+// cluster proxy like the other workloads of a proxied OpenShift cluster. When the
+// cluster proxy references a trusted CA bundle, a configmap with the trusted CA
+// injection label is created in the agent namespace and mounted into the agents.
+// On clusters without the Proxy API the lookup is a no-op, so the operator behaves
+// the same outside of OpenShift.
+func (n *klusterletController) resolveClusterProxyConfig(ctx context.Context, config *klusterletConfig) error {
+	proxy, err := n.dynamicClient.Resource(openshiftProxyGVR).Get(ctx, "cluster", metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		return nil
+	case err != nil:
+		return err
+	}
+
+	// The status holds the values resolved by the cluster network operator, which
+	// already include the cluster internal addresses in noProxy.
+	httpProxy, _, _ := unstructured.NestedString(proxy.Object, "status", "httpProxy")
+	httpsProxy, _, _ := unstructured.NestedString(proxy.Object, "status", "httpsProxy")
+	noProxy, _, _ := unstructured.NestedString(proxy.Object, "status", "noProxy")
+	if config.HTTPProxy == "" {
+		config.HTTPProxy = httpProxy
+	}
+	if config.HTTPSProxy == "" {
+		config.HTTPSProxy = httpsProxy
+	}
+	if config.NoProxy == "" {
+		config.NoProxy = noProxy
+	}
+
+	if trustedCA, _, _ := unstructured.NestedString(proxy.Object, "spec", "trustedCA", "name"); len(trustedCA) > 0 &&
+		config.TrustedCABundleConfigMap == "" {
+		config.TrustedCABundleConfigMap = fmt.Sprintf("%s-trusted-ca", config.KlusterletName)
+		config.InjectTrustedCABundle = true
+	}
+	return nil
 }
 
 func (n *klusterletController) sync(ctx context.Context, controllerContext factory.SyncContext) error {
 	klusterletName := controllerContext.QueueKey()
-	klog.V(4).Infof("Reconciling Klusterlet %q", klusterletName)
+	klog.V(4).InfoS("Reconciling Klusterlet", "controller", "KlusterletController", "klusterlet", klusterletName)
+
+	// A node event enqueues the default queue key, re-enqueue every klusterlet so
+	// the agent replica counts follow the master node count.
+	if klusterletName == factory.DefaultQueueKey {
+		klusterlets, err := n.klusterletLister.List(labels.Everything())
+		if err != nil {
+			return err
+		}
+		for _, klusterlet := range klusterlets {
+			controllerContext.Queue().Add(klusterlet.Name)
+		}
+		return nil
+	}
+
 	klusterlet, err := n.klusterletLister.Get(klusterletName)
 	if errors.IsNotFound(err) {
 		// AgentCore not found, could have been deleted, do nothing.
@@ -141,24 +409,54 @@ func (n *klusterletController) sync(ctx context.Context, controllerContext facto
 		return err
 	}
 	klusterlet = klusterlet.DeepCopy()
-	config := klusterletConfig{
-		KlusterletName:            klusterlet.Name,
-		KlusterletNamespace:       klusterlet.Spec.Namespace,
-		RegistrationImage:         klusterlet.Spec.RegistrationImagePullSpec,
-		WorkImage:                 klusterlet.Spec.WorkImagePullSpec,
-		ClusterName:               klusterlet.Spec.ClusterName,
-		BootStrapKubeConfigSecret: helpers.BootstrapHubKubeConfig,
-		HubKubeConfigSecret:       helpers.HubKubeConfig,
-		ExternalServerURL:         getServersFromKlusterlet(klusterlet),
-		OperatorNamespace:         n.operatorNamespace,
-		Replica:                   helpers.DetermineReplicaByNodes(ctx, n.kubeClient),
+	config := buildKlusterletConfig(klusterlet, n.operatorNamespace, helpers.DetermineReplicaByNodes(n.nodeLister))
+
+	config.MetricsProxyImage = n.metricsProxyImage
+
+	// Redirect the agent images to the configured registry mirrors, so air-gapped
+	// fleets pull from their local registry regardless of where the pull specs point.
+	config.RegistrationImage = helpers.ApplyImageMirrors(n.imageMirrors, config.RegistrationImage)
+	config.WorkImage = helpers.ApplyImageMirrors(n.imageMirrors, config.WorkImage)
+	config.MetricsProxyImage = helpers.ApplyImageMirrors(n.imageMirrors, config.MetricsProxyImage)
+
+	// Fill the proxy settings not explicitly configured in spec from the OpenShift
+	// cluster-wide Proxy object, like the other OpenShift operators do.
+	if err := n.resolveClusterProxyConfig(ctx, &config); err != nil {
+		return err
 	}
-	// If namespace is not set, use the default namespace
-	if config.KlusterletNamespace == "" {
-		config.KlusterletNamespace = helpers.KlusterletDefaultNamespace
+
+	// Namespaces created for a former spec.namespace of this klusterlet. The agents
+	// are migrated out of them below and the namespaces are only removed once the
+	// agents in the new namespace are available.
+	formerNamespaces, err := n.formerKlusterletNamespaces(ctx, klusterlet.Name, config.KlusterletNamespace)
+	if err != nil {
+		return err
+	}
+
+	// Resolve the agent image tags to digests when pinning is enabled, so a repushed
+	// mutable tag does not silently change the running agents. The digests already
+	// recorded in status stay pinned until the image pull specs change.
+	var resolvedImages map[string]string
+	if klusterlet.Spec.PinImageDigests {
+		agentImages := []string{config.RegistrationImage, config.WorkImage}
+		resolvedImages = helpers.ResolveImageDigests(ctx, n.kubeClient, config.KlusterletNamespace, agentImages...)
+		for _, image := range agentImages {
+			if digest, ok := klusterlet.Status.ResolvedImages[image]; ok {
+				resolvedImages[image] = digest
+			}
+		}
+		pin := func(image string) string {
+			if digest, ok := resolvedImages[image]; ok {
+				return digest
+			}
+			return image
+		}
+		config.RegistrationImage = pin(config.RegistrationImage)
+		config.WorkImage = pin(config.WorkImage)
 	}
 
-	// Update finalizer at first
+	// Update finalizer at first, and mark the klusterlet for backup in the same
+	// write, so a velero based backup includes it for disaster recovery
 	if klusterlet.DeletionTimestamp.IsZero() {
 		hasFinalizer := false
 		for i := range klusterlet.Finalizers {
@@ -169,6 +467,10 @@ func (n *klusterletController) sync(ctx context.Context, controllerContext facto
 		}
 		if !hasFinalizer {
 			klusterlet.Finalizers = append(klusterlet.Finalizers, klusterletFinalizer)
+			if klusterlet.Labels == nil {
+				klusterlet.Labels = map[string]string{}
+			}
+			klusterlet.Labels[helpers.BackupLabel] = "true"
 			_, err := n.klusterletClient.Update(ctx, klusterlet, metav1.UpdateOptions{})
 			return err
 		}
@@ -182,6 +484,88 @@ func (n *klusterletController) sync(ctx context.Context, controllerContext facto
 		return n.removeKlusterletFinalizer(ctx, klusterlet)
 	}
 
+	// While the klusterlet is set to Unmanaged, the deployed agents are left exactly
+	// as they are, e.g. during a maintenance window, and only the ReconcilePaused
+	// condition records that the spec is not being applied.
+	if klusterlet.Spec.ManagementState == operatorapiv1.ManagementStateUnmanaged {
+		_, _, updatedErr := helpers.UpdateKlusterletStatus(ctx, n.klusterletClient, klusterletName, helpers.UpdateKlusterletConditionFn(metav1.Condition{
+			Type:    reconcilePaused,
+			Status:  metav1.ConditionTrue,
+			Reason:  "Unmanaged",
+			Message: "The klusterlet is set to Unmanaged, the deployed agents are left as they are",
+		}))
+		return updatedErr
+	}
+
+	// Removed tears the deployed agents down with the same teardown as a deletion,
+	// but keeps the klusterlet and its configuration, so the agents can be
+	// reinstalled by setting the state back to Managed.
+	if klusterlet.Spec.ManagementState == operatorapiv1.ManagementStateRemoved {
+		if err := n.cleanUp(ctx, controllerContext, config); err != nil {
+			return err
+		}
+		_, _, updatedErr := helpers.UpdateKlusterletStatus(ctx, n.klusterletClient, klusterletName, helpers.UpdateKlusterletConditionFn(
+			metav1.Condition{
+				Type:    klusterletApplied,
+				Status:  metav1.ConditionFalse,
+				Reason:  "KlusterletRemoved",
+				Message: "The klusterlet is set to Removed, the deployed agents are torn down",
+			},
+			metav1.Condition{
+				Type:    reconcilePaused,
+				Status:  metav1.ConditionTrue,
+				Reason:  "Removed",
+				Message: "The klusterlet is set to Removed, only the teardown of the deployed agents is reconciled",
+			}))
+		return updatedErr
+	}
+	// The condition is only turned back when the klusterlet returns to Managed, so
+	// the common path does not touch status at all.
+	if meta.IsStatusConditionTrue(klusterlet.Status.Conditions, reconcilePaused) {
+		_, _, updatedErr := helpers.UpdateKlusterletStatus(ctx, n.klusterletClient, klusterletName, helpers.UpdateKlusterletConditionFn(metav1.Condition{
+			Type:    reconcilePaused,
+			Status:  metav1.ConditionFalse,
+			Reason:  "Managed",
+			Message: "The klusterlet is managed, the spec is reconciled normally",
+		}))
+		if updatedErr != nil {
+			return updatedErr
+		}
+	}
+
+	// Refuse to deploy agents from a different OCM release than this operator build
+	// supports, the mismatched agents would fail at runtime.
+	if err := helpers.CheckAgentImageVersions(config.RegistrationImage, config.WorkImage); err != nil {
+		_, _, updatedErr := helpers.UpdateKlusterletStatus(ctx, n.klusterletClient, klusterletName, helpers.UpdateKlusterletConditionFn(metav1.Condition{
+			Type: klusterletIncompatible, Status: metav1.ConditionTrue, Reason: "AgentVersionIncompatible",
+			Message: err.Error(),
+		}))
+		return updatedErr
+	}
+	// The condition is only turned back when the images become compatible again, so the
+	// common path does not touch status at all.
+	if meta.IsStatusConditionTrue(klusterlet.Status.Conditions, klusterletIncompatible) {
+		_, _, _ = helpers.UpdateKlusterletStatus(ctx, n.klusterletClient, klusterletName, helpers.UpdateKlusterletConditionFn(metav1.Condition{
+			Type: klusterletIncompatible, Status: metav1.ConditionFalse, Reason: "AgentVersionCompatible",
+			Message: "Agent image versions are compatible with the operator",
+		}))
+	}
+
+	// Warn when explicit image pull specs come from a different release stream than
+	// this operator build. Unlike the incompatible case above, the skewed agents
+	// still deploy, the condition just flags the likely fleet misconfiguration.
+	if skews := helpers.AgentImageVersionSkew(config.RegistrationImage, config.WorkImage); len(skews) > 0 {
+		_, _, _ = helpers.UpdateKlusterletStatus(ctx, n.klusterletClient, klusterletName, helpers.UpdateKlusterletConditionFn(metav1.Condition{
+			Type: klusterletVersionSkew, Status: metav1.ConditionTrue, Reason: "AgentVersionSkew",
+			Message: strings.Join(skews, "; "),
+		}))
+	} else if meta.IsStatusConditionTrue(klusterlet.Status.Conditions, klusterletVersionSkew) {
+		_, _, _ = helpers.UpdateKlusterletStatus(ctx, n.klusterletClient, klusterletName, helpers.UpdateKlusterletConditionFn(metav1.Condition{
+			Type: klusterletVersionSkew, Status: metav1.ConditionFalse, Reason: "NoAgentVersionSkew",
+			Message: "Agent image versions match the operator release stream",
+		}))
+	}
+
 	// Start deploy klusterlet components
 	// Ensure the existence namespaces for klusterlet and klusterlet addon
 	// Sync pull secret to each namespace
@@ -197,9 +581,9 @@ func (n *klusterletController) sync(ctx context.Context, controllerContext facto
 			n.kubeClient.CoreV1(),
 			controllerContext.Recorder(),
 			n.operatorNamespace,
-			imagePullSecret,
+			helpers.ImagePullSecret,
 			namespace,
-			imagePullSecret,
+			helpers.ImagePullSecret,
 			[]metav1.OwnerReference{},
 		)
 
@@ -217,6 +601,30 @@ func (n *klusterletController) sync(ctx context.Context, controllerContext facto
 		return err
 	}
 
+	// Copy the kubeconfig secrets of a former namespace before the agents are
+	// deployed in the new one, so the migrated agents keep their hub connection
+	// instead of bootstrapping from scratch.
+	for _, namespace := range formerNamespaces {
+		if err := n.copyMigratedSecrets(ctx, namespace, config); err != nil {
+			_, _, _ = helpers.UpdateKlusterletStatus(ctx, n.klusterletClient, klusterletName, helpers.UpdateKlusterletConditionFn(metav1.Condition{
+				Type: klusterletApplied, Status: metav1.ConditionFalse, Reason: "KlusterletApplyFailed",
+				Message: fmt.Sprintf("Failed to copy the kubeconfig secrets from former namespace %q: %v", namespace, err),
+			}))
+			return err
+		}
+	}
+
+	// Synthesize the bootstrap hub kubeconfig secret from the referenced token when
+	// the bootstrap configuration is set in spec.
+	if err := n.ensureBootstrapHubKubeconfig(ctx, controllerContext.Recorder(), klusterlet, config.KlusterletNamespace); err != nil {
+		_, _, _ = helpers.UpdateKlusterletStatus(ctx, n.klusterletClient, klusterletName, helpers.UpdateKlusterletConditionFn(metav1.Condition{
+			Type: klusterletApplied, Status: metav1.ConditionFalse, Reason: "KlusterletApplyFailed",
+			Message: fmt.Sprintf("Failed to synthesize the bootstrap hub kubeconfig: %v", err),
+		}))
+
+		return err
+	}
+
 	errs := []error{}
 	// If kube version is less than 1.12, deploy static resource for kube 1.11 at first
 	// TODO remove this when we do not support kube 1.11 any longer
@@ -225,11 +633,13 @@ func (n *klusterletController) sync(ctx context.Context, controllerContext facto
 			resourceapply.NewKubeClientHolder(n.kubeClient),
 			controllerContext.Recorder(),
 			func(name string) ([]byte, error) {
-				template, err := manifests.Klusterlet111ManifestFiles.ReadFile(name)
-				if err != nil {
-					return nil, err
-				}
-				return assets.MustCreateAssetFromTemplate(name, template, config).Data, nil
+				return n.renderCache.Render(name, config, func() ([]byte, error) {
+					template, err := manifests.Klusterlet111ManifestFiles.ReadFile(name)
+					if err != nil {
+						return nil, err
+					}
+					return assets.MustCreateAssetFromTemplate(name, template, config).Data, nil
+				})
 			},
 			kube111StaticResourceFiles...,
 		)
@@ -240,25 +650,65 @@ func (n *klusterletController) sync(ctx context.Context, controllerContext facto
 		}
 	}
 
-	// Apply static files
-	var appliedStaticFiles []string
-	// CRD v1beta1 was deprecated from k8s 1.16.0 and will be removed in k8s 1.22
-	if cnt, err := n.kubeVersion.Compare("v1.16.0"); err == nil && cnt < 0 {
-		appliedStaticFiles = append(crdV1beta1StaticFiles, staticResourceFiles...)
+	// Apply static files. The CRD files are skipped instead of failing the apply
+	// loop when the spoke serves no supported apiextensions version, and the gap is
+	// reported in the UnsupportedAPI condition.
+	crdFiles, unsupportedAPIs := n.spokeCRDFiles()
+	if len(unsupportedAPIs) > 0 {
+		_, _, updatedErr := helpers.UpdateKlusterletStatus(ctx, n.klusterletClient, klusterletName, helpers.UpdateKlusterletConditionFn(metav1.Condition{
+			Type: unsupportedAPI, Status: metav1.ConditionTrue, Reason: "RequiredAPIsNotServed",
+			Message: fmt.Sprintf("The CRD manifests were skipped because the spoke serves none of the supported apiextensions versions: %s", strings.Join(unsupportedAPIs, ", ")),
+		}))
+		if updatedErr != nil {
+			return updatedErr
+		}
+	} else if meta.IsStatusConditionTrue(klusterlet.Status.Conditions, unsupportedAPI) {
+		// The condition is only turned back when the APIs are served again, so the
+		// common path does not touch status at all.
+		_, _, _ = helpers.UpdateKlusterletStatus(ctx, n.klusterletClient, klusterletName, helpers.UpdateKlusterletConditionFn(metav1.Condition{
+			Type: unsupportedAPI, Status: metav1.ConditionFalse, Reason: "RequiredAPIsServed",
+			Message: "The spoke serves the APIs required by the klusterlet manifests",
+		}))
+	}
+	appliedStaticFiles := append(append([]string{}, crdFiles...), staticResourceFiles...)
+
+	// Bind the work agent to the generated restricted clusterrole when the allowed
+	// manifest resources are limited in spec, and to the built-in admin clusterrole
+	// otherwise. The files of the unselected mode are removed below, so a spec change
+	// takes effect without manual cleanup.
+	workRBACFiles, staleWorkRBACFiles := defaultWorkRBACFiles, restrictedWorkRBACFiles
+	if len(config.AllowedManifestResources) > 0 {
+		workRBACFiles, staleWorkRBACFiles = restrictedWorkRBACFiles, defaultWorkRBACFiles
+	}
+	appliedStaticFiles = append(appliedStaticFiles, workRBACFiles...)
+
+	// Apply the trusted CA injection configmap only when the cluster proxy references
+	// a trusted CA bundle, and remove it again when the reference goes away.
+	staleStaticFiles := append([]string{}, staleWorkRBACFiles...)
+	if config.InjectTrustedCABundle {
+		appliedStaticFiles = append(appliedStaticFiles, trustedCAFiles...)
 	} else {
-		appliedStaticFiles = append(crdV1StaticFiles, staticResourceFiles...)
+		staleStaticFiles = append(staleStaticFiles, trustedCAFiles...)
+	}
+	if config.MetricsProxyImage != "" {
+		appliedStaticFiles = append(appliedStaticFiles, metricsProxyFiles...)
 	}
 
-	resourceResults := resourceapply.ApplyDirectly(
-		resourceapply.NewKubeClientHolder(n.kubeClient).WithAPIExtensionsClient(n.apiExtensionClient),
-		controllerContext.Recorder(),
-		func(name string) ([]byte, error) {
+	render := func(name string) ([]byte, error) {
+		return n.renderCache.Render(name, config, func() ([]byte, error) {
 			template, err := manifests.KlusterletManifestFiles.ReadFile(name)
 			if err != nil {
 				return nil, err
 			}
 			return assets.MustCreateAssetFromTemplate(name, template, config).Data, nil
-		},
+		})
+	}
+	resourceResults := helpers.ApplyDirectly(
+		n.kubeClient,
+		n.apiExtensionClient,
+		nil,
+		controllerContext.Recorder(),
+		render,
 		appliedStaticFiles...,
 	)
 
@@ -268,6 +718,12 @@ func (n *klusterletController) sync(ctx context.Context, controllerContext facto
 		}
 	}
 
+	for _, file := range staleStaticFiles {
+		if err := helpers.CleanUpStaticObject(ctx, n.kubeClient, nil, nil, render, file); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
 	if len(errs) > 0 {
 		applyErrors := operatorhelpers.NewMultiLineAggregate(errs)
 		_, _, _ = helpers.UpdateKlusterletStatus(ctx, n.klusterletClient, klusterletName, helpers.UpdateKlusterletConditionFn(metav1.Condition{
@@ -278,13 +734,13 @@ func (n *klusterletController) sync(ctx context.Context, controllerContext facto
 	}
 
 	// Create hub config secret
-	hubSecret, err := n.kubeClient.CoreV1().Secrets(config.KlusterletNamespace).Get(ctx, helpers.HubKubeConfig, metav1.GetOptions{})
+	hubSecret, err := n.kubeClient.CoreV1().Secrets(config.KlusterletNamespace).Get(ctx, config.HubKubeConfigSecret, metav1.GetOptions{})
 	switch {
 	case errors.IsNotFound(err):
 		// Create an empty secret with placeholder
 		hubSecret = &corev1.Secret{
 			ObjectMeta: metav1.ObjectMeta{
-				Name:      helpers.HubKubeConfig,
+				Name:      config.HubKubeConfigSecret,
 				Namespace: config.KlusterletNamespace,
 			},
 			Data: map[string][]byte{"placeholder": []byte("placeholder")},
@@ -310,13 +766,10 @@ func (n *klusterletController) sync(ctx context.Context, controllerContext facto
 		n.kubeClient,
 		klusterlet.Status.Generations,
 		klusterlet.Spec.NodePlacement,
-		func(name string) ([]byte, error) {
-			template, err := manifests.KlusterletManifestFiles.ReadFile(name)
-			if err != nil {
-				return nil, err
-			}
-			return assets.MustCreateAssetFromTemplate(name, template, config).Data, nil
-		},
+		klusterlet.Spec.RuntimeClassName,
+		klusterlet.Spec.ProbeConfiguration,
+		klusterlet.Spec.RolloutConfiguration,
+		render,
 		controllerContext.Recorder(),
 		"klusterlet/klusterlet-registration-deployment.yaml")
 	if err != nil {
@@ -340,13 +793,10 @@ func (n *klusterletController) sync(ctx context.Context, controllerContext facto
 		n.kubeClient,
 		klusterlet.Status.Generations,
 		klusterlet.Spec.NodePlacement,
-		func(name string) ([]byte, error) {
-			template, err := manifests.KlusterletManifestFiles.ReadFile(name)
-			if err != nil {
-				return nil, err
-			}
-			return assets.MustCreateAssetFromTemplate(name, template, config).Data, nil
-		},
+		klusterlet.Spec.RuntimeClassName,
+		klusterlet.Spec.ProbeConfiguration,
+		klusterlet.Spec.RolloutConfiguration,
+		render,
 		controllerContext.Recorder(),
 		"klusterlet/klusterlet-work-deployment.yaml")
 	if err != nil {
@@ -358,22 +808,224 @@ func (n *klusterletController) sync(ctx context.Context, controllerContext facto
 	}
 	observedKlusterletGeneration := klusterlet.Generation
 
+	// Record every applied resource in status, so must-gather and uninstall
+	// verification can enumerate them without knowing the manifests.
+	relatedFiles := append([]string{}, appliedStaticFiles...)
+	relatedFiles = append(relatedFiles,
+		"klusterlet/klusterlet-registration-deployment.yaml",
+		"klusterlet/klusterlet-work-deployment.yaml")
+	relatedResources, err := helpers.NewRelatedResources(render, relatedFiles...)
+	if err != nil {
+		return err
+	}
+
 	// if we get here, we have successfully applied everything and should indicate that
 	_, _, _ = helpers.UpdateKlusterletStatus(ctx, n.klusterletClient, klusterletName,
 		helpers.UpdateKlusterletConditionFn(metav1.Condition{
 			Type: klusterletApplied, Status: metav1.ConditionTrue, Reason: "KlusterletApplied",
 			Message: "Klusterlet Component Applied"}),
 		helpers.UpdateKlusterletGenerationsFn(registrationGeneration, workGeneration),
+		helpers.UpdateKlusterletRelatedResourcesFn(relatedResources...),
 		func(oldStatus *operatorapiv1.KlusterletStatus) error {
 			oldStatus.ObservedGeneration = observedKlusterletGeneration
+			oldStatus.OperatorVersion = operatorversion.OperatorVersion()
+			oldStatus.ResolvedImages = resolvedImages
 			return nil
 		},
 	)
+
+	// Remove the namespaces of a former spec.namespace once the migrated agents are
+	// available. Until then the old agents keep running, so a namespace change does
+	// not interrupt the hub connection. The deployment informer retriggers the sync
+	// when the new agents become available.
+	return n.cleanUpFormerNamespaces(ctx, controllerContext, formerNamespaces, config)
+}
+
+// formerKlusterletNamespaces returns the namespaces labeled as owned by the given
+// klusterlet that do not belong to its current namespace, i.e. the leftovers of a
+// changed spec.namespace. The addon namespaces are covered by their base namespace.
+// spokeCRDFiles returns the CRD manifest files in the newest apiextensions version
+// the spoke serves. The served group versions decide when they can be discovered, so
+// distributions whose version string does not track upstream kube still get matching
+// manifests; the kube version comparison is the fallback. When the spoke serves no
+// supported version, no files and the missing group versions are returned.
+func (n *klusterletController) spokeCRDFiles() ([]string, []string) {
+	if n.apiSupported != nil {
+		v1Supported, v1Err := n.apiSupported("apiextensions.k8s.io/v1")
+		v1beta1Supported, v1beta1Err := n.apiSupported("apiextensions.k8s.io/v1beta1")
+		switch {
+		case v1Err != nil || v1beta1Err != nil:
+			// fall back to the kube version comparison below
+		case v1Supported:
+			return crdV1StaticFiles, nil
+		case v1beta1Supported:
+			return crdV1beta1StaticFiles, nil
+		default:
+			return nil, []string{"apiextensions.k8s.io/v1", "apiextensions.k8s.io/v1beta1"}
+		}
+	}
+
+	// CRD v1beta1 was deprecated from k8s 1.16.0 and will be removed in k8s 1.22
+	if cnt, err := n.kubeVersion.Compare("v1.16.0"); err == nil && cnt < 0 {
+		return crdV1beta1StaticFiles, nil
+	}
+	return crdV1StaticFiles, nil
+}
+
+func (n *klusterletController) formerKlusterletNamespaces(ctx context.Context, klusterletName, currentNamespace string) ([]string, error) {
+	namespaces, err := n.kubeClient.CoreV1().Namespaces().List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", helpers.KlusterletOwnerLabel, klusterletName),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	formerNamespaces := []string{}
+	for _, namespace := range namespaces.Items {
+		if namespace.Name == currentNamespace || strings.HasSuffix(namespace.Name, "-addon") {
+			continue
+		}
+		if !namespace.DeletionTimestamp.IsZero() {
+			continue
+		}
+		formerNamespaces = append(formerNamespaces, namespace.Name)
+	}
+	return formerNamespaces, nil
+}
+
+// copyMigratedSecrets copies the bootstrap and hub kubeconfig secrets of a former
+// namespace into the current one, unless they already exist there.
+func (n *klusterletController) copyMigratedSecrets(ctx context.Context, formerNamespace string, config klusterletConfig) error {
+	for _, secretName := range []string{config.BootStrapKubeConfigSecret, config.HubKubeConfigSecret} {
+		_, err := n.kubeClient.CoreV1().Secrets(config.KlusterletNamespace).Get(ctx, secretName, metav1.GetOptions{})
+		if err == nil {
+			continue
+		}
+		if !errors.IsNotFound(err) {
+			return err
+		}
+
+		secret, err := n.kubeClient.CoreV1().Secrets(formerNamespace).Get(ctx, secretName, metav1.GetOptions{})
+		switch {
+		case errors.IsNotFound(err):
+			// nothing to migrate, the secret is recreated in the current namespace
+			continue
+		case err != nil:
+			return err
+		}
+
+		_, err = n.kubeClient.CoreV1().Secrets(config.KlusterletNamespace).Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      secretName,
+				Namespace: config.KlusterletNamespace,
+			},
+			Type: secret.Type,
+			Data: secret.Data,
+		}, metav1.CreateOptions{})
+		if err != nil && !errors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanUpFormerNamespaces removes the given former namespaces and their addon
+// namespaces once both agents in the current namespace are fully available. While
+// the agents are not available yet the former namespaces are kept, so the old
+// agents can still serve the cluster.
+func (n *klusterletController) cleanUpFormerNamespaces(ctx context.Context, controllerContext factory.SyncContext, formerNamespaces []string, config klusterletConfig) error {
+	if len(formerNamespaces) == 0 {
+		return nil
+	}
+
+	deployments := []string{
+		fmt.Sprintf("%s-registration-agent", config.KlusterletName),
+		fmt.Sprintf("%s-work-agent", config.KlusterletName),
+	}
+	for _, deploymentName := range deployments {
+		deployment, err := n.kubeClient.AppsV1().Deployments(config.KlusterletNamespace).Get(ctx, deploymentName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if deployment.Status.AvailableReplicas == 0 || helpers.NumOfUnavailablePod(deployment) > 0 {
+			return nil
+		}
+	}
+
+	for _, formerNamespace := range formerNamespaces {
+		for _, namespace := range []string{formerNamespace, fmt.Sprintf("%s-addon", formerNamespace)} {
+			err := n.kubeClient.CoreV1().Namespaces().Delete(ctx, namespace, metav1.DeleteOptions{})
+			if errors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			controllerContext.Recorder().Eventf("NamespaceDeleted", "former klusterlet namespace %s is deleted", namespace)
+		}
+	}
 	return nil
 }
 
+// ensureBootstrapHubKubeconfig synthesizes the bootstrap hub kubeconfig secret from
+// the hub url, CA bundle configmap and token secret referenced by the bootstrap
+// configuration in spec. It does nothing when the bootstrap configuration is not set,
+// in which case the bootstrap secret is expected to be created out of band.
+func (n *klusterletController) ensureBootstrapHubKubeconfig(ctx context.Context, recorder events.Recorder, klusterlet *operatorapiv1.Klusterlet, namespace string) error {
+	bootstrapConfig := klusterlet.Spec.BootstrapConfiguration
+	if bootstrapConfig == nil {
+		return nil
+	}
+
+	tokenSecret, err := n.kubeClient.CoreV1().Secrets(namespace).Get(ctx, bootstrapConfig.TokenSecret, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get the bootstrap token secret %q: %v", bootstrapConfig.TokenSecret, err)
+	}
+	token := tokenSecret.Data["token"]
+	if len(token) == 0 {
+		return fmt.Errorf("the bootstrap token secret %q has no %q key", bootstrapConfig.TokenSecret, "token")
+	}
+
+	cluster := clientcmdapi.Cluster{Server: bootstrapConfig.HubAPIServerURL}
+	if len(bootstrapConfig.CABundleConfigMap) > 0 {
+		configmap, err := n.kubeClient.CoreV1().ConfigMaps(namespace).Get(ctx, bootstrapConfig.CABundleConfigMap, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("unable to get the CA bundle configmap %q: %v", bootstrapConfig.CABundleConfigMap, err)
+		}
+		caBundle := configmap.Data["ca-bundle.crt"]
+		if len(caBundle) == 0 {
+			return fmt.Errorf("the CA bundle configmap %q has no %q key", bootstrapConfig.CABundleConfigMap, "ca-bundle.crt")
+		}
+		cluster.CertificateAuthorityData = []byte(caBundle)
+	}
+
+	kubeconfigData, err := clientcmd.Write(clientcmdapi.Config{
+		Clusters:       map[string]*clientcmdapi.Cluster{"hub": &cluster},
+		AuthInfos:      map[string]*clientcmdapi.AuthInfo{"bootstrap": {Token: string(token)}},
+		Contexts:       map[string]*clientcmdapi.Context{"bootstrap": {Cluster: "hub", AuthInfo: "bootstrap"}},
+		CurrentContext: "bootstrap",
+	})
+	if err != nil {
+		return err
+	}
+
+	_, _, err = resourceapply.ApplySecret(n.kubeClient.CoreV1(), recorder, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      helpers.BootstrapHubKubeConfig,
+			Labels:    map[string]string{helpers.BackupLabel: "true"},
+		},
+		Data: map[string][]byte{"kubeconfig": kubeconfigData},
+	})
+	return err
+}
+
 func (n *klusterletController) ensureNamespace(ctx context.Context, klusterletName, namespace string) error {
 	_, err := n.kubeClient.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	podSecurityEnforceLevel := n.podSecurityEnforceLevel
+	if len(podSecurityEnforceLevel) == 0 {
+		podSecurityEnforceLevel = helpers.DefaultPodSecurityEnforceLevel
+	}
 	switch {
 	case errors.IsNotFound(err):
 		_, createErr := n.kubeClient.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{
@@ -382,6 +1034,10 @@ func (n *klusterletController) ensureNamespace(ctx context.Context, klusterletNa
 				Annotations: map[string]string{
 					"workload.openshift.io/allowed": "management",
 				},
+				Labels: map[string]string{
+					helpers.KlusterletOwnerLabel:    klusterletName,
+					helpers.PodSecurityEnforceLabel: podSecurityEnforceLevel,
+				},
 			},
 		}, metav1.CreateOptions{})
 		if createErr != nil {
@@ -402,17 +1058,32 @@ func (n *klusterletController) ensureNamespace(ctx context.Context, klusterletNa
 	return nil
 }
 
+// otherKlusterletsExist reports whether another klusterlet that is not being
+// deleted still exists on this management cluster, in which case a teardown keeps
+// the shared spoke CRDs the surviving instances rely on.
+func otherKlusterletsExist(klusterlets []*operatorapiv1.Klusterlet, name string) bool {
+	for _, klusterlet := range klusterlets {
+		if klusterlet.Name == name || !klusterlet.DeletionTimestamp.IsZero() {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
 func (n *klusterletController) cleanUp(ctx context.Context, controllerContext factory.SyncContext, config klusterletConfig) error {
 	// Remove deployment
 	registrationDeployment := fmt.Sprintf("%s-registration-agent", config.KlusterletName)
 	err := n.kubeClient.AppsV1().Deployments(config.KlusterletNamespace).Delete(ctx, registrationDeployment, metav1.DeleteOptions{})
 	if err != nil && !errors.IsNotFound(err) {
+		n.updateDeletingCondition(ctx, config.KlusterletName, 0, err)
 		return err
 	}
 	controllerContext.Recorder().Eventf("DeploymentDeleted", "deployment %s is deleted", registrationDeployment)
 	workDeployment := fmt.Sprintf("%s-work-agent", config.KlusterletName)
 	err = n.kubeClient.AppsV1().Deployments(config.KlusterletNamespace).Delete(ctx, workDeployment, metav1.DeleteOptions{})
 	if err != nil && !errors.IsNotFound(err) {
+		n.updateDeletingCondition(ctx, config.KlusterletName, 0, err)
 		return err
 	}
 
@@ -427,18 +1098,29 @@ func (n *klusterletController) cleanUp(ctx context.Context, controllerContext fa
 		}
 		hubHost = restConfig.Host
 	case !errors.IsNotFound(err):
+		n.updateDeletingCondition(ctx, config.KlusterletName, 1, err)
 		return err
 	}
 
-	// Remove secret
-	err = n.kubeClient.CoreV1().Secrets(config.KlusterletNamespace).Delete(ctx, config.HubKubeConfigSecret, metav1.DeleteOptions{})
-	if err != nil && !errors.IsNotFound(err) {
-		return err
+	// Remove secret. The secret is kept when the klusterlet is configured to retain
+	// the hub credentials, so a later reinstall does not need another registration
+	// approval on the hub.
+	if !config.RetainHubCredentialsOnDelete {
+		err = n.kubeClient.CoreV1().Secrets(config.KlusterletNamespace).Delete(ctx, config.HubKubeConfigSecret, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			n.updateDeletingCondition(ctx, config.KlusterletName, 1, err)
+			return err
+		}
+		controllerContext.Recorder().Eventf("SecretDeleted", "secret %s is deleted", config.HubKubeConfigSecret)
 	}
-	controllerContext.Recorder().Eventf("SecretDeleted", "secret %s is deleted", config.HubKubeConfigSecret)
 
-	// Remove Static files
-	for _, file := range staticResourceFiles {
+	// Remove Static files, including the work agent rbac of both modes
+	cleanUpStaticFiles := append([]string{}, staticResourceFiles...)
+	cleanUpStaticFiles = append(cleanUpStaticFiles, defaultWorkRBACFiles...)
+	cleanUpStaticFiles = append(cleanUpStaticFiles, restrictedWorkRBACFiles...)
+	cleanUpStaticFiles = append(cleanUpStaticFiles, trustedCAFiles...)
+	cleanUpStaticFiles = append(cleanUpStaticFiles, metricsProxyFiles...)
+	for _, file := range cleanUpStaticFiles {
 		err := helpers.CleanUpStaticObject(
 			ctx,
 			n.kubeClient,
@@ -454,13 +1136,14 @@ func (n *klusterletController) cleanUp(ctx context.Context, controllerContext fa
 			file,
 		)
 		if err != nil {
+			n.updateDeletingCondition(ctx, config.KlusterletName, 2, err)
 			return err
 		}
 	}
 
 	// TODO remove this when we do not support kube 1.11 any longer
 	cnt, err := n.kubeVersion.Compare("v1.12.0")
-	klog.Errorf("comapare version %d, %v", cnt, err)
+	klog.V(4).InfoS("Compared kube version", "controller", "KlusterletController", "klusterlet", config.KlusterletName, "result", cnt, "err", err)
 	if cnt, err := n.kubeVersion.Compare("v1.12.0"); err == nil && cnt < 0 {
 		for _, file := range kube111StaticResourceFiles {
 			err := helpers.CleanUpStaticObject(
@@ -478,35 +1161,53 @@ func (n *klusterletController) cleanUp(ctx context.Context, controllerContext fa
 				file,
 			)
 			if err != nil {
+				n.updateDeletingCondition(ctx, config.KlusterletName, 2, err)
 				return err
 			}
 		}
 	}
 
-	// remove the klusterlet namespace and klusterlet addon namespace
-	namespaces := []string{config.KlusterletNamespace, fmt.Sprintf("%s-addon", config.KlusterletNamespace)}
+	// remove the klusterlet namespace and klusterlet addon namespace. The klusterlet
+	// namespace is kept together with the retained hub credentials, removing it would
+	// purge the secret with it. The addon namespace is kept when its cleanup policy
+	// orphans it, for namespaces that also host non-OCM workloads.
+	namespaces := []string{}
+	if !config.RetainHubCredentialsOnDelete {
+		namespaces = append(namespaces, config.KlusterletNamespace)
+	}
+	if !config.OrphanAddOnNamespace {
+		namespaces = append(namespaces, fmt.Sprintf("%s-addon", config.KlusterletNamespace))
+	}
 	for _, namespace := range namespaces {
 		err = n.kubeClient.CoreV1().Namespaces().Delete(ctx, namespace, metav1.DeleteOptions{})
 		if err != nil && !errors.IsNotFound(err) {
+			n.updateDeletingCondition(ctx, config.KlusterletName, 3, err)
 			return err
 		}
+		controllerContext.Recorder().Eventf("NamespaceDeleted", "namespace %s is deleted", namespace)
 	}
 
 	// remove AppliedManifestWorks
 	if len(hubHost) > 0 {
 		if err := n.cleanUpAppliedManifestWorks(ctx, hubHost); err != nil {
+			n.updateDeletingCondition(ctx, config.KlusterletName, 4, err)
 			return err
 		}
 	}
 
-	// remove the CRDs
-	var crdStaticFiles []string
-	// CRD v1beta1 was deprecated from k8s 1.16.0 and will be removed in k8s 1.22
-	if cnt, err := n.kubeVersion.Compare("v1.16.0"); err == nil && cnt < 0 {
-		crdStaticFiles = crdV1beta1StaticFiles
-	} else {
-		crdStaticFiles = crdV1StaticFiles
+	// remove the CRDs. The appliedmanifestworks and clusterclaims CRDs are shared by
+	// every klusterlet on this management cluster, so they are kept while another
+	// klusterlet exists — removing them would cascade away the applied manifest work
+	// records of the surviving instances.
+	klusterlets, err := n.klusterletLister.List(labels.Everything())
+	if err != nil {
+		n.updateDeletingCondition(ctx, config.KlusterletName, 5, err)
+		return err
 	}
+	if otherKlusterletsExist(klusterlets, config.KlusterletName) {
+		return nil
+	}
+	crdStaticFiles, _ := n.spokeCRDFiles()
 	for _, file := range crdStaticFiles {
 		err := helpers.CleanUpStaticObject(
 			ctx,
@@ -523,12 +1224,31 @@ func (n *klusterletController) cleanUp(ctx context.Context, controllerContext fa
 			file,
 		)
 		if err != nil {
+			n.updateDeletingCondition(ctx, config.KlusterletName, 5, err)
 			return err
 		}
 	}
 	return nil
 }
 
+// updateDeletingCondition reports the teardown progress of a deleting klusterlet by
+// listing the steps that still have resources to be removed and the error the teardown
+// is currently blocked on.
+func (n *klusterletController) updateDeletingCondition(ctx context.Context, klusterletName string, stepIndex int, blockingErr error) {
+	_, _, err := helpers.UpdateKlusterletStatus(ctx, n.klusterletClient, klusterletName,
+		helpers.UpdateKlusterletConditionFn(metav1.Condition{
+			Type:   klusterletDeleting,
+			Status: metav1.ConditionTrue,
+			Reason: "ResourcesRemaining",
+			Message: fmt.Sprintf("Waiting for the removal of resources in steps: %s, blocked on: %v",
+				strings.Join(cleanUpSteps[stepIndex:], ", "), blockingErr),
+		}),
+	)
+	if err != nil {
+		klog.ErrorS(err, "Failed to update the Deleting condition of Klusterlet", "controller", "KlusterletController", "klusterlet", klusterletName)
+	}
+}
+
 func (n *klusterletController) removeKlusterletFinalizer(ctx context.Context, deploy *operatorapiv1.Klusterlet) error {
 	// reload klusterlet
 	deploy, err := n.klusterletClient.Get(ctx, deploy.Name, metav1.GetOptions{})
@@ -555,7 +1275,10 @@ func (n *klusterletController) removeKlusterletFinalizer(ctx context.Context, de
 }
 
 // cleanUpAppliedManifestWorks removes finalizer from the AppliedManifestWorks whose name starts with
-// the hash of the given hub host.
+// the hash of the given hub host. The work agent is already deleted at this point, so the
+// operator removes the applied resources recorded in their status itself before lifting
+// the cleanup finalizer, instead of hanging the deletion on an agent that can no longer
+// run the graceful teardown.
 func (n *klusterletController) cleanUpAppliedManifestWorks(ctx context.Context, hubHost string) error {
 	appliedManifestWorks, err := n.appliedManifestWorkClient.List(ctx, metav1.ListOptions{})
 	if err != nil {
@@ -569,6 +1292,13 @@ func (n *klusterletController) cleanUpAppliedManifestWorks(ctx context.Context,
 			continue
 		}
 
+		// the finalizer is only lifted once the applied resources are gone, so a
+		// failed removal is retried on the next sync instead of orphaning them
+		if err := n.removeAppliedResources(ctx, &appliedManifestWork); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
 		// remove finalizer if exists
 		if mutated := removeFinalizer(&appliedManifestWork, appliedManifestWorkFinalizer); !mutated {
 			continue
@@ -582,6 +1312,22 @@ func (n *klusterletController) cleanUpAppliedManifestWorks(ctx context.Context,
 	return operatorhelpers.NewMultiLineAggregate(errs)
 }
 
+// removeAppliedResources deletes the resources recorded in the status of the given
+// AppliedManifestWork from the managed cluster. Resources that are already gone are
+// skipped, so the removal is safe to repeat.
+func (n *klusterletController) removeAppliedResources(ctx context.Context, appliedManifestWork *workapiv1.AppliedManifestWork) error {
+	errs := []error{}
+	for _, resource := range appliedManifestWork.Status.AppliedResources {
+		gvr := schema.GroupVersionResource{Group: resource.Group, Version: resource.Version, Resource: resource.Resource}
+		err := n.dynamicClient.Resource(gvr).Namespace(resource.Namespace).Delete(ctx, resource.Name, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("unable to delete the applied resource %q %q of AppliedManifestWork %q: %w",
+				gvr.String(), resource.Name, appliedManifestWork.Name, err))
+		}
+	}
+	return operatorhelpers.NewMultiLineAggregate(errs)
+}
+
 // removeFinalizer removes a finalizer from the list. It mutates its input.
 func removeFinalizer(obj runtime.Object, finalizerName string) bool {
 	if obj == nil || reflect.ValueOf(obj).IsNil() {
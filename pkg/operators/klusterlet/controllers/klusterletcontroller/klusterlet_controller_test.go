@@ -1,6 +1,7 @@
 package klusterletcontroller
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"strings"
@@ -16,9 +17,12 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/rand"
 	"k8s.io/apimachinery/pkg/util/version"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	kubeinformers "k8s.io/client-go/informers"
 	fakekube "k8s.io/client-go/kubernetes/fake"
 	clienttesting "k8s.io/client-go/testing"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	clientcmdlatest "k8s.io/client-go/tools/clientcmd/api/latest"
 	fakeoperatorclient "open-cluster-management.io/api/client/operator/clientset/versioned/fake"
@@ -36,6 +40,7 @@ type testController struct {
 	apiExtensionClient *fakeapiextensions.Clientset
 	operatorClient     *fakeoperatorclient.Clientset
 	workClient         *fakeworkclient.Clientset
+	dynamicClient      *fakedynamic.FakeDynamicClient
 	operatorStore      cache.Store
 }
 
@@ -106,20 +111,31 @@ func newNode(name string) *corev1.Node {
 
 func newTestController(klusterlet *opratorapiv1.Klusterlet, appliedManifestWorks []runtime.Object, objects ...runtime.Object) *testController {
 	fakeKubeClient := fakekube.NewSimpleClientset(objects...)
+	testinghelper.EnableServerSideApplyForDeployments(fakeKubeClient)
 	fakeAPIExtensionClient := fakeapiextensions.NewSimpleClientset()
+	fakeDynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
 	fakeOperatorClient := fakeoperatorclient.NewSimpleClientset(klusterlet)
 	fakeWorkClient := fakeworkclient.NewSimpleClientset(appliedManifestWorks...)
 	operatorInformers := operatorinformers.NewSharedInformerFactory(fakeOperatorClient, 5*time.Minute)
+	kubeInformers := kubeinformers.NewSharedInformerFactory(fakeKubeClient, 5*time.Minute)
+	nodeStore := kubeInformers.Core().V1().Nodes().Informer().GetStore()
+	for _, object := range objects {
+		if node, ok := object.(*corev1.Node); ok {
+			nodeStore.Add(node)
+		}
+	}
 	kubeVersion, _ := version.ParseGeneric("v1.18.0")
 
 	hubController := &klusterletController{
 		klusterletClient:          fakeOperatorClient.OperatorV1().Klusterlets(),
 		kubeClient:                fakeKubeClient,
 		apiExtensionClient:        fakeAPIExtensionClient,
+		dynamicClient:             fakeDynamicClient,
 		appliedManifestWorkClient: fakeWorkClient.WorkV1().AppliedManifestWorks(),
 		klusterletLister:          operatorInformers.Operator().V1().Klusterlets().Lister(),
 		kubeVersion:               kubeVersion,
 		operatorNamespace:         "open-cluster-management",
+		nodeLister:                kubeInformers.Core().V1().Nodes().Lister(),
 	}
 
 	store := operatorInformers.Operator().V1().Klusterlets().Informer().GetStore()
@@ -131,6 +147,7 @@ func newTestController(klusterlet *opratorapiv1.Klusterlet, appliedManifestWorks
 		apiExtensionClient: fakeAPIExtensionClient,
 		operatorClient:     fakeOperatorClient,
 		workClient:         fakeWorkClient,
+		dynamicClient:      fakeDynamicClient,
 		operatorStore:      store,
 	}
 }
@@ -147,9 +164,10 @@ func ensureDeployments(t *testing.T, actions []clienttesting.Action, verb, serve
 			deployments = append(deployments, object.(*appsv1.Deployment))
 		}
 
-		if verb == "update" {
-			object := action.(clienttesting.UpdateActionImpl).Object
-			deployments = append(deployments, object.(*appsv1.Deployment))
+		if verb == "patch" {
+			if deployment := testinghelper.AppliedDeployment(action); deployment != nil {
+				deployments = append(deployments, deployment)
+			}
 		}
 	}
 
@@ -308,6 +326,409 @@ func TestSyncDeploy(t *testing.T) {
 		testinghelper.NamedCondition(klusterletApplied, "KlusterletApplied", metav1.ConditionTrue))
 }
 
+// TestSyncDeployHostedMode tests that a hosted mode klusterlet is deployed into its
+// own namespace derived from the klusterlet name, ignoring the namespace in spec, so
+// several hosted klusterlets on one management cluster do not collide
+func TestSyncDeployHostedMode(t *testing.T) {
+	klusterlet := newKlusterlet("klusterlet", "testns", "cluster1")
+	klusterlet.Spec.DeployOption.Mode = opratorapiv1.InstallModeHosted
+	agentNamespace := "klusterlet-klusterlet"
+	bootStrapSecret := newSecret(helpers.BootstrapHubKubeConfig, agentNamespace)
+	hubKubeConfigSecret := newSecret(helpers.HubKubeConfig, agentNamespace)
+	hubKubeConfigSecret.Data["kubeconfig"] = []byte("dummuykubeconnfig")
+	namespace := newNamespace(agentNamespace)
+	controller := newTestController(klusterlet, nil, bootStrapSecret, hubKubeConfigSecret, namespace)
+	syncContext := testinghelper.NewFakeSyncContext(t, "klusterlet")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		object := action.(clienttesting.CreateActionImpl).Object
+		accessor, _ := meta.Accessor(object)
+		if ns := accessor.GetNamespace(); ns != "" && ns != agentNamespace && ns != fmt.Sprintf("%s-addon", agentNamespace) {
+			t.Errorf("Expect object %q created in namespace %q, actual %q", accessor.GetName(), agentNamespace, ns)
+		}
+	}
+}
+
+// TestSyncDeployImageEnvOverrides tests that the agent images are resolved from the
+// environment of the operator when the image pull specs in spec are left empty
+func TestSyncDeployImageEnvOverrides(t *testing.T) {
+	t.Setenv("REGISTRATION_IMAGE", "mirror.example.com/registration:latest")
+	t.Setenv("WORK_IMAGE", "mirror.example.com/work:latest")
+
+	klusterlet := newKlusterlet("klusterlet", "testns", "cluster1")
+	klusterlet.Spec.RegistrationImagePullSpec = ""
+	klusterlet.Spec.WorkImagePullSpec = ""
+	bootStrapSecret := newSecret(helpers.BootstrapHubKubeConfig, "testns")
+	hubKubeConfigSecret := newSecret(helpers.HubKubeConfig, "testns")
+	hubKubeConfigSecret.Data["kubeconfig"] = []byte("dummuykubeconnfig")
+	namespace := newNamespace("testns")
+	controller := newTestController(klusterlet, nil, bootStrapSecret, hubKubeConfigSecret, namespace)
+	syncContext := testinghelper.NewFakeSyncContext(t, "klusterlet")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		deployment, ok := action.(clienttesting.CreateActionImpl).Object.(*appsv1.Deployment)
+		if !ok {
+			continue
+		}
+		image := deployment.Spec.Template.Spec.Containers[0].Image
+		if strings.Contains(deployment.Name, "registration") && image != "mirror.example.com/registration:latest" {
+			t.Errorf("Expected deployment %q to use the registration image from the environment, got %q", deployment.Name, image)
+		}
+		if strings.Contains(deployment.Name, "work") && image != "mirror.example.com/work:latest" {
+			t.Errorf("Expected deployment %q to use the work image from the environment, got %q", deployment.Name, image)
+		}
+	}
+}
+
+// TestSyncDeployIncompatibleVersion tests that agents of a different OCM release
+// than the operator supports are not deployed
+func TestSyncDeployIncompatibleVersion(t *testing.T) {
+	klusterlet := newKlusterlet("klusterlet", "testns", "cluster1")
+	klusterlet.Spec.RegistrationImagePullSpec = "quay.io/open-cluster-management/registration:v99.0.0"
+	bootStrapSecret := newSecret(helpers.BootstrapHubKubeConfig, "testns")
+	hubKubeConfigSecret := newSecret(helpers.HubKubeConfig, "testns")
+	hubKubeConfigSecret.Data["kubeconfig"] = []byte("dummuykubeconnfig")
+	namespace := newNamespace("testns")
+	controller := newTestController(klusterlet, nil, bootStrapSecret, hubKubeConfigSecret, namespace)
+	syncContext := testinghelper.NewFakeSyncContext(t, "klusterlet")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() == "create" {
+			t.Errorf("Expected no resources created for an incompatible version, got %#v", action)
+		}
+	}
+
+	operatorAction := controller.operatorClient.Actions()
+	if len(operatorAction) != 2 {
+		t.Errorf("Expect 2 actions in the sync loop, actual %#v", operatorAction)
+	}
+	testinghelper.AssertGet(t, operatorAction[0], "operator.open-cluster-management.io", "v1", "klusterlets")
+	testinghelper.AssertAction(t, operatorAction[1], "update")
+	testinghelper.AssertOnlyConditions(
+		t, operatorAction[1].(clienttesting.UpdateActionImpl).Object,
+		testinghelper.NamedCondition(klusterletIncompatible, "AgentVersionIncompatible", metav1.ConditionTrue))
+}
+
+// TestSyncDeployVersionSkew tests that agents from a compatible but different release
+// stream are deployed with a VersionSkewDetected warning condition
+func TestSyncDeployVersionSkew(t *testing.T) {
+	klusterlet := newKlusterlet("klusterlet", "testns", "cluster1")
+	klusterlet.Spec.RegistrationImagePullSpec = "quay.io/open-cluster-management/registration:v0.5.1"
+	bootStrapSecret := newSecret(helpers.BootstrapHubKubeConfig, "testns")
+	hubKubeConfigSecret := newSecret(helpers.HubKubeConfig, "testns")
+	hubKubeConfigSecret.Data["kubeconfig"] = []byte("dummuykubeconnfig")
+	namespace := newNamespace("testns")
+	controller := newTestController(klusterlet, nil, bootStrapSecret, hubKubeConfigSecret, namespace)
+	syncContext := testinghelper.NewFakeSyncContext(t, "klusterlet")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	created := false
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() == "create" {
+			created = true
+			break
+		}
+	}
+	if !created {
+		t.Errorf("Expected the skewed agents to still be deployed")
+	}
+
+	skewConditionFound := false
+	for _, action := range controller.operatorClient.Actions() {
+		update, ok := action.(clienttesting.UpdateActionImpl)
+		if !ok {
+			continue
+		}
+		updated, ok := update.Object.(*opratorapiv1.Klusterlet)
+		if !ok {
+			continue
+		}
+		if meta.IsStatusConditionTrue(updated.Status.Conditions, klusterletVersionSkew) {
+			skewConditionFound = true
+		}
+	}
+	if !skewConditionFound {
+		t.Errorf("Expected a true %s condition for the skewed registration image", klusterletVersionSkew)
+	}
+}
+
+// TestSyncDeployPinImageDigests tests that the agent images stay pinned to the
+// digests recorded in status when digest pinning is enabled
+func TestSyncDeployPinImageDigests(t *testing.T) {
+	registrationDigest := "quay.io/open-cluster-management/registration@sha256:aaa"
+	workDigest := "quay.io/open-cluster-management/work@sha256:bbb"
+
+	klusterlet := newKlusterlet("klusterlet", "testns", "cluster1")
+	klusterlet.Spec.PinImageDigests = true
+	klusterlet.Status.ResolvedImages = map[string]string{
+		"testregistration": registrationDigest,
+		"testwork":         workDigest,
+	}
+	bootStrapSecret := newSecret(helpers.BootstrapHubKubeConfig, "testns")
+	hubKubeConfigSecret := newSecret(helpers.HubKubeConfig, "testns")
+	hubKubeConfigSecret.Data["kubeconfig"] = []byte("dummuykubeconnfig")
+	namespace := newNamespace("testns")
+	controller := newTestController(klusterlet, nil, bootStrapSecret, hubKubeConfigSecret, namespace)
+	syncContext := testinghelper.NewFakeSyncContext(t, "klusterlet")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		deployment, ok := action.(clienttesting.CreateActionImpl).Object.(*appsv1.Deployment)
+		if !ok {
+			continue
+		}
+		image := deployment.Spec.Template.Spec.Containers[0].Image
+		if strings.Contains(deployment.Name, "registration") && image != registrationDigest {
+			t.Errorf("Expected deployment %q to be pinned to the recorded digest, got %q", deployment.Name, image)
+		}
+		if strings.Contains(deployment.Name, "work") && image != workDigest {
+			t.Errorf("Expected deployment %q to be pinned to the recorded digest, got %q", deployment.Name, image)
+		}
+	}
+}
+
+// TestSyncDeployWorkDriver tests that the work driver in spec is rendered into the
+// work agent deployment
+func TestSyncDeployWorkDriver(t *testing.T) {
+	klusterlet := newKlusterlet("klusterlet", "testns", "cluster1")
+	klusterlet.Spec.WorkConfiguration = &opratorapiv1.WorkAgentConfiguration{
+		WorkDriver:       opratorapiv1.WorkDriverTypeMqtt,
+		WorkDriverConfig: "mqtt-config",
+	}
+	bootStrapSecret := newSecret(helpers.BootstrapHubKubeConfig, "testns")
+	hubKubeConfigSecret := newSecret(helpers.HubKubeConfig, "testns")
+	hubKubeConfigSecret.Data["kubeconfig"] = []byte("dummuykubeconnfig")
+	namespace := newNamespace("testns")
+	controller := newTestController(klusterlet, nil, bootStrapSecret, hubKubeConfigSecret, namespace)
+	syncContext := testinghelper.NewFakeSyncContext(t, "klusterlet")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	workDeploymentFound := false
+	kubeActions := controller.kubeClient.Actions()
+	for _, action := range kubeActions {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		deployment, ok := action.(clienttesting.CreateActionImpl).Object.(*appsv1.Deployment)
+		if !ok || !strings.HasSuffix(deployment.Name, "work-agent") {
+			continue
+		}
+		workDeploymentFound = true
+
+		workDriverArgFound := false
+		for _, arg := range deployment.Spec.Template.Spec.Containers[0].Args {
+			if arg == "--work-driver=mqtt" {
+				workDriverArgFound = true
+			}
+		}
+		if !workDriverArgFound {
+			t.Errorf("Expect the work agent to have the work driver arg")
+		}
+
+		workDriverConfigVolumeFound := false
+		for _, volume := range deployment.Spec.Template.Spec.Volumes {
+			if volume.Secret != nil && volume.Secret.SecretName == "mqtt-config" {
+				workDriverConfigVolumeFound = true
+			}
+		}
+		if !workDriverConfigVolumeFound {
+			t.Errorf("Expect the work agent to mount the work driver config secret")
+		}
+	}
+	if !workDeploymentFound {
+		t.Errorf("Expect the work agent deployment to be created")
+	}
+}
+
+// TestSyncDeployWorkStatusSyncInterval tests that the status sync interval in the
+// work configuration is rendered into the work agent args
+func TestSyncDeployWorkStatusSyncInterval(t *testing.T) {
+	klusterlet := newKlusterlet("klusterlet", "testns", "cluster1")
+	klusterlet.Spec.WorkConfiguration = &opratorapiv1.WorkAgentConfiguration{
+		StatusSyncIntervalSeconds: 120,
+	}
+	bootStrapSecret := newSecret(helpers.BootstrapHubKubeConfig, "testns")
+	hubKubeConfigSecret := newSecret(helpers.HubKubeConfig, "testns")
+	hubKubeConfigSecret.Data["kubeconfig"] = []byte("dummuykubeconnfig")
+	namespace := newNamespace("testns")
+	controller := newTestController(klusterlet, nil, bootStrapSecret, hubKubeConfigSecret, namespace)
+	syncContext := testinghelper.NewFakeSyncContext(t, "klusterlet")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	workDeploymentFound := false
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		deployment, ok := action.(clienttesting.CreateActionImpl).Object.(*appsv1.Deployment)
+		if !ok || !strings.HasSuffix(deployment.Name, "work-agent") {
+			continue
+		}
+		workDeploymentFound = true
+
+		intervalArgFound := false
+		for _, arg := range deployment.Spec.Template.Spec.Containers[0].Args {
+			if arg == "--status-sync-interval=120s" {
+				intervalArgFound = true
+			}
+		}
+		if !intervalArgFound {
+			t.Errorf("Expect the work agent to have the status sync interval arg")
+		}
+	}
+	if !workDeploymentFound {
+		t.Errorf("Expect the work agent deployment to be created")
+	}
+}
+
+// TestSyncDeployRegistrationConfiguration tests that the cluster health check period,
+// the lease duration and the cluster annotations in the registration configuration are
+// rendered into the registration agent args
+func TestSyncDeployRegistrationConfiguration(t *testing.T) {
+	klusterlet := newKlusterlet("klusterlet", "testns", "cluster1")
+	klusterlet.Spec.RegistrationConfiguration = &opratorapiv1.RegistrationAgentConfiguration{
+		ClusterHealthCheckPeriodSeconds: 300,
+		LeaseDurationSeconds:            120,
+		ClusterAnnotations: map[string]string{
+			"owner":       "team-a",
+			"environment": "prod",
+		},
+	}
+	bootStrapSecret := newSecret(helpers.BootstrapHubKubeConfig, "testns")
+	hubKubeConfigSecret := newSecret(helpers.HubKubeConfig, "testns")
+	hubKubeConfigSecret.Data["kubeconfig"] = []byte("dummuykubeconnfig")
+	namespace := newNamespace("testns")
+	controller := newTestController(klusterlet, nil, bootStrapSecret, hubKubeConfigSecret, namespace)
+	syncContext := testinghelper.NewFakeSyncContext(t, "klusterlet")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	registrationDeploymentFound := false
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		deployment, ok := action.(clienttesting.CreateActionImpl).Object.(*appsv1.Deployment)
+		if !ok || !strings.HasSuffix(deployment.Name, "registration-agent") {
+			continue
+		}
+		registrationDeploymentFound = true
+
+		periodArgFound := false
+		leaseArgFound := false
+		annotationsArgFound := false
+		for _, arg := range deployment.Spec.Template.Spec.Containers[0].Args {
+			if arg == "--cluster-healthcheck-period=300s" {
+				periodArgFound = true
+			}
+			if arg == "--cluster-lease-duration-seconds=120" {
+				leaseArgFound = true
+			}
+			if arg == "--cluster-annotations=environment=prod,owner=team-a" {
+				annotationsArgFound = true
+			}
+		}
+		if !periodArgFound {
+			t.Errorf("Expect the registration agent to have the cluster health check period arg")
+		}
+		if !leaseArgFound {
+			t.Errorf("Expect the registration agent to have the cluster lease duration arg")
+		}
+		if !annotationsArgFound {
+			t.Errorf("Expect the registration agent to have the sorted cluster annotations arg")
+		}
+	}
+	if !registrationDeploymentFound {
+		t.Errorf("Expect the registration agent deployment to be created")
+	}
+}
+
+// TestSyncDeployHubConnectionTimeout tests that the hub connection timeout in spec
+// is rendered into the args of both agents
+func TestSyncDeployHubConnectionTimeout(t *testing.T) {
+	klusterlet := newKlusterlet("klusterlet", "testns", "cluster1")
+	klusterlet.Spec.HubConnectionTimeoutSeconds = 60
+	bootStrapSecret := newSecret(helpers.BootstrapHubKubeConfig, "testns")
+	hubKubeConfigSecret := newSecret(helpers.HubKubeConfig, "testns")
+	hubKubeConfigSecret.Data["kubeconfig"] = []byte("dummuykubeconnfig")
+	namespace := newNamespace("testns")
+	controller := newTestController(klusterlet, nil, bootStrapSecret, hubKubeConfigSecret, namespace)
+	syncContext := testinghelper.NewFakeSyncContext(t, "klusterlet")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	agentDeployments := 0
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		deployment, ok := action.(clienttesting.CreateActionImpl).Object.(*appsv1.Deployment)
+		if !ok || !strings.HasSuffix(deployment.Name, "-agent") {
+			continue
+		}
+		agentDeployments++
+
+		timeoutArgFound := false
+		for _, arg := range deployment.Spec.Template.Spec.Containers[0].Args {
+			if arg == "--hub-connection-timeout-seconds=60" {
+				timeoutArgFound = true
+			}
+		}
+		if !timeoutArgFound {
+			t.Errorf("Expect deployment %q to have the hub connection timeout arg", deployment.Name)
+		}
+	}
+	if agentDeployments != 2 {
+		t.Errorf("Expect both agent deployments to be created, actual %d", agentDeployments)
+	}
+}
+
 // TestSyncDelete test cleanup hub deploy
 func TestSyncDelete(t *testing.T) {
 	klusterlet := newKlusterlet("klusterlet", "testns", "")
@@ -338,8 +759,8 @@ func TestSyncDelete(t *testing.T) {
 		}
 	}
 
-	if len(deleteActions) != 14 {
-		t.Errorf("Expected 14 delete actions, but got %d", len(deleteActions))
+	if len(deleteActions) != 19 {
+		t.Errorf("Expected 19 delete actions, but got %d", len(deleteActions))
 	}
 
 	deleteCRDActions := []clienttesting.DeleteActionImpl{}
@@ -370,6 +791,233 @@ func TestSyncDelete(t *testing.T) {
 	}
 }
 
+// TestSyncDeleteKeepsSharedCRDs tests that deleting a klusterlet keeps the spoke
+// CRDs while another klusterlet on the same management cluster still relies on them
+func TestSyncDeleteKeepsSharedCRDs(t *testing.T) {
+	klusterlet := newKlusterlet("klusterlet", "testns", "")
+	now := metav1.Now()
+	klusterlet.ObjectMeta.SetDeletionTimestamp(&now)
+	bootstrapKubeConfigSecret := newSecret(helpers.BootstrapHubKubeConfig, "testns")
+	bootstrapKubeConfigSecret.Data["kubeconfig"] = newKubeConfig("testhost")
+	namespace := newNamespace("testns")
+	controller := newTestController(klusterlet, nil, namespace, bootstrapKubeConfigSecret)
+	controller.operatorStore.Add(newKlusterlet("klusterlet2", "testns2", ""))
+	syncContext := testinghelper.NewFakeSyncContext(t, "klusterlet")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	deleteActions := []clienttesting.DeleteActionImpl{}
+	kubeActions := controller.kubeClient.Actions()
+	for _, action := range kubeActions {
+		if action.GetVerb() == "delete" {
+			deleteAction := action.(clienttesting.DeleteActionImpl)
+			deleteActions = append(deleteActions, deleteAction)
+		}
+	}
+
+	if len(deleteActions) != 19 {
+		t.Errorf("Expected 19 delete actions, but got %d", len(deleteActions))
+	}
+
+	for _, action := range controller.apiExtensionClient.Actions() {
+		if action.GetVerb() == "delete" {
+			t.Errorf("Expected the shared CRDs to be kept while another klusterlet exists, got %#v", action)
+		}
+	}
+}
+
+// TestSyncUnmanaged tests that an Unmanaged klusterlet is not reconciled and the
+// deployed agents are left untouched
+func TestSyncUnmanaged(t *testing.T) {
+	klusterlet := newKlusterlet("klusterlet", "testns", "cluster1")
+	klusterlet.Spec.ManagementState = opratorapiv1.ManagementStateUnmanaged
+	namespace := newNamespace("testns")
+	controller := newTestController(klusterlet, nil, namespace)
+	syncContext := testinghelper.NewFakeSyncContext(t, "klusterlet")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() == "create" || action.GetVerb() == "delete" {
+			t.Errorf("Expected no resources touched for an unmanaged klusterlet, got %#v", action)
+		}
+	}
+
+	operatorActions := controller.operatorClient.Actions()
+	testinghelper.AssertEqualNumber(t, len(operatorActions), 2)
+	testinghelper.AssertGet(t, operatorActions[0], "operator.open-cluster-management.io", "v1", "klusterlets")
+	testinghelper.AssertAction(t, operatorActions[1], "update")
+	testinghelper.AssertOnlyConditions(
+		t, operatorActions[1].(clienttesting.UpdateActionImpl).Object,
+		testinghelper.NamedCondition(reconcilePaused, "Unmanaged", metav1.ConditionTrue))
+}
+
+// TestSyncRemoved tests that a Removed klusterlet tears the deployed agents down
+// but keeps the klusterlet and its finalizer
+func TestSyncRemoved(t *testing.T) {
+	klusterlet := newKlusterlet("klusterlet", "testns", "cluster1")
+	klusterlet.Spec.ManagementState = opratorapiv1.ManagementStateRemoved
+	bootstrapKubeConfigSecret := newSecret(helpers.BootstrapHubKubeConfig, "testns")
+	bootstrapKubeConfigSecret.Data["kubeconfig"] = newKubeConfig("testhost")
+	namespace := newNamespace("testns")
+	controller := newTestController(klusterlet, nil, namespace, bootstrapKubeConfigSecret)
+	syncContext := testinghelper.NewFakeSyncContext(t, "klusterlet")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	deleteActions := []clienttesting.DeleteActionImpl{}
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() == "create" {
+			t.Errorf("Expected no resources created for a removed klusterlet, got %#v", action)
+		}
+		if action.GetVerb() == "delete" {
+			deleteActions = append(deleteActions, action.(clienttesting.DeleteActionImpl))
+		}
+	}
+	// The same teardown as a deletion runs.
+	testinghelper.AssertEqualNumber(t, len(deleteActions), 19)
+
+	operatorActions := controller.operatorClient.Actions()
+	testinghelper.AssertGet(t, operatorActions[0], "operator.open-cluster-management.io", "v1", "klusterlets")
+	lastAction := operatorActions[len(operatorActions)-1]
+	testinghelper.AssertAction(t, lastAction, "update")
+	testinghelper.AssertOnlyConditions(
+		t, lastAction.(clienttesting.UpdateActionImpl).Object,
+		testinghelper.NamedCondition(klusterletApplied, "KlusterletRemoved", metav1.ConditionFalse),
+		testinghelper.NamedCondition(reconcilePaused, "Removed", metav1.ConditionTrue))
+
+	// The klusterlet and its finalizer stay, so the teardown is not a deletion and
+	// the agents can be reinstalled by setting the state back to Managed.
+	updated, err := controller.operatorClient.OperatorV1().Klusterlets().Get(context.Background(), "klusterlet", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected the klusterlet to be kept, but got %v", err)
+	}
+	hasFinalizer := false
+	for _, finalizer := range updated.Finalizers {
+		if finalizer == klusterletFinalizer {
+			hasFinalizer = true
+		}
+	}
+	if !hasFinalizer {
+		t.Errorf("Expected the finalizer to be kept, but got %v", updated.Finalizers)
+	}
+}
+
+// TestSyncDeleteAppliedResources tests that the operator itself removes the applied
+// resources recorded in the AppliedManifestWork status during the klusterlet deletion,
+// since the work agent is already gone and cannot run the graceful teardown
+func TestSyncDeleteAppliedResources(t *testing.T) {
+	klusterlet := newKlusterlet("klusterlet", "testns", "")
+	now := metav1.Now()
+	klusterlet.ObjectMeta.SetDeletionTimestamp(&now)
+	bootstrapKubeConfigSecret := newSecret(helpers.BootstrapHubKubeConfig, "testns")
+	bootstrapKubeConfigSecret.Data["kubeconfig"] = newKubeConfig("testhost")
+	namespace := newNamespace("testns")
+	appliedManifestWork := newAppliedManifestWorks("testhost", []string{appliedManifestWorkFinalizer}, false)
+	appliedManifestWork.Status.AppliedResources = []workapiv1.AppliedManifestResourceMeta{
+		{Version: "v1", Resource: "configmaps", Namespace: "default", Name: "test-configmap"},
+	}
+	controller := newTestController(klusterlet, []runtime.Object{appliedManifestWork}, namespace, bootstrapKubeConfigSecret)
+	syncContext := testinghelper.NewFakeSyncContext(t, "klusterlet")
+
+	if err := controller.controller.sync(nil, syncContext); err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	deleted := false
+	for _, action := range controller.dynamicClient.Actions() {
+		if action.GetVerb() != "delete" {
+			continue
+		}
+		deleteAction := action.(clienttesting.DeleteActionImpl)
+		if deleteAction.Resource.Resource == "configmaps" && deleteAction.Name == "test-configmap" {
+			deleted = true
+		}
+	}
+	if !deleted {
+		t.Errorf("Expected the applied resource to be deleted by the operator")
+	}
+}
+
+// TestSyncDeleteRetainHubCredentials tests that the hub kubeconfig secret and the
+// klusterlet namespace holding it survive the klusterlet deletion when the klusterlet
+// is configured to retain the hub credentials
+func TestSyncDeleteRetainHubCredentials(t *testing.T) {
+	klusterlet := newKlusterlet("klusterlet", "testns", "")
+	klusterlet.Spec.RetainHubCredentialsOnDelete = true
+	now := metav1.Now()
+	klusterlet.ObjectMeta.SetDeletionTimestamp(&now)
+	bootstrapKubeConfigSecret := newSecret(helpers.BootstrapHubKubeConfig, "testns")
+	bootstrapKubeConfigSecret.Data["kubeconfig"] = newKubeConfig("testhost")
+	namespace := newNamespace("testns")
+	controller := newTestController(klusterlet, nil, namespace, bootstrapKubeConfigSecret)
+	syncContext := testinghelper.NewFakeSyncContext(t, "klusterlet")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() != "delete" {
+			continue
+		}
+		deleteAction := action.(clienttesting.DeleteActionImpl)
+		if deleteAction.Resource.Resource == "secrets" && deleteAction.Name == helpers.HubKubeConfig {
+			t.Errorf("Expected the hub kubeconfig secret to be retained")
+		}
+		if deleteAction.Resource.Resource == "namespaces" && deleteAction.Name == "testns" {
+			t.Errorf("Expected the klusterlet namespace to be retained")
+		}
+	}
+}
+
+// TestSyncDeleteOrphanAddOnNamespace tests that the addon namespace survives the
+// klusterlet deletion when its cleanup policy orphans it
+func TestSyncDeleteOrphanAddOnNamespace(t *testing.T) {
+	klusterlet := newKlusterlet("klusterlet", "testns", "")
+	klusterlet.Spec.AddOnNamespaceCleanupPolicy = opratorapiv1.CleanupPolicyOrphan
+	now := metav1.Now()
+	klusterlet.ObjectMeta.SetDeletionTimestamp(&now)
+	namespace := newNamespace("testns")
+	controller := newTestController(klusterlet, nil, namespace)
+	syncContext := testinghelper.NewFakeSyncContext(t, "klusterlet")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	klusterletNamespaceDeleted := false
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() != "delete" {
+			continue
+		}
+		deleteAction := action.(clienttesting.DeleteActionImpl)
+		if deleteAction.Resource.Resource != "namespaces" {
+			continue
+		}
+		switch deleteAction.Name {
+		case "testns":
+			klusterletNamespaceDeleted = true
+		case "testns-addon":
+			t.Errorf("Expected the addon namespace to be orphaned")
+		}
+	}
+	if !klusterletNamespaceDeleted {
+		t.Errorf("Expected the klusterlet namespace to be deleted")
+	}
+}
+
 // TestGetServersFromKlusterlet tests getServersFromKlusterlet func
 func TestGetServersFromKlusterlet(t *testing.T) {
 	cases := []struct {
@@ -456,7 +1104,7 @@ func TestClusterNameChange(t *testing.T) {
 	if err != nil {
 		t.Errorf("Expected non error when sync, %v", err)
 	}
-	ensureDeployments(t, controller.kubeClient.Actions(), "update", "", "", "cluster1", 1)
+	ensureDeployments(t, controller.kubeClient.Actions(), "patch", "", "", "cluster1", 1)
 
 	// Update hubconfigsecret and sync again
 	hubSecret.Data["cluster-name"] = []byte("cluster2")
@@ -478,7 +1126,7 @@ func TestClusterNameChange(t *testing.T) {
 	if err != nil {
 		t.Errorf("Expected non error when sync, %v", err)
 	}
-	ensureDeployments(t, controller.kubeClient.Actions(), "update", "", "", "cluster2", 1)
+	ensureDeployments(t, controller.kubeClient.Actions(), "patch", "", "", "cluster2", 1)
 
 	// Update klusterlet with different cluster name and rerun sync
 	klusterlet = newKlusterlet("klusterlet", "testns", "cluster3")
@@ -492,7 +1140,7 @@ func TestClusterNameChange(t *testing.T) {
 	if err != nil {
 		t.Errorf("Expected non error when sync, %v", err)
 	}
-	ensureDeployments(t, controller.kubeClient.Actions(), "update", "https://localhost", "cluster3", "cluster3", 2)
+	ensureDeployments(t, controller.kubeClient.Actions(), "patch", "https://localhost", "cluster3", "cluster3", 2)
 }
 
 func TestSyncWithPullSecret(t *testing.T) {
@@ -501,7 +1149,7 @@ func TestSyncWithPullSecret(t *testing.T) {
 	hubKubeConfigSecret := newSecret(helpers.HubKubeConfig, "testns")
 	hubKubeConfigSecret.Data["kubeconfig"] = []byte("dummuykubeconnfig")
 	namespace := newNamespace("testns")
-	pullSecret := newSecret(imagePullSecret, "open-cluster-management")
+	pullSecret := newSecret(helpers.ImagePullSecret, "open-cluster-management")
 	controller := newTestController(klusterlet, nil, bootStrapSecret, hubKubeConfigSecret, namespace, pullSecret)
 	syncContext := testinghelper.NewFakeSyncContext(t, "klusterlet")
 
@@ -519,7 +1167,7 @@ func TestSyncWithPullSecret(t *testing.T) {
 		}
 	}
 
-	if createdSecret == nil || createdSecret.Name != imagePullSecret {
+	if createdSecret == nil || createdSecret.Name != helpers.ImagePullSecret {
 		t.Errorf("Failed to sync pull secret")
 	}
 }
@@ -588,8 +1236,140 @@ func TestDeployOnKube111(t *testing.T) {
 		}
 	}
 
-	if len(deleteActions) != 16 {
-		t.Errorf("Expected 16 delete actions, but got %d", len(kubeActions))
+	if len(deleteActions) != 21 {
+		t.Errorf("Expected 21 delete actions, but got %d", len(deleteActions))
+	}
+}
+
+// TestSyncWithBootstrapConfiguration tests that the bootstrap hub kubeconfig secret is
+// synthesized from the referenced token secret and CA bundle configmap
+func TestSyncWithBootstrapConfiguration(t *testing.T) {
+	klusterlet := newKlusterlet("klusterlet", "testns", "cluster1")
+	klusterlet.Spec.BootstrapConfiguration = &opratorapiv1.BootstrapConfiguration{
+		HubAPIServerURL:   "https://hub.test:6443",
+		CABundleConfigMap: "hub-ca-bundle",
+		TokenSecret:       "bootstrap-token",
+	}
+	namespace := newNamespace("testns")
+	tokenSecret := newSecret("bootstrap-token", "testns")
+	tokenSecret.Data["token"] = []byte("mybootstraptoken")
+	caBundleConfigMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "hub-ca-bundle", Namespace: "testns"},
+		Data:       map[string]string{"ca-bundle.crt": "mycabundle"},
+	}
+	controller := newTestController(klusterlet, nil, namespace, tokenSecret, caBundleConfigMap)
+	syncContext := testinghelper.NewFakeSyncContext(t, "klusterlet")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	var bootstrapSecret *corev1.Secret
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() != "create" {
+			continue
+		}
+		secret, ok := action.(clienttesting.CreateActionImpl).Object.(*corev1.Secret)
+		if ok && secret.Name == helpers.BootstrapHubKubeConfig {
+			bootstrapSecret = secret
+		}
+	}
+	if bootstrapSecret == nil {
+		t.Fatalf("Expected the bootstrap hub kubeconfig secret to be created")
+	}
+
+	kubeconfig, err := clientcmd.Load(bootstrapSecret.Data["kubeconfig"])
+	if err != nil {
+		t.Fatalf("Expected a valid kubeconfig in the bootstrap secret: %v", err)
+	}
+	if cluster := kubeconfig.Clusters["hub"]; cluster == nil || cluster.Server != "https://hub.test:6443" {
+		t.Errorf("Expected the hub url in the synthesized kubeconfig, got %#v", kubeconfig.Clusters)
+	} else if string(cluster.CertificateAuthorityData) != "mycabundle" {
+		t.Errorf("Expected the ca bundle in the synthesized kubeconfig, got %q", string(cluster.CertificateAuthorityData))
+	}
+	if authInfo := kubeconfig.AuthInfos["bootstrap"]; authInfo == nil || authInfo.Token != "mybootstraptoken" {
+		t.Errorf("Expected the bootstrap token in the synthesized kubeconfig, got %#v", kubeconfig.AuthInfos)
+	}
+}
+
+// TestSyncWithTrustedCABundle tests that the trusted CA bundle configmap referenced in
+// spec is mounted into the agent deployments
+func TestSyncWithTrustedCABundle(t *testing.T) {
+	klusterlet := newKlusterlet("klusterlet", "testns", "cluster1")
+	klusterlet.Spec.TrustedCABundleConfigMap = "my-trusted-ca"
+	bootStrapSecret := newSecret(helpers.BootstrapHubKubeConfig, "testns")
+	bootStrapSecret.Data["kubeconfig"] = newKubeConfig("testhost")
+	hubKubeConfigSecret := newSecret(helpers.HubKubeConfig, "testns")
+	hubKubeConfigSecret.Data["kubeconfig"] = newKubeConfig("testhost")
+	namespace := newNamespace("testns")
+	controller := newTestController(klusterlet, nil, bootStrapSecret, hubKubeConfigSecret, namespace)
+	syncContext := testinghelper.NewFakeSyncContext(t, "klusterlet")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	deploymentCount := 0
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() != "create" || action.GetResource().Resource != "deployments" {
+			continue
+		}
+		deploymentCount++
+		deployment := action.(clienttesting.CreateActionImpl).Object.(*appsv1.Deployment)
+		mounted := false
+		for _, volume := range deployment.Spec.Template.Spec.Volumes {
+			if volume.ConfigMap != nil && volume.ConfigMap.Name == "my-trusted-ca" {
+				mounted = true
+			}
+		}
+		if !mounted {
+			t.Errorf("Expected the trusted CA bundle to be mounted in deployment %s", deployment.Name)
+		}
+	}
+	if deploymentCount != 2 {
+		t.Errorf("Expected 2 agent deployments, actual %d", deploymentCount)
+	}
+}
+
+func TestSyncWithNamespaceMigration(t *testing.T) {
+	klusterlet := newKlusterlet("klusterlet", "newns", "cluster1")
+	oldNamespace := newNamespace("oldns")
+	oldNamespace.Labels = map[string]string{helpers.KlusterletOwnerLabel: "klusterlet"}
+	bootStrapSecret := newSecret(helpers.BootstrapHubKubeConfig, "oldns")
+	bootStrapSecret.Data["kubeconfig"] = newKubeConfig("testhost")
+	hubKubeConfigSecret := newSecret(helpers.HubKubeConfig, "oldns")
+	hubKubeConfigSecret.Data["kubeconfig"] = newKubeConfig("testhost")
+	controller := newTestController(klusterlet, nil, bootStrapSecret, hubKubeConfigSecret, oldNamespace)
+	syncContext := testinghelper.NewFakeSyncContext(t, "klusterlet")
+
+	err := controller.controller.sync(nil, syncContext)
+	if err != nil {
+		t.Errorf("Expected non error when sync, %v", err)
+	}
+
+	copiedSecrets := map[string]bool{}
+	namespaceDeleted := false
+	for _, action := range controller.kubeClient.Actions() {
+		if action.GetVerb() == "create" && action.GetResource().Resource == "secrets" {
+			secret := action.(clienttesting.CreateActionImpl).Object.(*corev1.Secret)
+			if secret.Namespace == "newns" {
+				copiedSecrets[secret.Name] = true
+			}
+		}
+		if action.GetVerb() == "delete" && action.GetResource().Resource == "namespaces" &&
+			action.(clienttesting.DeleteActionImpl).Name == "oldns" {
+			namespaceDeleted = true
+		}
+	}
+	for _, name := range []string{helpers.BootstrapHubKubeConfig, helpers.HubKubeConfig} {
+		if !copiedSecrets[name] {
+			t.Errorf("Expected secret %s to be copied into the new namespace", name)
+		}
+	}
+	if namespaceDeleted {
+		t.Errorf("Expected the former namespace to be kept until the migrated agents are available")
 	}
 }
 
@@ -0,0 +1,42 @@
+package klusterletcontroller
+
+import (
+	"github.com/openshift/library-go/pkg/assets"
+
+	operatorapiv1 "open-cluster-management.io/api/operator/v1"
+	"open-cluster-management.io/registration-operator/manifests"
+	"open-cluster-management.io/registration-operator/pkg/helpers"
+)
+
+// RenderManifests renders every manifest the operator would apply for the given
+// klusterlet without contacting a cluster. Values that are resolved from a live
+// cluster during a reconcile fall back to their defaults: the agent replica count is
+// a single replica instead of being derived from the node count, the v1 CRDs are
+// rendered regardless of the kube version and the digest pinning is skipped.
+func RenderManifests(klusterlet *operatorapiv1.Klusterlet, operatorNamespace string) ([]helpers.RenderedManifest, error) {
+	config := buildKlusterletConfig(klusterlet, operatorNamespace, singleReplica)
+
+	files := append([]string{}, crdV1StaticFiles...)
+	files = append(files, staticResourceFiles...)
+	if len(config.AllowedManifestResources) > 0 {
+		files = append(files, restrictedWorkRBACFiles...)
+	} else {
+		files = append(files, defaultWorkRBACFiles...)
+	}
+	files = append(files,
+		"klusterlet/klusterlet-registration-deployment.yaml",
+		"klusterlet/klusterlet-work-deployment.yaml")
+
+	rendered := []helpers.RenderedManifest{}
+	for _, file := range files {
+		template, err := manifests.KlusterletManifestFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		rendered = append(rendered, helpers.RenderedManifest{
+			Name: file,
+			Data: assets.MustCreateAssetFromTemplate(file, template, config).Data,
+		})
+	}
+	return rendered, nil
+}
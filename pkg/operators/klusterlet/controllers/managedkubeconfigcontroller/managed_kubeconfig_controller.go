@@ -0,0 +1,235 @@
+package managedkubeconfigcontroller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	certutil "k8s.io/client-go/util/cert"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+
+	operatorv1client "open-cluster-management.io/api/client/operator/clientset/versioned/typed/operator/v1"
+	operatorinformer "open-cluster-management.io/api/client/operator/informers/externalversions/operator/v1"
+	operatorlister "open-cluster-management.io/api/client/operator/listers/operator/v1"
+	operatorapiv1 "open-cluster-management.io/api/operator/v1"
+	"open-cluster-management.io/registration-operator/pkg/helpers"
+	"open-cluster-management.io/registration-operator/pkg/metrics"
+)
+
+const (
+	// managedClusterKubeConfigDegraded signals problems with the external managed
+	// kubeconfig a hosted mode klusterlet reaches its managed cluster with.
+	managedClusterKubeConfigDegraded = "ManagedClusterKubeConfigDegraded"
+
+	// managedClusterCheckTimeout bounds the calls against the managed cluster, so a
+	// single unreachable managed cluster does not stall the checks of the others.
+	managedClusterCheckTimeout = 10 * time.Second
+)
+
+// managedKubeConfigController periodically validates the external-managed-kubeconfig
+// secret of every hosted mode klusterlet: the secret must exist in the agent
+// namespace, hold a working kubeconfig, grant the permissions the agents need on the
+// managed cluster, and its client certificate must not be about to expire. The agent
+// pods keep running on the management cluster while their managed cluster credential
+// rots, so these failures only surface through the ManagedClusterKubeConfigDegraded
+// condition maintained here.
+type managedKubeConfigController struct {
+	kubeClient       kubernetes.Interface
+	klusterletClient operatorv1client.KlusterletInterface
+	klusterletLister operatorlister.KlusterletLister
+	// certExpiryWarningWindow is how long before the expiry of the client certificate
+	// of the external managed kubeconfig the condition starts warning.
+	certExpiryWarningWindow time.Duration
+}
+
+// NewManagedKubeConfigController creates the managed kubeconfig controller
+func NewManagedKubeConfigController(
+	kubeClient kubernetes.Interface,
+	klusterletClient operatorv1client.KlusterletInterface,
+	klusterletInformer operatorinformer.KlusterletInformer,
+	checkInterval time.Duration,
+	certExpiryWarningWindow time.Duration,
+	recorder events.Recorder) factory.Controller {
+	controller := &managedKubeConfigController{
+		kubeClient:              kubeClient,
+		klusterletClient:        klusterletClient,
+		klusterletLister:        klusterletInformer.Lister(),
+		certExpiryWarningWindow: certExpiryWarningWindow,
+	}
+	return factory.New().WithSync(metrics.InstrumentSyncer("ManagedKubeConfigController", controller.sync)).
+		WithInformersQueueKeyFunc(func(obj runtime.Object) string {
+			accessor, _ := meta.Accessor(obj)
+			return accessor.GetName()
+		}, klusterletInformer.Informer()).
+		// The external managed kubeconfig lives in the per-klusterlet agent namespace,
+		// so it is re-validated on every resync instead of through a dedicated informer.
+		ResyncEvery(checkInterval).
+		ToController("ManagedKubeConfigController", recorder)
+}
+
+func (m *managedKubeConfigController) sync(ctx context.Context, controllerContext factory.SyncContext) error {
+	klusterletName := controllerContext.QueueKey()
+	if klusterletName == "" {
+		return nil
+	}
+
+	// triggered by the periodic resync, re-check all klusterlets
+	if klusterletName == factory.DefaultQueueKey {
+		klusterlets, err := m.klusterletLister.List(labels.Everything())
+		if err != nil {
+			return err
+		}
+		for _, klusterlet := range klusterlets {
+			controllerContext.Queue().Add(klusterlet.Name)
+		}
+		return nil
+	}
+
+	klog.V(4).InfoS("Reconciling Klusterlet", "controller", "ManagedKubeConfigController", "klusterlet", klusterletName)
+
+	klusterlet, err := m.klusterletLister.Get(klusterletName)
+	switch {
+	case errors.IsNotFound(err):
+		return nil
+	case err != nil:
+		return err
+	}
+	if !klusterlet.DeletionTimestamp.IsZero() {
+		return nil
+	}
+
+	// The external managed kubeconfig only exists in hosted mode. Retire the
+	// condition when a klusterlet is switched out of hosted mode, and avoid any
+	// status write for the klusterlets that never were hosted.
+	if klusterlet.Spec.DeployOption.Mode != operatorapiv1.InstallModeHosted {
+		if meta.FindStatusCondition(klusterlet.Status.Conditions, managedClusterKubeConfigDegraded) == nil {
+			return nil
+		}
+		_, _, err := helpers.UpdateKlusterletStatus(ctx, m.klusterletClient, klusterletName,
+			func(status *operatorapiv1.KlusterletStatus) error {
+				meta.RemoveStatusCondition(&status.Conditions, managedClusterKubeConfigDegraded)
+				return nil
+			},
+			helpers.UpdateKlusterletSummaryFn())
+		return err
+	}
+
+	condition := checkManagedClusterKubeConfigCondition(
+		ctx, m.kubeClient, helpers.KlusterletAgentNamespace(klusterlet), m.certExpiryWarningWindow)
+
+	_, _, err = helpers.UpdateKlusterletStatus(ctx, m.klusterletClient, klusterletName,
+		helpers.UpdateKlusterletConditionFn(condition),
+		// recompute the scalar summary so the new condition is rolled up
+		helpers.UpdateKlusterletSummaryFn())
+	return err
+}
+
+// checkManagedClusterKubeConfigCondition validates the external managed kubeconfig
+// secret in the given agent namespace and reports the first problem found: a missing
+// secret, a kubeconfig no client can be built from, an expired or expiring client
+// certificate, an unreachable managed cluster, or missing permissions on it.
+func checkManagedClusterKubeConfigCondition(ctx context.Context, kubeClient kubernetes.Interface,
+	namespace string, warningWindow time.Duration) metav1.Condition {
+	condition := metav1.Condition{Type: managedClusterKubeConfigDegraded, Status: metav1.ConditionTrue}
+
+	secret, err := kubeClient.CoreV1().Secrets(namespace).Get(ctx, helpers.ExternalManagedKubeConfig, metav1.GetOptions{})
+	if err != nil {
+		condition.Reason = "ManagedClusterKubeConfigMissing"
+		condition.Message = fmt.Sprintf("Failed to get external managed kubeconfig secret %q %q: %v",
+			namespace, helpers.ExternalManagedKubeConfig, err)
+		return condition
+	}
+
+	restConfig, err := helpers.LoadClientConfigFromSecret(secret)
+	if err != nil {
+		condition.Reason = "ManagedClusterKubeConfigError"
+		condition.Message = fmt.Sprintf("Failed to load external managed kubeconfig secret %q %q: %v",
+			namespace, helpers.ExternalManagedKubeConfig, err)
+		return condition
+	}
+	restConfig.Timeout = managedClusterCheckTimeout
+
+	// The expiry of the client certificate is checked before any call, so an expired
+	// credential is named instead of showing up as a generic Unauthorized. The
+	// certificate is embedded in the kubeconfig or stored under the tls.crt key of
+	// the secret; kubeconfigs with other credential types, e.g. a token, carry none.
+	certData := restConfig.TLSClientConfig.CertData
+	if len(certData) == 0 {
+		certData = secret.Data["tls.crt"]
+	}
+	var certNotAfter *time.Time
+	if certs, err := certutil.ParseCertsPEM(certData); err == nil && len(certs) > 0 {
+		notAfter := certs[0].NotAfter
+		for _, cert := range certs[1:] {
+			if cert.NotAfter.Before(notAfter) {
+				notAfter = cert.NotAfter
+			}
+		}
+		certNotAfter = &notAfter
+		if time.Now().After(notAfter) {
+			condition.Reason = "CertificateExpired"
+			condition.Message = fmt.Sprintf("The client certificate of external managed kubeconfig secret %q %q expired at %v",
+				namespace, helpers.ExternalManagedKubeConfig, notAfter.UTC().Format(time.RFC3339))
+			return condition
+		}
+	}
+
+	managedClusterClient, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		condition.Reason = "ManagedClusterKubeConfigError"
+		condition.Message = fmt.Sprintf("Failed to build managed cluster client with external managed kubeconfig secret %q %q: %v",
+			namespace, helpers.ExternalManagedKubeConfig, err)
+		return condition
+	}
+
+	missing, err := helpers.MissingOperatorPermissions(ctx, managedClusterClient, managedClusterRequiredPermissions())
+	if err != nil {
+		condition.Reason = "ManagedClusterUnreachable"
+		condition.Message = fmt.Sprintf("Failed to reach the managed cluster with external managed kubeconfig secret %q %q: %v",
+			namespace, helpers.ExternalManagedKubeConfig, err)
+		return condition
+	}
+	if len(missing) > 0 {
+		condition.Reason = "ManagedClusterKubeConfigUnauthorized"
+		condition.Message = fmt.Sprintf("The external managed kubeconfig secret %q %q is not allowed to: %s",
+			namespace, helpers.ExternalManagedKubeConfig, strings.Join(missing, ", "))
+		return condition
+	}
+
+	if certNotAfter != nil && time.Until(*certNotAfter) < warningWindow {
+		condition.Reason = "CertificateExpiring"
+		condition.Message = fmt.Sprintf("The client certificate of external managed kubeconfig secret %q %q expires at %v",
+			namespace, helpers.ExternalManagedKubeConfig, certNotAfter.UTC().Format(time.RFC3339))
+		return condition
+	}
+
+	condition.Status = metav1.ConditionFalse
+	condition.Reason = "ManagedClusterKubeConfigValid"
+	condition.Message = "The external managed kubeconfig is valid and the managed cluster is reachable"
+	return condition
+}
+
+// managedClusterRequiredPermissions lists the RBAC the agents of a hosted klusterlet
+// need on the managed cluster: the work agent tracks its applied resources through
+// appliedmanifestworks there and both agents emit events.
+func managedClusterRequiredPermissions() []helpers.OperatorPermission {
+	permissions := []helpers.OperatorPermission{}
+	for _, verb := range []string{"create", "get", "list", "update", "watch"} {
+		permissions = append(permissions, helpers.OperatorPermission{
+			Group:    "work.open-cluster-management.io",
+			Resource: "appliedmanifestworks",
+			Verb:     verb,
+		})
+	}
+	return append(permissions, helpers.OperatorPermission{Resource: "events", Verb: "create"})
+}
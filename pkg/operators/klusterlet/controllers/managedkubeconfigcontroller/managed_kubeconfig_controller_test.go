@@ -0,0 +1,255 @@
+package managedkubeconfigcontroller
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	clientcmdlatest "k8s.io/client-go/tools/clientcmd/api/latest"
+
+	fakeoperatorclient "open-cluster-management.io/api/client/operator/clientset/versioned/fake"
+	operatorinformers "open-cluster-management.io/api/client/operator/informers/externalversions"
+	operatorapiv1 "open-cluster-management.io/api/operator/v1"
+	"open-cluster-management.io/registration-operator/pkg/helpers"
+	testinghelper "open-cluster-management.io/registration-operator/pkg/helpers/testing"
+)
+
+type testController struct {
+	controller     *managedKubeConfigController
+	operatorClient *fakeoperatorclient.Clientset
+}
+
+func newKlusterlet(name string, mode operatorapiv1.InstallMode) *operatorapiv1.Klusterlet {
+	return &operatorapiv1.Klusterlet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: operatorapiv1.KlusterletSpec{
+			DeployOption: operatorapiv1.KlusterletDeployOption{
+				Mode: mode,
+			},
+		},
+	}
+}
+
+func newKubeConfig(host string) []byte {
+	configData, _ := runtime.Encode(clientcmdlatest.Codec, &clientcmdapi.Config{
+		Clusters: map[string]*clientcmdapi.Cluster{"default-cluster": {
+			Server:                host,
+			InsecureSkipTLSVerify: true,
+		}},
+		Contexts: map[string]*clientcmdapi.Context{"default-context": {
+			Cluster: "default-cluster",
+		}},
+		CurrentContext: "default-context",
+	})
+	return configData
+}
+
+func newKubeConfigSecret(namespace string, kubeConfig []byte) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      helpers.ExternalManagedKubeConfig,
+			Namespace: namespace,
+		},
+		Data: map[string][]byte{"kubeconfig": kubeConfig},
+	}
+}
+
+// newCertSecret returns an external managed kubeconfig secret whose client
+// certificate expires at the given time.
+func newCertSecret(t *testing.T, namespace, host string, notAfter time.Time) *corev1.Secret {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Expected no error when generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Expected no error when creating certificate: %v", err)
+	}
+	secret := newKubeConfigSecret(namespace, newKubeConfig(host))
+	secret.Data["tls.crt"] = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	return secret
+}
+
+func newTestController(klusterlet *operatorapiv1.Klusterlet, objects ...runtime.Object) *testController {
+	fakeKubeClient := fakekube.NewSimpleClientset(objects...)
+	fakeOperatorClient := fakeoperatorclient.NewSimpleClientset(klusterlet)
+	operatorInformers := operatorinformers.NewSharedInformerFactory(fakeOperatorClient, 5*time.Minute)
+
+	controller := &managedKubeConfigController{
+		kubeClient:              fakeKubeClient,
+		klusterletClient:        fakeOperatorClient.OperatorV1().Klusterlets(),
+		klusterletLister:        operatorInformers.Operator().V1().Klusterlets().Lister(),
+		certExpiryWarningWindow: 7 * 24 * time.Hour,
+	}
+
+	store := operatorInformers.Operator().V1().Klusterlets().Informer().GetStore()
+	store.Add(klusterlet)
+
+	return &testController{
+		controller:     controller,
+		operatorClient: fakeOperatorClient,
+	}
+}
+
+func TestSync(t *testing.T) {
+	response := &struct {
+		allowToOperateAppliedManifestWorks bool
+	}{}
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		data, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		ssar := &authorizationv1.SelfSubjectAccessReview{}
+		json.Unmarshal(data, ssar)
+		if ssar.Spec.ResourceAttributes.Resource == "appliedmanifestworks" {
+			ssar.Status.Allowed = response.allowToOperateAppliedManifestWorks
+		} else {
+			ssar.Status.Allowed = true
+		}
+
+		w.Header().Set("Content-type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(ssar)
+	}))
+	defer apiServer.Close()
+
+	// agent namespace of a hosted klusterlet named "testklusterlet"
+	agentNamespace := "klusterlet-testklusterlet"
+
+	cases := []struct {
+		name                               string
+		objects                            []runtime.Object
+		klusterlet                         *operatorapiv1.Klusterlet
+		allowToOperateAppliedManifestWorks bool
+		expectedConditions                 []metav1.Condition
+	}{
+		{
+			name:       "no external managed kubeconfig secret",
+			klusterlet: newKlusterlet("testklusterlet", operatorapiv1.InstallModeHosted),
+			expectedConditions: []metav1.Condition{
+				testinghelper.NamedCondition(managedClusterKubeConfigDegraded, "ManagedClusterKubeConfigMissing", metav1.ConditionTrue),
+			},
+		},
+		{
+			name:       "bad external managed kubeconfig secret",
+			objects:    []runtime.Object{newKubeConfigSecret(agentNamespace, []byte("badkubeconfig"))},
+			klusterlet: newKlusterlet("testklusterlet", operatorapiv1.InstallModeHosted),
+			expectedConditions: []metav1.Condition{
+				testinghelper.NamedCondition(managedClusterKubeConfigDegraded, "ManagedClusterKubeConfigError", metav1.ConditionTrue),
+			},
+		},
+		{
+			name:       "expired client certificate",
+			objects:    []runtime.Object{newCertSecret(t, agentNamespace, apiServer.URL, time.Now().Add(-time.Hour))},
+			klusterlet: newKlusterlet("testklusterlet", operatorapiv1.InstallModeHosted),
+			expectedConditions: []metav1.Condition{
+				testinghelper.NamedCondition(managedClusterKubeConfigDegraded, "CertificateExpired", metav1.ConditionTrue),
+			},
+		},
+		{
+			name:                               "expiring client certificate",
+			objects:                            []runtime.Object{newCertSecret(t, agentNamespace, apiServer.URL, time.Now().Add(time.Hour))},
+			klusterlet:                         newKlusterlet("testklusterlet", operatorapiv1.InstallModeHosted),
+			allowToOperateAppliedManifestWorks: true,
+			expectedConditions: []metav1.Condition{
+				testinghelper.NamedCondition(managedClusterKubeConfigDegraded, "CertificateExpiring", metav1.ConditionTrue),
+			},
+		},
+		{
+			name:       "unauthorized external managed kubeconfig",
+			objects:    []runtime.Object{newKubeConfigSecret(agentNamespace, newKubeConfig(apiServer.URL))},
+			klusterlet: newKlusterlet("testklusterlet", operatorapiv1.InstallModeHosted),
+			expectedConditions: []metav1.Condition{
+				testinghelper.NamedCondition(managedClusterKubeConfigDegraded, "ManagedClusterKubeConfigUnauthorized", metav1.ConditionTrue),
+			},
+		},
+		{
+			name:                               "valid external managed kubeconfig",
+			objects:                            []runtime.Object{newKubeConfigSecret(agentNamespace, newKubeConfig(apiServer.URL))},
+			klusterlet:                         newKlusterlet("testklusterlet", operatorapiv1.InstallModeHosted),
+			allowToOperateAppliedManifestWorks: true,
+			expectedConditions: []metav1.Condition{
+				testinghelper.NamedCondition(managedClusterKubeConfigDegraded, "ManagedClusterKubeConfigValid", metav1.ConditionFalse),
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			controller := newTestController(c.klusterlet, c.objects...)
+			syncContext := testinghelper.NewFakeSyncContext(t, c.klusterlet.Name)
+
+			response.allowToOperateAppliedManifestWorks = c.allowToOperateAppliedManifestWorks
+
+			err := controller.controller.sync(context.TODO(), syncContext)
+			if err != nil {
+				t.Errorf("Expected no error when update status: %v", err)
+			}
+			operatorActions := controller.operatorClient.Actions()
+
+			testinghelper.AssertEqualNumber(t, len(operatorActions), 2)
+			testinghelper.AssertGet(t, operatorActions[0], "operator.open-cluster-management.io", "v1", "klusterlets")
+			testinghelper.AssertAction(t, operatorActions[1], "update")
+			testinghelper.AssertOnlyConditions(t, operatorActions[1].(clienttesting.UpdateActionImpl).Object, c.expectedConditions...)
+		})
+	}
+}
+
+func TestSyncNonHostedKlusterlet(t *testing.T) {
+	// klusterlets that are not in hosted mode must not get the condition at all
+	klusterlet := newKlusterlet("testklusterlet", operatorapiv1.InstallModeDefault)
+	controller := newTestController(klusterlet)
+
+	if err := controller.controller.sync(context.TODO(), testinghelper.NewFakeSyncContext(t, klusterlet.Name)); err != nil {
+		t.Errorf("Expected no error when sync: %v", err)
+	}
+	testinghelper.AssertEqualNumber(t, len(controller.operatorClient.Actions()), 0)
+
+	// a stale condition from a previous hosted deployment is retired
+	klusterlet = newKlusterlet("testklusterlet", operatorapiv1.InstallModeDefault)
+	klusterlet.Status.Conditions = []metav1.Condition{
+		testinghelper.NamedCondition(managedClusterKubeConfigDegraded, "ManagedClusterKubeConfigMissing", metav1.ConditionTrue),
+	}
+	controller = newTestController(klusterlet)
+
+	if err := controller.controller.sync(context.TODO(), testinghelper.NewFakeSyncContext(t, klusterlet.Name)); err != nil {
+		t.Errorf("Expected no error when sync: %v", err)
+	}
+	operatorActions := controller.operatorClient.Actions()
+	testinghelper.AssertEqualNumber(t, len(operatorActions), 2)
+	testinghelper.AssertAction(t, operatorActions[1], "update")
+	testinghelper.AssertOnlyConditions(t, operatorActions[1].(clienttesting.UpdateActionImpl).Object)
+}
@@ -0,0 +1,49 @@
+package migrationcontroller
+
+import (
+	"context"
+	"time"
+
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/client-go/dynamic"
+
+	"open-cluster-management.io/registration-operator/pkg/helpers"
+	"open-cluster-management.io/registration-operator/pkg/metrics"
+)
+
+// klusterletCRDName is the CRD of the operator itself. Its storage version is
+// migrated directly by the operator, since managed clusters do not run the
+// kube-storage-version-migrator.
+const klusterletCRDName = "klusterlets.operator.open-cluster-management.io"
+
+var ResyncInterval = time.Minute * 5
+
+// crdMigrationController rewrites the objects of the klusterlets CRD at its current
+// storage version and prunes the legacy versions from its storedVersions, so an
+// operator upgrade across an API version bump needs no manual intervention.
+type crdMigrationController struct {
+	dynamicClient      dynamic.Interface
+	apiExtensionClient apiextensionsclient.Interface
+}
+
+// NewCRDMigrationController returns a crdMigrationController
+func NewCRDMigrationController(
+	dynamicClient dynamic.Interface,
+	apiExtensionClient apiextensionsclient.Interface,
+	recorder events.Recorder) factory.Controller {
+	controller := &crdMigrationController{
+		dynamicClient:      dynamicClient,
+		apiExtensionClient: apiExtensionClient,
+	}
+
+	return factory.New().
+		ResyncEvery(ResyncInterval).
+		WithSync(metrics.InstrumentSyncer("KlusterletCRDMigrationController", controller.sync)).
+		ToController("KlusterletCRDMigrationController", recorder)
+}
+
+func (c *crdMigrationController) sync(ctx context.Context, controllerContext factory.SyncContext) error {
+	return helpers.MigrateCRDStorageVersion(ctx, c.apiExtensionClient, c.dynamicClient, klusterletCRDName, controllerContext.Recorder())
+}
@@ -0,0 +1,123 @@
+package migrationcontroller
+
+import (
+	"context"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	fakeapiextensions "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+
+	testinghelper "open-cluster-management.io/registration-operator/pkg/helpers/testing"
+)
+
+var klusterletGVR = schema.GroupVersionResource{
+	Group:    "operator.open-cluster-management.io",
+	Version:  "v1",
+	Resource: "klusterlets",
+}
+
+func newKlusterletCRD(storedVersions ...string) *apiextensionsv1.CustomResourceDefinition {
+	versions := []apiextensionsv1.CustomResourceDefinitionVersion{}
+	for index, version := range storedVersions {
+		versions = append(versions, apiextensionsv1.CustomResourceDefinitionVersion{
+			Name:    version,
+			Storage: index == len(storedVersions)-1,
+		})
+	}
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: klusterletCRDName,
+		},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group:    klusterletGVR.Group,
+			Names:    apiextensionsv1.CustomResourceDefinitionNames{Plural: klusterletGVR.Resource},
+			Versions: versions,
+		},
+		Status: apiextensionsv1.CustomResourceDefinitionStatus{
+			StoredVersions: storedVersions,
+		},
+	}
+}
+
+func newUnstructuredKlusterlet(name string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "operator.open-cluster-management.io/v1",
+			"kind":       "Klusterlet",
+			"metadata": map[string]interface{}{
+				"name": name,
+			},
+		},
+	}
+}
+
+func TestSync(t *testing.T) {
+	cases := []struct {
+		name            string
+		crds            []runtime.Object
+		klusterlets     []runtime.Object
+		expectedUpdates int
+		expectedPruned  bool
+	}{
+		{
+			name: "klusterlets crd not found",
+		},
+		{
+			name: "already at the storage version",
+			crds: []runtime.Object{newKlusterletCRD("v1")},
+		},
+		{
+			name:            "prune the stored versions",
+			crds:            []runtime.Object{newKlusterletCRD("v1beta1", "v1")},
+			klusterlets:     []runtime.Object{newUnstructuredKlusterlet("klusterlet")},
+			expectedUpdates: 1,
+			expectedPruned:  true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fakeDynamicClient := fakedynamic.NewSimpleDynamicClientWithCustomListKinds(
+				runtime.NewScheme(),
+				map[schema.GroupVersionResource]string{klusterletGVR: "KlusterletList"},
+				c.klusterlets...)
+			fakeAPIExtensionClient := fakeapiextensions.NewSimpleClientset(c.crds...)
+
+			controller := &crdMigrationController{
+				dynamicClient:      fakeDynamicClient,
+				apiExtensionClient: fakeAPIExtensionClient,
+			}
+
+			syncContext := testinghelper.NewFakeSyncContext(t, "")
+			if err := controller.sync(context.TODO(), syncContext); err != nil {
+				t.Fatalf("Expected no error when sync: %v", err)
+			}
+
+			updates := 0
+			for _, action := range fakeDynamicClient.Actions() {
+				if action.GetVerb() == "update" {
+					updates++
+				}
+			}
+			if updates != c.expectedUpdates {
+				t.Errorf("Expected %d updates, but got %d", c.expectedUpdates, updates)
+			}
+
+			if !c.expectedPruned {
+				return
+			}
+			crd, err := fakeAPIExtensionClient.ApiextensionsV1().CustomResourceDefinitions().Get(context.TODO(), klusterletCRDName, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("Expected no error when getting crd: %v", err)
+			}
+			if len(crd.Status.StoredVersions) != 1 || crd.Status.StoredVersions[0] != "v1" {
+				t.Errorf("Expected stored versions to be pruned, but got %v", crd.Status.StoredVersions)
+			}
+		})
+	}
+}
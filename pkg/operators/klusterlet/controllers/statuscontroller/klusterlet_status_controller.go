@@ -2,20 +2,28 @@ package statuscontroller
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
+	"net/url"
 	"strings"
+	"sync"
+	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
 	authorizationv1 "k8s.io/api/authorization/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	appsinformer "k8s.io/client-go/informers/apps/v1"
 	coreinformer "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	appslister "k8s.io/client-go/listers/apps/v1"
-	corelister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	certutil "k8s.io/client-go/util/cert"
 	"k8s.io/klog/v2"
 
 	"github.com/openshift/library-go/pkg/controller/factory"
@@ -24,23 +32,51 @@ import (
 	operatorv1client "open-cluster-management.io/api/client/operator/clientset/versioned/typed/operator/v1"
 	operatorinformer "open-cluster-management.io/api/client/operator/informers/externalversions/operator/v1"
 	operatorlister "open-cluster-management.io/api/client/operator/listers/operator/v1"
+	operatorapiv1 "open-cluster-management.io/api/operator/v1"
 	"open-cluster-management.io/registration-operator/pkg/helpers"
+	"open-cluster-management.io/registration-operator/pkg/metrics"
 )
 
 type klusterletStatusController struct {
 	kubeClient       kubernetes.Interface
-	secretLister     corelister.SecretLister
 	deploymentLister appslister.DeploymentLister
 	klusterletClient operatorv1client.KlusterletInterface
 	klusterletLister operatorlister.KlusterletLister
+	// checkInterval is the cadence of the periodic hub connectivity checks and the
+	// upper bound of the retry backoff while the hub is unreachable.
+	checkInterval time.Duration
+	// certExpiryWarningWindow is how long before the expiry of the hub kubeconfig
+	// client certificate the HubKubeConfigExpiring condition is raised.
+	certExpiryWarningWindow time.Duration
+
+	// hubUnreachableBackoff holds the next retry delay per klusterlet while the hub
+	// cannot be reached. The delays grow exponentially and are reset once a check
+	// succeeds again.
+	backoffLock           sync.Mutex
+	hubUnreachableBackoff map[string]time.Duration
+
+	// checkOperatorPermissions returns the RBAC the operator itself is missing on
+	// the managed cluster, unlike the agent checks above which review the agent
+	// permissions on the hub. It is a field so tests can run the controller without
+	// an authorization API; a nil check disables the OperatorPermissionDegraded
+	// condition.
+	checkOperatorPermissions func(ctx context.Context) ([]string, error)
 }
 
 const (
-	klusterletNamespace            = "open-cluster-management-agent"
 	klusterletRegistration         = "Registration"
 	klusterletWork                 = "Work"
 	klusterletRegistrationDegraded = "KlusterletRegistrationDegraded"
 	klusterletWorKDegraded         = "KlusterletWorkDegraded"
+	hubKubeConfigExpiring          = "HubKubeConfigExpiring"
+
+	// baseHubUnreachableDelay is the first retry delay after a hub connectivity
+	// check failed.
+	baseHubUnreachableDelay = 10 * time.Second
+
+	// defaultHubConnectionTimeout bounds the calls of the hub connectivity checks
+	// when spec.hubConnectionTimeoutSeconds is not set on the klusterlet.
+	defaultHubConnectionTimeout = 10 * time.Second
 )
 
 // NewKlusterletStatusController returns a klusterletStatusController
@@ -48,23 +84,33 @@ func NewKlusterletStatusController(
 	kubeClient kubernetes.Interface,
 	klusterletClient operatorv1client.KlusterletInterface,
 	klusterletInformer operatorinformer.KlusterletInformer,
-	secretInformer coreinformer.SecretInformer,
+	bootstrapSecretInformer coreinformer.SecretInformer,
+	hubSecretInformer coreinformer.SecretInformer,
 	deploymentInformer appsinformer.DeploymentInformer,
+	checkInterval time.Duration,
+	certExpiryWarningWindow time.Duration,
 	recorder events.Recorder) factory.Controller {
 	controller := &klusterletStatusController{
-		kubeClient:       kubeClient,
-		klusterletClient: klusterletClient,
-		secretLister:     secretInformer.Lister(),
-		deploymentLister: deploymentInformer.Lister(),
-		klusterletLister: klusterletInformer.Lister(),
-	}
-	return factory.New().WithSync(controller.sync).
-		WithInformersQueueKeyFunc(helpers.KlusterletSecretQueueKeyFunc(controller.klusterletLister), secretInformer.Informer()).
+		kubeClient:              kubeClient,
+		klusterletClient:        klusterletClient,
+		deploymentLister:        deploymentInformer.Lister(),
+		klusterletLister:        klusterletInformer.Lister(),
+		checkInterval:           checkInterval,
+		certExpiryWarningWindow: certExpiryWarningWindow,
+		hubUnreachableBackoff:   map[string]time.Duration{},
+		checkOperatorPermissions: func(ctx context.Context) ([]string, error) {
+			return helpers.MissingOperatorPermissions(ctx, kubeClient, helpers.OperatorRequiredPermissions())
+		},
+	}
+	return factory.New().WithSync(metrics.InstrumentSyncer("KlusterletStatusController", controller.sync)).
+		WithInformersQueueKeyFunc(helpers.KlusterletSecretQueueKeyFunc(controller.klusterletLister),
+			bootstrapSecretInformer.Informer(), hubSecretInformer.Informer()).
 		WithInformersQueueKeyFunc(helpers.KlusterletDeploymentQueueKeyFunc(controller.klusterletLister), deploymentInformer.Informer()).
 		WithInformersQueueKeyFunc(func(obj runtime.Object) string {
 			accessor, _ := meta.Accessor(obj)
 			return accessor.GetName()
 		}, klusterletInformer.Informer()).
+		ResyncEvery(checkInterval).
 		ToController("KlusterletStatusController", recorder)
 }
 
@@ -73,7 +119,20 @@ func (k *klusterletStatusController) sync(ctx context.Context, controllerContext
 	if klusterletName == "" {
 		return nil
 	}
-	klog.V(4).Infof("Reconciling Klusterlet %q", klusterletName)
+
+	// triggered by the periodic resync, re-check all klusterlets
+	if klusterletName == factory.DefaultQueueKey {
+		klusterlets, err := k.klusterletLister.List(labels.Everything())
+		if err != nil {
+			return err
+		}
+		for _, klusterlet := range klusterlets {
+			controllerContext.Queue().Add(klusterlet.Name)
+		}
+		return nil
+	}
+
+	klog.V(4).InfoS("Reconciling Klusterlet", "controller", "KlusterletStatusController", "klusterlet", klusterletName)
 
 	klusterlet, err := k.klusterletLister.Get(klusterletName)
 	switch {
@@ -84,19 +143,25 @@ func (k *klusterletStatusController) sync(ctx context.Context, controllerContext
 	}
 	klusterlet = klusterlet.DeepCopy()
 
-	klusterletNS := klusterlet.Spec.Namespace
-	if klusterletNS == "" {
-		klusterletNS = klusterletNamespace
+	klusterletNS := helpers.KlusterletAgentNamespace(klusterlet)
+
+	// A klusterlet on a high-latency link can raise the timeout of the connectivity
+	// checks, so slow hub responses are not reported as a degraded hub connection.
+	hubConnectionTimeout := defaultHubConnectionTimeout
+	if klusterlet.Spec.HubConnectionTimeoutSeconds > 0 {
+		hubConnectionTimeout = time.Duration(klusterlet.Spec.HubConnectionTimeoutSeconds) * time.Second
 	}
 
 	registrationDegradedCondition := checkAgentDegradedCondition(
 		ctx, k.kubeClient,
 		klusterletRegistration, klusterletRegistrationDegraded,
 		klusterletAgent{
-			clusterName:    klusterlet.Spec.ClusterName,
-			deploymentName: fmt.Sprintf("%s-registration-agent", klusterlet.Name),
-			namespace:      klusterletNS,
-			getSSARFunc:    getRegistrationSelfSubjectAccessReviews,
+			clusterName:             klusterlet.Spec.ClusterName,
+			deploymentName:          fmt.Sprintf("%s-registration-agent", klusterlet.Name),
+			namespace:               klusterletNS,
+			hubKubeConfigSecretName: helpers.HubKubeConfigSecretName(klusterlet),
+			hubConnectionTimeout:    hubConnectionTimeout,
+			getSSARFunc:             getRegistrationSelfSubjectAccessReviews,
 		},
 		[]degradedCheckFunc{checkBootstrapSecret, checkHubConfigSecret, checkAgentDeployment},
 	)
@@ -104,26 +169,153 @@ func (k *klusterletStatusController) sync(ctx context.Context, controllerContext
 		ctx, k.kubeClient,
 		klusterletWork, klusterletWorKDegraded,
 		klusterletAgent{
-			clusterName:    klusterlet.Spec.ClusterName,
-			deploymentName: fmt.Sprintf("%s-work-agent", klusterlet.Name),
-			namespace:      klusterletNS,
-			getSSARFunc:    getWorkSelfSubjectAccessReviews,
+			clusterName:             klusterlet.Spec.ClusterName,
+			deploymentName:          fmt.Sprintf("%s-work-agent", klusterlet.Name),
+			namespace:               klusterletNS,
+			hubKubeConfigSecretName: helpers.HubKubeConfigSecretName(klusterlet),
+			hubConnectionTimeout:    hubConnectionTimeout,
+			getSSARFunc:             getWorkSelfSubjectAccessReviews,
 		},
 		[]degradedCheckFunc{checkHubConfigSecret, checkAgentDeployment},
 	)
 
-	_, _, err = helpers.UpdateKlusterletStatus(ctx, k.klusterletClient, klusterletName,
+	expiringCondition, certNotAfter := checkHubKubeConfigExpiringCondition(
+		ctx, k.kubeClient, klusterletNS, helpers.HubKubeConfigSecretName(klusterlet), k.certExpiryWarningWindow)
+	if certNotAfter != nil {
+		metrics.SetHubKubeConfigExpiry(klusterletName, *certNotAfter)
+	}
+
+	// Requeue explicitly while the hub is unreachable. The delay grows exponentially
+	// up to the check interval and is jittered, so a fleet of hosted klusterlets
+	// spreads its retries instead of hitting a recovering hub in lockstep.
+	if hubUnreachable(registrationDegradedCondition, workDegradedCondition) {
+		controllerContext.Queue().AddAfter(klusterletName, k.nextHubUnreachableDelay(klusterletName))
+	} else {
+		k.resetHubUnreachableDelay(klusterletName)
+	}
+
+	updateFuncs := []helpers.UpdateKlusterletStatusFunc{
 		helpers.UpdateKlusterletConditionFn(registrationDegradedCondition),
 		helpers.UpdateKlusterletConditionFn(workDegradedCondition),
-	)
+		helpers.UpdateKlusterletConditionFn(expiringCondition),
+	}
+
+	// Verify the operator still holds the RBAC it needs, so a permission stripped
+	// after install shows up as a condition instead of silent reconcile failures.
+	if k.checkOperatorPermissions != nil {
+		updateFuncs = append(updateFuncs, helpers.UpdateKlusterletConditionFn(helpers.OperatorPermissionCondition(ctx, k.checkOperatorPermissions)))
+	}
+
+	// The scalar summary fields must be recomputed last, so they roll up the
+	// conditions as they are written by this update.
+	registeredHub := registeredHubURL(ctx, k.kubeClient, klusterletNS, helpers.HubKubeConfigSecretName(klusterlet))
+	updateFuncs = append(updateFuncs,
+		func(status *operatorapiv1.KlusterletStatus) error {
+			status.RegisteredHub = registeredHub
+			return nil
+		},
+		helpers.UpdateKlusterletSummaryFn())
+
+	_, _, err = helpers.UpdateKlusterletStatus(ctx, k.klusterletClient, klusterletName, updateFuncs...)
 	return err
 }
 
+// checkHubKubeConfigExpiringCondition parses the client certificate of the hub
+// kubeconfig secret and warns within the given window before it expires, so the
+// certificate can be renewed before the hub connection is degraded. The returned
+// expiry is nil when no certificate is found.
+func checkHubKubeConfigExpiringCondition(ctx context.Context, kubeClient kubernetes.Interface,
+	namespace, secretName string, warningWindow time.Duration) (metav1.Condition, *time.Time) {
+	condition := metav1.Condition{Type: hubKubeConfigExpiring}
+
+	hubConfigSecret, err := kubeClient.CoreV1().Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = "NoCertificate"
+		condition.Message = fmt.Sprintf("Failed to get hub kubeconfig secret %q %q: %v", namespace, secretName, err)
+		return condition, nil
+	}
+
+	certs, err := certutil.ParseCertsPEM(hubConfigSecret.Data["tls.crt"])
+	if err != nil || len(certs) == 0 {
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = "NoCertificate"
+		condition.Message = fmt.Sprintf("No client certificate found in hub kubeconfig secret %q %q", namespace, secretName)
+		return condition, nil
+	}
+
+	notAfter := certs[0].NotAfter
+	for _, cert := range certs[1:] {
+		if cert.NotAfter.Before(notAfter) {
+			notAfter = cert.NotAfter
+		}
+	}
+
+	if time.Until(notAfter) < warningWindow {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "CertificateExpiring"
+		condition.Message = fmt.Sprintf("The client certificate of hub kubeconfig secret %q %q expires at %v",
+			namespace, secretName, notAfter.UTC().Format(time.RFC3339))
+		return condition, &notAfter
+	}
+
+	condition.Status = metav1.ConditionFalse
+	condition.Reason = "CertificateValid"
+	condition.Message = fmt.Sprintf("The client certificate of hub kubeconfig secret %q %q is valid until %v",
+		namespace, secretName, notAfter.UTC().Format(time.RFC3339))
+	return condition, &notAfter
+}
+
+// hubUnreachable reports whether one of the degraded conditions was caused by a
+// failed call to the hub rather than by a broken local configuration.
+func hubUnreachable(conditions ...metav1.Condition) bool {
+	for _, condition := range conditions {
+		if condition.Status != metav1.ConditionTrue {
+			continue
+		}
+		for _, reason := range strings.Split(condition.Reason, ",") {
+			if reason == "BootstrapSecretError" || reason == "HubKubeConfigError" || reason == "HubServerUnreachable" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// nextHubUnreachableDelay returns the jittered delay before the next connectivity
+// check of the given klusterlet and doubles the stored delay for the check after
+// that, capped at the regular check interval.
+func (k *klusterletStatusController) nextHubUnreachableDelay(klusterletName string) time.Duration {
+	k.backoffLock.Lock()
+	defer k.backoffLock.Unlock()
+	if k.hubUnreachableBackoff == nil {
+		k.hubUnreachableBackoff = map[string]time.Duration{}
+	}
+	delay := k.hubUnreachableBackoff[klusterletName]
+	if delay == 0 {
+		delay = baseHubUnreachableDelay
+	}
+	next := 2 * delay
+	if k.checkInterval > 0 && next > k.checkInterval {
+		next = k.checkInterval
+	}
+	k.hubUnreachableBackoff[klusterletName] = next
+	return wait.Jitter(delay, 0.5)
+}
+
+func (k *klusterletStatusController) resetHubUnreachableDelay(klusterletName string) {
+	k.backoffLock.Lock()
+	defer k.backoffLock.Unlock()
+	delete(k.hubUnreachableBackoff, klusterletName)
+}
+
 type klusterletAgent struct {
-	clusterName    string
-	deploymentName string
-	namespace      string
-	getSSARFunc    getSelfSubjectAccessReviewsFunc
+	clusterName             string
+	deploymentName          string
+	namespace               string
+	hubKubeConfigSecretName string
+	hubConnectionTimeout    time.Duration
+	getSSARFunc             getSelfSubjectAccessReviewsFunc
 }
 
 func checkAgentDegradedCondition(
@@ -172,8 +364,14 @@ func checkBootstrapSecret(ctx context.Context, kubeClient kubernetes.Interface,
 		}
 	}
 
+	// Validate the kubeconfig in the secret field by field, so the degraded condition
+	// names the concrete problem instead of only reporting a generic secret error.
+	if condition := validateBootstrapKubeConfig(bootstrapSecret); condition != nil {
+		return condition
+	}
+
 	// Check if bootstrap secret works by building kube client
-	bootstrapClient, err := buildKubeClientWithSecret(bootstrapSecret)
+	bootstrapClient, err := buildKubeClientWithSecret(bootstrapSecret, agent.hubConnectionTimeout)
 	if err != nil {
 		return &metav1.Condition{
 			Reason: "BootstrapSecretError",
@@ -183,32 +381,125 @@ func checkBootstrapSecret(ctx context.Context, kubeClient kubernetes.Interface,
 	}
 
 	// Check the bootstrap client permissions by creating SelfSubjectAccessReviews
-	allowed, failedReview, err := createSelfSubjectAccessReviews(ctx, bootstrapClient, getBootstrapSelfSubjectAccessReviews())
+	deniedReviews, failedReview, err := createSelfSubjectAccessReviews(ctx, bootstrapClient, getBootstrapSelfSubjectAccessReviews())
 	if err != nil {
+		// A transport failure means the hub server itself cannot be reached, which has
+		// a different remedy than a secret the hub refuses, so it gets its own reason.
+		if isServerUnreachableError(err) {
+			return &metav1.Condition{
+				Reason: "HubServerUnreachable",
+				Message: fmt.Sprintf("The hub server of bootstrap secret %q %q cannot be reached: %v",
+					agent.namespace, helpers.BootstrapHubKubeConfig, err),
+			}
+		}
 		return &metav1.Condition{
 			Reason: "BootstrapSecretError",
 			Message: fmt.Sprintf("Failed to create %+v with bootstrap secret %q %q: %v",
 				failedReview, agent.namespace, helpers.BootstrapHubKubeConfig, err),
 		}
 	}
-	if !allowed {
+	if len(deniedReviews) > 0 {
 		return &metav1.Condition{
 			Reason: "BootstrapSecretUnauthorized",
-			Message: fmt.Sprintf("Operation for resource %+v is not allowed with bootstrap secret %q %q",
-				failedReview.Spec.ResourceAttributes, agent.namespace, helpers.BootstrapHubKubeConfig),
+			Message: fmt.Sprintf("Operations %q are not allowed with bootstrap secret %q %q",
+				describeMissingPermissions(deniedReviews), agent.namespace, helpers.BootstrapHubKubeConfig),
 		}
 	}
 
 	return nil
 }
 
+// validateBootstrapKubeConfig inspects the kubeconfig of the bootstrap secret and
+// returns a degraded condition naming the first concrete problem: a missing
+// kubeconfig key, an unparseable kubeconfig, a current context without a context or
+// cluster entry, or an unparseable or expired embedded client certificate. A nil
+// return means the kubeconfig is structurally sound, the live checks against the hub
+// follow separately.
+func validateBootstrapKubeConfig(secret *corev1.Secret) *metav1.Condition {
+	kubeconfigData, ok := secret.Data["kubeconfig"]
+	if !ok {
+		return &metav1.Condition{
+			Reason:  "BootstrapKubeConfigMissing",
+			Message: fmt.Sprintf("The bootstrap secret %q %q has no \"kubeconfig\" key", secret.Namespace, secret.Name),
+		}
+	}
+
+	kubeconfig, err := clientcmd.Load(kubeconfigData)
+	if err != nil {
+		return &metav1.Condition{
+			Reason:  "BootstrapKubeConfigInvalid",
+			Message: fmt.Sprintf("The kubeconfig of bootstrap secret %q %q cannot be parsed: %v", secret.Namespace, secret.Name, err),
+		}
+	}
+
+	kubeconfigContext := kubeconfig.Contexts[kubeconfig.CurrentContext]
+	if kubeconfigContext == nil {
+		return &metav1.Condition{
+			Reason: "BootstrapKubeConfigInvalid",
+			Message: fmt.Sprintf("The current context %q is not found in the kubeconfig of bootstrap secret %q %q",
+				kubeconfig.CurrentContext, secret.Namespace, secret.Name),
+		}
+	}
+	if kubeconfig.Clusters[kubeconfigContext.Cluster] == nil {
+		return &metav1.Condition{
+			Reason: "BootstrapKubeConfigInvalid",
+			Message: fmt.Sprintf("The cluster %q of the current context is not found in the kubeconfig of bootstrap secret %q %q",
+				kubeconfigContext.Cluster, secret.Namespace, secret.Name),
+		}
+	}
+
+	// The client certificate is either embedded in the kubeconfig or held in the
+	// tls.crt key next to it. A token based bootstrap carries no certificate at all.
+	certData := secret.Data["tls.crt"]
+	if authInfo := kubeconfig.AuthInfos[kubeconfigContext.AuthInfo]; authInfo != nil && len(authInfo.ClientCertificateData) > 0 {
+		certData = authInfo.ClientCertificateData
+	}
+	if len(certData) == 0 {
+		return nil
+	}
+
+	certs, err := certutil.ParseCertsPEM(certData)
+	if err != nil {
+		return &metav1.Condition{
+			Reason:  "BootstrapClientCertInvalid",
+			Message: fmt.Sprintf("The client certificate of bootstrap secret %q %q cannot be parsed: %v", secret.Namespace, secret.Name, err),
+		}
+	}
+	notAfter := certs[0].NotAfter
+	for _, cert := range certs[1:] {
+		if cert.NotAfter.Before(notAfter) {
+			notAfter = cert.NotAfter
+		}
+	}
+	if notAfter.Before(time.Now()) {
+		return &metav1.Condition{
+			Reason: "BootstrapClientCertExpired",
+			Message: fmt.Sprintf("The client certificate of bootstrap secret %q %q expired at %v",
+				secret.Namespace, secret.Name, notAfter.UTC().Format(time.RFC3339)),
+		}
+	}
+
+	return nil
+}
+
+// isServerUnreachableError reports whether the error of a hub call was a transport
+// failure, e.g. a refused connection, an unresolvable host or a timeout, rather than
+// an error response from a reachable server.
+func isServerUnreachableError(err error) bool {
+	var urlError *url.Error
+	if stderrors.As(err, &urlError) {
+		return true
+	}
+	return errors.IsTimeout(err) || errors.IsServerTimeout(err) || errors.IsServiceUnavailable(err)
+}
+
 // Check hub-kubeconfig-secret, if the secret is invalid, return degraded condition
 func checkHubConfigSecret(ctx context.Context, kubeClient kubernetes.Interface, agent klusterletAgent) *metav1.Condition {
-	hubConfigSecret, err := kubeClient.CoreV1().Secrets(agent.namespace).Get(ctx, helpers.HubKubeConfig, metav1.GetOptions{})
+	hubConfigSecret, err := kubeClient.CoreV1().Secrets(agent.namespace).Get(ctx, agent.hubKubeConfigSecretName, metav1.GetOptions{})
 	if err != nil {
 		return &metav1.Condition{
 			Reason:  "HubKubeConfigSecretMissing",
-			Message: fmt.Sprintf("Failed to get hub kubeconfig secret %q %q: %v", agent.namespace, helpers.HubKubeConfig, err),
+			Message: fmt.Sprintf("Failed to get hub kubeconfig secret %q %q: %v", agent.namespace, agent.hubKubeConfigSecretName, err),
 		}
 	}
 
@@ -221,7 +512,7 @@ func checkHubConfigSecret(ctx context.Context, kubeClient kubernetes.Interface,
 		}
 	}
 
-	hubClient, err := buildKubeClientWithSecret(hubConfigSecret)
+	hubClient, err := buildKubeClientWithSecret(hubConfigSecret, agent.hubConnectionTimeout)
 	if err != nil {
 		return &metav1.Condition{
 			Reason: "HubKubeConfigError",
@@ -245,7 +536,7 @@ func checkHubConfigSecret(ctx context.Context, kubeClient kubernetes.Interface,
 	}
 
 	// Check the hub kubeconfig permissions by creating SelfSubjectAccessReviews
-	allowed, failedReview, err := createSelfSubjectAccessReviews(ctx, hubClient, agent.getSSARFunc(agent.clusterName))
+	deniedReviews, failedReview, err := createSelfSubjectAccessReviews(ctx, hubClient, agent.getSSARFunc(agent.clusterName))
 	if err != nil {
 		return &metav1.Condition{
 			Reason: "HubKubeConfigError",
@@ -253,11 +544,11 @@ func checkHubConfigSecret(ctx context.Context, kubeClient kubernetes.Interface,
 				failedReview, hubConfigSecret.Namespace, hubConfigSecret.Name, err),
 		}
 	}
-	if !allowed {
+	if len(deniedReviews) > 0 {
 		return &metav1.Condition{
 			Reason: "HubKubeConfigUnauthorized",
-			Message: fmt.Sprintf("Operation for resource %+v is not allowed with hub config secret %q %q",
-				failedReview.Spec.ResourceAttributes, hubConfigSecret.Namespace, hubConfigSecret.Name),
+			Message: fmt.Sprintf("Operations %q are not allowed with hub config secret %q %q",
+				describeMissingPermissions(deniedReviews), hubConfigSecret.Namespace, hubConfigSecret.Name),
 		}
 	}
 
@@ -274,39 +565,112 @@ func checkAgentDeployment(ctx context.Context, kubeClient kubernetes.Interface,
 		}
 	}
 	if unavailablePod := helpers.NumOfUnavailablePod(deployment); unavailablePod > 0 {
+		message := fmt.Sprintf("%v of requested instances are unavailable of deployment %q %q",
+			unavailablePod, agent.namespace, agent.deploymentName)
+		if failures := podFailureMessages(ctx, kubeClient, deployment); len(failures) > 0 {
+			message = fmt.Sprintf("%s: %s", message, strings.Join(failures, "; "))
+		}
 		return &metav1.Condition{
-			Reason: "UnavailablePods",
-			Message: fmt.Sprintf("%v of requested instances are unavailable of deployment %q %q",
-				unavailablePod, agent.namespace, agent.deploymentName),
+			Reason:  "UnavailablePods",
+			Message: message,
 		}
 	}
 	return nil
 }
 
-func buildKubeClientWithSecret(secret *corev1.Secret) (kubernetes.Interface, error) {
+// podFailureMessages lists the pods of the deployment and collects the concrete
+// container failure reasons like CrashLoopBackOff, ImagePullBackOff or OOMKilled,
+// so the degraded condition names the actual problem instead of only counting the
+// unavailable pods.
+func podFailureMessages(ctx context.Context, kubeClient kubernetes.Interface, deployment *appsv1.Deployment) []string {
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil
+	}
+	pods, err := kubeClient.CoreV1().Pods(deployment.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil
+	}
+
+	messages := []string{}
+	for _, pod := range pods.Items {
+		for _, containerStatus := range pod.Status.ContainerStatuses {
+			if waiting := containerStatus.State.Waiting; waiting != nil &&
+				(waiting.Reason == "CrashLoopBackOff" || waiting.Reason == "ImagePullBackOff" || waiting.Reason == "ErrImagePull") {
+				messages = append(messages, fmt.Sprintf("container %q of pod %q is in %s: %s",
+					containerStatus.Name, pod.Name, waiting.Reason, waiting.Message))
+				continue
+			}
+			if terminated := containerStatus.LastTerminationState.Terminated; terminated != nil && terminated.Reason == "OOMKilled" {
+				messages = append(messages, fmt.Sprintf("container %q of pod %q was %s",
+					containerStatus.Name, pod.Name, terminated.Reason))
+			}
+		}
+	}
+	return messages
+}
+
+// registeredHubURL returns the API server URL of the hub from the hub kubeconfig
+// secret, or an empty string while the agents have not registered yet.
+func registeredHubURL(ctx context.Context, kubeClient kubernetes.Interface, namespace, secretName string) string {
+	hubConfigSecret, err := kubeClient.CoreV1().Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		return ""
+	}
+	restConfig, err := helpers.LoadClientConfigFromSecret(hubConfigSecret)
+	if err != nil {
+		return ""
+	}
+	return restConfig.Host
+}
+
+func buildKubeClientWithSecret(secret *corev1.Secret, timeout time.Duration) (kubernetes.Interface, error) {
 	restConfig, err := helpers.LoadClientConfigFromSecret(secret)
 	if err != nil {
 		return nil, err
 	}
+	restConfig.Timeout = timeout
 
 	return kubernetes.NewForConfig(restConfig)
 }
 
+// createSelfSubjectAccessReviews runs all given reviews and returns the denied
+// ones, so the degraded condition can list every missing permission at once
+// instead of only the first denied review.
 func createSelfSubjectAccessReviews(
 	ctx context.Context,
 	kubeClient kubernetes.Interface,
-	selfSubjectAccessReviews []authorizationv1.SelfSubjectAccessReview) (bool, *authorizationv1.SelfSubjectAccessReview, error) {
+	selfSubjectAccessReviews []authorizationv1.SelfSubjectAccessReview) ([]authorizationv1.SelfSubjectAccessReview, *authorizationv1.SelfSubjectAccessReview, error) {
+	deniedReviews := []authorizationv1.SelfSubjectAccessReview{}
 	for i := range selfSubjectAccessReviews {
 		subjectAccessReview := selfSubjectAccessReviews[i]
 		ssar, err := kubeClient.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &subjectAccessReview, metav1.CreateOptions{})
 		if err != nil {
-			return false, &subjectAccessReview, err
+			return nil, &subjectAccessReview, err
 		}
 		if !ssar.Status.Allowed {
-			return false, &subjectAccessReview, nil
+			deniedReviews = append(deniedReviews, subjectAccessReview)
+		}
+	}
+	return deniedReviews, nil, nil
+}
+
+// describeMissingPermissions renders denied reviews as a compact
+// "verb group/resource/subresource" list for the degraded condition messages.
+func describeMissingPermissions(reviews []authorizationv1.SelfSubjectAccessReview) string {
+	permissions := []string{}
+	for _, review := range reviews {
+		attributes := review.Spec.ResourceAttributes
+		resource := attributes.Resource
+		if attributes.Group != "" {
+			resource = attributes.Group + "/" + resource
+		}
+		if attributes.Subresource != "" {
+			resource = resource + "/" + attributes.Subresource
 		}
+		permissions = append(permissions, fmt.Sprintf("%s %s", attributes.Verb, resource))
 	}
-	return true, nil, nil
+	return strings.Join(permissions, ", ")
 }
 
 func getBootstrapSelfSubjectAccessReviews() []authorizationv1.SelfSubjectAccessReview {
@@ -2,8 +2,14 @@ package statuscontroller
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"io/ioutil"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -107,7 +113,6 @@ func newTestController(klusterlet *operatorapiv1.Klusterlet, objects ...runtime.
 	klusterletController := &klusterletStatusController{
 		kubeClient:       fakeKubeClient,
 		klusterletClient: fakeOperatorClient.OperatorV1().Klusterlets(),
-		secretLister:     kubeInformers.Core().V1().Secrets().Lister(),
 		deploymentLister: kubeInformers.Apps().V1().Deployments().Lister(),
 		klusterletLister: operatorInformers.Operator().V1().Klusterlets().Lister(),
 	}
@@ -172,6 +177,7 @@ func TestSync(t *testing.T) {
 			expectedConditions: []metav1.Condition{
 				testinghelper.NamedCondition(klusterletRegistrationDegraded, "BootstrapSecretMissing,HubKubeConfigMissing,GetDeploymentFailed", metav1.ConditionTrue),
 				testinghelper.NamedCondition(klusterletWorKDegraded, "HubKubeConfigMissing,GetDeploymentFailed", metav1.ConditionTrue),
+				testinghelper.NamedCondition(hubKubeConfigExpiring, "NoCertificate", metav1.ConditionUnknown),
 			},
 		},
 		{
@@ -182,8 +188,22 @@ func TestSync(t *testing.T) {
 			},
 			klusterlet: newKlusterlet("testklusterlet", "test", ""),
 			expectedConditions: []metav1.Condition{
-				testinghelper.NamedCondition(klusterletRegistrationDegraded, "BootstrapSecretError,HubKubeConfigMissing,GetDeploymentFailed", metav1.ConditionTrue),
+				testinghelper.NamedCondition(klusterletRegistrationDegraded, "BootstrapKubeConfigInvalid,HubKubeConfigMissing,GetDeploymentFailed", metav1.ConditionTrue),
 				testinghelper.NamedCondition(klusterletWorKDegraded, "HubKubeConfigMissing,GetDeploymentFailed", metav1.ConditionTrue),
+				testinghelper.NamedCondition(hubKubeConfigExpiring, "NoCertificate", metav1.ConditionUnknown),
+			},
+		},
+		{
+			name: "Unreachable hub server in bootstrap secret",
+			object: []runtime.Object{
+				newSecret(helpers.HubKubeConfig, "test"),
+				newSecretWithKubeConfig(helpers.BootstrapHubKubeConfig, "test", newKubeConfig("https://127.0.0.1:1")),
+			},
+			klusterlet: newKlusterlet("testklusterlet", "test", ""),
+			expectedConditions: []metav1.Condition{
+				testinghelper.NamedCondition(klusterletRegistrationDegraded, "HubServerUnreachable,HubKubeConfigMissing,GetDeploymentFailed", metav1.ConditionTrue),
+				testinghelper.NamedCondition(klusterletWorKDegraded, "HubKubeConfigMissing,GetDeploymentFailed", metav1.ConditionTrue),
+				testinghelper.NamedCondition(hubKubeConfigExpiring, "NoCertificate", metav1.ConditionUnknown),
 			},
 		},
 		{
@@ -196,6 +216,7 @@ func TestSync(t *testing.T) {
 			expectedConditions: []metav1.Condition{
 				testinghelper.NamedCondition(klusterletRegistrationDegraded, "BootstrapSecretUnauthorized,HubKubeConfigMissing,GetDeploymentFailed", metav1.ConditionTrue),
 				testinghelper.NamedCondition(klusterletWorKDegraded, "HubKubeConfigMissing,GetDeploymentFailed", metav1.ConditionTrue),
+				testinghelper.NamedCondition(hubKubeConfigExpiring, "NoCertificate", metav1.ConditionUnknown),
 			},
 		},
 		{
@@ -208,6 +229,7 @@ func TestSync(t *testing.T) {
 			expectedConditions: []metav1.Condition{
 				testinghelper.NamedCondition(klusterletRegistrationDegraded, "HubKubeConfigSecretMissing,GetDeploymentFailed", metav1.ConditionTrue),
 				testinghelper.NamedCondition(klusterletWorKDegraded, "HubKubeConfigSecretMissing,GetDeploymentFailed", metav1.ConditionTrue),
+				testinghelper.NamedCondition(hubKubeConfigExpiring, "NoCertificate", metav1.ConditionUnknown),
 			},
 		},
 		{
@@ -221,6 +243,7 @@ func TestSync(t *testing.T) {
 			expectedConditions: []metav1.Condition{
 				testinghelper.NamedCondition(klusterletRegistrationDegraded, "ClusterNameMissing,GetDeploymentFailed", metav1.ConditionTrue),
 				testinghelper.NamedCondition(klusterletWorKDegraded, "ClusterNameMissing,GetDeploymentFailed", metav1.ConditionTrue),
+				testinghelper.NamedCondition(hubKubeConfigExpiring, "NoCertificate", metav1.ConditionUnknown),
 			},
 		},
 		{
@@ -234,6 +257,7 @@ func TestSync(t *testing.T) {
 			expectedConditions: []metav1.Condition{
 				testinghelper.NamedCondition(klusterletRegistrationDegraded, "HubKubeConfigMissing,GetDeploymentFailed", metav1.ConditionTrue),
 				testinghelper.NamedCondition(klusterletWorKDegraded, "HubKubeConfigMissing,GetDeploymentFailed", metav1.ConditionTrue),
+				testinghelper.NamedCondition(hubKubeConfigExpiring, "NoCertificate", metav1.ConditionUnknown),
 			},
 		},
 		{
@@ -247,6 +271,7 @@ func TestSync(t *testing.T) {
 			expectedConditions: []metav1.Condition{
 				testinghelper.NamedCondition(klusterletRegistrationDegraded, "HubKubeConfigError,GetDeploymentFailed", metav1.ConditionTrue),
 				testinghelper.NamedCondition(klusterletWorKDegraded, "HubKubeConfigError,GetDeploymentFailed", metav1.ConditionTrue),
+				testinghelper.NamedCondition(hubKubeConfigExpiring, "NoCertificate", metav1.ConditionUnknown),
 			},
 		},
 		{
@@ -260,6 +285,7 @@ func TestSync(t *testing.T) {
 			expectedConditions: []metav1.Condition{
 				testinghelper.NamedCondition(klusterletRegistrationDegraded, "HubKubeConfigUnauthorized,GetDeploymentFailed", metav1.ConditionTrue),
 				testinghelper.NamedCondition(klusterletWorKDegraded, "HubKubeConfigUnauthorized,GetDeploymentFailed", metav1.ConditionTrue),
+				testinghelper.NamedCondition(hubKubeConfigExpiring, "NoCertificate", metav1.ConditionUnknown),
 			},
 		},
 		{
@@ -277,6 +303,7 @@ func TestSync(t *testing.T) {
 			expectedConditions: []metav1.Condition{
 				testinghelper.NamedCondition(klusterletRegistrationDegraded, "UnavailablePods", metav1.ConditionTrue),
 				testinghelper.NamedCondition(klusterletWorKDegraded, "UnavailablePods", metav1.ConditionTrue),
+				testinghelper.NamedCondition(hubKubeConfigExpiring, "NoCertificate", metav1.ConditionUnknown),
 			},
 		},
 		{
@@ -294,6 +321,7 @@ func TestSync(t *testing.T) {
 			expectedConditions: []metav1.Condition{
 				testinghelper.NamedCondition(klusterletRegistrationDegraded, "RegistrationFunctional", metav1.ConditionFalse),
 				testinghelper.NamedCondition(klusterletWorKDegraded, "WorkFunctional", metav1.ConditionFalse),
+				testinghelper.NamedCondition(hubKubeConfigExpiring, "NoCertificate", metav1.ConditionUnknown),
 			},
 		},
 	}
@@ -320,3 +348,184 @@ func TestSync(t *testing.T) {
 		})
 	}
 }
+
+func TestHubUnreachableBackoff(t *testing.T) {
+	unreachable := testinghelper.NamedCondition(klusterletRegistrationDegraded, "HubKubeConfigError,GetDeploymentFailed", metav1.ConditionTrue)
+	local := testinghelper.NamedCondition(klusterletWorKDegraded, "HubKubeConfigMissing", metav1.ConditionTrue)
+	functional := testinghelper.NamedCondition(klusterletRegistrationDegraded, "RegistrationFunctional", metav1.ConditionFalse)
+
+	if !hubUnreachable(unreachable, local) {
+		t.Errorf("Expected a HubKubeConfigError reason to be treated as unreachable hub")
+	}
+	if hubUnreachable(local, functional) {
+		t.Errorf("Expected local configuration problems not to be treated as unreachable hub")
+	}
+
+	controller := &klusterletStatusController{checkInterval: time.Minute}
+	for i, expected := range []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute} {
+		delay := controller.nextHubUnreachableDelay("testklusterlet")
+		if delay < expected || delay > expected+expected/2 {
+			t.Errorf("Expected delay %d within [%v, %v], but got %v", i, expected, expected+expected/2, delay)
+		}
+	}
+
+	controller.resetHubUnreachableDelay("testklusterlet")
+	if delay := controller.nextHubUnreachableDelay("testklusterlet"); delay >= 2*baseHubUnreachableDelay {
+		t.Errorf("Expected the delay to restart from the base delay after a reset, but got %v", delay)
+	}
+}
+
+func newCertSecret(t *testing.T, name, namespace string, notAfter time.Time) *corev1.Secret {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Expected no error when generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Expected no error when creating certificate: %v", err)
+	}
+	secret := newSecret(name, namespace)
+	secret.Data["tls.crt"] = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	return secret
+}
+
+func TestValidateBootstrapKubeConfig(t *testing.T) {
+	newKubeConfigWithContext := func(currentContext, cluster string) []byte {
+		configData, _ := runtime.Encode(clientcmdlatest.Codec, &clientcmdapi.Config{
+			Clusters: map[string]*clientcmdapi.Cluster{"default-cluster": {
+				Server:                "https://hub.example.com",
+				InsecureSkipTLSVerify: true,
+			}},
+			Contexts: map[string]*clientcmdapi.Context{"default-context": {
+				Cluster: cluster,
+			}},
+			CurrentContext: currentContext,
+		})
+		return configData
+	}
+	withCert := func(secret *corev1.Secret, notAfter time.Time) *corev1.Secret {
+		certSecret := newCertSecret(t, secret.Name, secret.Namespace, notAfter)
+		secret.Data["tls.crt"] = certSecret.Data["tls.crt"]
+		return secret
+	}
+
+	cases := []struct {
+		name           string
+		secret         *corev1.Secret
+		expectedReason string
+	}{
+		{
+			name:           "kubeconfig key missing",
+			secret:         newSecret(helpers.BootstrapHubKubeConfig, "test"),
+			expectedReason: "BootstrapKubeConfigMissing",
+		},
+		{
+			name:           "kubeconfig unparseable",
+			secret:         newSecretWithKubeConfig(helpers.BootstrapHubKubeConfig, "test", []byte("no kubeconfig")),
+			expectedReason: "BootstrapKubeConfigInvalid",
+		},
+		{
+			name:           "current context missing",
+			secret:         newSecretWithKubeConfig(helpers.BootstrapHubKubeConfig, "test", newKubeConfigWithContext("other-context", "default-cluster")),
+			expectedReason: "BootstrapKubeConfigInvalid",
+		},
+		{
+			name:           "cluster of current context missing",
+			secret:         newSecretWithKubeConfig(helpers.BootstrapHubKubeConfig, "test", newKubeConfigWithContext("default-context", "other-cluster")),
+			expectedReason: "BootstrapKubeConfigInvalid",
+		},
+		{
+			name: "client certificate expired",
+			secret: withCert(
+				newSecretWithKubeConfig(helpers.BootstrapHubKubeConfig, "test", newKubeConfigWithContext("default-context", "default-cluster")),
+				time.Now().Add(-time.Hour)),
+			expectedReason: "BootstrapClientCertExpired",
+		},
+		{
+			name: "client certificate unparseable",
+			secret: func() *corev1.Secret {
+				secret := newSecretWithKubeConfig(helpers.BootstrapHubKubeConfig, "test", newKubeConfigWithContext("default-context", "default-cluster"))
+				secret.Data["tls.crt"] = []byte("no certificate")
+				return secret
+			}(),
+			expectedReason: "BootstrapClientCertInvalid",
+		},
+		{
+			name: "valid certificate based kubeconfig",
+			secret: withCert(
+				newSecretWithKubeConfig(helpers.BootstrapHubKubeConfig, "test", newKubeConfigWithContext("default-context", "default-cluster")),
+				time.Now().Add(30*24*time.Hour)),
+		},
+		{
+			name:   "valid token based kubeconfig without certificate",
+			secret: newSecretWithKubeConfig(helpers.BootstrapHubKubeConfig, "test", newKubeConfigWithContext("default-context", "default-cluster")),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			condition := validateBootstrapKubeConfig(c.secret)
+			if len(c.expectedReason) == 0 {
+				if condition != nil {
+					t.Errorf("Expected no condition, but got %+v", condition)
+				}
+				return
+			}
+			if condition == nil {
+				t.Fatalf("Expected a condition with reason %q, but got none", c.expectedReason)
+			}
+			if condition.Reason != c.expectedReason {
+				t.Errorf("Expected condition reason %q, but got %q", c.expectedReason, condition.Reason)
+			}
+		})
+	}
+}
+
+func TestHubKubeConfigExpiringCondition(t *testing.T) {
+	cases := []struct {
+		name           string
+		secret         *corev1.Secret
+		expectedStatus metav1.ConditionStatus
+		expectedReason string
+	}{
+		{
+			name:           "no certificate",
+			secret:         newSecret(helpers.HubKubeConfig, "test"),
+			expectedStatus: metav1.ConditionUnknown,
+			expectedReason: "NoCertificate",
+		},
+		{
+			name:           "certificate expiring",
+			secret:         newCertSecret(t, helpers.HubKubeConfig, "test", time.Now().Add(time.Hour)),
+			expectedStatus: metav1.ConditionTrue,
+			expectedReason: "CertificateExpiring",
+		},
+		{
+			name:           "certificate valid",
+			secret:         newCertSecret(t, helpers.HubKubeConfig, "test", time.Now().Add(30*24*time.Hour)),
+			expectedStatus: metav1.ConditionFalse,
+			expectedReason: "CertificateValid",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fakeKubeClient := fakekube.NewSimpleClientset(c.secret)
+			condition, _ := checkHubKubeConfigExpiringCondition(
+				context.TODO(), fakeKubeClient, "test", helpers.HubKubeConfig, 7*24*time.Hour)
+			if condition.Status != c.expectedStatus {
+				t.Errorf("Expected condition status %q, but got %q", c.expectedStatus, condition.Status)
+			}
+			if condition.Reason != c.expectedReason {
+				t.Errorf("Expected condition reason %q, but got %q", c.expectedReason, condition.Reason)
+			}
+		})
+	}
+}
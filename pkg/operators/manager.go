@@ -3,12 +3,19 @@ package operators
 import (
 	"context"
 	"io/ioutil"
+	"os"
 	"time"
 
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	versionutil "k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	apiregistrationclient "k8s.io/kube-aggregator/pkg/client/clientset_generated/clientset"
 
 	"github.com/openshift/library-go/pkg/controller/controllercmd"
@@ -16,88 +23,287 @@ import (
 	operatorclient "open-cluster-management.io/api/client/operator/clientset/versioned"
 	operatorinformer "open-cluster-management.io/api/client/operator/informers/externalversions"
 	workclientset "open-cluster-management.io/api/client/work/clientset/versioned"
+	"open-cluster-management.io/registration-operator/pkg/conversion"
+	"open-cluster-management.io/registration-operator/pkg/health"
 	"open-cluster-management.io/registration-operator/pkg/helpers"
+	"open-cluster-management.io/registration-operator/pkg/metrics"
+	"open-cluster-management.io/registration-operator/pkg/operators/clustermanager/controllers/bootstraptokencontroller"
 	certrotationcontroller "open-cluster-management.io/registration-operator/pkg/operators/clustermanager/controllers/certrotationcontroller"
 	"open-cluster-management.io/registration-operator/pkg/operators/clustermanager/controllers/clustermanagercontroller"
+	"open-cluster-management.io/registration-operator/pkg/operators/clustermanager/controllers/migrationcontroller"
 	clustermanagerstatuscontroller "open-cluster-management.io/registration-operator/pkg/operators/clustermanager/controllers/statuscontroller"
+	"open-cluster-management.io/registration-operator/pkg/operators/gccontroller"
+	"open-cluster-management.io/registration-operator/pkg/operators/klusterlet/controllers/addoncontroller"
 	"open-cluster-management.io/registration-operator/pkg/operators/klusterlet/controllers/bootstrapcontroller"
 	"open-cluster-management.io/registration-operator/pkg/operators/klusterlet/controllers/klusterletcontroller"
+	"open-cluster-management.io/registration-operator/pkg/operators/klusterlet/controllers/managedkubeconfigcontroller"
+	klusterletmigrationcontroller "open-cluster-management.io/registration-operator/pkg/operators/klusterlet/controllers/migrationcontroller"
 	"open-cluster-management.io/registration-operator/pkg/operators/klusterlet/controllers/statuscontroller"
+	"open-cluster-management.io/registration-operator/pkg/operators/pullsecretcontroller"
 )
 
 // defaultSpokeComponentNamespace is the default namespace in which the operator is deployed
 const defaultComponentNamespace = "open-cluster-management"
 
+// metricsAddr is the address the operator metrics endpoint listens on
+const metricsAddr = ":8383"
+
+// pprofAddr is the address the pprof endpoints listen on when --enable-pprof is set
+const pprofAddr = ":6060"
+
+// conversionWebhookAddr is the address the CRD conversion webhook listens on when a
+// serving certificate is configured
+const conversionWebhookAddr = ":9443"
+
+// operatorResources holds the clients and informer factories the run functions wire
+// their controllers with. The combined command hands the same instance to both
+// operators, so the connections and informer caches are shared.
+type operatorResources struct {
+	kubeClient                kubernetes.Interface
+	apiExtensionClient        apiextensionsclient.Interface
+	dynamicClient             dynamic.Interface
+	operatorClient            operatorclient.Interface
+	kubeInformer              informers.SharedInformerFactory
+	deploymentInformerFactory informers.SharedInformerFactory
+	nodeInformerFactory       informers.SharedInformerFactory
+	operatorInformer          operatorinformer.SharedInformerFactory
+	operatorNamespace         string
+}
+
+func (o *Options) newOperatorResources(kubeConfig *rest.Config) (*operatorResources, error) {
+	kubeClient, err := kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	apiExtensionClient, err := apiextensionsclient.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	operatorClient, err := operatorclient.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read component namespace
+	operatorNamespace := defaultComponentNamespace
+	nsBytes, err := ioutil.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
+	if err == nil {
+		operatorNamespace = string(nsBytes)
+	}
+
+	return &operatorResources{
+		kubeClient:         kubeClient,
+		apiExtensionClient: apiExtensionClient,
+		dynamicClient:      dynamicClient,
+		operatorClient:     operatorClient,
+		// The namespaces the operands run in are configurable in the clustermanager and
+		// klusterlet specs, so the informers are not scoped to the default namespace.
+		kubeInformer: informers.NewSharedInformerFactory(kubeClient, o.InformerResyncInterval),
+		// The deployment informer only watches the deployments the operator manages itself,
+		// identified by the managed-by label, instead of every deployment on the cluster.
+		deploymentInformerFactory: newDeploymentInformerFactory(kubeClient, o.InformerResyncInterval),
+		// The node informer only watches the master nodes the replica counts are
+		// derived from, instead of every node on the cluster.
+		nodeInformerFactory: newNodeInformerFactory(kubeClient, o.InformerResyncInterval),
+		operatorInformer:    operatorinformer.NewSharedInformerFactory(operatorClient, o.InformerResyncInterval),
+		operatorNamespace:   operatorNamespace,
+	}, nil
+}
+
+func (r *operatorResources) start(ctx context.Context) {
+	go r.operatorInformer.Start(ctx.Done())
+	go r.kubeInformer.Start(ctx.Done())
+	go r.deploymentInformerFactory.Start(ctx.Done())
+	go r.nodeInformerFactory.Start(ctx.Done())
+}
+
 // RunClusterManagerOperator starts a new cluster manager operator
-func RunClusterManagerOperator(ctx context.Context, controllerContext *controllercmd.ControllerContext) error {
-	// Build kubclient client and informer for managed cluster
-	kubeClient, err := kubernetes.NewForConfig(controllerContext.KubeConfig)
+func (o *Options) RunClusterManagerOperator(ctx context.Context, controllerContext *controllercmd.ControllerContext) error {
+	resources, err := o.newOperatorResources(controllerContext.KubeConfig)
 	if err != nil {
 		return err
 	}
-	apiExtensionClient, err := apiextensionsclient.NewForConfig(controllerContext.KubeConfig)
+	if err := o.startClusterManagerControllers(ctx, controllerContext, resources); err != nil {
+		return err
+	}
+
+	go metrics.ServeMetrics(ctx, metricsAddr)
+	if o.EnablePprof {
+		go metrics.ServePprof(ctx, pprofAddr)
+	}
+	o.startConversionWebhook(ctx, "ClusterManager")
+	resources.start(ctx)
+
+	<-ctx.Done()
+	return nil
+}
+
+// RunKlusterletOperator starts a new klusterlet operator
+func (o *Options) RunKlusterletOperator(ctx context.Context, controllerContext *controllercmd.ControllerContext) error {
+	resources, err := o.newOperatorResources(controllerContext.KubeConfig)
 	if err != nil {
 		return err
 	}
-	apiRegistrationClient, err := apiregistrationclient.NewForConfig(controllerContext.KubeConfig)
+	if err := o.startKlusterletControllers(ctx, controllerContext, resources); err != nil {
+		return err
+	}
+
+	go metrics.ServeMetrics(ctx, metricsAddr)
+	if o.EnablePprof {
+		go metrics.ServePprof(ctx, pprofAddr)
+	}
+	o.startConversionWebhook(ctx, "Klusterlet")
+	resources.start(ctx)
+
+	<-ctx.Done()
+	return nil
+}
+
+// RunCombinedOperators starts the cluster manager and the klusterlet operator
+// controllers in one process, for setups where the hub is also a managed cluster or
+// where running two operator deployments is too expensive. The controllers share the
+// informer factories, the metrics endpoint and the leader election lease of the
+// single process.
+func (o *Options) RunCombinedOperators(ctx context.Context, controllerContext *controllercmd.ControllerContext) error {
+	resources, err := o.newOperatorResources(controllerContext.KubeConfig)
 	if err != nil {
 		return err
 	}
+	if err := o.startClusterManagerControllers(ctx, controllerContext, resources); err != nil {
+		return err
+	}
+	if err := o.startKlusterletControllers(ctx, controllerContext, resources); err != nil {
+		return err
+	}
 
-	kubeInformer := informers.NewSharedInformerFactoryWithOptions(kubeClient, 5*time.Minute, informers.WithNamespace(helpers.ClusterManagerNamespace))
+	go metrics.ServeMetrics(ctx, metricsAddr)
+	if o.EnablePprof {
+		go metrics.ServePprof(ctx, pprofAddr)
+	}
+	o.startConversionWebhook(ctx, "ClusterManager", "Klusterlet")
+	resources.start(ctx)
+
+	<-ctx.Done()
+	return nil
+}
 
-	// Build operator client and informer
-	operatorClient, err := operatorclient.NewForConfig(controllerContext.KubeConfig)
+// startClusterManagerControllers wires up the cluster manager side controllers and
+// starts them along with their dedicated informer factories
+func (o *Options) startClusterManagerControllers(ctx context.Context, controllerContext *controllercmd.ControllerContext, resources *operatorResources) error {
+	apiRegistrationClient, err := apiregistrationclient.NewForConfig(controllerContext.KubeConfig)
 	if err != nil {
 		return err
 	}
-	operatorInformer := operatorinformer.NewSharedInformerFactory(operatorClient, 5*time.Minute)
+
+	imageMirrors, err := helpers.ParseImageMirrors(o.ImageMirrors)
+	if err != nil {
+		return err
+	}
+
+	deploymentInformer := resources.deploymentInformerFactory.Apps().V1().Deployments()
+	nodeInformer := resources.nodeInformerFactory.Core().V1().Nodes()
 
 	clusterManagerController := clustermanagercontroller.NewClusterManagerController(
-		kubeClient,
-		apiExtensionClient,
+		resources.kubeClient,
+		resources.apiExtensionClient,
 		apiRegistrationClient.ApiregistrationV1(),
-		operatorClient.OperatorV1().ClusterManagers(),
-		operatorInformer.Operator().V1().ClusterManagers(),
-		kubeInformer.Apps().V1().Deployments(),
-		kubeInformer.Core().V1().ConfigMaps(),
+		resources.operatorClient.OperatorV1().ClusterManagers(),
+		resources.operatorInformer.Operator().V1().ClusterManagers(),
+		deploymentInformer,
+		resources.kubeInformer.Core().V1().ConfigMaps(),
+		nodeInformer,
+		resources.operatorNamespace,
+		os.Getenv("IMAGE_MANIFEST_CONFIGMAP"),
+		o.PodSecurityEnforceLevel,
+		o.MetricsProxyImage,
+		imageMirrors,
+		o.syncThrottle(),
 		controllerContext.EventRecorder)
 
 	statusController := clustermanagerstatuscontroller.NewClusterManagerStatusController(
-		operatorClient.OperatorV1().ClusterManagers(),
-		operatorInformer.Operator().V1().ClusterManagers(),
-		kubeInformer.Apps().V1().Deployments(),
+		resources.kubeClient,
+		resources.operatorClient.OperatorV1().ClusterManagers(),
+		resources.operatorInformer.Operator().V1().ClusterManagers(),
+		deploymentInformer,
 		controllerContext.EventRecorder)
 
 	certRotationController := certrotationcontroller.NewCertRotationController(
-		kubeClient,
-		kubeInformer.Core().V1().Secrets(),
-		kubeInformer.Core().V1().ConfigMaps(),
-		operatorInformer.Operator().V1().ClusterManagers(),
+		resources.kubeClient,
+		resources.kubeInformer.Core().V1().Secrets(),
+		resources.kubeInformer.Core().V1().ConfigMaps(),
+		resources.operatorInformer.Operator().V1().ClusterManagers(),
+		controllerContext.EventRecorder)
+
+	crdMigrationController := migrationcontroller.NewCRDMigrationController(
+		resources.dynamicClient,
+		resources.apiExtensionClient,
+		resources.operatorClient.OperatorV1().ClusterManagers(),
+		resources.operatorInformer.Operator().V1().ClusterManagers(),
 		controllerContext.EventRecorder)
 
-	go operatorInformer.Start(ctx.Done())
-	go kubeInformer.Start(ctx.Done())
-	go clusterManagerController.Run(ctx, 1)
-	go statusController.Run(ctx, 1)
+	bootstrapTokenController := bootstraptokencontroller.NewBootstrapTokenController(
+		resources.kubeClient,
+		resources.operatorInformer.Operator().V1().ClusterManagers(),
+		controllerContext.KubeConfig,
+		controllerContext.EventRecorder)
+
+	gcController := gccontroller.NewGCController(
+		"ClusterManagerGCController",
+		helpers.ClusterManagerOwnerLabel,
+		resources.kubeClient,
+		func(name string) (bool, error) {
+			_, err := resources.operatorInformer.Operator().V1().ClusterManagers().Lister().Get(name)
+			if errors.IsNotFound(err) {
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+			return true, nil
+		},
+		resources.operatorInformer.Operator().V1().ClusterManagers().Informer(),
+		controllerContext.EventRecorder)
+
+	pullSecretController := pullsecretcontroller.NewPullSecretController(
+		"ClusterManagerPullSecretController",
+		helpers.ClusterManagerOwnerLabel,
+		resources.kubeClient,
+		resources.operatorNamespace,
+		resources.operatorInformer.Operator().V1().ClusterManagers().Informer(),
+		controllerContext.EventRecorder)
+
+	// The operator is not ready until its informer caches are synced. Leadership is
+	// already reflected by the probes: the listener only serves while this replica
+	// holds the leader election lease.
+	health.AddReadinessCheck("ClusterManagerInformer", resources.operatorInformer.Operator().V1().ClusterManagers().Informer().HasSynced)
+	health.AddReadinessCheck("DeploymentInformer", deploymentInformer.Informer().HasSynced)
+	health.AddReadinessCheck("ConfigMapInformer", resources.kubeInformer.Core().V1().ConfigMaps().Informer().HasSynced)
+	health.AddReadinessCheck("SecretInformer", resources.kubeInformer.Core().V1().Secrets().Informer().HasSynced)
+	health.AddReadinessCheck("NodeInformer", nodeInformer.Informer().HasSynced)
+
+	go clusterManagerController.Run(ctx, o.MaxConcurrentSyncs)
+	go statusController.Run(ctx, o.MaxConcurrentSyncs)
 	go certRotationController.Run(ctx, 1)
+	go crdMigrationController.Run(ctx, 1)
+	go bootstrapTokenController.Run(ctx, 1)
+	go gcController.Run(ctx, 1)
+	go pullSecretController.Run(ctx, 1)
 
-	<-ctx.Done()
 	return nil
 }
 
-// RunKlusterletOperator starts a new klusterlet operator
-func RunKlusterletOperator(ctx context.Context, controllerContext *controllercmd.ControllerContext) error {
-	// Build kubclient client and informer for managed cluster
-	kubeClient, err := kubernetes.NewForConfig(controllerContext.KubeConfig)
-	if err != nil {
-		return err
-	}
-	apiExtensionClient, err := apiextensionsclient.NewForConfig(controllerContext.KubeConfig)
+// startKlusterletControllers wires up the klusterlet side controllers and starts them
+// along with their dedicated informer factories
+func (o *Options) startKlusterletControllers(ctx context.Context, controllerContext *controllercmd.ControllerContext, resources *operatorResources) error {
+	workClient, err := workclientset.NewForConfig(controllerContext.KubeConfig)
 	if err != nil {
 		return err
 	}
-	version, err := kubeClient.ServerVersion()
+	version, err := resources.kubeClient.Discovery().ServerVersion()
 	if err != nil {
 		return err
 	}
@@ -105,62 +311,170 @@ func RunKlusterletOperator(ctx context.Context, controllerContext *controllercmd
 	if err != nil {
 		return err
 	}
-
-	kubeInformer := informers.NewSharedInformerFactory(kubeClient, 5*time.Minute)
-
-	// Build operator client and informer
-	operatorClient, err := operatorclient.NewForConfig(controllerContext.KubeConfig)
+	imageMirrors, err := helpers.ParseImageMirrors(o.ImageMirrors)
 	if err != nil {
 		return err
 	}
-	operatorInformer := operatorinformer.NewSharedInformerFactory(operatorClient, 5*time.Minute)
 
-	workClient, err := workclientset.NewForConfig(controllerContext.KubeConfig)
-	if err != nil {
-		return err
-	}
+	deploymentInformer := resources.deploymentInformerFactory.Apps().V1().Deployments()
+	nodeInformer := resources.nodeInformerFactory.Core().V1().Nodes()
 
-	// Read component namespace
-	operatorNamespace := defaultComponentNamespace
-	nsBytes, err := ioutil.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
-	if err == nil {
-		operatorNamespace = string(nsBytes)
-	}
+	// The operator is only interested in the bootstrap and hub kubeconfig secrets. The
+	// agent namespaces are configurable in the klusterlet spec, so the secret informers
+	// are scoped by secret name instead of namespace to avoid caching every secret on
+	// the cluster.
+	bootstrapSecretInformerFactory := newSecretInformerFactory(resources.kubeClient, helpers.BootstrapHubKubeConfig, o.InformerResyncInterval)
+	hubSecretInformerFactory := newSecretInformerFactory(resources.kubeClient, helpers.HubKubeConfig, o.InformerResyncInterval)
+	bootstrapSecretInformer := bootstrapSecretInformerFactory.Core().V1().Secrets()
+	hubSecretInformer := hubSecretInformerFactory.Core().V1().Secrets()
 
 	klusterletController := klusterletcontroller.NewKlusterletController(
-		kubeClient,
-		apiExtensionClient,
-		operatorClient.OperatorV1().Klusterlets(),
-		operatorInformer.Operator().V1().Klusterlets(),
-		kubeInformer.Core().V1().Secrets(),
-		kubeInformer.Apps().V1().Deployments(),
+		resources.kubeClient,
+		resources.apiExtensionClient,
+		resources.dynamicClient,
+		resources.operatorClient.OperatorV1().Klusterlets(),
+		resources.operatorInformer.Operator().V1().Klusterlets(),
+		bootstrapSecretInformer,
+		hubSecretInformer,
+		deploymentInformer,
+		nodeInformer,
 		workClient.WorkV1().AppliedManifestWorks(),
 		kubeVersion,
-		operatorNamespace,
+		resources.operatorNamespace,
+		o.PodSecurityEnforceLevel,
+		o.MetricsProxyImage,
+		imageMirrors,
+		o.syncThrottle(),
 		controllerContext.EventRecorder)
 
 	statusController := statuscontroller.NewKlusterletStatusController(
-		kubeClient,
-		operatorClient.OperatorV1().Klusterlets(),
-		operatorInformer.Operator().V1().Klusterlets(),
-		kubeInformer.Core().V1().Secrets(),
-		kubeInformer.Apps().V1().Deployments(),
+		resources.kubeClient,
+		resources.operatorClient.OperatorV1().Klusterlets(),
+		resources.operatorInformer.Operator().V1().Klusterlets(),
+		bootstrapSecretInformer,
+		hubSecretInformer,
+		deploymentInformer,
+		o.HubConnectivityCheckInterval,
+		o.HubCertExpiryWarningWindow,
 		controllerContext.EventRecorder,
 	)
 
 	bootstrapController := bootstrapcontroller.NewBootstrapController(
-		kubeClient,
-		operatorInformer.Operator().V1().Klusterlets(),
-		kubeInformer.Core().V1().Secrets(),
+		resources.kubeClient,
+		resources.operatorClient.OperatorV1().Klusterlets(),
+		resources.operatorInformer.Operator().V1().Klusterlets(),
+		bootstrapSecretInformer,
+		hubSecretInformer,
 		controllerContext.EventRecorder,
 	)
 
-	go operatorInformer.Start(ctx.Done())
-	go kubeInformer.Start(ctx.Done())
-	go klusterletController.Run(ctx, 1)
-	go statusController.Run(ctx, 1)
+	crdMigrationController := klusterletmigrationcontroller.NewCRDMigrationController(
+		resources.dynamicClient,
+		resources.apiExtensionClient,
+		controllerContext.EventRecorder)
+
+	managedKubeConfigController := managedkubeconfigcontroller.NewManagedKubeConfigController(
+		resources.kubeClient,
+		resources.operatorClient.OperatorV1().Klusterlets(),
+		resources.operatorInformer.Operator().V1().Klusterlets(),
+		o.HubConnectivityCheckInterval,
+		o.HubCertExpiryWarningWindow,
+		controllerContext.EventRecorder)
+
+	addOnCatalogController := addoncontroller.NewAddOnCatalogController(
+		resources.kubeClient,
+		resources.apiExtensionClient,
+		resources.dynamicClient,
+		resources.operatorClient.OperatorV1().Klusterlets(),
+		resources.operatorInformer.Operator().V1().Klusterlets(),
+		controllerContext.EventRecorder)
+
+	gcController := gccontroller.NewGCController(
+		"KlusterletGCController",
+		helpers.KlusterletOwnerLabel,
+		resources.kubeClient,
+		func(name string) (bool, error) {
+			_, err := resources.operatorInformer.Operator().V1().Klusterlets().Lister().Get(name)
+			if errors.IsNotFound(err) {
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+			return true, nil
+		},
+		resources.operatorInformer.Operator().V1().Klusterlets().Informer(),
+		controllerContext.EventRecorder)
+
+	pullSecretController := pullsecretcontroller.NewPullSecretController(
+		"KlusterletPullSecretController",
+		helpers.KlusterletOwnerLabel,
+		resources.kubeClient,
+		resources.operatorNamespace,
+		resources.operatorInformer.Operator().V1().Klusterlets().Informer(),
+		controllerContext.EventRecorder)
+
+	// The operator is not ready until its informer caches are synced. Leadership is
+	// already reflected by the probes: the listener only serves while this replica
+	// holds the leader election lease.
+	health.AddReadinessCheck("KlusterletInformer", resources.operatorInformer.Operator().V1().Klusterlets().Informer().HasSynced)
+	health.AddReadinessCheck("DeploymentInformer", deploymentInformer.Informer().HasSynced)
+	health.AddReadinessCheck("BootstrapSecretInformer", bootstrapSecretInformer.Informer().HasSynced)
+	health.AddReadinessCheck("HubSecretInformer", hubSecretInformer.Informer().HasSynced)
+	health.AddReadinessCheck("NodeInformer", nodeInformer.Informer().HasSynced)
+
+	go bootstrapSecretInformerFactory.Start(ctx.Done())
+	go hubSecretInformerFactory.Start(ctx.Done())
+	go klusterletController.Run(ctx, o.MaxConcurrentSyncs)
+	go statusController.Run(ctx, o.MaxConcurrentSyncs)
 	go bootstrapController.Run(ctx, 1)
+	go crdMigrationController.Run(ctx, 1)
+	go managedKubeConfigController.Run(ctx, 1)
+	go addOnCatalogController.Run(ctx, 1)
+	go gcController.Run(ctx, 1)
+	go pullSecretController.Run(ctx, 1)
 
-	<-ctx.Done()
 	return nil
 }
+
+// startConversionWebhook serves the CRD conversion reviews for the given kinds when
+// a serving certificate is configured. Every served version shares the v1 schema
+// today, so the identity conversion answers all reviews; a future v1beta2 or v2
+// version registers its own conversion function here instead.
+func (o *Options) startConversionWebhook(ctx context.Context, kinds ...string) {
+	if len(o.ConversionWebhookCertFile) == 0 || len(o.ConversionWebhookKeyFile) == 0 {
+		return
+	}
+	webhook := conversion.NewWebhook()
+	for _, kind := range kinds {
+		webhook.RegisterConverter(kind, conversion.IdentityConvert)
+	}
+	go webhook.Serve(ctx, conversionWebhookAddr, o.ConversionWebhookCertFile, o.ConversionWebhookKeyFile)
+}
+
+// newSecretInformerFactory returns an informer factory that watches secrets with the
+// given name in all namespaces
+func newSecretInformerFactory(kubeClient kubernetes.Interface, name string, resync time.Duration) informers.SharedInformerFactory {
+	return informers.NewSharedInformerFactoryWithOptions(kubeClient, resync,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}))
+}
+
+// newNodeInformerFactory returns an informer factory that only watches the master
+// nodes the replica counts of the managed deployments are derived from
+func newNodeInformerFactory(kubeClient kubernetes.Interface, resync time.Duration) informers.SharedInformerFactory {
+	return informers.NewSharedInformerFactoryWithOptions(kubeClient, resync,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = helpers.MasterNodeLabelSelector
+		}))
+}
+
+// newDeploymentInformerFactory returns an informer factory that watches the deployments
+// carrying the operator managed-by label in all namespaces
+func newDeploymentInformerFactory(kubeClient kubernetes.Interface, resync time.Duration) informers.SharedInformerFactory {
+	return informers.NewSharedInformerFactoryWithOptions(kubeClient, resync,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = labels.Set{helpers.ManagedByLabel: helpers.FieldManager}.String()
+		}))
+}
@@ -0,0 +1,100 @@
+package operators
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+	"golang.org/x/time/rate"
+
+	"open-cluster-management.io/registration-operator/pkg/helpers"
+)
+
+// Options holds the controller tunables of the operators that are exposed as
+// command line flags.
+type Options struct {
+	// MaxConcurrentSyncs is the number of reconciles the controllers keyed by
+	// resource run in parallel.
+	MaxConcurrentSyncs int
+	// SyncRateLimitQPS and SyncRateLimitBurst throttle how many reconciles the
+	// main controllers may start per second.
+	SyncRateLimitQPS   float64
+	SyncRateLimitBurst int
+	// InformerResyncInterval is the period after which the informers replay their
+	// caches to the controllers. Zero disables the periodic resync.
+	InformerResyncInterval time.Duration
+	// PodSecurityEnforceLevel is the pod security level set on the namespaces the
+	// operators create via the pod-security.kubernetes.io/enforce label.
+	PodSecurityEnforceLevel string
+	// MetricsProxyImage is the image of the kube-rbac-proxy sidecar rendered into
+	// the deployed components to front their metrics endpoints. Empty leaves the
+	// metrics endpoints unproxied.
+	MetricsProxyImage string
+	// HubConnectivityCheckInterval is the cadence of the periodic hub
+	// connectivity checks of the klusterlet operator. While the hub is
+	// unreachable the checks back off exponentially up to this interval.
+	HubConnectivityCheckInterval time.Duration
+	// HubCertExpiryWarningWindow is how long before the expiry of the hub
+	// kubeconfig client certificate of a klusterlet the HubKubeConfigExpiring
+	// condition is raised.
+	HubCertExpiryWarningWindow time.Duration
+	// EnablePprof exposes the pprof endpoints on a dedicated listener, so memory
+	// and goroutine profiles can be captured from a running operator.
+	EnablePprof bool
+	// ImageMirrors holds the source-prefix=mirror-prefix pairs the rendered image
+	// references are redirected through, for air-gapped fleets pulling from a
+	// local registry.
+	ImageMirrors []string
+	// ConversionWebhookCertFile and ConversionWebhookKeyFile hold the serving
+	// certificate of the CRD conversion webhook. The webhook is only served when
+	// both are set.
+	ConversionWebhookCertFile string
+	ConversionWebhookKeyFile  string
+}
+
+// NewOptions returns the default controller tunables.
+func NewOptions() *Options {
+	return &Options{
+		MaxConcurrentSyncs:      1,
+		SyncRateLimitQPS:        10,
+		SyncRateLimitBurst:      100,
+		InformerResyncInterval:  5 * time.Minute,
+		PodSecurityEnforceLevel: helpers.DefaultPodSecurityEnforceLevel,
+
+		HubConnectivityCheckInterval: 5 * time.Minute,
+		HubCertExpiryWarningWindow:   7 * 24 * time.Hour,
+	}
+}
+
+// AddFlags registers the controller tunables on the given flag set.
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.IntVar(&o.MaxConcurrentSyncs, "max-concurrent-syncs", o.MaxConcurrentSyncs,
+		"The number of reconciles that are run in parallel. Raise this on hubs hosting many klusterlets.")
+	fs.Float64Var(&o.SyncRateLimitQPS, "sync-rate-limit-qps", o.SyncRateLimitQPS,
+		"The number of reconciles per second the main controllers may start.")
+	fs.IntVar(&o.SyncRateLimitBurst, "sync-rate-limit-burst", o.SyncRateLimitBurst,
+		"The number of reconciles the main controllers may start in a burst.")
+	fs.DurationVar(&o.InformerResyncInterval, "informer-resync-interval", o.InformerResyncInterval,
+		"The period after which the informers resync their caches. Set to 0 to disable the periodic resync.")
+	fs.StringVar(&o.PodSecurityEnforceLevel, "pod-security-enforce-level", o.PodSecurityEnforceLevel,
+		"The pod security level enforced on the namespaces created by the operators, one of privileged, baseline or restricted.")
+	fs.StringVar(&o.MetricsProxyImage, "metrics-rbac-proxy-image", o.MetricsProxyImage,
+		"The image of the kube-rbac-proxy sidecar that fronts the metrics endpoints of the deployed components. Leave empty to expose the metrics endpoints without the sidecar.")
+	fs.DurationVar(&o.HubConnectivityCheckInterval, "hub-connectivity-check-interval", o.HubConnectivityCheckInterval,
+		"The period of the hub connectivity checks run against the bootstrap and hub kubeconfigs of each klusterlet.")
+	fs.DurationVar(&o.HubCertExpiryWarningWindow, "hub-cert-expiry-warning-window", o.HubCertExpiryWarningWindow,
+		"How long before the expiry of the hub kubeconfig client certificate of a klusterlet the HubKubeConfigExpiring condition is raised.")
+	fs.BoolVar(&o.EnablePprof, "enable-pprof", o.EnablePprof,
+		"Serve the pprof endpoints on "+pprofAddr+", so memory and goroutine profiles can be captured from the running operator.")
+	fs.StringArrayVar(&o.ImageMirrors, "image-mirror", o.ImageMirrors,
+		"A source-prefix=mirror-prefix pair the rendered image references are redirected through, e.g. quay.io/open-cluster-management=registry.example.com:5000/ocm. May be given multiple times, the longest matching source prefix wins.")
+	fs.StringVar(&o.ConversionWebhookCertFile, "conversion-webhook-cert-file", o.ConversionWebhookCertFile,
+		"The serving certificate of the CRD conversion webhook. The webhook is only served on "+conversionWebhookAddr+" when both the certificate and the key are set.")
+	fs.StringVar(&o.ConversionWebhookKeyFile, "conversion-webhook-key-file", o.ConversionWebhookKeyFile,
+		"The key of the serving certificate of the CRD conversion webhook.")
+}
+
+// syncThrottle returns the rate limiter the main controller sync functions are
+// wrapped with.
+func (o *Options) syncThrottle() *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(o.SyncRateLimitQPS), o.SyncRateLimitBurst)
+}
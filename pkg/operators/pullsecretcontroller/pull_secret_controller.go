@@ -0,0 +1,132 @@
+package pullsecretcontroller
+
+import (
+	"context"
+	"time"
+
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+	operatorhelpers "github.com/openshift/library-go/pkg/operator/v1helpers"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"open-cluster-management.io/registration-operator/pkg/helpers"
+	"open-cluster-management.io/registration-operator/pkg/metrics"
+)
+
+var ResyncInterval = time.Minute * 5
+
+// pullSecretController distributes the image pull secret of the operator namespace
+// into every namespace the operator created, identified by its owner label, and
+// references the copy from the service accounts living there. Disconnected installs
+// then maintain the registry credentials in the operator namespace only, instead of
+// copying them into each hub, agent and addon namespace by hand. A pull secret a
+// service account already references is left untouched.
+type pullSecretController struct {
+	kubeClient        kubernetes.Interface
+	operatorNamespace string
+	ownerLabel        string
+}
+
+// NewPullSecretController returns a controller that keeps the image pull secret of
+// the operator namespace synced into the namespaces labeled with ownerLabel and
+// attached to their service accounts.
+func NewPullSecretController(
+	controllerName string,
+	ownerLabel string,
+	kubeClient kubernetes.Interface,
+	operatorNamespace string,
+	ownerInformer factory.Informer,
+	recorder events.Recorder) factory.Controller {
+	controller := &pullSecretController{
+		kubeClient:        kubeClient,
+		operatorNamespace: operatorNamespace,
+		ownerLabel:        ownerLabel,
+	}
+
+	return factory.New().
+		ResyncEvery(ResyncInterval).
+		WithInformers(ownerInformer).
+		WithSync(metrics.InstrumentSyncer(controllerName, controller.sync)).
+		ToController(controllerName, recorder)
+}
+
+func (c *pullSecretController) sync(ctx context.Context, controllerContext factory.SyncContext) error {
+	// The label key alone is an exists selector, so only the namespaces the operator
+	// created with an owner are listed.
+	namespaces, err := c.kubeClient.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: c.ownerLabel})
+	if err != nil {
+		return err
+	}
+
+	errs := []error{}
+	for _, namespace := range namespaces.Items {
+		if namespace.DeletionTimestamp != nil {
+			continue
+		}
+		// SyncSecret also prunes the copy again once the pull secret is removed
+		// from the operator namespace.
+		secret, _, err := resourceapply.SyncSecret(
+			c.kubeClient.CoreV1(),
+			controllerContext.Recorder(),
+			c.operatorNamespace,
+			helpers.ImagePullSecret,
+			namespace.Name,
+			helpers.ImagePullSecret,
+			[]metav1.OwnerReference{})
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if secret == nil {
+			continue
+		}
+		if err := c.attachToServiceAccounts(ctx, controllerContext.Recorder(), namespace.Name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return operatorhelpers.NewMultiLineAggregate(errs)
+}
+
+// attachToServiceAccounts references the pull secret from every service account of
+// the namespace. The accounts in an operator owned namespace belong either to the
+// operands or to the addon agents deployed next to them, and they all pull from the
+// same registry in a disconnected install.
+func (c *pullSecretController) attachToServiceAccounts(ctx context.Context, recorder events.Recorder, namespace string) error {
+	serviceAccounts, err := c.kubeClient.CoreV1().ServiceAccounts(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	errs := []error{}
+	for i := range serviceAccounts.Items {
+		serviceAccount := &serviceAccounts.Items[i]
+		if referencesPullSecret(serviceAccount) {
+			continue
+		}
+		serviceAccount.ImagePullSecrets = append(serviceAccount.ImagePullSecrets,
+			corev1.LocalObjectReference{Name: helpers.ImagePullSecret})
+		if _, err := c.kubeClient.CoreV1().ServiceAccounts(namespace).Update(ctx, serviceAccount, metav1.UpdateOptions{}); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		recorder.Eventf("PullSecretAttached",
+			"image pull secret %s is attached to serviceaccount %s/%s", helpers.ImagePullSecret, namespace, serviceAccount.Name)
+	}
+
+	return operatorhelpers.NewMultiLineAggregate(errs)
+}
+
+// referencesPullSecret reports whether the service account already references the
+// distributed pull secret
+func referencesPullSecret(serviceAccount *corev1.ServiceAccount) bool {
+	for _, reference := range serviceAccount.ImagePullSecrets {
+		if reference.Name == helpers.ImagePullSecret {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package pullsecretcontroller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"open-cluster-management.io/registration-operator/pkg/helpers"
+	testinghelper "open-cluster-management.io/registration-operator/pkg/helpers/testing"
+)
+
+const operatorNamespace = "open-cluster-management"
+
+func newNamespace(name, owner string) *corev1.Namespace {
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+	}
+	if len(owner) > 0 {
+		namespace.Labels = map[string]string{helpers.KlusterletOwnerLabel: owner}
+	}
+	return namespace
+}
+
+func newPullSecret(namespace string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: helpers.ImagePullSecret, Namespace: namespace},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte("{}")},
+	}
+}
+
+func newServiceAccount(namespace, name string, pullSecrets ...string) *corev1.ServiceAccount {
+	serviceAccount := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+	}
+	for _, pullSecret := range pullSecrets {
+		serviceAccount.ImagePullSecrets = append(serviceAccount.ImagePullSecrets, corev1.LocalObjectReference{Name: pullSecret})
+	}
+	return serviceAccount
+}
+
+func TestSync(t *testing.T) {
+	cases := []struct {
+		name                string
+		objects             []runtime.Object
+		expectedSecrets     []string
+		expectedAttachments map[string][]string
+	}{
+		{
+			name: "pull secret is synced into owned namespaces only",
+			objects: []runtime.Object{
+				newPullSecret(operatorNamespace),
+				newNamespace("klusterlet-agent", "klusterlet"),
+				newNamespace("unowned", ""),
+			},
+			expectedSecrets: []string{"klusterlet-agent"},
+		},
+		{
+			name: "pull secret is attached to the service accounts",
+			objects: []runtime.Object{
+				newPullSecret(operatorNamespace),
+				newNamespace("klusterlet-agent", "klusterlet"),
+				newServiceAccount("klusterlet-agent", "klusterlet-registration-sa"),
+				newServiceAccount("klusterlet-agent", "klusterlet-work-sa", helpers.ImagePullSecret),
+				newServiceAccount("unowned", "other-sa"),
+			},
+			expectedSecrets: []string{"klusterlet-agent"},
+			expectedAttachments: map[string][]string{
+				"klusterlet-agent/klusterlet-registration-sa": {helpers.ImagePullSecret},
+				"klusterlet-agent/klusterlet-work-sa":         {helpers.ImagePullSecret},
+				"unowned/other-sa":                            nil,
+			},
+		},
+		{
+			name: "missing pull secret prunes the copies",
+			objects: []runtime.Object{
+				newNamespace("klusterlet-agent", "klusterlet"),
+				newPullSecret("klusterlet-agent"),
+				newServiceAccount("klusterlet-agent", "klusterlet-registration-sa"),
+			},
+			expectedSecrets: []string{},
+			expectedAttachments: map[string][]string{
+				"klusterlet-agent/klusterlet-registration-sa": nil,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fakeKubeClient := fakekube.NewSimpleClientset(c.objects...)
+			controller := &pullSecretController{
+				kubeClient:        fakeKubeClient,
+				operatorNamespace: operatorNamespace,
+				ownerLabel:        helpers.KlusterletOwnerLabel,
+			}
+
+			syncContext := testinghelper.NewFakeSyncContext(t, "")
+			if err := controller.sync(context.TODO(), syncContext); err != nil {
+				t.Fatalf("Expected no error when sync: %v", err)
+			}
+
+			for _, namespace := range c.expectedSecrets {
+				if _, err := fakeKubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), helpers.ImagePullSecret, metav1.GetOptions{}); err != nil {
+					t.Errorf("Expected pull secret in namespace %q: %v", namespace, err)
+				}
+			}
+			if len(c.expectedSecrets) == 0 {
+				secrets, err := fakeKubeClient.CoreV1().Secrets("klusterlet-agent").List(context.TODO(), metav1.ListOptions{})
+				if err != nil {
+					t.Fatalf("Expected no error when listing secrets: %v", err)
+				}
+				if len(secrets.Items) != 0 {
+					t.Errorf("Expected the pull secret copy to be pruned, but got %v", secrets.Items)
+				}
+			}
+
+			for key, expectedPullSecrets := range c.expectedAttachments {
+				namespace, name, err := cache.SplitMetaNamespaceKey(key)
+				if err != nil {
+					t.Fatalf("Invalid service account key %q: %v", key, err)
+				}
+				serviceAccount, err := fakeKubeClient.CoreV1().ServiceAccounts(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatalf("Expected no error when getting service account %q: %v", key, err)
+				}
+				var pullSecrets []string
+				for _, reference := range serviceAccount.ImagePullSecrets {
+					pullSecrets = append(pullSecrets, reference.Name)
+				}
+				if !reflect.DeepEqual(pullSecrets, expectedPullSecrets) {
+					t.Errorf("Expected pull secrets %v on service account %q, but got %v", expectedPullSecrets, key, pullSecrets)
+				}
+			}
+		})
+	}
+}
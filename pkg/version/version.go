@@ -6,6 +6,11 @@ import (
 	"k8s.io/component-base/metrics/legacyregistry"
 )
 
+// SupportedBundleVersion is the OCM bundle version this operator build deploys. The
+// version tags of the configured agent images are checked against it before the
+// agents are deployed.
+const SupportedBundleVersion = "0.5.0"
+
 var (
 	// commitFromGit is a constant representing the source version that
 	// generated this build. It should be set during build via -ldflags.
@@ -33,6 +38,17 @@ func Get() version.Info {
 	}
 }
 
+// OperatorVersion returns the version string the operators record in the status of
+// the resources they reconcile, so a fleet inventory can verify the deployed operator
+// versions without inspecting the pod images. The git commit is used as a fallback
+// for development builds without a version tag.
+func OperatorVersion() string {
+	if len(versionFromGit) > 0 {
+		return versionFromGit
+	}
+	return commitFromGit
+}
+
 func init() {
 	buildInfo := metrics.NewGaugeVec(
 		&metrics.GaugeOpts{
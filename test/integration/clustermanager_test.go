@@ -27,7 +27,7 @@ func startHubOperator(ctx context.Context) {
 	certrotation.TargetCertValidity = time.Second * 10
 	certrotation.ResyncInterval = time.Second * 1
 
-	err := operators.RunClusterManagerOperator(ctx, &controllercmd.ControllerContext{
+	err := operators.NewOptions().RunClusterManagerOperator(ctx, &controllercmd.ControllerContext{
 		KubeConfig:    restConfig,
 		EventRecorder: util.NewIntegrationTestEventRecorder("integration"),
 	})
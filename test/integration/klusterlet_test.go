@@ -22,7 +22,7 @@ import (
 )
 
 func startKlusterletOperator(ctx context.Context) {
-	err := operators.RunKlusterletOperator(ctx, &controllercmd.ControllerContext{
+	err := operators.NewOptions().RunKlusterletOperator(ctx, &controllercmd.ControllerContext{
 		KubeConfig:    restConfig,
 		EventRecorder: util.NewIntegrationTestEventRecorder("integration"),
 	})